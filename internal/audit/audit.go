@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/audit_entry"
+	"receipt_uploader/internal/models/audit_query"
+	"sync"
+)
+
+const maxEntrySize = 64 * 1024 // max size of a line of the log
+
+// Service appends every entry to a log file, one JSON entry per line. Entries are never changed or
+// removed, a torn last entry left by a crash is dropped when the log is opened. Queries scan the
+// log. Without path entries are only kept in memory.
+type Service struct {
+	path    string
+	file    *os.File
+	mu      sync.Mutex
+	seq     int64                    // Seq of the last entry
+	entries []audit_entry.AuditEntry // entries of a log without path
+}
+
+// NewService opens the log at path, it is created if it does not exist
+func NewService(path string) (ServiceType, error) {
+	if path == "" {
+		return NewMemory(), nil
+	}
+
+	mkErr := os.MkdirAll(filepath.Dir(path), 0755)
+	if mkErr != nil {
+		return nil, fmt.Errorf("os.MkdirAll() failed, err: %w", mkErr)
+	}
+
+	file, openErr := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if openErr != nil {
+		return nil, fmt.Errorf("os.OpenFile() failed, err: %w", openErr)
+	}
+
+	s := &Service{path: path, file: file}
+	loadErr := s.load()
+	if loadErr != nil {
+		file.Close()
+		return nil, fmt.Errorf("s.load(path: %s) failed, err: %w", path, loadErr)
+	}
+	return s, nil
+}
+
+// NewMemory creates a log which keeps entries in memory only, it is meant for tests
+func NewMemory() ServiceType {
+	return &Service{}
+}
+
+func (s *Service) Record(entry *audit_entry.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Seq = s.seq + 1
+	if s.path == "" {
+		s.entries = append(s.entries, *entry)
+		s.seq++
+		return nil
+	}
+	if s.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	data, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+
+	_, writeErr := s.file.Write(append(data, '\n'))
+	if writeErr == nil {
+		writeErr = s.file.Sync()
+	}
+	if writeErr != nil {
+		return fmt.Errorf("s.file.Write() failed, err: %w", writeErr)
+	}
+	s.seq++
+	return nil
+}
+
+func (s *Service) Query(query *audit_query.Query) ([]audit_entry.AuditEntry, error) {
+	logging.Debugf("audit.Query(actor: %s, from: %s, to: %s, after: %d)", query.Actor, query.From, query.To, query.After)
+
+	if s.path == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		result := []audit_entry.AuditEntry{}
+		for _, entry := range s.entries {
+			if query.Matches(&entry) {
+				result = append(result, entry)
+			}
+			if query.Limit > 0 && len(result) == query.Limit {
+				break
+			}
+		}
+		return result, nil
+	}
+
+	// entries are appended while the log is read, an entry which is not complete yet is skipped
+	file, openErr := os.Open(s.path)
+	if openErr != nil {
+		return nil, fmt.Errorf("os.Open() failed, err: %w", openErr)
+	}
+	defer file.Close()
+
+	result := []audit_entry.AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+	for scanner.Scan() {
+		var entry audit_entry.AuditEntry
+		unmarshalErr := json.Unmarshal(scanner.Bytes(), &entry)
+		if unmarshalErr != nil {
+			continue
+		}
+		if query.Matches(&entry) {
+			result = append(result, entry)
+		}
+		if query.Limit > 0 && len(result) == query.Limit {
+			break
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, fmt.Errorf("scanner.Scan() failed, err: %w", scanErr)
+	}
+	return result, nil
+}
+
+// Close closes the log, entries can not be recorded afterwards
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	closeErr := s.file.Close()
+	s.file = nil
+	return closeErr
+}
+
+// load finds the Seq of the last entry and drops a torn last entry, new entries are appended after
+// the last complete one
+func (s *Service) load() error {
+	reader := bufio.NewReader(s.file)
+	valid := int64(0) // size of the log up to the end of the last complete entry
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr == io.EOF {
+			if len(line) > 0 {
+				logging.Warnf("dropping torn last entry of audit log, %d bytes", len(line))
+			}
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("reader.ReadBytes() failed, err: %w", readErr)
+		}
+
+		var entry audit_entry.AuditEntry
+		unmarshalErr := json.Unmarshal(bytes.TrimSpace(line), &entry)
+		if unmarshalErr != nil {
+			return fmt.Errorf("invalid entry at offset %d, err: %w", valid, unmarshalErr)
+		}
+		s.seq = entry.Seq
+		valid += int64(len(line))
+	}
+
+	truncateErr := s.file.Truncate(valid)
+	if truncateErr != nil {
+		return fmt.Errorf("s.file.Truncate() failed, err: %w", truncateErr)
+	}
+	_, seekErr := s.file.Seek(valid, io.SeekStart)
+	if seekErr != nil {
+		return fmt.Errorf("s.file.Seek() failed, err: %w", seekErr)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/models/audit_entry"
+	"receipt_uploader/internal/models/audit_query"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	baseDir := "test-audit"
+	path := filepath.Join(baseDir, "audit.log")
+	defer os.RemoveAll(baseDir)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := func(t *testing.T, s ServiceType, actor string, offset time.Duration, status int) {
+		recordErr := s.Record(&audit_entry.AuditEntry{
+			Time:       start.Add(offset),
+			Actor:      actor,
+			Action:     constants.AUDIT_ACTION_DOWNLOAD,
+			ReceiptID:  "receipt1",
+			Status:     status,
+			Outcome:    audit_entry.Outcome(status),
+			ClientAddr: "127.0.0.1",
+		})
+		assert.Nil(t, recordErr)
+	}
+
+	t.Run("succeed, query by actor and time range", func(t *testing.T) {
+		for _, s := range []ServiceType{NewMemory(), newService(t, path)} {
+			record(t, s, "user_a", 0, 200)
+			record(t, s, "user_b", time.Minute, 404)
+			record(t, s, "user_a", 2*time.Minute, 404)
+			record(t, s, "user_a", 3*time.Minute, 200)
+
+			entries, queryErr := s.Query(&audit_query.Query{Actor: "user_a"})
+			assert.Nil(t, queryErr)
+			assert.Len(t, entries, 3)
+			assert.Equal(t, []int64{1, 3, 4}, []int64{entries[0].Seq, entries[1].Seq, entries[2].Seq})
+
+			entries, queryErr = s.Query(&audit_query.Query{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)})
+			assert.Nil(t, queryErr)
+			assert.Len(t, entries, 2)
+			assert.Equal(t, "user_b", entries[0].Actor)
+			assert.Equal(t, constants.AUDIT_OUTCOME_NOT_FOUND, entries[1].Outcome)
+
+			entries, queryErr = s.Query(&audit_query.Query{Actor: "user_a", After: 1, Limit: 1})
+			assert.Nil(t, queryErr)
+			assert.Len(t, entries, 1)
+			assert.Equal(t, int64(3), entries[0].Seq)
+
+			assert.Nil(t, s.Close())
+		}
+	})
+
+	t.Run("succeed, entries are kept when the log is opened again", func(t *testing.T) {
+		s := newService(t, path)
+		record(t, s, "user_c", 4*time.Minute, 200)
+
+		entries, queryErr := s.Query(&audit_query.Query{})
+		assert.Nil(t, queryErr)
+		assert.Len(t, entries, 5)
+		assert.Equal(t, int64(5), entries[4].Seq)
+		assert.Nil(t, s.Close())
+	})
+
+	t.Run("succeed, torn last entry is dropped", func(t *testing.T) {
+		file, openErr := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		assert.Nil(t, openErr)
+		_, writeErr := file.WriteString(`{"seq":6,"actor":"us`)
+		assert.Nil(t, writeErr)
+		file.Close()
+
+		s := newService(t, path)
+		record(t, s, "user_d", 5*time.Minute, 200)
+
+		entries, queryErr := s.Query(&audit_query.Query{After: 4})
+		assert.Nil(t, queryErr)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "user_d", entries[1].Actor)
+		assert.Equal(t, int64(6), entries[1].Seq)
+		assert.Nil(t, s.Close())
+	})
+
+	t.Run("should fail, record after close", func(t *testing.T) {
+		s := newService(t, path)
+		assert.Nil(t, s.Close())
+
+		recordErr := s.Record(&audit_entry.AuditEntry{Actor: "user_a"})
+		assert.NotNil(t, recordErr)
+	})
+
+	t.Run("should fail, invalid entry in the middle of the log", func(t *testing.T) {
+		invalidPath := filepath.Join(baseDir, "invalid.log")
+		assert.Nil(t, os.WriteFile(invalidPath, []byte("not json\n{\"seq\":1}\n"), 0644))
+
+		s, openErr := NewService(invalidPath)
+		assert.NotNil(t, openErr)
+		assert.Nil(t, s)
+	})
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, constants.AUDIT_OUTCOME_SUCCESS, audit_entry.Outcome(200))
+	assert.Equal(t, constants.AUDIT_OUTCOME_SUCCESS, audit_entry.Outcome(304))
+	assert.Equal(t, constants.AUDIT_OUTCOME_DENIED, audit_entry.Outcome(403))
+	assert.Equal(t, constants.AUDIT_OUTCOME_NOT_FOUND, audit_entry.Outcome(404))
+	assert.Equal(t, constants.AUDIT_OUTCOME_REJECTED, audit_entry.Outcome(400))
+	assert.Equal(t, constants.AUDIT_OUTCOME_ERROR, audit_entry.Outcome(500))
+}
+
+func newService(t *testing.T, path string) ServiceType {
+	s, openErr := NewService(path)
+	assert.Nil(t, openErr)
+	return s
+}
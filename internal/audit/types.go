@@ -0,0 +1,13 @@
+package audit
+
+import (
+	"receipt_uploader/internal/models/audit_entry"
+	"receipt_uploader/internal/models/audit_query"
+)
+
+// ServiceType records who accessed which receipt in an append-only log
+type ServiceType interface {
+	Record(entry *audit_entry.AuditEntry) error                       // sets entry.Seq
+	Query(query *audit_query.Query) ([]audit_entry.AuditEntry, error) // oldest entry first
+	Close() error
+}
@@ -0,0 +1,154 @@
+package checksums
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"time"
+)
+
+const sidecarExtension = ".sha256"
+
+// Service wraps a storage and records the SHA-256 checksum of every object written under
+// config.UploadsDir, config.ResizedDir and config.TrashDir in a sidecar object
+// {config.ChecksumsDir}/{key}.sha256, which is removed together with the object.
+// Nothing is recorded if config.ChecksumsDir is not set.
+type Service struct {
+	storage.ServiceType
+	config *configs.Config
+}
+
+func NewService(config *configs.Config, s storage.ServiceType) ServiceType {
+	return &Service{
+		ServiceType: s,
+		config:      config,
+	}
+}
+
+// Put writes the object and records the checksum of the written content
+func (s *Service) Put(key string, r io.Reader) error {
+	if !s.tracked(key) {
+		return s.ServiceType.Put(key, r)
+	}
+
+	hash := sha256.New()
+	putErr := s.ServiceType.Put(key, io.TeeReader(r, hash))
+	if putErr != nil {
+		return putErr
+	}
+
+	recordErr := s.Record(key, hex.EncodeToString(hash.Sum(nil)))
+	if recordErr != nil {
+		return fmt.Errorf("s.Record(key: %s) failed, err: %w", key, recordErr)
+	}
+	return nil
+}
+
+// Delete removes the object and its recorded checksum
+func (s *Service) Delete(key string) error {
+	deleteErr := s.ServiceType.Delete(key)
+	if deleteErr != nil || !s.tracked(key) {
+		return deleteErr
+	}
+
+	sidecarErr := s.ServiceType.Delete(s.sidecarPath(key))
+	if sidecarErr != nil && !errors.Is(sidecarErr, fs.ErrNotExist) {
+		logging.Errorf("s.ServiceType.Delete(checksum of key: %s) failed, err: %s", key, sidecarErr.Error())
+	}
+	return nil
+}
+
+func (s *Service) Checksum(key string) (string, error) {
+	if !s.tracked(key) {
+		return "", &fs.PathError{Op: "checksum", Path: key, Err: fs.ErrNotExist}
+	}
+
+	reader, getErr := s.ServiceType.Get(s.sidecarPath(key))
+	if getErr != nil {
+		return "", getErr
+	}
+	defer reader.Close()
+
+	data, readErr := io.ReadAll(reader)
+	if readErr != nil {
+		return "", fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s *Service) Compute(key string) (string, error) {
+	reader, getErr := s.ServiceType.Get(key)
+	if getErr != nil {
+		return "", getErr
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	_, copyErr := io.Copy(hash, reader)
+	if copyErr != nil {
+		return "", fmt.Errorf("io.Copy() failed, err: %w", copyErr)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *Service) Record(key, sum string) error {
+	if !s.tracked(key) {
+		return nil
+	}
+	return s.ServiceType.Put(s.sidecarPath(key), strings.NewReader(sum))
+}
+
+// SweepTempFiles implements storage.Sweeper if the wrapped storage does
+func (s *Service) SweepTempFiles(dir string) (int, error) {
+	sweeper, ok := s.ServiceType.(storage.Sweeper)
+	if !ok {
+		return 0, nil
+	}
+	return sweeper.SweepTempFiles(dir)
+}
+
+// SetModTime implements storage.ModTimeSetter if the wrapped storage does
+func (s *Service) SetModTime(key string, modTime time.Time) error {
+	setter, ok := s.ServiceType.(storage.ModTimeSetter)
+	if !ok {
+		return fmt.Errorf("storage does not support setting modification time, key=%s", key)
+	}
+	return setter.SetModTime(key, modTime)
+}
+
+// tracked tells if a checksum is recorded for key
+func (s *Service) tracked(key string) bool {
+	return IsTracked(s.config, key)
+}
+
+// IsTracked tells if a checksum is recorded for key, i.e. key is an image under config.UploadsDir,
+// config.ResizedDir or config.TrashDir and config.ChecksumsDir is set
+func IsTracked(config *configs.Config, key string) bool {
+	if config.ChecksumsDir == "" {
+		return false
+	}
+	key = filepath.Clean(key)
+	for _, dir := range []string{config.UploadsDir, config.ResizedDir, config.TrashDir} {
+		if dir != "" && strings.HasPrefix(key, filepath.Clean(dir)+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) sidecarPath(key string) string {
+	return SidecarPath(s.config, key)
+}
+
+// SidecarPath returns the key of the object holding the recorded checksum of key
+func SidecarPath(config *configs.Config, key string) string {
+	return filepath.Join(config.ChecksumsDir, filepath.Clean(key)+sidecarExtension)
+}
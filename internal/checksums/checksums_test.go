@@ -0,0 +1,113 @@
+package checksums
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksums(t *testing.T) {
+	config := &configs.Config{
+		UploadsDir:   "uploads",
+		ResizedDir:   "resized",
+		RecordsDir:   "records",
+		TrashDir:     "trash",
+		ChecksumsDir: "checksums",
+	}
+	store := storage.NewMemory()
+	service := NewService(config, store)
+
+	sumOf := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	t.Run("succeed, record checksum on write", func(t *testing.T) {
+		key := "resized/user1/123456_small.jpg"
+		putErr := service.Put(key, bytes.NewReader([]byte("data")))
+		assert.Nil(t, putErr)
+
+		checksum, checksumErr := service.Checksum(key)
+		assert.Nil(t, checksumErr)
+		assert.Equal(t, sumOf("data"), checksum)
+
+		computed, computeErr := service.Compute(key)
+		assert.Nil(t, computeErr)
+		assert.Equal(t, checksum, computed)
+
+		objects, listErr := store.List(config.ChecksumsDir)
+		assert.Nil(t, listErr)
+		assert.Len(t, objects, 1)
+	})
+
+	t.Run("succeed, checksum follows overwrite and move", func(t *testing.T) {
+		key := "uploads/user1#123456.jpg"
+		trashKey := "trash/user1/123456/user1#123456.jpg"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("first"))))
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("second"))))
+
+		moveErr := storage.Move(service, key, trashKey)
+		assert.Nil(t, moveErr)
+
+		_, checksumErr := service.Checksum(key)
+		assert.ErrorIs(t, checksumErr, os.ErrNotExist)
+		checksum, checksumErr := service.Checksum(trashKey)
+		assert.Nil(t, checksumErr)
+		assert.Equal(t, sumOf("second"), checksum)
+	})
+
+	t.Run("succeed, detect corrupted content", func(t *testing.T) {
+		key := "resized/user1/654321.jpg"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("data"))))
+		assert.Nil(t, store.Put(key, bytes.NewReader([]byte("corrupted"))))
+
+		checksum, checksumErr := service.Checksum(key)
+		assert.Nil(t, checksumErr)
+		computed, computeErr := service.Compute(key)
+		assert.Nil(t, computeErr)
+		assert.NotEqual(t, checksum, computed)
+	})
+
+	t.Run("succeed, no checksum of records", func(t *testing.T) {
+		key := "records/user1/receipts/123456.json"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("{}"))))
+
+		_, checksumErr := service.Checksum(key)
+		assert.ErrorIs(t, checksumErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, no checksum without ChecksumsDir", func(t *testing.T) {
+		disabledStore := storage.NewMemory()
+		disabled := NewService(&configs.Config{UploadsDir: "uploads", ResizedDir: "resized"}, disabledStore)
+		assert.Nil(t, disabled.Put("uploads/user1#123456.jpg", bytes.NewReader([]byte("data"))))
+
+		_, checksumErr := disabled.Checksum("uploads/user1#123456.jpg")
+		assert.ErrorIs(t, checksumErr, os.ErrNotExist)
+
+		objects, listErr := disabledStore.List("")
+		assert.Nil(t, listErr)
+		assert.Len(t, objects, 1)
+	})
+
+	t.Run("succeed, delete removes checksum", func(t *testing.T) {
+		key := "resized/user2/123456.jpg"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("data"))))
+
+		deleteErr := service.Delete(key)
+		assert.Nil(t, deleteErr)
+
+		_, checksumErr := service.Checksum(key)
+		assert.ErrorIs(t, checksumErr, os.ErrNotExist)
+	})
+
+	t.Run("should fail, delete of missing key", func(t *testing.T) {
+		deleteErr := service.Delete("resized/user2/notexist.jpg")
+		assert.ErrorIs(t, deleteErr, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,11 @@
+package checksums
+
+import "receipt_uploader/internal/storage"
+
+// ServiceType is a storage which records the SHA-256 checksum of every image it writes
+type ServiceType interface {
+	storage.ServiceType
+	Checksum(key string) (string, error) // recorded hex encoded checksum, wraps fs.ErrNotExist if none is recorded
+	Compute(key string) (string, error)  // hex encoded checksum of the current content
+	Record(key, sum string) error        // records sum as checksum of key
+}
@@ -0,0 +1,372 @@
+package collections
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/collection"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/storage"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Service stores collections as json objects in storage, organized per user:
+//
+//	{collectionsDir}/{username}/{collectionId}.json
+//
+// Receipts are looked up in the metadata store, which reports receipts of other users as not
+// found, so only the owner's receipts can be added. Receipts which have been deleted stay in
+// the collection, they are listed again once they are restored from trash.
+type Service struct {
+	collectionsDir  string
+	storage         storage.ServiceType
+	metadataService metadata.ServiceType
+	mu              sync.Mutex
+}
+
+func NewService(collectionsDir string, s storage.ServiceType, metadataService metadata.ServiceType) ServiceType {
+	return &Service{
+		collectionsDir:  collectionsDir,
+		storage:         s,
+		metadataService: metadataService,
+	}
+}
+
+func (s *Service) Create(username, name string) (*collection.Collection, error) {
+	logging.Debugf("collections.Create(username: %s, name: %s)", username, name)
+
+	name, nameErr := validateName(name)
+	if nameErr != nil {
+		return nil, nameErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	takenErr := s.checkNameFree(username, "", name)
+	if takenErr != nil {
+		return nil, takenErr
+	}
+
+	now := time.Now().UTC()
+	c := &collection.Collection{
+		CollectionID: strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Username:     username,
+		Name:         name,
+		ReceiptIDs:   []string{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	putErr := s.put(c)
+	if putErr != nil {
+		return nil, putErr
+	}
+	return c, nil
+}
+
+func (s *Service) Get(username, collectionId string) (*collection.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(username, collectionId)
+}
+
+func (s *Service) List(username string) ([]collection.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(username)
+}
+
+func (s *Service) Rename(username, collectionId, name string) (*collection.Collection, error) {
+	logging.Debugf("collections.Rename(username: %s, collectionId: %s, name: %s)", username, collectionId, name)
+
+	name, nameErr := validateName(name)
+	if nameErr != nil {
+		return nil, nameErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, getErr := s.get(username, collectionId)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if c.Name == name {
+		return c, nil
+	}
+
+	takenErr := s.checkNameFree(username, collectionId, name)
+	if takenErr != nil {
+		return nil, takenErr
+	}
+
+	c.Name = name
+	c.UpdatedAt = time.Now().UTC()
+	putErr := s.put(c)
+	if putErr != nil {
+		return nil, putErr
+	}
+	return c, nil
+}
+
+func (s *Service) Delete(username, collectionId string) error {
+	logging.Debugf("collections.Delete(username: %s, collectionId: %s)", username, collectionId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, getErr := s.get(username, collectionId)
+	if getErr != nil {
+		return getErr
+	}
+	return s.storage.Delete(s.collectionPath(username, collectionId))
+}
+
+// AddReceipt adds username's receipt to the collection, adding a receipt twice has no effect.
+// An error wrapping fs.ErrNotExist is returned if username has no such receipt.
+func (s *Service) AddReceipt(username, collectionId, receiptId string) (*collection.Collection, error) {
+	logging.Debugf("collections.AddReceipt(username: %s, collectionId: %s, receiptId: %s)", username, collectionId, receiptId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, getErr := s.get(username, collectionId)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	_, metadataErr := s.metadataService.Get(username, receiptId)
+	if metadataErr != nil {
+		return nil, fmt.Errorf("metadataService.Get() failed, err: %w", metadataErr)
+	}
+	if c.Contains(receiptId) {
+		return c, nil
+	}
+
+	c.ReceiptIDs = append(c.ReceiptIDs, receiptId)
+	c.UpdatedAt = time.Now().UTC()
+	putErr := s.put(c)
+	if putErr != nil {
+		return nil, putErr
+	}
+	return c, nil
+}
+
+// RemoveReceipt removes the receipt from the collection, the receipt itself is kept. An error
+// wrapping fs.ErrNotExist is returned if the receipt is not in the collection.
+func (s *Service) RemoveReceipt(username, collectionId, receiptId string) error {
+	logging.Debugf("collections.RemoveReceipt(username: %s, collectionId: %s, receiptId: %s)", username, collectionId, receiptId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, getErr := s.get(username, collectionId)
+	if getErr != nil {
+		return getErr
+	}
+
+	i := slices.Index(c.ReceiptIDs, receiptId)
+	if i < 0 {
+		return fmt.Errorf("receipt not in collection, receiptId: %s, err: %w", receiptId, fs.ErrNotExist)
+	}
+
+	c.ReceiptIDs = slices.Delete(c.ReceiptIDs, i, i+1)
+	c.UpdatedAt = time.Now().UTC()
+	return s.put(c)
+}
+
+// Receipts returns the metadata of the receipts of the collection, receipts which are deleted
+// are skipped
+func (s *Service) Receipts(username, collectionId string) ([]receipt_metadata.ReceiptMetadata, error) {
+	s.mu.Lock()
+	c, getErr := s.get(username, collectionId)
+	s.mu.Unlock()
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	receipts := []receipt_metadata.ReceiptMetadata{}
+	for _, receiptId := range c.ReceiptIDs {
+		m, metadataErr := s.metadataService.Get(username, receiptId)
+		if errors.Is(metadataErr, fs.ErrNotExist) {
+			continue
+		}
+		if metadataErr != nil {
+			return nil, fmt.Errorf("metadataService.Get() failed, err: %w", metadataErr)
+		}
+		receipts = append(receipts, *m)
+	}
+
+	sort.Slice(receipts, func(i, j int) bool {
+		if receipts[i].CreatedAt.Equal(receipts[j].CreatedAt) {
+			return receipts[i].ReceiptID < receipts[j].ReceiptID
+		}
+		return receipts[i].CreatedAt.Before(receipts[j].CreatedAt)
+	})
+	return receipts, nil
+}
+
+// Totals sums the amounts of receipts per currency, ordered by currency. Receipts without
+// amount are not summed.
+func Totals(receipts []receipt_metadata.ReceiptMetadata) []collection.Total {
+	type sum struct {
+		value    *big.Rat
+		decimals int
+		receipts int
+	}
+
+	sums := map[string]*sum{}
+	for _, m := range receipts {
+		amount := m.Annotations.Amount
+		if amount == nil {
+			continue
+		}
+		value, ok := new(big.Rat).SetString(amount.Value)
+		if !ok {
+			logging.Errorf("invalid amount, receiptId: %s, value: %s", m.ReceiptID, amount.Value)
+			continue
+		}
+
+		total, ok := sums[amount.Currency]
+		if !ok {
+			total = &sum{value: new(big.Rat)}
+			sums[amount.Currency] = total
+		}
+		total.value.Add(total.value, value)
+		total.receipts++
+		if _, decimals, found := strings.Cut(amount.Value, "."); found {
+			total.decimals = max(total.decimals, len(decimals))
+		}
+	}
+
+	totals := []collection.Total{}
+	for currency, total := range sums {
+		totals = append(totals, collection.Total{
+			Currency: currency,
+			Value:    total.value.FloatString(total.decimals),
+			Receipts: total.receipts,
+		})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Currency < totals[j].Currency
+	})
+	return totals
+}
+
+// validateName returns name without leading and trailing spaces, errors wrap ErrInvalidName
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w, name is empty", ErrInvalidName)
+	}
+	if utf8.RuneCountInString(name) > constants.COLLECTION_NAME_MAX {
+		return "", fmt.Errorf("%w, name is longer than %d characters", ErrInvalidName, constants.COLLECTION_NAME_MAX)
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return "", fmt.Errorf("%w, name contains control characters", ErrInvalidName)
+	}
+	return name, nil
+}
+
+// checkNameFree returns an error wrapping ErrNameTaken if a collection of username other than
+// collectionId has name, ignoring case
+func (s *Service) checkNameFree(username, collectionId, name string) error {
+	list, listErr := s.list(username)
+	if listErr != nil {
+		return listErr
+	}
+	for _, c := range list {
+		if c.CollectionID != collectionId && strings.EqualFold(c.Name, name) {
+			return fmt.Errorf("%w, name: %s", ErrNameTaken, name)
+		}
+	}
+	return nil
+}
+
+func (s *Service) get(username, collectionId string) (*collection.Collection, error) {
+	var c collection.Collection
+	getErr := s.getJSON(s.collectionPath(username, collectionId), &c)
+	if errors.Is(getErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w, collectionId: %s, err: %w", ErrNotFound, collectionId, getErr)
+	}
+	if getErr != nil {
+		return nil, getErr
+	}
+	return &c, nil
+}
+
+func (s *Service) list(username string) ([]collection.Collection, error) {
+	objects, listErr := s.storage.List(filepath.Join(s.collectionsDir, username))
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List() failed, err: %w", listErr)
+	}
+
+	list := []collection.Collection{}
+	for _, obj := range objects {
+		if !strings.HasSuffix(obj.Key, ".json") {
+			continue
+		}
+		var c collection.Collection
+		getErr := s.getJSON(obj.Key, &c)
+		if getErr != nil {
+			return nil, getErr
+		}
+		list = append(list, c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CollectionID < list[j].CollectionID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (s *Service) put(c *collection.Collection) error {
+	data, marshalErr := json.Marshal(c)
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+	return s.storage.Put(s.collectionPath(c.Username, c.CollectionID), bytes.NewReader(data))
+}
+
+func (s *Service) collectionPath(username, collectionId string) string {
+	return filepath.Join(s.collectionsDir, username, collectionId+".json")
+}
+
+func (s *Service) getJSON(key string, v interface{}) error {
+	reader, getErr := s.storage.Get(key)
+	if getErr != nil {
+		return getErr
+	}
+	defer reader.Close()
+
+	data, readErr := io.ReadAll(reader)
+	if readErr != nil {
+		return fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+	unmarshalErr := json.Unmarshal(data, v)
+	if unmarshalErr != nil {
+		return fmt.Errorf("json.Unmarshal(key: %s) failed, err: %w", key, unmarshalErr)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package collections
+
+import (
+	"os"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/collection"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollections(t *testing.T) {
+	username := "test_user_collections"
+	now := time.Now().UTC()
+
+	metadataService := metadata.NewMemory()
+	for i, amount := range []*receipt_metadata.Amount{
+		{Value: "12.50", Currency: "EUR"},
+		{Value: "40", Currency: "USD"},
+		nil,
+	} {
+		putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID:   "receipt" + string(rune('0'+i)),
+			Username:    username,
+			CreatedAt:   now.Add(time.Duration(i) * time.Second),
+			Annotations: receipt_metadata.Annotations{Amount: amount},
+		})
+		assert.Nil(t, putErr)
+	}
+	assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{ReceiptID: "otherreceipt", Username: "test_user_other", CreatedAt: now}))
+
+	service := NewService("collections", storage.NewMemory(), metadataService)
+
+	t.Run("succeed, create, rename, list and delete", func(t *testing.T) {
+		trip, createErr := service.Create(username, "  Trip to Oslo ")
+		assert.Nil(t, createErr)
+		assert.Equal(t, "Trip to Oslo", trip.Name)
+		assert.Empty(t, trip.ReceiptIDs)
+
+		project, createErr := service.Create(username, "Project A")
+		assert.Nil(t, createErr)
+
+		renamed, renameErr := service.Rename(username, trip.CollectionID, "Trip to Bergen")
+		assert.Nil(t, renameErr)
+		assert.Equal(t, "Trip to Bergen", renamed.Name)
+
+		list, listErr := service.List(username)
+		assert.Nil(t, listErr)
+		assert.Len(t, list, 2)
+		assert.Equal(t, trip.CollectionID, list[0].CollectionID)
+		assert.Equal(t, "Trip to Bergen", list[0].Name)
+
+		empty, emptyErr := service.List("test_user_other")
+		assert.Nil(t, emptyErr)
+		assert.Empty(t, empty)
+
+		assert.Nil(t, service.Delete(username, project.CollectionID))
+		_, getErr := service.Get(username, project.CollectionID)
+		assert.ErrorIs(t, getErr, ErrNotFound)
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+	})
+
+	t.Run("should fail, invalid or taken name", func(t *testing.T) {
+		c, createErr := service.Create(username, "Taken")
+		assert.Nil(t, createErr)
+
+		_, createErr = service.Create(username, "taken")
+		assert.ErrorIs(t, createErr, ErrNameTaken)
+
+		// names are scoped to the user
+		_, createErr = service.Create("test_user_other", "Taken")
+		assert.Nil(t, createErr)
+
+		for _, name := range []string{"", "   ", strings.Repeat("a", 101), "new\nline"} {
+			_, createErr = service.Create(username, name)
+			assert.ErrorIs(t, createErr, ErrInvalidName, name)
+			_, renameErr := service.Rename(username, c.CollectionID, name)
+			assert.ErrorIs(t, renameErr, ErrInvalidName, name)
+		}
+
+		other, _ := service.Create(username, "Other")
+		_, renameErr := service.Rename(username, other.CollectionID, "TAKEN")
+		assert.ErrorIs(t, renameErr, ErrNameTaken)
+
+		_, renameErr = service.Rename(username, c.CollectionID, "Taken")
+		assert.Nil(t, renameErr)
+	})
+
+	t.Run("succeed, add and remove receipts", func(t *testing.T) {
+		c, createErr := service.Create(username, "Receipts")
+		assert.Nil(t, createErr)
+
+		for _, receiptId := range []string{"receipt2", "receipt0", "receipt1", "receipt0"} {
+			_, addErr := service.AddReceipt(username, c.CollectionID, receiptId)
+			assert.Nil(t, addErr)
+		}
+		got, _ := service.Get(username, c.CollectionID)
+		assert.Equal(t, []string{"receipt2", "receipt0", "receipt1"}, got.ReceiptIDs)
+
+		receipts, receiptsErr := service.Receipts(username, c.CollectionID)
+		assert.Nil(t, receiptsErr)
+		assert.Len(t, receipts, 3)
+		assert.Equal(t, "receipt0", receipts[0].ReceiptID)
+
+		assert.Nil(t, service.RemoveReceipt(username, c.CollectionID, "receipt2"))
+		assert.ErrorIs(t, service.RemoveReceipt(username, c.CollectionID, "receipt2"), os.ErrNotExist)
+
+		// receipts which are deleted are skipped
+		assert.Nil(t, metadataService.Delete(username, "receipt1"))
+		receipts, receiptsErr = service.Receipts(username, c.CollectionID)
+		assert.Nil(t, receiptsErr)
+		assert.Len(t, receipts, 1)
+		assert.Equal(t, "receipt0", receipts[0].ReceiptID)
+	})
+
+	t.Run("should fail, receipt or collection of another user", func(t *testing.T) {
+		c, createErr := service.Create(username, "Mine")
+		assert.Nil(t, createErr)
+
+		_, addErr := service.AddReceipt(username, c.CollectionID, "otherreceipt")
+		assert.ErrorIs(t, addErr, os.ErrNotExist)
+		assert.NotErrorIs(t, addErr, ErrNotFound)
+
+		_, addErr = service.AddReceipt("test_user_other", c.CollectionID, "otherreceipt")
+		assert.ErrorIs(t, addErr, ErrNotFound)
+
+		_, getErr := service.Get("test_user_other", c.CollectionID)
+		assert.ErrorIs(t, getErr, ErrNotFound)
+		assert.ErrorIs(t, service.Delete("test_user_other", c.CollectionID), ErrNotFound)
+	})
+}
+
+func TestTotals(t *testing.T) {
+	receipts := []receipt_metadata.ReceiptMetadata{
+		{ReceiptID: "a", Annotations: receipt_metadata.Annotations{Amount: &receipt_metadata.Amount{Value: "12.50", Currency: "EUR"}}},
+		{ReceiptID: "b", Annotations: receipt_metadata.Annotations{Amount: &receipt_metadata.Amount{Value: "0.125", Currency: "EUR"}}},
+		{ReceiptID: "c", Annotations: receipt_metadata.Annotations{Amount: &receipt_metadata.Amount{Value: "-2.5", Currency: "EUR"}}},
+		{ReceiptID: "d", Annotations: receipt_metadata.Annotations{Amount: &receipt_metadata.Amount{Value: "40", Currency: "USD"}}},
+		{ReceiptID: "e", Annotations: receipt_metadata.Annotations{Amount: &receipt_metadata.Amount{Value: "1000", Currency: "JPY"}}},
+		{ReceiptID: "f"},
+	}
+
+	assert.Equal(t, []collection.Total{
+		{Currency: "EUR", Value: "10.125", Receipts: 3},
+		{Currency: "JPY", Value: "1000", Receipts: 1},
+		{Currency: "USD", Value: "40", Receipts: 1},
+	}, Totals(receipts))
+
+	assert.Equal(t, []collection.Total{}, Totals(nil))
+}
@@ -0,0 +1,29 @@
+package collections
+
+import (
+	"errors"
+	"receipt_uploader/internal/models/collection"
+	"receipt_uploader/internal/models/receipt_metadata"
+)
+
+var (
+	// ErrNotFound is wrapped by errors of a collection which does not exist or belongs to another user
+	ErrNotFound = errors.New("collection not found")
+	// ErrInvalidName is wrapped by errors of a name which is empty or too long
+	ErrInvalidName = errors.New("invalid collection name")
+	// ErrNameTaken is wrapped by errors of a name which another collection of the user has
+	ErrNameTaken = errors.New("collection name is taken")
+)
+
+// ServiceType stores the collections of every user. Receipts are referenced by receiptId, only
+// receipts of the owner of a collection can be added to it.
+type ServiceType interface {
+	Create(username, name string) (*collection.Collection, error)
+	Get(username, collectionId string) (*collection.Collection, error)
+	List(username string) ([]collection.Collection, error) // oldest collection first
+	Rename(username, collectionId, name string) (*collection.Collection, error)
+	Delete(username, collectionId string) error // the receipts are kept
+	AddReceipt(username, collectionId, receiptId string) (*collection.Collection, error)
+	RemoveReceipt(username, collectionId, receiptId string) error
+	Receipts(username, collectionId string) ([]receipt_metadata.ReceiptMetadata, error) // oldest receipt first
+}
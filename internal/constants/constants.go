@@ -3,15 +3,99 @@ package constants
 import "time"
 
 const (
-	PORT             = ":8080"
-	ROOT_DIR_IMAGES  = "receipts"              // root dir to store all uplaoded and converted photos
-	MAX_UPLOAD_SIZE  = int64(10 * 1024 * 1024) // Maximum 10 MB
-	HTTP_ERR_MSG_500 = "internal server error"
-	HTTP_ERR_MSG_400 = "invalid image"
-	HTTP_ERR_MSG_403 = "access forbidden"
-	HTTP_ERR_MSG_404 = "image not found"
-	HTTP_ERR_MSG_405 = "method not allowed"
-	IMAGE_SIZE_MIN_W = 600
-	IMAGE_SIZE_MIN_H = 800
-	RESIZE_TIMEOUT   = 2 * time.Second
+	PORT                        = ":8080"
+	ROOT_DIR_IMAGES             = "receipts"                // root dir to store all uplaoded and converted photos
+	MAX_UPLOAD_SIZE             = int64(10 * 1024 * 1024)   // Maximum 10 MB
+	MAX_IMPORT_SIZE             = int64(1024 * 1024 * 1024) // Maximum 1 GB of an import archive
+	MAX_PATCH_SIZE              = int64(64 * 1024)          // Maximum 64 KB of a PATCH /receipts/{receiptId} body
+	MAX_COLLECTION_BODY_SIZE    = int64(4 * 1024)           // Maximum 4 KB of a body of POST /collections and PATCH /collections/{collectionId}
+	HTTP_ERR_MSG_500            = "internal server error"
+	HTTP_ERR_MSG_400            = "invalid image"
+	HTTP_ERR_MSG_400_ARCHIVE    = "invalid archive"
+	HTTP_ERR_MSG_400_QUERY      = "invalid query parameter"
+	HTTP_ERR_MSG_400_METADATA   = "invalid metadata"
+	HTTP_ERR_MSG_400_COLLECTION = "invalid collection request"
+	HTTP_ERR_MSG_400_NAME       = "invalid collection name"
+	HTTP_ERR_MSG_403            = "access forbidden"
+	HTTP_ERR_MSG_404            = "image not found"
+	HTTP_ERR_MSG_404_COLLECTION = "collection not found"
+	HTTP_ERR_MSG_405            = "method not allowed"
+	HTTP_ERR_MSG_409_NAME       = "collection name is taken"
+	HTTP_ERR_MSG_409_RESTORE    = "receipt has been uploaded again"
+	HTTP_ERR_MSG_412            = "receipt has been modified"
+	HTTP_ERR_MSG_413            = "image is larger than storage quota"
+	HTTP_ERR_MSG_507            = "storage quota exceeded"
+	HTTP_ERR_MSG_507_RECEIPTS   = "receipt quota exceeded"
+	IMAGE_SIZE_MIN_W            = 600
+	IMAGE_SIZE_MIN_H            = 800
+	RESIZE_TIMEOUT              = 2 * time.Second
+	TEMP_FILE_PREFIX            = ".tmp-"          // prefix of files which are being written
+	IMPORT_ENQUEUE_TIMEOUT      = 10 * time.Second // how long an import waits for space in resize_queue per receipt
+	RECONCILE_RATE              = 10               // default number of resize jobs re-submitted per second at startup
+
+	TRASH_RETENTION      = 30 * 24 * time.Hour // default time deleted receipts are kept in trash
+	TRASH_PURGE_INTERVAL = time.Hour           // default interval of purging expired receipts from trash
+
+	GC_INTERVAL = 24 * time.Hour // default interval of applying retention policies
+
+	SCRUB_INTERVAL     = 24 * time.Hour // default interval of verifying checksums of all images
+	SCRUB_GRACE_PERIOD = time.Minute    // missing variants of newer receipts are not reported, they are still being resized
+
+	TIERING_INTERVAL = 24 * time.Hour // default interval of moving old originals to cold storage
+	TIER_HOT         = "hot"          // original is in config.UploadsDir
+	TIER_COLD        = "cold"         // original has been moved to cold storage
+
+	REPLICATION_QUORUM_PRIMARY = "primary" // a write succeeds once the primary is written, replica failures are logged
+	REPLICATION_QUORUM_BOTH    = "both"    // a write succeeds once the primary and the replica are written
+
+	VARIANT_ORIGINAL          = "original"   // copy of the original in config.DIR_RESIZED, served without size
+	VARIANT_STATUS_QUEUED     = "queued"     // variant is waiting to be generated
+	VARIANT_STATUS_PROCESSING = "processing" // variant is being generated
+	VARIANT_STATUS_READY      = "ready"      // variant has been generated
+	VARIANT_STATUS_FAILED     = "failed"     // generating the variant failed
+	METADATA_COMPACT_AFTER    = 1000         // min number of log entries before the metadata log is compacted
+	QUEUE_SEGMENT_SIZE        = 1024 * 1024  // size in bytes after which the durable resize queue starts a new segment
+
+	RESIZE_ERR_READ    = "read"    // the original could not be read from storage
+	RESIZE_ERR_DECODE  = "decode"  // the original is not a valid image
+	RESIZE_ERR_RESIZE  = "resize"  // resizing or encoding a variant failed
+	RESIZE_ERR_WRITE   = "write"   // a variant could not be written to storage
+	RESIZE_ERR_TIMEOUT = "timeout" // generating took longer than RESIZE_TIMEOUT
+
+	ANNOTATION_NOTES_MAX    = 2000 // max number of characters of notes
+	ANNOTATION_MERCHANT_MAX = 200  // max number of characters of merchant
+	ANNOTATION_TAGS_MAX     = 20   // max number of tags of a receipt
+	ANNOTATION_TAG_MAX      = 32   // max length of a tag
+
+	LIST_LIMIT_DEFAULT = 20     // default number of receipts per page of GET /receipts
+	LIST_LIMIT_MAX     = 100    // max number of receipts per page of GET /receipts
+	SORT_ORDER_ASC     = "asc"  // oldest receipt first
+	SORT_ORDER_DESC    = "desc" // newest receipt first
+	SEARCH_QUERY_MAX   = 1000   // max length of the query of GET /receipts/search
+
+	COLLECTION_NAME_MAX = 100 // max number of characters of the name of a collection
+
+	AUDIT_ACTION_UPLOAD     = "upload"    // POST /receipts
+	AUDIT_ACTION_DOWNLOAD   = "download"  // GET /receipts/{receiptId}
+	AUDIT_ACTION_VIEW       = "view"      // GET /receipts/{receiptId}/meta
+	AUDIT_ACTION_UPDATE     = "update"    // PATCH /receipts/{receiptId}
+	AUDIT_ACTION_DELETE     = "delete"    // DELETE /receipts/{receiptId}
+	AUDIT_ACTION_RESTORE    = "restore"   // POST /receipts/{receiptId}/restore
+	AUDIT_ACTION_EXPORT     = "export"    // GET /receipts/export
+	AUDIT_ACTION_IMPORT     = "import"    // POST /receipts/import
+	AUDIT_OUTCOME_SUCCESS   = "success"   // status below 400
+	AUDIT_OUTCOME_DENIED    = "denied"    // 401 or 403, e.g. an invalid username_token
+	AUDIT_OUTCOME_NOT_FOUND = "not_found" // 404, also returned for a receipt of another user
+	AUDIT_OUTCOME_REJECTED  = "rejected"  // any other 4xx, e.g. an invalid request
+	AUDIT_OUTCOME_ERROR     = "error"     // 5xx
+	AUDIT_ACTOR_MAX         = 100         // max length of the recorded username_token
+	AUDIT_LIMIT_DEFAULT     = 100         // default number of entries per page of GET /admin/audit
+	AUDIT_LIMIT_MAX         = 1000        // max number of entries per page of GET /admin/audit
+
+	QUOTA_MAX_BYTES    = int64(1024 * 1024 * 1024) // default storage quota per user, 1 GB
+	QUOTA_MAX_RECEIPTS = 1000                      // default number of receipts per user
+
+	STORAGE_BACKEND_FILESYSTEM = "filesystem"
+	STORAGE_BACKEND_MEMORY     = "memory"
+	STORAGE_BACKEND_S3         = "s3"
 )
@@ -0,0 +1,548 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	magic           = "RCE1"                       // first bytes of every encrypted object
+	noncePrefixSize = 8                            // random part of the nonce of every chunk
+	headerSize      = len(magic) + noncePrefixSize // magic followed by the nonce prefix
+	chunkSize       = 64 * 1024                    // plaintext bytes sealed together
+	tagSize         = 16                           // AES-GCM authentication tag of every chunk
+	sealedChunkSize = chunkSize + tagSize          // size of a full chunk in the encrypted object
+	keyExtension    = ".key"                       // extension of wrapped data keys in config.Encryption.KeysDir
+	keyIDSize       = 8                            // bytes of the SHA-256 of a master key identifying it
+	lastChunk       = byte(1)                      // additional data of the last chunk, detects truncated objects
+	otherChunk      = byte(0)                      // additional data of every other chunk
+	nonceSize       = 12                           // nonce of AES-GCM, the nonce prefix followed by the chunk counter
+)
+
+// Service wraps a storage and encrypts every image under config.UploadsDir, config.ResizedDir and
+// config.TrashDir with AES-GCM. Every user has a random data key, which is stored in
+// {config.Encryption.KeysDir}/{username}.key wrapped by the master key, so rotating the master key
+// only re-wraps data keys and never re-encrypts objects.
+//
+// An object is sealed in chunks of 64 KiB, so it is decrypted while it is read. Objects written
+// before encryption was enabled are read as they are. Nothing is encrypted if
+// config.Encryption.MasterKey is not set.
+type Service struct {
+	storage.ServiceType
+	config   *configs.Config
+	mu       sync.Mutex
+	dataKeys map[string]cipher.AEAD // unwrapped data keys, keyed by username
+}
+
+// wrappedKey is a data key sealed by a master key, the username is authenticated with it
+type wrappedKey struct {
+	MasterKeyID string `json:"masterKeyId"` // hex encoded prefix of the SHA-256 of the master key
+	Nonce       []byte `json:"nonce"`
+	Key         []byte `json:"key"`
+}
+
+func NewService(config *configs.Config, s storage.ServiceType) ServiceType {
+	return &Service{
+		ServiceType: s,
+		config:      config,
+		dataKeys:    make(map[string]cipher.AEAD),
+	}
+}
+
+// Put encrypts the object with the data key of its owner, the data key is created on the first write
+func (s *Service) Put(key string, r io.Reader) error {
+	username, ok := s.owner(key)
+	if !ok {
+		return s.ServiceType.Put(key, r)
+	}
+
+	aead, keyErr := s.dataKey(username, true)
+	if keyErr != nil {
+		return fmt.Errorf("s.dataKey(username: %s) failed, err: %w", username, keyErr)
+	}
+
+	reader, writer := io.Pipe()
+	encrypted := make(chan struct{})
+	go func() {
+		writer.CloseWithError(encrypt(aead, r, writer))
+		close(encrypted)
+	}()
+
+	putErr := s.ServiceType.Put(key, reader)
+	reader.Close() // unblocks encrypt() if the storage stopped reading
+	<-encrypted
+	return putErr
+}
+
+// Get returns a reader decrypting the object while it is read, a read fails with an error
+// wrapping ErrDecrypt if the object has been modified
+func (s *Service) Get(key string) (io.ReadCloser, error) {
+	username, ok := s.owner(key)
+	if !ok {
+		return s.ServiceType.Get(key)
+	}
+
+	reader, getErr := s.ServiceType.Get(key)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	header, encrypted, headerErr := readHeader(reader)
+	if headerErr != nil {
+		reader.Close()
+		return nil, headerErr
+	}
+	if !encrypted {
+		logging.Debugf("object is not encrypted, key: %s", key)
+		return &readCloser{Reader: io.MultiReader(bytes.NewReader(header), reader), Closer: reader}, nil
+	}
+
+	aead, keyErr := s.dataKey(username, false)
+	if keyErr != nil {
+		reader.Close()
+		return nil, fmt.Errorf("s.dataKey(username: %s) failed, err: %w", username, keyErr)
+	}
+
+	return &decryptReader{
+		source:      reader,
+		aead:        aead,
+		noncePrefix: header[len(magic):],
+		sealed:      make([]byte, sealedChunkSize),
+	}, nil
+}
+
+// Stat returns the size of the decrypted object
+func (s *Service) Stat(key string) (*storage.ObjectInfo, error) {
+	info, statErr := s.ServiceType.Stat(key)
+	if statErr != nil {
+		return nil, statErr
+	}
+	s.decryptedSize(info)
+	return info, nil
+}
+
+// List returns the sizes of the decrypted objects
+func (s *Service) List(prefix string) ([]storage.ObjectInfo, error) {
+	objects, listErr := s.ServiceType.List(prefix)
+	if listErr != nil {
+		return nil, listErr
+	}
+	for i := range objects {
+		s.decryptedSize(&objects[i])
+	}
+	return objects, nil
+}
+
+// SweepTempFiles implements storage.Sweeper if the wrapped storage does
+func (s *Service) SweepTempFiles(dir string) (int, error) {
+	sweeper, ok := s.ServiceType.(storage.Sweeper)
+	if !ok {
+		return 0, nil
+	}
+	return sweeper.SweepTempFiles(dir)
+}
+
+// SetModTime implements storage.ModTimeSetter if the wrapped storage does
+func (s *Service) SetModTime(key string, modTime time.Time) error {
+	setter, ok := s.ServiceType.(storage.ModTimeSetter)
+	if !ok {
+		return fmt.Errorf("storage does not support setting modification time, key=%s", key)
+	}
+	return setter.SetModTime(key, modTime)
+}
+
+// RotateKeys re-wraps every data key which is not wrapped by config.Encryption.MasterKey, i.e. which
+// is wrapped by config.Encryption.PreviousMasterKey. Objects are not re-encrypted as their data keys
+// do not change. Running it again after a failure only re-wraps the remaining data keys.
+func (s *Service) RotateKeys() (*RotationReport, error) {
+	if !s.enabled() {
+		return nil, errors.New("encryption is disabled, no master key is configured")
+	}
+	logging.Infof("encryption.RotateKeys()")
+
+	objects, listErr := s.ServiceType.List(s.config.Encryption.KeysDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.ServiceType.List(dir: %s) failed, err: %w", s.config.Encryption.KeysDir, listErr)
+	}
+
+	report := &RotationReport{}
+	currentID := masterKeyID(s.config.Encryption.MasterKey)
+	for _, obj := range objects {
+		username, ok := strings.CutSuffix(filepath.Base(obj.Key), keyExtension)
+		if !ok {
+			continue
+		}
+		report.Scanned++
+
+		s.mu.Lock()
+		rewrapped, rotateErr := s.rotateKey(username, currentID)
+		s.mu.Unlock()
+		if rotateErr != nil {
+			logging.Errorf("s.rotateKey(username: %s) failed, err: %s", username, rotateErr.Error())
+			report.Failed++
+			continue
+		}
+		if rewrapped {
+			report.Rewrapped++
+		} else {
+			report.Current++
+		}
+	}
+
+	logging.Infof(
+		"key rotation done, scanned: %d, rewrapped: %d, current: %d, failed: %d",
+		report.Scanned, report.Rewrapped, report.Current, report.Failed,
+	)
+	return report, nil
+}
+
+// rotateKey re-wraps the data key of username by the master key identified by currentID, it tells
+// if the data key had to be re-wrapped. s.mu must be held.
+func (s *Service) rotateKey(username, currentID string) (bool, error) {
+	wrapped, getErr := s.getWrappedKey(username)
+	if getErr != nil {
+		return false, getErr
+	}
+	if wrapped.MasterKeyID == currentID {
+		return false, nil
+	}
+
+	dataKey, unwrapErr := s.unwrap(username, wrapped)
+	if unwrapErr != nil {
+		return false, unwrapErr
+	}
+
+	putErr := s.putDataKey(username, dataKey)
+	if putErr != nil {
+		return false, putErr
+	}
+	return true, nil
+}
+
+// dataKey returns the data key of username, it is created if it does not exist and create is true
+func (s *Service) dataKey(username string, create bool) (cipher.AEAD, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if aead, ok := s.dataKeys[username]; ok {
+		return aead, nil
+	}
+
+	var dataKey []byte
+	wrapped, getErr := s.getWrappedKey(username)
+	switch {
+	case getErr == nil:
+		key, unwrapErr := s.unwrap(username, wrapped)
+		if unwrapErr != nil {
+			return nil, unwrapErr
+		}
+		dataKey = key
+	case errors.Is(getErr, fs.ErrNotExist) && create:
+		dataKey = make([]byte, KEY_SIZE)
+		_, randErr := rand.Read(dataKey)
+		if randErr != nil {
+			return nil, fmt.Errorf("rand.Read() failed, err: %w", randErr)
+		}
+		putErr := s.putDataKey(username, dataKey)
+		if putErr != nil {
+			return nil, putErr
+		}
+		logging.Infof("created data key of %s", username)
+	default:
+		return nil, getErr
+	}
+
+	aead, aeadErr := newAEAD(dataKey)
+	if aeadErr != nil {
+		return nil, aeadErr
+	}
+	s.dataKeys[username] = aead
+	return aead, nil
+}
+
+func (s *Service) getWrappedKey(username string) (*wrappedKey, error) {
+	reader, getErr := s.ServiceType.Get(s.keyPath(username))
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer reader.Close()
+
+	var wrapped wrappedKey
+	decodeErr := json.NewDecoder(reader).Decode(&wrapped)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("json.Decode(data key of %s) failed, err: %w", username, decodeErr)
+	}
+	return &wrapped, nil
+}
+
+// putDataKey stores dataKey of username wrapped by the master key
+func (s *Service) putDataKey(username string, dataKey []byte) error {
+	aead, aeadErr := newAEAD(s.config.Encryption.MasterKey)
+	if aeadErr != nil {
+		return aeadErr
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, randErr := rand.Read(nonce)
+	if randErr != nil {
+		return fmt.Errorf("rand.Read() failed, err: %w", randErr)
+	}
+
+	data, marshalErr := json.Marshal(&wrappedKey{
+		MasterKeyID: masterKeyID(s.config.Encryption.MasterKey),
+		Nonce:       nonce,
+		Key:         aead.Seal(nil, nonce, dataKey, []byte(username)),
+	})
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+
+	putErr := s.ServiceType.Put(s.keyPath(username), bytes.NewReader(data))
+	if putErr != nil {
+		return fmt.Errorf("s.ServiceType.Put(data key of %s) failed, err: %w", username, putErr)
+	}
+	return nil
+}
+
+// unwrap opens the data key of username with the master key which wrapped it
+func (s *Service) unwrap(username string, wrapped *wrappedKey) ([]byte, error) {
+	for _, masterKey := range [][]byte{s.config.Encryption.MasterKey, s.config.Encryption.PreviousMasterKey} {
+		if len(masterKey) == 0 || masterKeyID(masterKey) != wrapped.MasterKeyID {
+			continue
+		}
+
+		aead, aeadErr := newAEAD(masterKey)
+		if aeadErr != nil {
+			return nil, aeadErr
+		}
+		dataKey, openErr := aead.Open(nil, wrapped.Nonce, wrapped.Key, []byte(username))
+		if openErr != nil {
+			return nil, fmt.Errorf("%w, data key of %s, err: %s", ErrDecrypt, username, openErr.Error())
+		}
+		return dataKey, nil
+	}
+	return nil, fmt.Errorf("data key of %s is wrapped by an unknown master key, masterKeyId=%s", username, wrapped.MasterKeyID)
+}
+
+// decryptedSize replaces the size of an encrypted object by the size of its content. The content size
+// follows from the size of the object as every chunk is sealed with the same overhead, so only the
+// header is read to tell if the object is encrypted.
+func (s *Service) decryptedSize(info *storage.ObjectInfo) {
+	if _, ok := s.owner(info.Key); !ok || info.Size < int64(headerSize+tagSize) {
+		return
+	}
+
+	reader, getErr := s.getHeader(info.Key)
+	if getErr != nil {
+		return
+	}
+	defer reader.Close()
+
+	_, encrypted, _ := readHeader(reader)
+	if encrypted {
+		info.Size = plaintextSize(info.Size)
+	}
+}
+
+// getHeader returns a reader of the header of the object at key, the whole object is requested if
+// the wrapped storage can not read a range of it
+func (s *Service) getHeader(key string) (io.ReadCloser, error) {
+	if ranger, ok := s.ServiceType.(storage.RangeReader); ok {
+		return ranger.GetRange(key, 0, int64(headerSize))
+	}
+	return s.ServiceType.Get(key)
+}
+
+func (s *Service) enabled() bool {
+	return len(s.config.Encryption.MasterKey) > 0
+}
+
+// owner returns the user owning the image stored at key, false is returned if key is not an
+// encrypted image: {UploadsDir}/{username}#{receiptId}.jpg, {ResizedDir}/{username}/... or
+// {TrashDir}/{username}/...
+func (s *Service) owner(key string) (string, bool) {
+	if !s.enabled() {
+		return "", false
+	}
+
+	key = filepath.Clean(key)
+	separator := string(filepath.Separator)
+	for _, dir := range []string{s.config.UploadsDir, s.config.ResizedDir, s.config.TrashDir} {
+		if dir == "" {
+			continue
+		}
+		rel, found := strings.CutPrefix(key, filepath.Clean(dir)+separator)
+		if !found {
+			continue
+		}
+		if username, _, nested := strings.Cut(rel, separator); nested {
+			return username, username != ""
+		}
+		username, _, found := strings.Cut(rel, "#")
+		return username, found && username != ""
+	}
+	return "", false
+}
+
+func (s *Service) keyPath(username string) string {
+	return filepath.Join(s.config.Encryption.KeysDir, username+keyExtension)
+}
+
+// encrypt writes the header and the sealed chunks of r to w, the last chunk is shorter than
+// chunkSize and may be empty
+func encrypt(aead cipher.AEAD, r io.Reader, w io.Writer) error {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	_, randErr := rand.Read(header[len(magic):])
+	if randErr != nil {
+		return fmt.Errorf("rand.Read() failed, err: %w", randErr)
+	}
+	_, writeErr := w.Write(header)
+	if writeErr != nil {
+		return writeErr
+	}
+
+	plain := make([]byte, chunkSize)
+	sealed := make([]byte, 0, sealedChunkSize)
+	for counter := uint32(0); ; counter++ {
+		n, readErr := io.ReadFull(r, plain)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+
+		last := n < chunkSize
+		sealed = aead.Seal(sealed[:0], chunkNonce(header[len(magic):], counter), plain[:n], chunkAdditionalData(last))
+		_, writeErr = w.Write(sealed)
+		if writeErr != nil {
+			return writeErr
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decryptReader opens the chunks of an encrypted object one by one
+type decryptReader struct {
+	source      io.ReadCloser
+	aead        cipher.AEAD
+	noncePrefix []byte
+	counter     uint32
+	sealed      []byte // buffer of the current chunk
+	plain       []byte // decrypted bytes of the current chunk which have not been read
+	done        bool   // the last chunk has been opened
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		nextErr := d.next()
+		if nextErr != nil {
+			return 0, nextErr
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.source.Close()
+}
+
+func (d *decryptReader) next() error {
+	n, readErr := io.ReadFull(d.source, d.sealed)
+	if readErr == io.EOF {
+		return fmt.Errorf("%w, object is truncated", ErrDecrypt)
+	}
+	if readErr != nil && readErr != io.ErrUnexpectedEOF {
+		return readErr
+	}
+
+	last := n < sealedChunkSize
+	plain, openErr := d.aead.Open(d.sealed[:0], chunkNonce(d.noncePrefix, d.counter), d.sealed[:n], chunkAdditionalData(last))
+	if openErr != nil {
+		return fmt.Errorf("%w, chunk: %d, err: %s", ErrDecrypt, d.counter, openErr.Error())
+	}
+
+	d.plain = plain
+	d.done = last
+	d.counter++
+	return nil
+}
+
+// readCloser reads an object which is not encrypted after its first bytes have been read
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readHeader reads the header of an object and tells if the object is encrypted, the read bytes
+// are returned
+func readHeader(r io.Reader) ([]byte, bool, error) {
+	header := make([]byte, headerSize)
+	n, readErr := io.ReadFull(r, header)
+	if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+		return nil, false, readErr
+	}
+	return header[:n], n == headerSize && string(header[:len(magic)]) == magic, nil
+}
+
+// plaintextSize returns the content size of an encrypted object of size bytes
+func plaintextSize(size int64) int64 {
+	body := size - int64(headerSize)
+	fullChunks := body / sealedChunkSize
+	return fullChunks*chunkSize + body - fullChunks*sealedChunkSize - tagSize
+}
+
+func chunkNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	return nonce
+}
+
+func chunkAdditionalData(last bool) []byte {
+	if last {
+		return []byte{lastChunk}
+	}
+	return []byte{otherChunk}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, blockErr := aes.NewCipher(key)
+	if blockErr != nil {
+		return nil, fmt.Errorf("aes.NewCipher() failed, err: %w", blockErr)
+	}
+	aead, gcmErr := cipher.NewGCM(block)
+	if gcmErr != nil {
+		return nil, fmt.Errorf("cipher.NewGCM() failed, err: %w", gcmErr)
+	}
+	return aead, nil
+}
+
+// masterKeyID identifies a master key without revealing it
+func masterKeyID(masterKey []byte) string {
+	sum := sha256.Sum256(masterKey)
+	return hex.EncodeToString(sum[:keyIDSize])
+}
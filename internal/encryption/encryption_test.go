@@ -0,0 +1,259 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryption(t *testing.T) {
+	newKey := func(t *testing.T) []byte {
+		key := make([]byte, KEY_SIZE)
+		_, randErr := rand.Read(key)
+		assert.Nil(t, randErr)
+		return key
+	}
+
+	newConfig := func(masterKey []byte) *configs.Config {
+		return &configs.Config{
+			UploadsDir: "uploads",
+			ResizedDir: "resized",
+			RecordsDir: "records",
+			TrashDir:   "trash",
+			Encryption: configs.EncryptionConfig{
+				MasterKey: masterKey,
+				KeysDir:   "keys",
+			},
+		}
+	}
+
+	read := func(t *testing.T, s storage.ServiceType, key string) ([]byte, error) {
+		reader, getErr := s.Get(key)
+		if getErr != nil {
+			return nil, getErr
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	newContent := func(t *testing.T, size int) []byte {
+		data := make([]byte, size)
+		_, randErr := rand.Read(data)
+		assert.Nil(t, randErr)
+		return data
+	}
+
+	t.Run("succeed, encrypt on write and decrypt on read", func(t *testing.T) {
+		store := storage.NewMemory()
+		service := NewService(newConfig(newKey(t)), store)
+
+		for _, size := range []int{0, 10, chunkSize, 3*chunkSize + 100} {
+			key := "resized/user1/123456_small.jpg"
+			data := newContent(t, size)
+			assert.Nil(t, service.Put(key, bytes.NewReader(data)))
+
+			stored, storedErr := read(t, store, key)
+			assert.Nil(t, storedErr)
+			assert.Equal(t, magic, string(stored[:len(magic)]))
+			assert.False(t, size > 0 && bytes.Contains(stored, data[:min(size, 64)]))
+
+			decrypted, readErr := read(t, service, key)
+			assert.Nil(t, readErr)
+			assert.Equal(t, data, decrypted)
+
+			info, statErr := service.Stat(key)
+			assert.Nil(t, statErr)
+			assert.Equal(t, int64(size), info.Size)
+		}
+
+		_, keyErr := store.Stat("keys/user1.key")
+		assert.Nil(t, keyErr)
+	})
+
+	t.Run("succeed, list decrypted sizes", func(t *testing.T) {
+		store := storage.NewMemory()
+		service := NewService(newConfig(newKey(t)), store)
+		assert.Nil(t, service.Put("uploads/user1#123456.jpg", bytes.NewReader(newContent(t, 1000))))
+		assert.Nil(t, service.Put("trash/user1/654321/user1#654321.jpg", bytes.NewReader(newContent(t, 2000))))
+
+		uploads, listErr := service.List("uploads")
+		assert.Nil(t, listErr)
+		assert.Len(t, uploads, 1)
+		assert.Equal(t, int64(1000), uploads[0].Size)
+
+		trashed, listErr := service.List("trash")
+		assert.Nil(t, listErr)
+		assert.Len(t, trashed, 1)
+		assert.Equal(t, int64(2000), trashed[0].Size)
+	})
+
+	t.Run("succeed, only headers are read for sizes", func(t *testing.T) {
+		store := &rangeCountingStorage{ServiceType: storage.NewMemory()}
+		service := NewService(newConfig(newKey(t)), store)
+		assert.Nil(t, service.Put("uploads/user1#123456.jpg", bytes.NewReader(newContent(t, 3*chunkSize))))
+		store.gets = 0
+
+		info, statErr := service.Stat("uploads/user1#123456.jpg")
+		assert.Nil(t, statErr)
+		assert.Equal(t, int64(3*chunkSize), info.Size)
+		assert.Equal(t, 0, store.gets)
+		assert.Equal(t, []int64{int64(headerSize)}, store.ranges)
+	})
+
+	t.Run("succeed, records are not encrypted", func(t *testing.T) {
+		store := storage.NewMemory()
+		service := NewService(newConfig(newKey(t)), store)
+		key := "records/user1/receipts/123456.json"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("{}"))))
+
+		stored, readErr := read(t, store, key)
+		assert.Nil(t, readErr)
+		assert.Equal(t, "{}", string(stored))
+	})
+
+	t.Run("succeed, read images written before encryption was enabled", func(t *testing.T) {
+		store := storage.NewMemory()
+		service := NewService(newConfig(newKey(t)), store)
+		assert.Nil(t, store.Put("uploads/user1#123456.jpg", bytes.NewReader([]byte("plain"))))
+		assert.Nil(t, store.Put("uploads/user1#654321.jpg", bytes.NewReader([]byte("plain image which is longer than a header"))))
+
+		data, readErr := read(t, service, "uploads/user1#123456.jpg")
+		assert.Nil(t, readErr)
+		assert.Equal(t, "plain", string(data))
+
+		data, readErr = read(t, service, "uploads/user1#654321.jpg")
+		assert.Nil(t, readErr)
+		assert.Equal(t, "plain image which is longer than a header", string(data))
+
+		info, statErr := service.Stat("uploads/user1#123456.jpg")
+		assert.Nil(t, statErr)
+		assert.Equal(t, int64(5), info.Size)
+	})
+
+	t.Run("succeed, nothing is encrypted without master key", func(t *testing.T) {
+		store := storage.NewMemory()
+		service := NewService(newConfig(nil), store)
+		key := "uploads/user1#123456.jpg"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("plain"))))
+
+		stored, readErr := read(t, store, key)
+		assert.Nil(t, readErr)
+		assert.Equal(t, "plain", string(stored))
+
+		_, rotateErr := service.RotateKeys()
+		assert.NotNil(t, rotateErr)
+	})
+
+	t.Run("succeed, users have their own data key", func(t *testing.T) {
+		store := storage.NewMemory()
+		config := newConfig(newKey(t))
+		service := NewService(config, store)
+		assert.Nil(t, service.Put("uploads/user1#123456.jpg", bytes.NewReader([]byte("data of user1"))))
+		assert.Nil(t, service.Put("uploads/user2#654321.jpg", bytes.NewReader([]byte("data of user2"))))
+
+		// the object of user1 stored as an object of user2 can not be decrypted
+		stored, readErr := read(t, store, "uploads/user1#123456.jpg")
+		assert.Nil(t, readErr)
+		assert.Nil(t, store.Put("uploads/user2#123456.jpg", bytes.NewReader(stored)))
+
+		_, readErr = read(t, NewService(config, store), "uploads/user2#123456.jpg")
+		assert.ErrorIs(t, readErr, ErrDecrypt)
+	})
+
+	t.Run("should fail, detect modified and truncated objects", func(t *testing.T) {
+		store := storage.NewMemory()
+		service := NewService(newConfig(newKey(t)), store)
+		key := "resized/user1/123456.jpg"
+		assert.Nil(t, service.Put(key, bytes.NewReader(newContent(t, 2*chunkSize+10))))
+
+		stored, readErr := read(t, store, key)
+		assert.Nil(t, readErr)
+
+		modified := bytes.Clone(stored)
+		modified[headerSize+chunkSize+1] ^= 0xff
+		assert.Nil(t, store.Put(key, bytes.NewReader(modified)))
+		_, readErr = read(t, service, key)
+		assert.ErrorIs(t, readErr, ErrDecrypt)
+
+		// dropping the last chunk keeps full chunks only
+		assert.Nil(t, store.Put(key, bytes.NewReader(stored[:headerSize+2*sealedChunkSize])))
+		_, readErr = read(t, service, key)
+		assert.ErrorIs(t, readErr, ErrDecrypt)
+	})
+
+	t.Run("should fail, data key is missing", func(t *testing.T) {
+		store := storage.NewMemory()
+		config := newConfig(newKey(t))
+		key := "uploads/user1#123456.jpg"
+		assert.Nil(t, NewService(config, store).Put(key, bytes.NewReader([]byte("data"))))
+		assert.Nil(t, store.Delete("keys/user1.key"))
+
+		_, readErr := read(t, NewService(config, store), key)
+		assert.ErrorIs(t, readErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, rotate master key without re-encrypting objects", func(t *testing.T) {
+		store := storage.NewMemory()
+		oldKey := newKey(t)
+		key := "uploads/user1#123456.jpg"
+		assert.Nil(t, NewService(newConfig(oldKey), store).Put(key, bytes.NewReader([]byte("data of user1"))))
+		assert.Nil(t, NewService(newConfig(oldKey), store).Put("uploads/user2#654321.jpg", bytes.NewReader([]byte("data of user2"))))
+		before, readErr := read(t, store, key)
+		assert.Nil(t, readErr)
+
+		// without the previous master key the data keys can not be unwrapped
+		newMasterKey := newKey(t)
+		_, readErr = read(t, NewService(newConfig(newMasterKey), store), key)
+		assert.NotNil(t, readErr)
+
+		config := newConfig(newMasterKey)
+		config.Encryption.PreviousMasterKey = oldKey
+		report, rotateErr := NewService(config, store).RotateKeys()
+		assert.Nil(t, rotateErr)
+		assert.Equal(t, &RotationReport{Scanned: 2, Rewrapped: 2}, report)
+
+		report, rotateErr = NewService(config, store).RotateKeys()
+		assert.Nil(t, rotateErr)
+		assert.Equal(t, &RotationReport{Scanned: 2, Current: 2}, report)
+
+		after, readErr := read(t, store, key)
+		assert.Nil(t, readErr)
+		assert.Equal(t, before, after)
+
+		// the previous master key is no longer needed
+		data, readErr := read(t, NewService(newConfig(newMasterKey), store), key)
+		assert.Nil(t, readErr)
+		assert.Equal(t, "data of user1", string(data))
+	})
+}
+
+func TestPlaintextSize(t *testing.T) {
+	for _, size := range []int64{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 5 * chunkSize} {
+		fullChunks := size / chunkSize
+		encrypted := int64(headerSize) + fullChunks*sealedChunkSize + size - fullChunks*chunkSize + tagSize
+		assert.Equal(t, size, plaintextSize(encrypted))
+	}
+}
+
+// rangeCountingStorage records the whole objects and the ranges which have been read
+type rangeCountingStorage struct {
+	storage.ServiceType
+	gets   int
+	ranges []int64 // length of every range read
+}
+
+func (r *rangeCountingStorage) Get(key string) (io.ReadCloser, error) {
+	r.gets++
+	return r.ServiceType.Get(key)
+}
+
+func (r *rangeCountingStorage) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	r.ranges = append(r.ranges, length)
+	return r.ServiceType.(storage.RangeReader).GetRange(key, offset, length)
+}
@@ -0,0 +1,25 @@
+package encryption
+
+import (
+	"errors"
+	"receipt_uploader/internal/storage"
+)
+
+const KEY_SIZE = 32 // size of master keys and data keys in bytes, AES-256
+
+// ErrDecrypt is wrapped by errors reading an object which has been modified or truncated
+var ErrDecrypt = errors.New("decryption failed")
+
+// ServiceType is a storage which encrypts images at rest with a data key per user
+type ServiceType interface {
+	storage.ServiceType
+	RotateKeys() (*RotationReport, error)
+}
+
+// RotationReport summarizes the data keys re-wrapped by a key rotation
+type RotationReport struct {
+	Scanned   int `json:"scanned"`   // number of data keys
+	Rewrapped int `json:"rewrapped"` // data keys which have been re-wrapped by the master key
+	Current   int `json:"current"`   // data keys which were already wrapped by the master key
+	Failed    int `json:"failed"`    // data keys which could not be re-wrapped
+}
@@ -0,0 +1,239 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exif is what is known from the EXIF block of a JPEG image about how it was taken
+type Exif struct {
+	CapturedAt  string `json:"capturedAt,omitempty"`  // DateTimeOriginal, RFC 3339 if the offset was recorded, local time of the device otherwise
+	Orientation int    `json:"orientation,omitempty"` // 1-8, how the image must be rotated or flipped to be displayed upright
+	Make        string `json:"make,omitempty"`        // manufacturer of the device
+	Model       string `json:"model,omitempty"`       // model of the device
+	HasGPS      bool   `json:"hasGps"`                // the location where the image was taken was recorded
+}
+
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+	markerAPP1 = 0xE1
+
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitude       = 0x0004
+
+	typeASCII = 2
+	typeShort = 3
+	typeLong  = 4
+
+	exifDateTimeLayout = "2006:01:02 15:04:05"
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Parse reads the EXIF block of the JPEG image data, nil is returned if the image has none
+func Parse(data []byte) (*Exif, error) {
+	segment, findErr := findExifSegment(data)
+	if findErr != nil {
+		return nil, fmt.Errorf("findExifSegment() failed, err: %w", findErr)
+	}
+	if segment == nil {
+		return nil, nil
+	}
+
+	t, tiffErr := newTiff(segment)
+	if tiffErr != nil {
+		return nil, fmt.Errorf("newTiff() failed, err: %w", tiffErr)
+	}
+
+	ifd0, ifd0Err := t.readIFD(t.order.Uint32(segment[4:8]))
+	if ifd0Err != nil {
+		return nil, fmt.Errorf("t.readIFD(IFD0) failed, err: %w", ifd0Err)
+	}
+
+	result := &Exif{
+		Make:  t.ascii(ifd0[tagMake]),
+		Model: t.ascii(ifd0[tagModel]),
+	}
+	if orientation := t.uint(ifd0[tagOrientation]); orientation >= 1 && orientation <= 8 {
+		result.Orientation = int(orientation)
+	}
+
+	capturedAt := t.ascii(ifd0[tagDateTime])
+	if entry, ok := ifd0[tagExifIFD]; ok {
+		exifIFD, exifErr := t.readIFD(t.uint(entry))
+		if exifErr != nil {
+			return nil, fmt.Errorf("t.readIFD(Exif IFD) failed, err: %w", exifErr)
+		}
+		if original := t.ascii(exifIFD[tagDateTimeOriginal]); original != "" {
+			capturedAt = original + t.ascii(exifIFD[tagOffsetTimeOriginal])
+		}
+	}
+	result.CapturedAt = formatDateTime(capturedAt)
+
+	if entry, ok := ifd0[tagGPSIFD]; ok {
+		gpsIFD, gpsErr := t.readIFD(t.uint(entry))
+		if gpsErr != nil {
+			return nil, fmt.Errorf("t.readIFD(GPS IFD) failed, err: %w", gpsErr)
+		}
+		_, hasLatitude := gpsIFD[tagGPSLatitude]
+		_, hasLongitude := gpsIFD[tagGPSLongitude]
+		result.HasGPS = hasLatitude && hasLongitude
+	}
+
+	return result, nil
+}
+
+// findExifSegment returns the TIFF structure of the APP1 segment holding the EXIF block, the
+// segments before the image data are scanned
+func findExifSegment(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errors.New("not a JPEG image")
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, fmt.Errorf("invalid segment marker at %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return nil, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, fmt.Errorf("invalid segment length at %d", pos)
+		}
+		payload := data[pos+4 : pos+2+length]
+		if marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			return payload[len(exifHeader):], nil
+		}
+		pos += 2 + length
+	}
+	return nil, nil
+}
+
+// tiff is the TIFF structure of an EXIF block, offsets of IFDs and values are relative to its start
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// entry is a tag of an IFD
+type entry struct {
+	kind  uint16
+	count uint32
+	value []byte // the value or the offset of the value if it does not fit in 4 bytes
+}
+
+func newTiff(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, errors.New("TIFF header is truncated")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid byte order: %q", data[:2])
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, errors.New("invalid TIFF header")
+	}
+	return &tiff{data: data, order: order}, nil
+}
+
+// readIFD returns the entries of the IFD at offset keyed by tag
+func (t *tiff) readIFD(offset uint32) (map[uint16]entry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("IFD offset %d is out of range", offset)
+	}
+
+	count := int(t.order.Uint16(t.data[offset : offset+2]))
+	start := int(offset) + 2
+	if start+count*12 > len(t.data) {
+		return nil, fmt.Errorf("IFD at %d is truncated", offset)
+	}
+
+	entries := make(map[uint16]entry, count)
+	for i := 0; i < count; i++ {
+		raw := t.data[start+i*12 : start+(i+1)*12]
+		entries[t.order.Uint16(raw[0:2])] = entry{
+			kind:  t.order.Uint16(raw[2:4]),
+			count: t.order.Uint32(raw[4:8]),
+			value: raw[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// uint returns the first value of a SHORT or LONG entry, 0 for entries of other types
+func (t *tiff) uint(e entry) uint32 {
+	switch e.kind {
+	case typeShort:
+		return uint32(t.order.Uint16(e.value[0:2]))
+	case typeLong:
+		return t.order.Uint32(e.value)
+	}
+	return 0
+}
+
+// ascii returns the value of an ASCII entry without the trailing NULs and spaces, "" for entries
+// of other types or pointing out of range
+func (t *tiff) ascii(e entry) string {
+	if e.kind != typeASCII {
+		return ""
+	}
+
+	value := e.value[:min(e.count, 4)]
+	if e.count > 4 {
+		offset := uint64(t.order.Uint32(e.value))
+		if offset+uint64(e.count) > uint64(len(t.data)) {
+			return ""
+		}
+		value = t.data[offset : offset+uint64(e.count)]
+	}
+	return strings.TrimRight(string(value), "\x00 ")
+}
+
+// formatDateTime converts an EXIF date and time, optionally followed by its offset, e.g. "+02:00",
+// to RFC 3339. Without the offset the time is returned without zone, "" if it is invalid.
+func formatDateTime(value string) string {
+	if len(value) < len(exifDateTimeLayout) {
+		return ""
+	}
+
+	local, parseErr := time.Parse(exifDateTimeLayout, value[:len(exifDateTimeLayout)])
+	if parseErr != nil {
+		return ""
+	}
+
+	if len(value) > len(exifDateTimeLayout) {
+		withOffset, offsetErr := time.Parse(exifDateTimeLayout+"-07:00", value)
+		if offsetErr == nil {
+			return withOffset.Format(time.RFC3339)
+		}
+	}
+	return local.Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,84 @@
+package exif_test
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/exif"
+	"receipt_uploader/internal/test_utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	baseDir := "test-exif"
+	os.MkdirAll(baseDir, 0755)
+	defer os.RemoveAll(baseDir)
+
+	t.Run("succeed, capture time with offset, orientation, model and GPS", func(t *testing.T) {
+		path := filepath.Join(baseDir, "exif.jpg")
+		createErr := test_utils.CreateTestImageWithExif(path, 120, 80, "2024:05:01 10:30:00", "+02:00", "Pixel 8")
+		assert.Nil(t, createErr)
+		data, readErr := os.ReadFile(path)
+		assert.Nil(t, readErr)
+
+		result, parseErr := exif.Parse(data)
+		assert.Nil(t, parseErr)
+		assert.Equal(t, &exif.Exif{
+			CapturedAt:  "2024-05-01T10:30:00+02:00",
+			Orientation: 6,
+			Model:       "Pixel 8",
+			HasGPS:      true,
+		}, result)
+
+		config, _, decodeErr := image.DecodeConfig(bytes.NewReader(data))
+		assert.Nil(t, decodeErr)
+		assert.Equal(t, 120, config.Width)
+	})
+
+	t.Run("succeed, capture time without offset", func(t *testing.T) {
+		path := filepath.Join(baseDir, "local.jpg")
+		createErr := test_utils.CreateTestImageWithExif(path, 120, 80, "2024:05:01 10:30:00", "", "X")
+		assert.Nil(t, createErr)
+		data, readErr := os.ReadFile(path)
+		assert.Nil(t, readErr)
+
+		result, parseErr := exif.Parse(data)
+		assert.Nil(t, parseErr)
+		assert.Equal(t, "2024-05-01T10:30:00", result.CapturedAt)
+		assert.Equal(t, "X", result.Model)
+	})
+
+	t.Run("succeed, image without EXIF", func(t *testing.T) {
+		var buf bytes.Buffer
+		encodeErr := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 10, 10)), nil)
+		assert.Nil(t, encodeErr)
+
+		result, parseErr := exif.Parse(buf.Bytes())
+		assert.Nil(t, parseErr)
+		assert.Nil(t, result)
+	})
+
+	t.Run("should fail, not a JPEG image", func(t *testing.T) {
+		result, parseErr := exif.Parse([]byte("not an image"))
+		assert.NotNil(t, parseErr)
+		assert.Nil(t, result)
+	})
+
+	t.Run("should fail, truncated EXIF block", func(t *testing.T) {
+		path := filepath.Join(baseDir, "truncated.jpg")
+		createErr := test_utils.CreateTestImageWithExif(path, 120, 80, "2024:05:01 10:30:00", "+02:00", "Pixel 8")
+		assert.Nil(t, createErr)
+		data, readErr := os.ReadFile(path)
+		assert.Nil(t, readErr)
+
+		// APP1 claims to be longer than the image
+		data[4], data[5] = 0xFF, 0xFF
+		result, parseErr := exif.Parse(data[:200])
+		assert.NotNil(t, parseErr)
+		assert.Nil(t, result)
+	})
+}
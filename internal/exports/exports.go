@@ -0,0 +1,192 @@
+package exports
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/export_manifest"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Service exports the receipts of a user in config.ResizedDir/{username} as a tar.gz archive, the
+// original in config.UploadsDir is exported instead of a missing copy:
+//
+//	manifest.json
+//	receipts/{receiptId}.jpg
+//	receipts/{receiptId}_{size}.jpg
+//
+// Images are copied from storage into the archive one by one, they are never held in memory.
+type Service struct {
+	config         *configs.Config
+	storage        storage.ServiceType
+	recordsService records.ServiceType
+}
+
+func NewService(config *configs.Config, s storage.ServiceType, recordsService records.ServiceType) ServiceType {
+	return &Service{
+		config:         config,
+		storage:        s,
+		recordsService: recordsService,
+	}
+}
+
+// Manifest lists the originals of username and the resized images of the given variants. The copy
+// of an original is listed, or the original itself if the copy is missing, e.g. as it has not been
+// resized yet. A cold original is recalled once it is written. A receipt with neither of them is
+// listed as a failure.
+func (s *Service) Manifest(username string, variants []string) (*export_manifest.Manifest, error) {
+	logging.Debugf("exports.Manifest(username: %s, variants: %v)", username, variants)
+
+	objects, listErr := s.storage.List(filepath.Join(s.config.ResizedDir, username))
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List() failed, err: %w", listErr)
+	}
+
+	manifest := &export_manifest.Manifest{
+		Username:   username,
+		ExportedAt: time.Now().UTC(),
+		Variants:   variants,
+		Files:      []export_manifest.ManifestFile{},
+		Failures:   []export_manifest.ManifestFailure{},
+	}
+	copies := map[string]bool{}
+	for _, obj := range objects {
+		imageMeta, variant, parseErr := image_meta.FromResizedDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromResizedDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			continue
+		}
+		if variant != "" && !slices.Contains(variants, variant) {
+			continue
+		}
+		if variant == "" {
+			copies[imageMeta.ReceiptID] = true
+		}
+
+		manifest.Files = append(manifest.Files, export_manifest.ManifestFile{
+			ImageMeta:   *imageMeta,
+			Variant:     variant,
+			ArchivePath: path.Join(export_manifest.RECEIPTS_DIR, imageMeta.FileName),
+			Bytes:       obj.Size,
+			ModTime:     obj.ModTime,
+		})
+	}
+
+	originalsErr := s.addOriginals(manifest, copies)
+	if originalsErr != nil {
+		return nil, originalsErr
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].ArchivePath < manifest.Files[j].ArchivePath
+	})
+
+	return manifest, nil
+}
+
+// addOriginals adds the original of every receipt of manifest.Username without copy, or a failure
+// if the original is missing too
+func (s *Service) addOriginals(manifest *export_manifest.Manifest, copies map[string]bool) error {
+	receipts, listErr := s.recordsService.List(manifest.Username)
+	if listErr != nil {
+		return fmt.Errorf("s.recordsService.List() failed, err: %w", listErr)
+	}
+
+	for _, receipt := range receipts {
+		if copies[receipt.ReceiptID] {
+			continue
+		}
+		imageMeta := image_meta.FromReceiptID(manifest.Username, receipt.ReceiptID, s.config.UploadsDir)
+		info, statErr := s.storage.Stat(imageMeta.Path)
+		if statErr != nil {
+			logging.Warnf("s.storage.Stat(path: %s) failed, err: %s", imageMeta.Path, statErr.Error())
+			manifest.Failures = append(manifest.Failures, export_manifest.ManifestFailure{
+				ReceiptID: receipt.ReceiptID,
+				Error:     "original not found",
+			})
+			continue
+		}
+
+		manifest.Files = append(manifest.Files, export_manifest.ManifestFile{
+			ImageMeta:   *imageMeta,
+			ArchivePath: path.Join(export_manifest.RECEIPTS_DIR, receipt.ReceiptID+imageMeta.Extension),
+			Bytes:       info.Size,
+			ModTime:     info.ModTime,
+		})
+	}
+	return nil
+}
+
+// Write streams the archive of manifest to w, the manifest is the first entry
+func (s *Service) Write(manifest *export_manifest.Manifest, w io.Writer) error {
+	logging.Debugf("exports.Write(username: %s, files: %d)", manifest.Username, len(manifest.Files))
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	manifestBytes, marshalErr := json.MarshalIndent(manifest, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("json.MarshalIndent() failed, err: %w", marshalErr)
+	}
+	headerErr := tarWriter.WriteHeader(&tar.Header{
+		Name:    export_manifest.MANIFEST_FILE_NAME,
+		Mode:    0644,
+		Size:    int64(len(manifestBytes)),
+		ModTime: manifest.ExportedAt,
+	})
+	if headerErr != nil {
+		return fmt.Errorf("tarWriter.WriteHeader(manifest) failed, err: %w", headerErr)
+	}
+	_, writeErr := tarWriter.Write(manifestBytes)
+	if writeErr != nil {
+		return fmt.Errorf("tarWriter.Write(manifest) failed, err: %w", writeErr)
+	}
+
+	for _, file := range manifest.Files {
+		copyErr := s.writeFile(tarWriter, &file)
+		if copyErr != nil {
+			return copyErr
+		}
+	}
+
+	closeErr := tarWriter.Close()
+	if closeErr != nil {
+		return fmt.Errorf("tarWriter.Close() failed, err: %w", closeErr)
+	}
+	return gzipWriter.Close()
+}
+
+func (s *Service) writeFile(tarWriter *tar.Writer, file *export_manifest.ManifestFile) error {
+	reader, getErr := s.storage.Get(file.Path)
+	if getErr != nil {
+		return fmt.Errorf("s.storage.Get(path: %s) failed, err: %w", file.Path, getErr)
+	}
+	defer reader.Close()
+
+	headerErr := tarWriter.WriteHeader(&tar.Header{
+		Name:    file.ArchivePath,
+		Mode:    0644,
+		Size:    file.Bytes,
+		ModTime: file.ModTime,
+	})
+	if headerErr != nil {
+		return fmt.Errorf("tarWriter.WriteHeader(path: %s) failed, err: %w", file.ArchivePath, headerErr)
+	}
+
+	// the image may have been re-written since it was listed, tar requires exactly file.Bytes
+	copied, copyErr := io.CopyN(tarWriter, reader, file.Bytes)
+	if copyErr != nil {
+		return fmt.Errorf("io.CopyN(path: %s) failed, copied: %d, err: %w", file.Path, copied, copyErr)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package exports_mock
+
+import (
+	"errors"
+	"io"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/export_manifest"
+	"time"
+)
+
+type ServiceMock struct{}
+
+func (s *ServiceMock) Manifest(username string, variants []string) (*export_manifest.Manifest, error) {
+	logging.Debugf("exports_mock.Manifest(username: %s)", username)
+	if username == "mock_manifest_failed" {
+		return nil, errors.New("mock Manifest() failed")
+	}
+	return &export_manifest.Manifest{
+		Username:   username,
+		ExportedAt: time.Now().UTC(),
+		Variants:   variants,
+		Files:      []export_manifest.ManifestFile{},
+		Failures:   []export_manifest.ManifestFailure{},
+	}, nil
+}
+
+func (s *ServiceMock) Write(manifest *export_manifest.Manifest, w io.Writer) error {
+	logging.Debugf("exports_mock.Write(username: %s)", manifest.Username)
+	return nil
+}
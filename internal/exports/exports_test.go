@@ -0,0 +1,122 @@
+package exports
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/export_manifest"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExports(t *testing.T) {
+	config := &configs.Config{
+		UploadsDir: "uploads",
+		ResizedDir: "resized",
+		RecordsDir: "records",
+		Dimensions: configs.AllowedDimensions,
+	}
+	store := storage.NewMemory()
+	recordsService := records.NewService(config.RecordsDir, store)
+	service := NewService(config, store, recordsService)
+
+	for _, receiptId := range []string{"first", "second"} {
+		imageMeta := image_meta.FromReceiptID("user1", receiptId, config.UploadsDir)
+		for _, path := range image_meta.GetReceiptPaths(imageMeta, config.ResizedDir, &config.Dimensions) {
+			assert.Nil(t, store.Put(path, bytes.NewReader([]byte(path))))
+		}
+	}
+	otherMeta := image_meta.FromReceiptID("user2", "other", config.UploadsDir)
+	assert.Nil(t, store.Put(image_meta.GetResizedPath(otherMeta, "resized/user2", ""), bytes.NewReader([]byte("other"))))
+
+	t.Run("succeed, manifest of originals and chosen variants", func(t *testing.T) {
+		manifest, manifestErr := service.Manifest("user1", []string{"small"})
+		assert.Nil(t, manifestErr)
+		assert.Equal(t, "user1", manifest.Username)
+
+		archivePaths := []string{}
+		for _, file := range manifest.Files {
+			archivePaths = append(archivePaths, file.ArchivePath)
+			assert.Equal(t, "user1", file.Username)
+		}
+		assert.Equal(t, []string{
+			"receipts/first.jpg",
+			"receipts/first_small.jpg",
+			"receipts/second.jpg",
+			"receipts/second_small.jpg",
+		}, archivePaths)
+	})
+
+	t.Run("succeed, write archive", func(t *testing.T) {
+		manifest, manifestErr := service.Manifest("user1", []string{})
+		assert.Nil(t, manifestErr)
+
+		var buf bytes.Buffer
+		assert.Nil(t, service.Write(manifest, &buf))
+
+		gzipReader, gzipErr := gzip.NewReader(&buf)
+		assert.Nil(t, gzipErr)
+		tarReader := tar.NewReader(gzipReader)
+
+		header, nextErr := tarReader.Next()
+		assert.Nil(t, nextErr)
+		assert.Equal(t, export_manifest.MANIFEST_FILE_NAME, header.Name)
+		var archived export_manifest.Manifest
+		assert.Nil(t, json.NewDecoder(tarReader).Decode(&archived))
+		assert.Len(t, archived.Files, 2)
+
+		for _, file := range manifest.Files {
+			header, nextErr := tarReader.Next()
+			assert.Nil(t, nextErr)
+			assert.Equal(t, file.ArchivePath, header.Name)
+
+			content, readErr := io.ReadAll(tarReader)
+			assert.Nil(t, readErr)
+			assert.Equal(t, file.Path, string(content))
+		}
+
+		_, nextErr = tarReader.Next()
+		assert.Equal(t, io.EOF, nextErr)
+	})
+
+	t.Run("succeed, original of a receipt without copy", func(t *testing.T) {
+		pendingMeta := image_meta.FromReceiptID("user4", "pending", config.UploadsDir)
+		assert.Nil(t, store.Put(pendingMeta.Path, bytes.NewReader([]byte("pending"))))
+		for _, receiptId := range []string{"pending", "lost"} {
+			assert.Nil(t, recordsService.Put(&receipt_record.ReceiptRecord{ReceiptID: receiptId, Username: "user4"}))
+		}
+
+		manifest, manifestErr := service.Manifest("user4", []string{"small"})
+		assert.Nil(t, manifestErr)
+		assert.Len(t, manifest.Files, 1)
+		assert.Equal(t, "receipts/pending.jpg", manifest.Files[0].ArchivePath)
+		assert.Equal(t, pendingMeta.Path, manifest.Files[0].Path)
+		assert.Equal(t, int64(len("pending")), manifest.Files[0].Bytes)
+		assert.Equal(t, []export_manifest.ManifestFailure{{ReceiptID: "lost", Error: "original not found"}}, manifest.Failures)
+
+		var buf bytes.Buffer
+		assert.Nil(t, service.Write(manifest, &buf))
+	})
+
+	t.Run("succeed, empty export", func(t *testing.T) {
+		manifest, manifestErr := service.Manifest("user3", []string{})
+		assert.Nil(t, manifestErr)
+		assert.Empty(t, manifest.Files)
+	})
+
+	t.Run("should fail, image changed after listing", func(t *testing.T) {
+		manifest, manifestErr := service.Manifest("user2", []string{})
+		assert.Nil(t, manifestErr)
+		manifest.Files[0].Bytes += 10
+
+		assert.NotNil(t, service.Write(manifest, io.Discard))
+	})
+}
@@ -0,0 +1,11 @@
+package exports
+
+import (
+	"io"
+	"receipt_uploader/internal/models/export_manifest"
+)
+
+type ServiceType interface {
+	Manifest(username string, variants []string) (*export_manifest.Manifest, error)
+	Write(manifest *export_manifest.Manifest, w io.Writer) error
+}
@@ -0,0 +1,298 @@
+package gc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/storage"
+	"sort"
+	"time"
+)
+
+// receiptFiles are the files of a receipt found in config.UploadsDir and config.ResizedDir
+type receiptFiles struct {
+	username  string
+	receiptId string
+	original  *storage.ObjectInfo
+	variants  []storage.ObjectInfo
+}
+
+// Service applies the retention policies of config.Retention and config.RetentionOverrides to
+// the originals and variants of all receipts. Receipts in trash are handled by the trash purger.
+type Service struct {
+	config         *configs.Config
+	storage        storage.ServiceType
+	recordsService records.ServiceType
+	metadata       metadata.ServiceType
+	usage          quotas.UsageTracker
+	resizeQueue    resize_queue.ServiceType
+	interval       time.Duration
+}
+
+func NewService(
+	config *configs.Config,
+	s storage.ServiceType,
+	recordsService records.ServiceType,
+	metadataService metadata.ServiceType,
+	u quotas.UsageTracker,
+	resizeQueue resize_queue.ServiceType,
+) ServiceType {
+	interval := config.GCInterval
+	if interval <= 0 {
+		interval = constants.GC_INTERVAL
+	}
+
+	return &Service{
+		config:         config,
+		storage:        s,
+		recordsService: recordsService,
+		metadata:       metadataService,
+		usage:          u,
+		resizeQueue:    resizeQueue,
+		interval:       interval,
+	}
+}
+
+// Run applies the retention policies once:
+//   - variants older than the Variants retention are deleted, together with the original,
+//     otherwise the reconciler would generate them again
+//   - originals older than the Originals retention are deleted
+//   - originals whose copy and resized images all exist are deleted if DropOriginalsWithVariants is set
+//
+// A receipt without any file left is purged, its record is deleted. If dryRun is true nothing is
+// deleted, the report lists what would be deleted.
+func (s *Service) Run(now time.Time, dryRun bool) (*Report, error) {
+	logging.Infof("gc.Run(now: %s, dryRun: %t)", now.Format(time.RFC3339), dryRun)
+
+	receipts, collectErr := s.collect()
+	if collectErr != nil {
+		return nil, collectErr
+	}
+
+	report := &Report{
+		DryRun:    dryRun,
+		Deletions: []Deletion{},
+	}
+	for _, receipt := range receipts {
+		report.Scanned++
+		deletions := s.plan(receipt, now)
+		if len(deletions) == 0 {
+			continue
+		}
+
+		if !dryRun {
+			// cancel first, so that a queued or running task does not re-create variants after
+			// they are deleted
+			s.resizeQueue.Cancel(receipt.username, receipt.receiptId)
+		}
+		deleted := []Deletion{}
+		for _, deletion := range deletions {
+			if !dryRun {
+				deleteErr := s.storage.Delete(deletion.Path)
+				if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+					logging.Errorf("s.storage.Delete(path: %s) failed, err: %s", deletion.Path, deleteErr.Error())
+					report.Failed++
+					continue
+				}
+			}
+			deleted = append(deleted, deletion)
+			report.Deletions = append(report.Deletions, deletion)
+			report.FreedBytes += deletion.Size
+		}
+
+		purged := len(deleted) == countFiles(receipt)
+		if purged {
+			report.Purged++
+		}
+		if !dryRun {
+			s.release(receipt, deleted, purged)
+		}
+	}
+
+	logging.Infof(
+		"gc completed, dryRun: %t, scanned: %d, deleted: %d, purged: %d, freedBytes: %d, failed: %d",
+		dryRun, report.Scanned, len(report.Deletions), report.Purged, report.FreedBytes, report.Failed,
+	)
+	return report, nil
+}
+
+// Start applies the retention policies every config.GCInterval until stopChan is closed,
+// in dry-run mode the report is only logged
+func (s *Service) Start(stopChan <-chan struct{}) {
+	fmt.Println("starting garbage collector...")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			fmt.Println("Garbage collector stopped")
+			return
+		case <-ticker.C:
+			report, runErr := s.Run(time.Now().UTC(), s.config.GCDryRun)
+			if runErr != nil {
+				logging.Errorf("s.Run() failed, err: %s", runErr.Error())
+				continue
+			}
+			if s.config.GCDryRun {
+				data, _ := json.Marshal(report)
+				logging.Infof("gc dry-run report: %s", string(data))
+			}
+		}
+	}
+}
+
+// policy returns the retention policy of username
+func (s *Service) policy(username string) configs.RetentionPolicy {
+	if policy, ok := s.config.RetentionOverrides[username]; ok {
+		return policy
+	}
+	return s.config.Retention
+}
+
+// plan returns the files of receipt which should be deleted at now
+func (s *Service) plan(receipt *receiptFiles, now time.Time) []Deletion {
+	policy := s.policy(receipt.username)
+
+	variantsExpired := false
+	if policy.Variants > 0 {
+		for _, variant := range receipt.variants {
+			if now.Sub(variant.ModTime) >= policy.Variants {
+				variantsExpired = true
+				break
+			}
+		}
+	}
+
+	deletions := []Deletion{}
+	if receipt.original != nil {
+		reason := ""
+		switch {
+		case variantsExpired:
+			reason = REASON_EXPIRED
+		case policy.Originals > 0 && now.Sub(receipt.original.ModTime) >= policy.Originals:
+			reason = REASON_EXPIRED
+		case policy.DropOriginalsWithVariants && len(receipt.variants) == len(s.config.Dimensions)+1:
+			reason = REASON_VARIANTS_EXIST
+		}
+		if reason != "" {
+			deletions = append(deletions, s.deletion(receipt, *receipt.original, CLASS_ORIGINAL, reason))
+		}
+	}
+
+	if variantsExpired {
+		for _, variant := range receipt.variants {
+			deletions = append(deletions, s.deletion(receipt, variant, CLASS_VARIANT, REASON_EXPIRED))
+		}
+	}
+	return deletions
+}
+
+func (s *Service) deletion(receipt *receiptFiles, obj storage.ObjectInfo, class, reason string) Deletion {
+	return Deletion{
+		Path:      obj.Key,
+		Username:  receipt.username,
+		ReceiptID: receipt.receiptId,
+		Class:     class,
+		Reason:    reason,
+		Size:      obj.Size,
+	}
+}
+
+// release updates the usage of the owner of receipt and deletes its record and metadata if it has
+// been purged
+func (s *Service) release(receipt *receiptFiles, deleted []Deletion, purged bool) {
+	freed := int64(0)
+	for _, deletion := range deleted {
+		freed += deletion.Size
+	}
+	receipts := 0
+	if purged {
+		receipts = -1
+		deleteErr := s.recordsService.Delete(receipt.username, receipt.receiptId)
+		if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+			logging.Errorf("s.recordsService.Delete(receiptId: %s) failed, err: %s", receipt.receiptId, deleteErr.Error())
+		}
+		metadataErr := s.metadata.Delete(receipt.username, receipt.receiptId)
+		if metadataErr != nil && !errors.Is(metadataErr, fs.ErrNotExist) {
+			logging.Errorf("s.metadata.Delete(receiptId: %s) failed, err: %s", receipt.receiptId, metadataErr.Error())
+		}
+	}
+
+	usageErr := s.usage.AddUsage(receipt.username, -freed, receipts)
+	if usageErr != nil {
+		logging.Errorf("s.usage.AddUsage(username: %s) failed, err: %s", receipt.username, usageErr.Error())
+	}
+}
+
+// collect groups the files in config.UploadsDir and config.ResizedDir by receipt
+func (s *Service) collect() ([]*receiptFiles, error) {
+	receipts := map[string]*receiptFiles{}
+	get := func(username, receiptId string) *receiptFiles {
+		key := username + "#" + receiptId
+		receipt, ok := receipts[key]
+		if !ok {
+			receipt = &receiptFiles{username: username, receiptId: receiptId}
+			receipts[key] = receipt
+		}
+		return receipt
+	}
+
+	originals, listErr := s.storage.List(s.config.UploadsDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List(dir: %s) failed, err: %w", s.config.UploadsDir, listErr)
+	}
+	for _, obj := range originals {
+		imageMeta, parseErr := image_meta.FromUploadDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromUploadDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			continue
+		}
+		original := obj
+		get(imageMeta.Username, imageMeta.ReceiptID).original = &original
+	}
+
+	variants, listErr := s.storage.List(s.config.ResizedDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List(dir: %s) failed, err: %w", s.config.ResizedDir, listErr)
+	}
+	for _, obj := range variants {
+		imageMeta, _, parseErr := image_meta.FromResizedDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromResizedDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			continue
+		}
+		receipt := get(imageMeta.Username, imageMeta.ReceiptID)
+		receipt.variants = append(receipt.variants, obj)
+	}
+
+	sorted := make([]*receiptFiles, 0, len(receipts))
+	for _, receipt := range receipts {
+		sorted = append(sorted, receipt)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].username != sorted[j].username {
+			return sorted[i].username < sorted[j].username
+		}
+		return sorted[i].receiptId < sorted[j].receiptId
+	})
+	return sorted, nil
+}
+
+func countFiles(receipt *receiptFiles) int {
+	count := len(receipt.variants)
+	if receipt.original != nil {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,177 @@
+package gc
+
+import (
+	"bytes"
+	"os"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cancellingQueue records the receipts whose resize tasks have been cancelled
+type cancellingQueue struct {
+	resize_queue_mock.ServiceMock
+	cancelled []string
+}
+
+func (q *cancellingQueue) Cancel(username, receiptId string) bool {
+	q.cancelled = append(q.cancelled, username+"/"+receiptId)
+	return false
+}
+
+func TestGC(t *testing.T) {
+	year := 365 * 24 * time.Hour
+	var metadataService metadata.ServiceType
+	var resizeQueue *cancellingQueue
+
+	newService := func(retention configs.RetentionPolicy, overrides map[string]configs.RetentionPolicy) (ServiceType, storage.ServiceType, records.ServiceType, quotas.ServiceType) {
+		config := &configs.Config{
+			UploadsDir:         "uploads",
+			ResizedDir:         "resized",
+			RecordsDir:         "records",
+			Dimensions:         configs.AllowedDimensions,
+			Retention:          retention,
+			RetentionOverrides: overrides,
+		}
+		store := storage.NewMemory()
+		recordsService := records.NewService(config.RecordsDir, store)
+		quotasService := quotas.NewService(config, store)
+		metadataService = metadata.NewMemory()
+		resizeQueue = &cancellingQueue{}
+		return NewService(config, store, recordsService, metadataService, quotasService, resizeQueue), store, recordsService, quotasService
+	}
+
+	// createReceipt stores the original and the first `variants` files of the copy and resized images
+	createReceipt := func(t *testing.T, store storage.ServiceType, recordsService records.ServiceType, quotasService quotas.ServiceType, username, receiptId string, variants int) []string {
+		imageMeta := image_meta.FromReceiptID(username, receiptId, "uploads")
+		paths := image_meta.GetReceiptPaths(imageMeta, "resized", &configs.AllowedDimensions)[:variants+1]
+		for _, path := range paths {
+			assert.Nil(t, store.Put(path, bytes.NewReader([]byte("data"))))
+		}
+		assert.Nil(t, recordsService.Put(&receipt_record.ReceiptRecord{ReceiptID: receiptId, Username: username, Path: imageMeta.Path}))
+		assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{ReceiptID: receiptId, Username: username, Path: imageMeta.Path}))
+		assert.Nil(t, quotasService.AddUsage(username, int64(4*len(paths)), 1))
+		return paths
+	}
+
+	t.Run("succeed, keep everything by default", func(t *testing.T) {
+		service, store, recordsService, quotasService := newService(configs.RetentionPolicy{}, nil)
+		createReceipt(t, store, recordsService, quotasService, "user1", "complete", len(configs.AllowedDimensions)+1)
+
+		report, runErr := service.Run(time.Now().Add(10*year), false)
+		assert.Nil(t, runErr)
+		assert.Equal(t, 1, report.Scanned)
+		assert.Empty(t, report.Deletions)
+	})
+
+	t.Run("succeed, dry run deletes nothing", func(t *testing.T) {
+		service, store, recordsService, quotasService := newService(configs.RetentionPolicy{Variants: year}, nil)
+		paths := createReceipt(t, store, recordsService, quotasService, "user1", "expired", len(configs.AllowedDimensions)+1)
+
+		report, runErr := service.Run(time.Now().Add(2*year), true)
+		assert.Nil(t, runErr)
+		assert.True(t, report.DryRun)
+		assert.Len(t, report.Deletions, len(paths))
+		assert.Equal(t, 1, report.Purged)
+		assert.Equal(t, int64(4*len(paths)), report.FreedBytes)
+
+		for _, path := range paths {
+			_, statErr := store.Stat(path)
+			assert.Nil(t, statErr)
+		}
+		assert.Empty(t, resizeQueue.cancelled)
+	})
+
+	t.Run("succeed, expired variants purge the receipt", func(t *testing.T) {
+		service, store, recordsService, quotasService := newService(configs.RetentionPolicy{Variants: year}, nil)
+		paths := createReceipt(t, store, recordsService, quotasService, "user1", "expired", len(configs.AllowedDimensions)+1)
+
+		notExpired, runErr := service.Run(time.Now().Add(year/2), false)
+		assert.Nil(t, runErr)
+		assert.Empty(t, notExpired.Deletions)
+
+		report, runErr := service.Run(time.Now().Add(2*year), false)
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Deletions, len(paths))
+		assert.Equal(t, 1, report.Purged)
+		assert.Equal(t, []string{"user1/expired"}, resizeQueue.cancelled)
+
+		for _, path := range paths {
+			_, statErr := store.Stat(path)
+			assert.ErrorIs(t, statErr, os.ErrNotExist)
+		}
+		_, getErr := recordsService.Get("user1", "expired")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+		_, getErr = metadataService.Get("user1", "expired")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+
+		current, usageErr := quotasService.GetUsage("user1")
+		assert.Nil(t, usageErr)
+		assert.Equal(t, int64(0), current.Bytes)
+		assert.Equal(t, 0, current.Receipts)
+	})
+
+	t.Run("succeed, expired originals only", func(t *testing.T) {
+		service, store, recordsService, quotasService := newService(configs.RetentionPolicy{Originals: year}, nil)
+		paths := createReceipt(t, store, recordsService, quotasService, "user1", "expired", len(configs.AllowedDimensions)+1)
+
+		report, runErr := service.Run(time.Now().Add(2*year), false)
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Deletions, 1)
+		assert.Equal(t, CLASS_ORIGINAL, report.Deletions[0].Class)
+		assert.Equal(t, REASON_EXPIRED, report.Deletions[0].Reason)
+		assert.Equal(t, 0, report.Purged)
+
+		_, statErr := store.Stat(paths[0])
+		assert.ErrorIs(t, statErr, os.ErrNotExist)
+		_, getErr := recordsService.Get("user1", "expired")
+		assert.Nil(t, getErr)
+
+		current, usageErr := quotasService.GetUsage("user1")
+		assert.Nil(t, usageErr)
+		assert.Equal(t, int64(4*(len(paths)-1)), current.Bytes)
+		assert.Equal(t, 1, current.Receipts)
+	})
+
+	t.Run("succeed, drop originals with all variants", func(t *testing.T) {
+		service, store, recordsService, quotasService := newService(configs.RetentionPolicy{DropOriginalsWithVariants: true}, nil)
+		completePaths := createReceipt(t, store, recordsService, quotasService, "user1", "complete", len(configs.AllowedDimensions)+1)
+		partialPaths := createReceipt(t, store, recordsService, quotasService, "user1", "partial", 2)
+
+		report, runErr := service.Run(time.Now(), false)
+		assert.Nil(t, runErr)
+		assert.Equal(t, 2, report.Scanned)
+		assert.Len(t, report.Deletions, 1)
+		assert.Equal(t, completePaths[0], report.Deletions[0].Path)
+		assert.Equal(t, REASON_VARIANTS_EXIST, report.Deletions[0].Reason)
+
+		_, statErr := store.Stat(partialPaths[0])
+		assert.Nil(t, statErr)
+	})
+
+	t.Run("succeed, per-user override", func(t *testing.T) {
+		service, store, recordsService, quotasService := newService(
+			configs.RetentionPolicy{},
+			map[string]configs.RetentionPolicy{"short_lived": {Variants: year}},
+		)
+		createReceipt(t, store, recordsService, quotasService, "user1", "kept", len(configs.AllowedDimensions)+1)
+		createReceipt(t, store, recordsService, quotasService, "short_lived", "expired", len(configs.AllowedDimensions)+1)
+
+		report, runErr := service.Run(time.Now().Add(2*year), false)
+		assert.Nil(t, runErr)
+		assert.Equal(t, 1, report.Purged)
+		for _, deletion := range report.Deletions {
+			assert.Equal(t, "short_lived", deletion.Username)
+		}
+	})
+}
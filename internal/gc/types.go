@@ -0,0 +1,36 @@
+package gc
+
+import "time"
+
+const (
+	CLASS_ORIGINAL = "original" // original in config.UploadsDir
+	CLASS_VARIANT  = "variant"  // copy or resized image in config.ResizedDir
+
+	REASON_EXPIRED        = "expired"        // older than the retention of its storage class
+	REASON_VARIANTS_EXIST = "variants_exist" // original is no longer needed, all variants exist
+)
+
+type ServiceType interface {
+	Run(now time.Time, dryRun bool) (*Report, error)
+	Start(stopChan <-chan struct{})
+}
+
+// Deletion is a file removed by the garbage collector, or which would be removed in a dry run
+type Deletion struct {
+	Path      string `json:"path"`
+	Username  string `json:"username"`
+	ReceiptID string `json:"receiptId"`
+	Class     string `json:"class"`  // original, variant
+	Reason    string `json:"reason"` // expired, variants_exist
+	Size      int64  `json:"size"`
+}
+
+// Report summarizes what a garbage collection run deleted
+type Report struct {
+	DryRun     bool       `json:"dryRun"`     // true if nothing has actually been deleted
+	Scanned    int        `json:"scanned"`    // number of receipts found
+	Deletions  []Deletion `json:"deletions"`  // files deleted
+	Purged     int        `json:"purged"`     // receipts without any file left, their records are deleted as well
+	FreedBytes int64      `json:"freedBytes"` // total size of deleted files
+	Failed     int        `json:"failed"`     // files which could not be deleted
+}
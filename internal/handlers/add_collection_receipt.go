@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func AddCollectionReceipt(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodPut != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleAddCollectionReceipt(w, r, collectionsService)
+	}
+}
+
+func handleAddCollectionReceipt(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	logging.Debugf("handleAddCollectionReceipt(), path: %s", r.URL.Path)
+
+	receiptReq, parseErr := http_requests.ParseCollectionReceiptRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseCollectionReceiptRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_COLLECTION,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	// like downloads, receipts of other users are not found
+	c, addErr := collectionsService.AddReceipt(receiptReq.Username, receiptReq.CollectionId, receiptReq.ReceiptId)
+	if addErr != nil {
+		logging.Errorf("collectionsService.AddReceipt() failed, err: %s", addErr.Error())
+		sendCollectionError(w, addErr)
+		return
+	}
+
+	resp := toCollectionItem(c)
+	http_utils.SendCollectionItemResponse(w, &resp, http.StatusOK)
+}
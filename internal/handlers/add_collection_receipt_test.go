@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddCollectionReceiptHandler(t *testing.T) {
+	username := "test_user_collections"
+	metadataService := metadata.NewMemory()
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadataService)
+	c, createErr := collectionsService.Create(username, "Trip")
+	assert.Nil(t, createErr)
+	assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{ReceiptID: "receipt1", Username: username, CreatedAt: time.Now().UTC()}))
+	assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{ReceiptID: "otherreceipt", Username: "test_user_other", CreatedAt: time.Now().UTC()}))
+
+	add := func(t *testing.T, method, username, collectionId, receiptId string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, "/collections/"+collectionId+"/receipts/"+receiptId, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		AddCollectionReceipt(collectionsService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, receipt added once", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			rr := add(t, http.MethodPut, username, c.CollectionID, "receipt1")
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var resp http_responses.CollectionItem
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, []string{"receipt1"}, resp.ReceiptIDs)
+		}
+	})
+
+	t.Run("return 404, receipt of another user", func(t *testing.T) {
+		rr := add(t, http.MethodPut, username, c.CollectionID, "otherreceipt")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var resp http_responses.ErrorResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, constants.HTTP_ERR_MSG_404, resp.Error)
+	})
+
+	t.Run("return 404, collection of another user", func(t *testing.T) {
+		rr := add(t, http.MethodPut, "test_user_other", c.CollectionID, "otherreceipt")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var resp http_responses.ErrorResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, constants.HTTP_ERR_MSG_404_COLLECTION, resp.Error)
+	})
+
+	t.Run("return 400, invalid receiptId", func(t *testing.T) {
+		rr := add(t, http.MethodPut, username, c.CollectionID, "Ab-12")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := add(t, http.MethodPost, username, c.CollectionID, "receipt1")
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
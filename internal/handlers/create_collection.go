@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/collection"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func CreateCollection(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodPost != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleCreateCollection(w, r, collectionsService)
+	}
+}
+
+func handleCreateCollection(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	logging.Debugf("handleCreateCollection()")
+
+	createReq, parseErr := http_requests.ParseCreateCollectionRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseCreateCollectionRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_COLLECTION,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	c, createErr := collectionsService.Create(createReq.Username, createReq.Name)
+	if createErr != nil {
+		logging.Errorf("collectionsService.Create() failed, err: %s", createErr.Error())
+		sendCollectionError(w, createErr)
+		return
+	}
+
+	resp := toCollectionItem(c)
+	http_utils.SendCollectionItemResponse(w, &resp, http.StatusCreated)
+}
+
+// sendCollectionError responds with the status of an error returned by collections.ServiceType
+func sendCollectionError(w http.ResponseWriter, err error) {
+	resp := http_responses.ErrorResponse{
+		Error: constants.HTTP_ERR_MSG_500,
+	}
+	statusCode := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, collections.ErrInvalidName):
+		resp.Error = constants.HTTP_ERR_MSG_400_NAME
+		statusCode = http.StatusBadRequest
+	case errors.Is(err, collections.ErrNameTaken):
+		resp.Error = constants.HTTP_ERR_MSG_409_NAME
+		statusCode = http.StatusConflict
+	case errors.Is(err, collections.ErrNotFound):
+		resp.Error = constants.HTTP_ERR_MSG_404_COLLECTION
+		statusCode = http.StatusNotFound
+	case errors.Is(err, fs.ErrNotExist):
+		resp.Error = constants.HTTP_ERR_MSG_404
+		statusCode = http.StatusNotFound
+	}
+
+	http_utils.SendErrorResponse(w, &resp, statusCode)
+}
+
+func toCollectionItem(c *collection.Collection) http_responses.CollectionItem {
+	return http_responses.CollectionItem{
+		CollectionID: c.CollectionID,
+		Name:         c.Name,
+		ReceiptIDs:   c.ReceiptIDs,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+	}
+}
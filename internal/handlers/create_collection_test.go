@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCollectionHandler(t *testing.T) {
+	username := "test_user_collections"
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadata.NewMemory())
+
+	create := func(t *testing.T, method, body string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, "/collections", strings.NewReader(body))
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		CreateCollection(collectionsService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 201, collection created", func(t *testing.T) {
+		rr := create(t, http.MethodPost, `{"name": "Trip to Oslo"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var resp http_responses.CollectionItem
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.CollectionID)
+		assert.Equal(t, "Trip to Oslo", resp.Name)
+		assert.Equal(t, []string{}, resp.ReceiptIDs)
+
+		c, getErr := collectionsService.Get(username, resp.CollectionID)
+		assert.Nil(t, getErr)
+		assert.Equal(t, "Trip to Oslo", c.Name)
+	})
+
+	t.Run("return 409, name is taken", func(t *testing.T) {
+		rr := create(t, http.MethodPost, `{"name": "trip to oslo"}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		var resp http_responses.ErrorResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, constants.HTTP_ERR_MSG_409_NAME, resp.Error)
+	})
+
+	t.Run("return 400, invalid body or name", func(t *testing.T) {
+		for _, body := range []string{`{"name": ""}`, `{"name": "a", "unknown": 1}`, `not json`, `{"name": "` + strings.Repeat("a", 101) + `"}`} {
+			rr := create(t, http.MethodPost, body)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := create(t, http.MethodPut, `{"name": "Trip"}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
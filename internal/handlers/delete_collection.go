@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func DeleteCollection(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodDelete != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleDeleteCollection(w, r, collectionsService)
+	}
+}
+
+func handleDeleteCollection(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	logging.Debugf("handleDeleteCollection(), path: %s", r.URL.Path)
+
+	collectionReq, parseErr := http_requests.ParseCollectionRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseCollectionRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_COLLECTION,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	deleteErr := collectionsService.Delete(collectionReq.Username, collectionReq.CollectionId)
+	if deleteErr != nil {
+		logging.Errorf("collectionsService.Delete() failed, err: %s", deleteErr.Error())
+		sendCollectionError(w, deleteErr)
+		return
+	}
+
+	logging.Infof("collection deleted, collectionId: %s", collectionReq.CollectionId)
+	http_utils.SendDeleteResponse(w)
+}
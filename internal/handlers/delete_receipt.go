@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/trash"
+)
+
+func DeleteReceipt(
+	config *configs.Config,
+	trashService trash.ServiceType,
+	resizeQueue resize_queue.ServiceType,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodDelete != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleDelete(w, r, config, trashService, resizeQueue)
+	}
+}
+
+func handleDelete(
+	w http.ResponseWriter,
+	r *http.Request,
+	config *configs.Config,
+	trashService trash.ServiceType,
+	resizeQueue resize_queue.ServiceType,
+) {
+	logging.Debugf("handleDelete(), path: %s", r.URL.Path)
+
+	deleteReq, parseErr := http_requests.ParseDeleteRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseDeleteRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	// cancel first, so that a queued or running task does not re-create variants after deletion
+	if resizeQueue.Cancel(deleteReq.Username, deleteReq.ReceiptId) {
+		logging.Infof("cancelled resize tasks, receiptId: %s", deleteReq.ReceiptId)
+	}
+
+	imageMeta := image_meta.FromReceiptID(deleteReq.Username, deleteReq.ReceiptId, config.UploadsDir)
+	_, deleteErr := trashService.Trash(imageMeta, config.ResizedDir)
+	if deleteErr != nil {
+		logging.Errorf("trashService.Trash() failed, err: %s", deleteErr.Error())
+
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		statusCode := http.StatusInternalServerError
+
+		if errors.Is(deleteErr, os.ErrNotExist) {
+			resp = http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_404,
+			}
+			statusCode = http.StatusNotFound
+		}
+
+		http_utils.SendErrorResponse(w, &resp, statusCode)
+		return
+	}
+
+	logging.Infof("receipt has been moved to trash, receiptId: %s", deleteReq.ReceiptId)
+	http_utils.SendDeleteResponse(w)
+}
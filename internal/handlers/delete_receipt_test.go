@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/test_utils"
+	"receipt_uploader/internal/trash"
+	"receipt_uploader/internal/trash/trash_mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteReceiptHandler(t *testing.T) {
+	baseDir := "test-delete"
+	config := configs.Config{
+		ResizedDir: filepath.Join(baseDir, "resized"),
+		UploadsDir: filepath.Join(baseDir, "uploads"),
+		TrashDir:   filepath.Join(baseDir, "trash"),
+		Dimensions: configs.AllowedDimensions,
+	}
+
+	test_utils.InitTestServer(&config)
+	defer os.RemoveAll(baseDir)
+
+	store := storage.NewFileSystem("")
+	imagesService := images.NewService(&config.Dimensions, store, &quotas_mock.ServiceMock{}, nil)
+	recordsService := records.NewService("records", storage.NewMemory())
+	trashService := trash.NewService(&config, store, recordsService, metadata.NewMemory(), &quotas_mock.ServiceMock{})
+	mockResizeQueue := &resize_queue_mock.ServiceMock{}
+
+	t.Run("return 204, original and all variants moved to trash", func(t *testing.T) {
+		username := "test_user_delete"
+		receiptId := "deletereceiptid"
+		paths := createTestReceipt(t, &config, recordsService, username, receiptId)
+
+		req, reqErr := http.NewRequest(http.MethodDelete, "/receipts/"+receiptId, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		handler := DeleteReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		for _, path := range paths {
+			_, statErr := os.Stat(path)
+			assert.ErrorIs(t, statErr, os.ErrNotExist)
+		}
+
+		_, recordErr := recordsService.Get(username, receiptId)
+		assert.ErrorIs(t, recordErr, os.ErrNotExist)
+
+		entries, listErr := trashService.List(username)
+		assert.Nil(t, listErr)
+		assert.Len(t, entries, 1)
+
+		getReq, getReqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId+"?size=small", nil)
+		assert.Nil(t, getReqErr)
+		getReq.Header.Set("username_token", username)
+
+		getRR := httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksums.NewService(&config, store), metadata.NewMemory()).ServeHTTP(getRR, getReq)
+		assert.Equal(t, http.StatusNotFound, getRR.Code)
+	})
+
+	t.Run("return 404, receipt of another user", func(t *testing.T) {
+		owner := "test_user_owner"
+		receiptId := "ownerreceiptid"
+		paths := createTestReceipt(t, &config, recordsService, owner, receiptId)
+
+		req, reqErr := http.NewRequest(http.MethodDelete, "/receipts/"+receiptId, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "test_user_other")
+
+		rr := httptest.NewRecorder()
+		handler := DeleteReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		for _, path := range paths {
+			_, statErr := os.Stat(path)
+			assert.Nil(t, statErr)
+		}
+	})
+
+	t.Run("return 404, not found by receiptId", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodDelete, "/receipts/notfound", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "test_user_delete")
+
+		rr := httptest.NewRecorder()
+		handler := DeleteReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 400, invalid receiptId, receiptId=Ab1234", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodDelete, "/receipts/Ab1234", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := DeleteReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, not allowed method", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPut, "/receipts/1234", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := DeleteReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("return 500, Trash() failed", func(t *testing.T) {
+		mockTrashService := trash_mock.ServiceMock{}
+		url := fmt.Sprintf("/receipts/%s", "mocktrashfailed")
+
+		req, reqErr := http.NewRequest(http.MethodDelete, url, nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := DeleteReceipt(&config, &mockTrashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+// createTestReceipt creates the original, its copy and all variants of a receipt on disk
+func createTestReceipt(t *testing.T, config *configs.Config, recordsService records.ServiceType, username, receiptId string) []string {
+	os.MkdirAll(config.UploadsDir, 0755)
+	os.MkdirAll(filepath.Join(config.ResizedDir, username), 0755)
+
+	paths := []string{
+		filepath.Join(config.UploadsDir, username+"#"+receiptId+".jpg"),
+		filepath.Join(config.ResizedDir, username, receiptId+".jpg"),
+	}
+	for _, d := range config.Dimensions {
+		paths = append(paths, filepath.Join(config.ResizedDir, username, receiptId+"_"+d.Name+".jpg"))
+	}
+	for _, path := range paths {
+		createErr := test_utils.CreateTestImageJPG(path, 10, 10)
+		assert.Nil(t, createErr)
+	}
+
+	putErr := recordsService.Put(&receipt_record.ReceiptRecord{
+		ReceiptID:   receiptId,
+		Username:    username,
+		ContentHash: receiptId,
+	})
+	assert.Nil(t, putErr)
+	return paths
+}
@@ -1,19 +1,28 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"os"
+	"receipt_uploader/internal/checksums"
 	"receipt_uploader/internal/constants"
 	"receipt_uploader/internal/http_utils"
 	"receipt_uploader/internal/images"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/http_requests"
 	"receipt_uploader/internal/models/http_responses"
 	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
 )
 
-func DownloadReceipt(config *configs.Config, imagesService images.ServiceType) http.HandlerFunc {
+func DownloadReceipt(
+	config *configs.Config,
+	imagesService images.ServiceType,
+	checksumsService checksums.ServiceType,
+	metadataService metadata.ServiceType,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
 
@@ -25,11 +34,18 @@ func DownloadReceipt(config *configs.Config, imagesService images.ServiceType) h
 			return
 		}
 
-		handleGet(w, r, config, imagesService)
+		handleGet(w, r, config, imagesService, checksumsService, metadataService)
 	}
 }
 
-func handleGet(w http.ResponseWriter, r *http.Request, config *configs.Config, imagesService images.ServiceType) {
+func handleGet(
+	w http.ResponseWriter,
+	r *http.Request,
+	config *configs.Config,
+	imagesService images.ServiceType,
+	checksumsService checksums.ServiceType,
+	metadataService metadata.ServiceType,
+) {
 	logging.Debugf("handleGet(), path: %s", r.URL.Path)
 
 	downloadReq, parseErr := http_requests.ParseDownloadRequest(r, &config.Dimensions)
@@ -42,8 +58,32 @@ func handleGet(w http.ResponseWriter, r *http.Request, config *configs.Config, i
 		return
 	}
 
+	receiptMetadata, metadataErr := metadataService.Get(downloadReq.Username, downloadReq.ReceiptId)
+	if metadataErr != nil && !errors.Is(metadataErr, os.ErrNotExist) {
+		logging.Errorf("metadataService.Get() failed, err: %s", metadataErr.Error())
+	}
+
 	imageMeta := image_meta.FromGetRequset(downloadReq.ReceiptId, downloadReq.Size, downloadReq.Username, config.ResizedDir)
-	fileBytes, fileName, getErr := imagesService.GetImage(imageMeta)
+	reader, size, getErr := imagesService.GetImage(imageMeta)
+	servesOriginal := false
+	if errors.Is(getErr, os.ErrNotExist) && downloadReq.Size == "" {
+		// the copy is gone, e.g. not generated yet, the original is served and recalled from cold storage if needed
+		original := image_meta.FromReceiptID(downloadReq.Username, downloadReq.ReceiptId, config.UploadsDir)
+		reader, size, getErr = imagesService.GetImage(original)
+		imageMeta.Path = original.Path
+		servesOriginal = true
+	}
+	if errors.Is(getErr, os.ErrNotExist) && receiptMetadata != nil && downloadReq.Size != "" {
+		variant := receiptMetadata.Variants[downloadReq.Size]
+		if variant.IsPending() || variant.Status == constants.VARIANT_STATUS_FAILED {
+			logging.Infof("image not generated, receiptId: %s, size: %s, status: %s", downloadReq.ReceiptId, downloadReq.Size, variant.Status)
+			http_utils.SendPendingDownloadResponse(w, &http_responses.PendingDownloadResponse{
+				ReceiptID:     downloadReq.ReceiptId,
+				VariantStatus: toVariantStatus(downloadReq.Size, variant),
+			})
+			return
+		}
+	}
 	if getErr != nil {
 		logging.Errorf("images.GetImage() failed, err: %s", getErr.Error())
 
@@ -52,7 +92,7 @@ func handleGet(w http.ResponseWriter, r *http.Request, config *configs.Config, i
 		}
 		statusCode := http.StatusInternalServerError
 
-		if os.IsNotExist(getErr) {
+		if errors.Is(getErr, os.ErrNotExist) {
 			resp = http_responses.ErrorResponse{
 				Error: constants.HTTP_ERR_MSG_404,
 			}
@@ -62,7 +102,46 @@ func handleGet(w http.ResponseWriter, r *http.Request, config *configs.Config, i
 		http_utils.SendErrorResponse(w, &resp, statusCode)
 		return
 	}
+	defer reader.Close()
+
+	checksum := getChecksum(checksumsService, receiptMetadata, downloadReq.Size, servesOriginal, imageMeta.Path)
+	if http_utils.MatchesIfNoneMatch(r.Header.Get("If-None-Match"), checksum) {
+		logging.Infof("image not modified: %s", imageMeta.FileName)
+		http_utils.SendNotModifiedResponse(w, checksum)
+		return
+	}
 
 	logging.Infof("response with image: %s", imageMeta.FileName)
-	http_utils.SendGetImageResponse(w, fileName, &fileBytes)
+	http_utils.SendGetImageResponse(w, imageMeta.FileName, reader, size, checksum)
+}
+
+// getChecksum returns the checksum recorded when the image was written, so a client can detect
+// a corrupted download. It is looked up in the metadata of the receipt first, then in the checksums
+// of storage, the image itself is not read. It is empty for images written before checksums were
+// recorded, they are sent without ETag.
+func getChecksum(
+	checksumsService checksums.ServiceType,
+	receiptMetadata *receipt_metadata.ReceiptMetadata,
+	size string,
+	servesOriginal bool,
+	path string,
+) string {
+	if receiptMetadata != nil {
+		if servesOriginal {
+			return receiptMetadata.Checksum
+		}
+		variant := receiptMetadata.Variants[receipt_metadata.VariantName(size)]
+		if variant.Status == constants.VARIANT_STATUS_READY && variant.Checksum != "" {
+			return variant.Checksum
+		}
+	}
+
+	checksum, checksumErr := checksumsService.Checksum(path)
+	if checksumErr == nil {
+		return checksum
+	}
+	if !errors.Is(checksumErr, os.ErrNotExist) {
+		logging.Errorf("checksumsService.Checksum(path: %s) failed, err: %s", path, checksumErr.Error())
+	}
+	return ""
 }
@@ -1,15 +1,28 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/constants"
 	"receipt_uploader/internal/images"
 	images_mock "receipt_uploader/internal/images/mock"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/storage"
 	"receipt_uploader/internal/test_utils"
 	"testing"
 
@@ -19,15 +32,17 @@ import (
 func TestDownloadReceiptHandler(t *testing.T) {
 	baseDir := "test-get"
 	config := configs.Config{
-		ResizedDir: filepath.Join(baseDir, "resized"),
-		UploadsDir: filepath.Join(baseDir, "uploads"),
-		Dimensions: configs.AllowedDimensions,
+		ResizedDir:   filepath.Join(baseDir, "resized"),
+		UploadsDir:   filepath.Join(baseDir, "uploads"),
+		ChecksumsDir: filepath.Join(baseDir, "checksums"),
+		Dimensions:   configs.AllowedDimensions,
 	}
 
 	test_utils.InitTestServer(&config)
 	defer os.RemoveAll(baseDir)
 
-	imagesService := images.NewService(&config.Dimensions)
+	checksumsService := checksums.NewService(&config, storage.NewFileSystem(""))
+	imagesService := images.NewService(&config.Dimensions, checksumsService, &quotas_mock.ServiceMock{}, nil)
 	t.Run("return 200, size=small", func(t *testing.T) {
 		username := "test-user-get"
 		receiptId := "testrecieptid"
@@ -49,12 +64,17 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		req.Header.Set("username_token", username)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&config, imagesService)
+		handler := DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
 		status := rr.Code
 		assert.Equal(t, http.StatusOK, status)
+		written, readErr := os.ReadFile(fPath)
+		assert.Nil(t, readErr)
+		assert.Equal(t, written, rr.Body.Bytes())
+		// written without checksum, it is not computed from the image
+		assert.Empty(t, rr.Header().Get("ETag"))
 	})
 
 	t.Run("return 200, size is empty", func(t *testing.T) {
@@ -77,7 +97,7 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		req.Header.Set("username_token", username)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&config, imagesService)
+		handler := DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
@@ -96,6 +116,157 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, status1)
 	})
 
+	t.Run("return 200, ETag and Digest of recorded checksum", func(t *testing.T) {
+		username := "test-user-checksum"
+		receiptId := "checksumreceiptid"
+		path := filepath.Join(config.ResizedDir, username, receiptId+"_small.jpg")
+		payload := []byte("checksum payload")
+		putErr := checksumsService.Put(path, bytes.NewReader(payload))
+		assert.Nil(t, putErr)
+
+		sum := sha256.Sum256(payload)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId+"?size=small", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory()).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+		assert.Equal(t, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]), rr.Header().Get("Digest"))
+
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory()).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.Bytes())
+	})
+
+	t.Run("return 200, Digest of recorded checksum for corrupted image", func(t *testing.T) {
+		username := "test-user-checksum"
+		receiptId := "corruptedreceiptid"
+		path := filepath.Join(config.ResizedDir, username, receiptId+"_small.jpg")
+		payload := []byte("original payload")
+		putErr := checksumsService.Put(path, bytes.NewReader(payload))
+		assert.Nil(t, putErr)
+		writeErr := os.WriteFile(path, []byte("corrupted payload"), 0644)
+		assert.Nil(t, writeErr)
+
+		sum := sha256.Sum256(payload)
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId+"?size=small", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory()).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]), rr.Header().Get("Digest"))
+		assert.Equal(t, "corrupted payload", rr.Body.String())
+	})
+
+	t.Run("return 200, ETag of checksum in metadata", func(t *testing.T) {
+		username := "test-user-metadata"
+		receiptId := "metadatareceiptid"
+		path := filepath.Join(config.ResizedDir, username, receiptId+"_small.jpg")
+		putErr := checksumsService.Put(path, bytes.NewReader([]byte("metadata payload")))
+		assert.Nil(t, putErr)
+
+		sum := sha256.Sum256([]byte("payload in metadata"))
+		checksum := hex.EncodeToString(sum[:])
+		metadataService := metadata.NewMemory()
+		putErr = metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID: receiptId,
+			Username:  username,
+			Variants: map[string]receipt_metadata.Variant{
+				"small": {Status: constants.VARIANT_STATUS_READY, Checksum: checksum},
+			},
+		})
+		assert.Nil(t, putErr)
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId+"?size=small", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksumsService, metadataService).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"`+checksum+`"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("return 200, original served without copy", func(t *testing.T) {
+		username := "test-user-original"
+		receiptId := "originalreceiptid"
+		fPath := image_meta.FromReceiptID(username, receiptId, config.UploadsDir).Path
+		os.MkdirAll(config.UploadsDir, 0755)
+		createErr := test_utils.CreateTestImageJPG(fPath, 300, 300)
+		assert.Nil(t, createErr)
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory()).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Header().Get("Content-Disposition"), receiptId+".jpg")
+	})
+
+	t.Run("return 202 and 409, image not generated yet or failed", func(t *testing.T) {
+		username := "test-user-pending"
+		receiptId := "pendingreceiptid"
+		metadataService := metadata.NewMemory()
+		putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID: receiptId,
+			Username:  username,
+			Variants: map[string]receipt_metadata.Variant{
+				"small": {Status: constants.VARIANT_STATUS_PROCESSING},
+				"large": {Status: constants.VARIANT_STATUS_FAILED, ErrorCategory: constants.RESIZE_ERR_TIMEOUT},
+			},
+		})
+		assert.Nil(t, putErr)
+
+		tests := []struct {
+			size   string
+			code   int
+			status string
+		}{
+			{"small", http.StatusAccepted, constants.VARIANT_STATUS_PROCESSING},
+			{"large", http.StatusConflict, constants.VARIANT_STATUS_FAILED},
+		}
+		for _, tc := range tests {
+			req, reqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId+"?size="+tc.size, nil)
+			assert.Nil(t, reqErr)
+			req.Header.Set("username_token", username)
+
+			rr := httptest.NewRecorder()
+			DownloadReceipt(&config, imagesService, checksumsService, metadataService).ServeHTTP(rr, req)
+			assert.Equal(t, tc.code, rr.Code, tc.size)
+
+			var resp http_responses.PendingDownloadResponse
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, receiptId, resp.ReceiptID)
+			assert.Equal(t, tc.size, resp.Size)
+			assert.Equal(t, tc.status, resp.Status)
+		}
+
+		// a receipt of another user is not found
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/"+receiptId+"?size=small", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "test-user-other")
+
+		rr := httptest.NewRecorder()
+		DownloadReceipt(&config, imagesService, checksumsService, metadataService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
 	t.Run("return 404, not found by receiptId", func(t *testing.T) {
 		receiptId := "notfound"
 		size := "medium"
@@ -105,7 +276,7 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&config, imagesService)
+		handler := DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
@@ -122,7 +293,7 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&config, imagesService)
+		handler := DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
@@ -139,7 +310,7 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&config, imagesService)
+		handler := DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
@@ -156,7 +327,7 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&config, imagesService)
+		handler := DownloadReceipt(&config, imagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
@@ -179,7 +350,7 @@ func TestDownloadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := DownloadReceipt(&mockConfig, &mockImagesService)
+		handler := DownloadReceipt(&mockConfig, &mockImagesService, checksumsService, metadata.NewMemory())
 
 		handler.ServeHTTP(rr, req)
 
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/exports"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func ExportReceipts(config *configs.Config, exportsService exports.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleExport(w, r, config, exportsService)
+	}
+}
+
+func handleExport(w http.ResponseWriter, r *http.Request, config *configs.Config, exportsService exports.ServiceType) {
+	logging.Debugf("handleExport(), query: %s", r.URL.RawQuery)
+
+	exportReq, parseErr := http_requests.ParseExportRequest(r, &config.Dimensions)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseExportRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_QUERY,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	manifest, manifestErr := exportsService.Manifest(exportReq.Username, exportReq.Sizes)
+	if manifestErr != nil {
+		logging.Errorf("exportsService.Manifest() failed, err: %s", manifestErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	fileName := fmt.Sprintf("receipts_%s.tar.gz", manifest.ExportedAt.Format("20060102"))
+	http_utils.WriteExportHeaders(w, fileName)
+
+	writeErr := exportsService.Write(manifest, w)
+	if writeErr != nil {
+		// status has been sent already, the truncated archive tells the client the export failed
+		logging.Errorf("exportsService.Write() failed, err: %s", writeErr.Error())
+		return
+	}
+	logging.Infof("exported %d files, username: %s", len(manifest.Files), exportReq.Username)
+}
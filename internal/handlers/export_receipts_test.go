@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/exports"
+	"receipt_uploader/internal/exports/exports_mock"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/export_manifest"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportReceiptsHandler(t *testing.T) {
+	config := configs.Config{
+		ResizedDir: "resized",
+		UploadsDir: "uploads",
+		RecordsDir: "records",
+		Dimensions: configs.AllowedDimensions,
+	}
+	store := storage.NewMemory()
+	exportsService := exports.NewService(&config, store, records.NewService(config.RecordsDir, store))
+
+	t.Run("return 200, tar.gz archive of the user", func(t *testing.T) {
+		username := "test_user_export"
+		imageMeta := image_meta.FromReceiptID(username, "123456", config.UploadsDir)
+		for _, path := range image_meta.GetReceiptPaths(imageMeta, config.ResizedDir, &config.Dimensions) {
+			assert.Nil(t, store.Put(path, bytes.NewReader([]byte(path))))
+		}
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/export?sizes=medium", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		ExportReceipts(&config, exportsService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/gzip", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Header().Get("Content-Disposition"), ".tar.gz")
+
+		gzipReader, gzipErr := gzip.NewReader(rr.Body)
+		assert.Nil(t, gzipErr)
+		tarReader := tar.NewReader(gzipReader)
+		names := []string{}
+		for {
+			header, nextErr := tarReader.Next()
+			if nextErr != nil {
+				break
+			}
+			names = append(names, header.Name)
+		}
+		assert.Equal(t, []string{
+			export_manifest.MANIFEST_FILE_NAME,
+			"receipts/123456.jpg",
+			"receipts/123456_medium.jpg",
+		}, names)
+	})
+
+	t.Run("return 400, invalid sizes", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/export?sizes=huge", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		ExportReceipts(&config, exportsService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, not allowed method", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/export", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		ExportReceipts(&config, exportsService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("return 500, Manifest() failed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/export", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "mock_manifest_failed")
+
+		rr := httptest.NewRecorder()
+		ExportReceipts(&config, &exports_mock.ServiceMock{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
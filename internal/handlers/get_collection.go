@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func GetCollection(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleGetCollection(w, r, collectionsService)
+	}
+}
+
+func handleGetCollection(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	logging.Debugf("handleGetCollection(), path: %s", r.URL.Path)
+
+	collectionReq, parseErr := http_requests.ParseCollectionRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseCollectionRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_COLLECTION,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	c, getErr := collectionsService.Get(collectionReq.Username, collectionReq.CollectionId)
+	if getErr != nil {
+		logging.Errorf("collectionsService.Get() failed, err: %s", getErr.Error())
+		sendCollectionError(w, getErr)
+		return
+	}
+
+	receipts, receiptsErr := collectionsService.Receipts(collectionReq.Username, collectionReq.CollectionId)
+	if receiptsErr != nil {
+		logging.Errorf("collectionsService.Receipts() failed, err: %s", receiptsErr.Error())
+		sendCollectionError(w, receiptsErr)
+		return
+	}
+
+	resp := http_responses.CollectionResponse{
+		CollectionItem: toCollectionItem(c),
+		Receipts:       len(receipts),
+		Totals:         collections.Totals(receipts),
+	}
+	for _, m := range receipts {
+		if m.Annotations.Amount == nil {
+			resp.WithoutAmount++
+		}
+	}
+	http_utils.SendCollectionResponse(w, &resp)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/collection"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCollectionHandler(t *testing.T) {
+	username := "test_user_collections"
+	metadataService := metadata.NewMemory()
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadataService)
+
+	c, createErr := collectionsService.Create(username, "Trip")
+	assert.Nil(t, createErr)
+	for receiptId, amount := range map[string]*receipt_metadata.Amount{
+		"receipt1": {Value: "12.50", Currency: "EUR"},
+		"receipt2": {Value: "7.5", Currency: "EUR"},
+		"receipt3": nil,
+	} {
+		putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID:   receiptId,
+			Username:    username,
+			CreatedAt:   time.Now().UTC(),
+			Annotations: receipt_metadata.Annotations{Amount: amount},
+		})
+		assert.Nil(t, putErr)
+		_, addErr := collectionsService.AddReceipt(username, c.CollectionID, receiptId)
+		assert.Nil(t, addErr)
+	}
+
+	get := func(t *testing.T, method, username, collectionId string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, "/collections/"+collectionId, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		GetCollection(collectionsService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, collection with totals", func(t *testing.T) {
+		rr := get(t, http.MethodGet, username, c.CollectionID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.CollectionResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "Trip", resp.Name)
+		assert.Len(t, resp.ReceiptIDs, 3)
+		assert.Equal(t, 3, resp.Receipts)
+		assert.Equal(t, 1, resp.WithoutAmount)
+		assert.Equal(t, []collection.Total{{Currency: "EUR", Value: "20.00", Receipts: 2}}, resp.Totals)
+	})
+
+	t.Run("return 404, collection of another user", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "test_user_other", c.CollectionID)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var resp http_responses.ErrorResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, constants.HTTP_ERR_MSG_404_COLLECTION, resp.Error)
+	})
+
+	t.Run("return 400, invalid collectionId", func(t *testing.T) {
+		rr := get(t, http.MethodGet, username, "Ab-12")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := get(t, http.MethodPost, username, c.CollectionID)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
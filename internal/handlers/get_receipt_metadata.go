@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func GetReceiptMetadata(config *configs.Config, metadataService metadata.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleGetMetadata(w, r, config, metadataService)
+	}
+}
+
+func handleGetMetadata(w http.ResponseWriter, r *http.Request, config *configs.Config, metadataService metadata.ServiceType) {
+	logging.Debugf("handleGetMetadata(), path: %s", r.URL.Path)
+
+	metaReq, parseErr := http_requests.ParseMetadataRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseMetadataRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	receiptMetadata, getErr := metadataService.Get(metaReq.Username, metaReq.ReceiptId)
+	if getErr != nil {
+		logging.Errorf("metadataService.Get() failed, err: %s", getErr.Error())
+
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		statusCode := http.StatusInternalServerError
+
+		if errors.Is(getErr, os.ErrNotExist) {
+			resp = http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_404,
+			}
+			statusCode = http.StatusNotFound
+		}
+
+		http_utils.SendErrorResponse(w, &resp, statusCode)
+		return
+	}
+
+	resp := toReceiptItem(receiptMetadata, &config.Dimensions)
+	http_utils.SendReceiptMetadataResponse(w, &resp)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/exif"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReceiptMetadataHandler(t *testing.T) {
+	config := configs.Config{
+		Dimensions: configs.AllowedDimensions,
+	}
+	username := "test_user_meta"
+
+	metadataService := metadata.NewMemory()
+	putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+		ReceiptID: "metareceiptid",
+		Username:  username,
+		CreatedAt: time.Now().UTC(),
+		Width:     1000,
+		Height:    1200,
+		Size:      2048,
+		Variants: map[string]receipt_metadata.Variant{
+			constants.VARIANT_ORIGINAL: {Status: constants.VARIANT_STATUS_READY},
+			"small":                    {Status: constants.VARIANT_STATUS_READY, Width: 100, Height: 120, Size: 512},
+		},
+		Exif:        &exif.Exif{CapturedAt: "2024-05-01T10:30:00", Orientation: 1, Model: "Pixel 8"},
+		Annotations: receipt_metadata.Annotations{Merchant: "Cafe Aalto", Tags: []string{"travel"}},
+		Revision:    3,
+		Tier:        constants.TIER_COLD,
+	})
+	assert.Nil(t, putErr)
+
+	get := func(t *testing.T, method, url, username string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, url, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		GetReceiptMetadata(&config, metadataService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, metadata and annotations of the receipt", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "/receipts/metareceiptid/meta", username)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+
+		var resp http_responses.ReceiptItem
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "metareceiptid", resp.ReceiptID)
+		assert.Equal(t, "Cafe Aalto", resp.Annotations.Merchant)
+		assert.Equal(t, []string{"travel"}, resp.Annotations.Tags)
+		assert.Equal(t, `"3"`, resp.ETag)
+		assert.Equal(t, constants.TIER_COLD, resp.Tier)
+		assert.Len(t, resp.Sizes, 2)
+		assert.Equal(t, 1000, resp.Sizes[0].Width)
+		assert.Equal(t, int64(2048), resp.Sizes[0].Bytes)
+		assert.Equal(t, int64(512), resp.Sizes[1].Bytes)
+		assert.Equal(t, "2024-05-01T10:30:00", resp.Exif.CapturedAt)
+		assert.Equal(t, "Pixel 8", resp.Exif.Model)
+		assert.False(t, resp.Exif.HasGPS)
+	})
+
+	t.Run("return 404, receipt of another user", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "/receipts/metareceiptid/meta", "test_user_other")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 400, invalid receiptId", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "/receipts/Ab1234/meta", username)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := get(t, http.MethodPost, "/receipts/metareceiptid/meta", username)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/quotas"
+)
+
+func GetUsage(config *configs.Config, quotasService quotas.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleGetUsage(w, r, quotasService)
+	}
+}
+
+func handleGetUsage(w http.ResponseWriter, r *http.Request, quotasService quotas.ServiceType) {
+	username := r.Header.Get("username_token")
+	logging.Debugf("handleGetUsage(), username: %s", username)
+
+	current, getErr := quotasService.GetUsage(username)
+	if getErr != nil {
+		logging.Errorf("quotasService.GetUsage() failed, err: %s", getErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	quota := quotasService.GetQuota(username)
+	resp := http_responses.UsageResponse{
+		UsedBytes:    current.Bytes,
+		UsedReceipts: current.Receipts,
+		MaxBytes:     quota.MaxBytes,
+		MaxReceipts:  quota.MaxReceipts,
+	}
+	http_utils.SendUsageResponse(w, &resp)
+}
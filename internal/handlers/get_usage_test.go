@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUsageHandler(t *testing.T) {
+	config := configs.Config{
+		RecordsDir: "records",
+		Quota: configs.Quota{
+			MaxBytes:    2048,
+			MaxReceipts: 10,
+		},
+	}
+	quotasService := quotas.NewService(&config, storage.NewMemory())
+
+	t.Run("return 200, usage and quota of the user", func(t *testing.T) {
+		username := "test_user_usage"
+		assert.Nil(t, quotasService.AddUsage(username, 1024, 1))
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/usage", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		GetUsage(&config, quotasService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.UsageResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, http_responses.UsageResponse{
+			UsedBytes:    1024,
+			UsedReceipts: 1,
+			MaxBytes:     2048,
+			MaxReceipts:  10,
+		}, resp)
+	})
+
+	t.Run("return 405, not allowed method", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/usage", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		GetUsage(&config, quotasService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("return 500, GetUsage() failed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/usage", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "mock_get_usage_failed")
+
+		rr := httptest.NewRecorder()
+		GetUsage(&config, &quotas_mock.ServiceMock{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/resize_queue"
+)
+
+func GetWorkerMetrics(resizeQueue resize_queue.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := http_responses.WorkerMetricsResponse{
+			Workers: resizeQueue.Metrics(),
+		}
+		http_utils.SendWorkerMetricsResponse(w, &resp)
+	}
+}
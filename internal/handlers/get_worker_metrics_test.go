@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWorkerMetricsHandler(t *testing.T) {
+	resizeQueue := &resize_queue_mock.ServiceMock{}
+
+	t.Run("return 200, metrics of every worker", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/admin/workers", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		GetWorkerMetrics(resizeQueue).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.WorkerMetricsResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Len(t, resp.Workers, 2)
+		assert.Equal(t, int64(3), resp.Workers[0].TasksCompleted)
+		assert.Equal(t, int64(1), resp.Workers[0].TasksFailed)
+		assert.Equal(t, int64(800), resp.Workers[1].BusyMs)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/admin/workers", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		GetWorkerMetrics(resizeQueue).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/imports"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func ImportReceipts(config *configs.Config, importsService imports.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodPost != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleImport(w, r, importsService)
+	}
+}
+
+func handleImport(w http.ResponseWriter, r *http.Request, importsService imports.ServiceType) {
+	username := r.Header.Get("username_token")
+	logging.Debugf("handleImport(), username: %s", username)
+
+	if len(r.URL.Query()) > 0 {
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_QUERY,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, constants.MAX_IMPORT_SIZE)
+	report, importErr := importsService.ImportArchive(username, body)
+	if importErr != nil {
+		logging.Errorf("importsService.ImportArchive() failed, err: %s", importErr.Error())
+
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		statusCode := http.StatusInternalServerError
+
+		// files before the broken part have been imported, retrying reports them as duplicates
+		if errors.Is(importErr, imports.ErrInvalidArchive) {
+			resp = http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_400_ARCHIVE,
+			}
+			statusCode = http.StatusBadRequest
+		}
+
+		http_utils.SendErrorResponse(w, &resp, statusCode)
+		return
+	}
+
+	http_utils.SendImportResponse(w, report)
+}
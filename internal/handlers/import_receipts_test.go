@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/imports"
+	"receipt_uploader/internal/imports/imports_mock"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/import_report"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/test_utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportReceiptsHandler(t *testing.T) {
+	config := configs.Config{
+		ResizedDir: "resized",
+		UploadsDir: "uploads",
+		RecordsDir: "records",
+		Dimensions: configs.AllowedDimensions,
+	}
+	store := storage.NewMemory()
+	imagesService := images.NewService(&config.Dimensions, store, &quotas_mock.ServiceMock{}, nil)
+	recordsService := records.NewService(config.RecordsDir, store)
+	importsService := imports.NewService(&config, store, imagesService, recordsService, metadata.NewMemory(), &quotas_mock.ServiceMock{}, &resize_queue_mock.ServiceMock{})
+
+	t.Run("return 200, report of imported files", func(t *testing.T) {
+		fileName := "test_image_import.jpg"
+		createErr := test_utils.CreateTestImageJPG(fileName, 800, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+		data, readErr := os.ReadFile(fileName)
+		assert.Nil(t, readErr)
+
+		var archive bytes.Buffer
+		gzipWriter := gzip.NewWriter(&archive)
+		tarWriter := tar.NewWriter(gzipWriter)
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Name: fileName, Mode: 0644, Size: int64(len(data))}))
+		_, writeErr := tarWriter.Write(data)
+		assert.Nil(t, writeErr)
+		assert.Nil(t, tarWriter.Close())
+		assert.Nil(t, gzipWriter.Close())
+
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/import", &archive)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "test_user_import")
+
+		rr := httptest.NewRecorder()
+		ImportReceipts(&config, importsService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var report import_report.Report
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 1, report.Imported)
+		assert.Equal(t, fileName, report.Files[0].Name)
+		assert.NotEmpty(t, report.Files[0].ReceiptID)
+	})
+
+	t.Run("return 400, invalid archive", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/import", bytes.NewReader([]byte("receipts")))
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "mock_invalid_archive")
+
+		rr := httptest.NewRecorder()
+		ImportReceipts(&config, &imports_mock.ServiceMock{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 400, query parameter", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/import?dir=/etc", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		ImportReceipts(&config, &imports_mock.ServiceMock{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, not allowed method", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/import", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		ImportReceipts(&config, importsService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("return 500, ImportArchive() failed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/import", bytes.NewReader([]byte("receipts")))
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "mock_import_failed")
+
+		rr := httptest.NewRecorder()
+		ImportReceipts(&config, &imports_mock.ServiceMock{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func ListCollectionReceipts(config *configs.Config, collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleListCollectionReceipts(w, r, config, collectionsService)
+	}
+}
+
+func handleListCollectionReceipts(w http.ResponseWriter, r *http.Request, config *configs.Config, collectionsService collections.ServiceType) {
+	logging.Debugf("handleListCollectionReceipts(), path: %s", r.URL.Path)
+
+	receiptsReq, parseErr := http_requests.ParseCollectionReceiptsRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseCollectionReceiptsRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_QUERY,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	receipts, receiptsErr := collectionsService.Receipts(receiptsReq.Username, receiptsReq.CollectionId)
+	if receiptsErr != nil {
+		logging.Errorf("collectionsService.Receipts() failed, err: %s", receiptsErr.Error())
+		sendCollectionError(w, receiptsErr)
+		return
+	}
+
+	page, next := paginate(receipts, &receiptsReq.ListRequest)
+	resp := http_responses.ReceiptListResponse{
+		Items: []http_responses.ReceiptItem{},
+	}
+	for i := range page {
+		resp.Items = append(resp.Items, toReceiptItem(&page[i], &config.Dimensions))
+	}
+	if next != nil {
+		resp.NextCursor = http_requests.EncodeCursor(next)
+	}
+	http_utils.SendReceiptListResponse(w, &resp)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCollectionReceiptsHandler(t *testing.T) {
+	config := configs.Config{
+		Dimensions: configs.AllowedDimensions,
+	}
+	username := "test_user_collections"
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	metadataService := metadata.NewMemory()
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadataService)
+	c, createErr := collectionsService.Create(username, "Trip")
+	assert.Nil(t, createErr)
+	for i := 0; i < 4; i++ {
+		receiptId := fmt.Sprintf("receipt%d", i)
+		putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID: receiptId,
+			Username:  username,
+			CreatedAt: start.AddDate(0, 0, i),
+			Variants:  map[string]receipt_metadata.Variant{},
+		})
+		assert.Nil(t, putErr)
+		if i != 1 {
+			_, addErr := collectionsService.AddReceipt(username, c.CollectionID, receiptId)
+			assert.Nil(t, addErr)
+		}
+	}
+
+	list := func(t *testing.T, username, path string) (int, *http_responses.ReceiptListResponse) {
+		req, reqErr := http.NewRequest(http.MethodGet, path, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		ListCollectionReceipts(&config, collectionsService).ServeHTTP(rr, req)
+
+		var resp http_responses.ReceiptListResponse
+		if rr.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		}
+		return rr.Code, &resp
+	}
+
+	receiptIds := func(resp *http_responses.ReceiptListResponse) []string {
+		ids := []string{}
+		for _, item := range resp.Items {
+			ids = append(ids, item.ReceiptID)
+		}
+		return ids
+	}
+
+	t.Run("return 200, receipts of the collection paginated like the list", func(t *testing.T) {
+		status, resp := list(t, username, "/collections/"+c.CollectionID+"/receipts?limit=2")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt3", "receipt2"}, receiptIds(resp))
+		assert.NotEmpty(t, resp.NextCursor)
+
+		status, resp = list(t, username, "/collections/"+c.CollectionID+"/receipts?limit=2&cursor="+resp.NextCursor)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt0"}, receiptIds(resp))
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("return 404, collection of another user", func(t *testing.T) {
+		status, _ := list(t, "test_user_other", "/collections/"+c.CollectionID+"/receipts")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("return 400, invalid query parameter", func(t *testing.T) {
+		status, _ := list(t, username, "/collections/"+c.CollectionID+"/receipts?unknown=1")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
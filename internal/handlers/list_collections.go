@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func ListCollections(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleListCollections(w, r, collectionsService)
+	}
+}
+
+func handleListCollections(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	username := r.Header.Get("username_token")
+	logging.Debugf("handleListCollections(), username: %s", username)
+
+	list, listErr := collectionsService.List(username)
+	if listErr != nil {
+		logging.Errorf("collectionsService.List() failed, err: %s", listErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	resp := http_responses.CollectionListResponse{
+		Items: []http_responses.CollectionItem{},
+	}
+	for i := range list {
+		resp.Items = append(resp.Items, toCollectionItem(&list[i]))
+	}
+	http_utils.SendCollectionListResponse(w, &resp)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCollectionsHandler(t *testing.T) {
+	username := "test_user_collections"
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadata.NewMemory())
+	for _, name := range []string{"Trip", "Project"} {
+		_, createErr := collectionsService.Create(username, name)
+		assert.Nil(t, createErr)
+	}
+	_, createErr := collectionsService.Create("test_user_other", "Other")
+	assert.Nil(t, createErr)
+
+	list := func(t *testing.T, method string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, "/collections", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		ListCollections(collectionsService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, collections of the user oldest first", func(t *testing.T) {
+		rr := list(t, http.MethodGet)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.CollectionListResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Len(t, resp.Items, 2)
+		assert.Equal(t, "Trip", resp.Items[0].Name)
+		assert.Equal(t, "Project", resp.Items[1].Name)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := list(t, http.MethodDelete)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"strconv"
+)
+
+func ListReceipts(config *configs.Config, metadataService metadata.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleListReceipts(w, r, config, metadataService)
+	}
+}
+
+func handleListReceipts(w http.ResponseWriter, r *http.Request, config *configs.Config, metadataService metadata.ServiceType) {
+	logging.Debugf("handleListReceipts()")
+
+	listReq, parseErr := http_requests.ParseListRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseListRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_QUERY,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	list, listErr := metadataService.List(listReq.Username)
+	if listErr != nil {
+		logging.Errorf("metadataService.List() failed, err: %s", listErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	page, next := paginate(list, listReq)
+	resp := http_responses.ReceiptListResponse{
+		Items: []http_responses.ReceiptItem{},
+	}
+	for i := range page {
+		resp.Items = append(resp.Items, toReceiptItem(&page[i], &config.Dimensions))
+	}
+	if next != nil {
+		resp.NextCursor = http_requests.EncodeCursor(next)
+	}
+	http_utils.SendReceiptListResponse(w, &resp)
+}
+
+// paginate returns the page of list, which is ordered oldest first, requested by listReq and the
+// cursor of the next page, which is nil if there is none
+func paginate(list []receipt_metadata.ReceiptMetadata, listReq *http_requests.ListRequest) ([]receipt_metadata.ReceiptMetadata, *http_requests.ListCursor) {
+	if listReq.Order == constants.SORT_ORDER_DESC {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+
+	page := []receipt_metadata.ReceiptMetadata{}
+	for _, m := range list {
+		if listReq.Cursor != nil && !isAfter(&m, listReq.Cursor, listReq.Order) {
+			continue
+		}
+		if !listReq.From.IsZero() && m.CreatedAt.Before(listReq.From) {
+			continue
+		}
+		if !listReq.To.IsZero() && !m.CreatedAt.Before(listReq.To) {
+			continue
+		}
+		if listReq.Status != "" && m.Status() != listReq.Status {
+			continue
+		}
+
+		if len(page) == listReq.Limit {
+			last := page[len(page)-1]
+			return page, &http_requests.ListCursor{CreatedAt: last.CreatedAt, ReceiptID: last.ReceiptID}
+		}
+		page = append(page, m)
+	}
+	return page, nil
+}
+
+// isAfter reports if m comes after cursor in order
+func isAfter(m *receipt_metadata.ReceiptMetadata, cursor *http_requests.ListCursor, order string) bool {
+	after := m.CreatedAt.After(cursor.CreatedAt) ||
+		(m.CreatedAt.Equal(cursor.CreatedAt) && m.ReceiptID > cursor.ReceiptID)
+	before := m.CreatedAt.Before(cursor.CreatedAt) ||
+		(m.CreatedAt.Equal(cursor.CreatedAt) && m.ReceiptID < cursor.ReceiptID)
+	if order == constants.SORT_ORDER_DESC {
+		return before
+	}
+	return after
+}
+
+// toReceiptItem lists the original, which can always be downloaded, and the resized images which are ready
+func toReceiptItem(m *receipt_metadata.ReceiptMetadata, dimensions *configs.Dimensions) http_responses.ReceiptItem {
+	downloadURL := "/receipts/" + url.PathEscape(m.ReceiptID)
+	item := http_responses.ReceiptItem{
+		ReceiptID:   m.ReceiptID,
+		UploadedAt:  m.CreatedAt,
+		Status:      m.Status(),
+		Annotations: m.Annotations,
+		Exif:        m.Exif,
+		ETag:        http_utils.ETag(strconv.Itoa(m.Revision)),
+		Tier:        m.Tier,
+		Sizes: []http_responses.ReceiptSize{{
+			Size:   constants.VARIANT_ORIGINAL,
+			Width:  m.Width,
+			Height: m.Height,
+			Bytes:  m.Size,
+			URL:    downloadURL,
+		}},
+	}
+
+	for _, d := range *dimensions {
+		variant, ok := m.Variants[d.Name]
+		if !ok || variant.Status != constants.VARIANT_STATUS_READY {
+			continue
+		}
+		item.Sizes = append(item.Sizes, http_responses.ReceiptSize{
+			Size:   d.Name,
+			Width:  variant.Width,
+			Height: variant.Height,
+			Bytes:  variant.Size,
+			URL:    downloadURL + "?size=" + url.QueryEscape(d.Name),
+		})
+	}
+	return item
+}
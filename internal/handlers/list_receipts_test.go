@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListReceiptsHandler(t *testing.T) {
+	config := configs.Config{
+		Dimensions: configs.AllowedDimensions,
+	}
+	username := "test_user_list"
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	metadataService := metadata.NewMemory()
+	for i := 0; i < 5; i++ {
+		m := &receipt_metadata.ReceiptMetadata{
+			ReceiptID: fmt.Sprintf("receipt%d", i),
+			Username:  username,
+			CreatedAt: start.AddDate(0, 0, i),
+			Width:     1000,
+			Height:    1200,
+			Size:      2048,
+			Variants:  map[string]receipt_metadata.Variant{},
+		}
+		for _, name := range receipt_metadata.VariantNames(&config.Dimensions) {
+			m.Variants[name] = receipt_metadata.Variant{Status: constants.VARIANT_STATUS_READY, Width: 100, Height: 120, Size: 512}
+		}
+		if i == 3 {
+			m.Variants["large"] = receipt_metadata.Variant{Status: constants.VARIANT_STATUS_QUEUED}
+		}
+		assert.Nil(t, metadataService.Put(m))
+	}
+	assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{ReceiptID: "other", Username: "test_user_other", CreatedAt: start}))
+
+	list := func(t *testing.T, query string) (int, *http_responses.ReceiptListResponse) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts"+query, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		ListReceipts(&config, metadataService).ServeHTTP(rr, req)
+
+		var resp http_responses.ReceiptListResponse
+		if rr.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		}
+		return rr.Code, &resp
+	}
+
+	receiptIds := func(resp *http_responses.ReceiptListResponse) []string {
+		ids := []string{}
+		for _, item := range resp.Items {
+			ids = append(ids, item.ReceiptID)
+		}
+		return ids
+	}
+
+	t.Run("return 200, newest receipts of the user first", func(t *testing.T) {
+		status, resp := list(t, "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt4", "receipt3", "receipt2", "receipt1", "receipt0"}, receiptIds(resp))
+		assert.Empty(t, resp.NextCursor)
+
+		item := resp.Items[0]
+		assert.Equal(t, constants.VARIANT_STATUS_READY, item.Status)
+		assert.True(t, start.AddDate(0, 0, 4).Equal(item.UploadedAt))
+		assert.Len(t, item.Sizes, len(config.Dimensions)+1)
+		assert.Equal(t, http_responses.ReceiptSize{Size: "original", Width: 1000, Height: 1200, Bytes: 2048, URL: "/receipts/receipt4"}, item.Sizes[0])
+		assert.Equal(t, "/receipts/receipt4?size=small", item.Sizes[1].URL)
+
+		// resized images which are not ready are not listed
+		assert.Equal(t, constants.VARIANT_STATUS_QUEUED, resp.Items[1].Status)
+		assert.Len(t, resp.Items[1].Sizes, len(config.Dimensions))
+	})
+
+	t.Run("return 200, paginate oldest first", func(t *testing.T) {
+		ids := []string{}
+		query := "?order=asc&limit=2"
+		for pages := 0; pages < 5; pages++ {
+			status, resp := list(t, query)
+			assert.Equal(t, http.StatusOK, status)
+			assert.LessOrEqual(t, len(resp.Items), 2)
+			ids = append(ids, receiptIds(resp)...)
+			if resp.NextCursor == "" {
+				break
+			}
+			query = "?order=asc&limit=2&cursor=" + resp.NextCursor
+		}
+		assert.Equal(t, []string{"receipt0", "receipt1", "receipt2", "receipt3", "receipt4"}, ids)
+	})
+
+	t.Run("return 200, filter by date range and status", func(t *testing.T) {
+		status, resp := list(t, "?from=2026-01-02&to=2026-01-04")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt3", "receipt2", "receipt1"}, receiptIds(resp))
+
+		status, resp = list(t, "?from=2026-01-02T12:00:00Z&to=2026-01-04T12:00:00Z")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt2", "receipt1"}, receiptIds(resp))
+
+		status, resp = list(t, "?status=queued")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt3"}, receiptIds(resp))
+
+		status, resp = list(t, "?status=failed")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, resp.Items)
+	})
+
+	t.Run("return 400, invalid query parameter", func(t *testing.T) {
+		for _, query := range []string{
+			"?limit=0",
+			"?limit=1000",
+			"?order=newest",
+			"?status=unknown",
+			"?from=yesterday",
+			"?from=2026-01-04&to=2026-01-02",
+			"?cursor=invalid",
+			"?size=small",
+		} {
+			status, _ := list(t, query)
+			assert.Equal(t, http.StatusBadRequest, status, query)
+		}
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPut, "/receipts", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		ListReceipts(&config, metadataService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
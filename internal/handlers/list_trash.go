@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/trash"
+)
+
+func ListTrash(config *configs.Config, trashService trash.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleListTrash(w, r, trashService)
+	}
+}
+
+func handleListTrash(w http.ResponseWriter, r *http.Request, trashService trash.ServiceType) {
+	username := r.Header.Get("username_token")
+	logging.Debugf("handleListTrash(), username: %s", username)
+
+	entries, listErr := trashService.List(username)
+	if listErr != nil {
+		logging.Errorf("trashService.List() failed, err: %s", listErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	resp := http_responses.TrashListResponse{
+		Items: []http_responses.TrashItem{},
+	}
+	for _, entry := range entries {
+		resp.Items = append(resp.Items, http_responses.TrashItem{
+			ReceiptID: entry.ReceiptID,
+			DeletedAt: entry.DeletedAt,
+			PurgeAt:   entry.PurgeAt(trashService.Retention()),
+		})
+	}
+	http_utils.SendTrashListResponse(w, &resp)
+}
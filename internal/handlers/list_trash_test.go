@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/trash"
+	"receipt_uploader/internal/trash/trash_mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTrashHandler(t *testing.T) {
+	config := configs.Config{
+		ResizedDir:     "resized",
+		UploadsDir:     "uploads",
+		TrashDir:       "trash",
+		Dimensions:     configs.AllowedDimensions,
+		TrashRetention: 24 * time.Hour,
+	}
+	store := storage.NewMemory()
+	recordsService := records.NewService("records", store)
+	trashService := trash.NewService(&config, store, recordsService, metadata.NewMemory(), &quotas_mock.ServiceMock{})
+
+	t.Run("return 200, trashed receipts of the user", func(t *testing.T) {
+		username := "test_user_trash"
+		for _, receiptId := range []string{"first", "second"} {
+			imageMeta := image_meta.FromReceiptID(username, receiptId, config.UploadsDir)
+			putErr := store.Put(imageMeta.Path, http.NoBody)
+			assert.Nil(t, putErr)
+			_, trashErr := trashService.Trash(imageMeta, config.ResizedDir)
+			assert.Nil(t, trashErr)
+		}
+
+		req, reqErr := http.NewRequest(http.MethodGet, "/trash", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		ListTrash(&config, trashService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.TrashListResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Len(t, resp.Items, 2)
+		for _, item := range resp.Items {
+			assert.Equal(t, item.DeletedAt.Add(config.TrashRetention), item.PurgeAt)
+		}
+
+		otherReq, otherReqErr := http.NewRequest(http.MethodGet, "/trash", nil)
+		assert.Nil(t, otherReqErr)
+		otherReq.Header.Set("username_token", "test_user_other")
+
+		otherRR := httptest.NewRecorder()
+		ListTrash(&config, trashService).ServeHTTP(otherRR, otherReq)
+		assert.Equal(t, http.StatusOK, otherRR.Code)
+
+		var otherResp http_responses.TrashListResponse
+		assert.Nil(t, json.Unmarshal(otherRR.Body.Bytes(), &otherResp))
+		assert.Empty(t, otherResp.Items)
+	})
+
+	t.Run("return 405, not allowed method", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/trash", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		ListTrash(&config, trashService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("return 500, List() failed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/trash", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "mock_list_failed")
+
+		rr := httptest.NewRecorder()
+		ListTrash(&config, &trash_mock.ServiceMock{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/audit"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"strconv"
+)
+
+func QueryAudit(auditService audit.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleQueryAudit(w, r, auditService)
+	}
+}
+
+func handleQueryAudit(w http.ResponseWriter, r *http.Request, auditService audit.ServiceType) {
+	logging.Debugf("handleQueryAudit(), query: %s", r.URL.RawQuery)
+
+	auditReq, parseErr := http_requests.ParseAuditRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseAuditRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_QUERY,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	// one more entry than the page tells if there is a next page
+	limit := auditReq.Query.Limit
+	auditReq.Query.Limit++
+	entries, queryErr := auditService.Query(&auditReq.Query)
+	if queryErr != nil {
+		logging.Errorf("auditService.Query() failed, err: %s", queryErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	resp := http_responses.AuditListResponse{
+		Items: entries,
+	}
+	if len(entries) > limit {
+		resp.Items = entries[:limit]
+		resp.NextCursor = strconv.FormatInt(entries[limit-1].Seq, 10)
+	}
+	http_utils.SendAuditListResponse(w, &resp)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/audit"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/models/audit_entry"
+	"receipt_uploader/internal/models/http_responses"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryAuditHandler(t *testing.T) {
+	auditService := audit.NewMemory()
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, actor := range []string{"user_a", "user_b", "user_a", "user_a"} {
+		recordErr := auditService.Record(&audit_entry.AuditEntry{
+			Time:      start.Add(time.Duration(i) * time.Hour),
+			Actor:     actor,
+			Action:    constants.AUDIT_ACTION_DOWNLOAD,
+			ReceiptID: "auditreceiptid",
+			Status:    http.StatusOK,
+			Outcome:   constants.AUDIT_OUTCOME_SUCCESS,
+		})
+		assert.Nil(t, recordErr)
+	}
+
+	query := func(t *testing.T, method, url string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, url, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "admin")
+
+		rr := httptest.NewRecorder()
+		QueryAudit(auditService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, entries of a user in a time range", func(t *testing.T) {
+		rr := query(t, http.MethodGet, "/admin/audit?user=user_a&from=2026-01-01T11:00:00Z&to=2026-01-01T13:30:00Z")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.AuditListResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Len(t, resp.Items, 2)
+		assert.Equal(t, int64(3), resp.Items[0].Seq)
+		assert.Equal(t, int64(4), resp.Items[1].Seq)
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("return 200, pages follow the cursor", func(t *testing.T) {
+		rr := query(t, http.MethodGet, "/admin/audit?user=user_a&limit=2")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var first http_responses.AuditListResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &first))
+		assert.Len(t, first.Items, 2)
+		assert.Equal(t, "3", first.NextCursor)
+
+		rr = query(t, http.MethodGet, "/admin/audit?user=user_a&limit=2&cursor="+first.NextCursor)
+		var second http_responses.AuditListResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &second))
+		assert.Len(t, second.Items, 1)
+		assert.Equal(t, int64(4), second.Items[0].Seq)
+		assert.Empty(t, second.NextCursor)
+	})
+
+	t.Run("return 400, invalid query", func(t *testing.T) {
+		for _, url := range []string{
+			"/admin/audit?limit=0",
+			"/admin/audit?cursor=abc",
+			"/admin/audit?from=2026-01-02&to=2026-01-01",
+			"/admin/audit?unknown=1",
+		} {
+			rr := query(t, http.MethodGet, url)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+		}
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := query(t, http.MethodPost, "/admin/audit")
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
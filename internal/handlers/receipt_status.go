@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+)
+
+func ReceiptStatus(config *configs.Config, metadataService metadata.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleReceiptStatus(w, r, config, metadataService)
+	}
+}
+
+func handleReceiptStatus(w http.ResponseWriter, r *http.Request, config *configs.Config, metadataService metadata.ServiceType) {
+	logging.Debugf("handleReceiptStatus(), path: %s", r.URL.Path)
+
+	statusReq, parseErr := http_requests.ParseStatusRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseStatusRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	receiptMetadata, getErr := metadataService.Get(statusReq.Username, statusReq.ReceiptId)
+	if getErr != nil {
+		logging.Errorf("metadataService.Get() failed, err: %s", getErr.Error())
+
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		statusCode := http.StatusInternalServerError
+
+		if errors.Is(getErr, os.ErrNotExist) {
+			resp = http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_404,
+			}
+			statusCode = http.StatusNotFound
+		}
+
+		http_utils.SendErrorResponse(w, &resp, statusCode)
+		return
+	}
+
+	resp := http_responses.ReceiptStatusResponse{
+		ReceiptID:  receiptMetadata.ReceiptID,
+		Status:     receiptMetadata.Status(),
+		UploadedAt: receiptMetadata.CreatedAt,
+		Sizes:      []http_responses.VariantStatus{},
+	}
+	for _, name := range receipt_metadata.VariantNames(&config.Dimensions) {
+		resp.Sizes = append(resp.Sizes, toVariantStatus(name, receiptMetadata.Variants[name]))
+	}
+	http_utils.SendReceiptStatusResponse(w, &resp)
+}
+
+// toVariantStatus reports the status of a variant without its error message, which is internal
+func toVariantStatus(name string, variant receipt_metadata.Variant) http_responses.VariantStatus {
+	status := http_responses.VariantStatus{
+		Size:          name,
+		Status:        variant.Status,
+		ErrorCategory: variant.ErrorCategory,
+		UpdatedAt:     variant.UpdatedAt,
+	}
+	if status.Status == "" {
+		// the dimension was added after the receipt was uploaded
+		status.Status = constants.VARIANT_STATUS_QUEUED
+	}
+	if !variant.StartedAt.IsZero() {
+		status.StartedAt = &variant.StartedAt
+	}
+	return status
+}
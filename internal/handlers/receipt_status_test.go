@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiptStatusHandler(t *testing.T) {
+	config := configs.Config{
+		Dimensions: configs.AllowedDimensions,
+	}
+	username := "test_user_status"
+	now := time.Now().UTC()
+
+	metadataService := metadata.NewMemory()
+	putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+		ReceiptID: "statusreceiptid",
+		Username:  username,
+		CreatedAt: now,
+		Variants: map[string]receipt_metadata.Variant{
+			constants.VARIANT_ORIGINAL: {Status: constants.VARIANT_STATUS_READY, StartedAt: now, UpdatedAt: now, Error: "internal"},
+			"small":                    {Status: constants.VARIANT_STATUS_PROCESSING, StartedAt: now, UpdatedAt: now},
+			"medium":                   {Status: constants.VARIANT_STATUS_QUEUED, UpdatedAt: now},
+			"large":                    {Status: constants.VARIANT_STATUS_FAILED, StartedAt: now, UpdatedAt: now, Error: "disk full", ErrorCategory: constants.RESIZE_ERR_WRITE},
+		},
+	})
+	assert.Nil(t, putErr)
+
+	get := func(t *testing.T, method, url, username string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, url, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		ReceiptStatus(&config, metadataService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, status of every size", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "/receipts/statusreceiptid/status", username)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.ReceiptStatusResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "statusreceiptid", resp.ReceiptID)
+		assert.Equal(t, constants.VARIANT_STATUS_FAILED, resp.Status)
+		assert.Len(t, resp.Sizes, len(config.Dimensions)+1)
+
+		statuses := map[string]http_responses.VariantStatus{}
+		for _, size := range resp.Sizes {
+			statuses[size.Size] = size
+		}
+		assert.Equal(t, constants.VARIANT_STATUS_READY, statuses[constants.VARIANT_ORIGINAL].Status)
+		assert.Equal(t, constants.VARIANT_STATUS_PROCESSING, statuses["small"].Status)
+		assert.NotNil(t, statuses["small"].StartedAt)
+		assert.Equal(t, constants.VARIANT_STATUS_QUEUED, statuses["medium"].Status)
+		assert.Nil(t, statuses["medium"].StartedAt)
+		assert.Equal(t, constants.VARIANT_STATUS_FAILED, statuses["large"].Status)
+		assert.Equal(t, constants.RESIZE_ERR_WRITE, statuses["large"].ErrorCategory)
+
+		// error messages are internal
+		assert.NotContains(t, rr.Body.String(), "disk full")
+	})
+
+	t.Run("return 404, receipt of another user", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "/receipts/statusreceiptid/status", "test_user_other")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 400, invalid receiptId", func(t *testing.T) {
+		rr := get(t, http.MethodGet, "/receipts/Ab1234/status", username)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := get(t, http.MethodPost, "/receipts/statusreceiptid/status", username)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func RemoveCollectionReceipt(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodDelete != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleRemoveCollectionReceipt(w, r, collectionsService)
+	}
+}
+
+func handleRemoveCollectionReceipt(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	logging.Debugf("handleRemoveCollectionReceipt(), path: %s", r.URL.Path)
+
+	receiptReq, parseErr := http_requests.ParseCollectionReceiptRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseCollectionReceiptRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_COLLECTION,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	removeErr := collectionsService.RemoveReceipt(receiptReq.Username, receiptReq.CollectionId, receiptReq.ReceiptId)
+	if removeErr != nil {
+		logging.Errorf("collectionsService.RemoveReceipt() failed, err: %s", removeErr.Error())
+		sendCollectionError(w, removeErr)
+		return
+	}
+
+	http_utils.SendDeleteResponse(w)
+}
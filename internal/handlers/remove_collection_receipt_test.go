@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveCollectionReceiptHandler(t *testing.T) {
+	username := "test_user_collections"
+	metadataService := metadata.NewMemory()
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadataService)
+	c, createErr := collectionsService.Create(username, "Trip")
+	assert.Nil(t, createErr)
+	assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{ReceiptID: "receipt1", Username: username, CreatedAt: time.Now().UTC()}))
+	_, addErr := collectionsService.AddReceipt(username, c.CollectionID, "receipt1")
+	assert.Nil(t, addErr)
+
+	remove := func(t *testing.T, method, username, collectionId, receiptId string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, "/collections/"+collectionId+"/receipts/"+receiptId, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		RemoveCollectionReceipt(collectionsService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 404, collection of another user", func(t *testing.T) {
+		rr := remove(t, http.MethodDelete, "test_user_other", c.CollectionID, "receipt1")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 204, receipt removed and kept", func(t *testing.T) {
+		rr := remove(t, http.MethodDelete, username, c.CollectionID, "receipt1")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		got, _ := collectionsService.Get(username, c.CollectionID)
+		assert.Empty(t, got.ReceiptIDs)
+		_, metadataErr := metadataService.Get(username, "receipt1")
+		assert.Nil(t, metadataErr)
+
+		rr = remove(t, http.MethodDelete, username, c.CollectionID, "receipt1")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := remove(t, http.MethodGet, username, c.CollectionID, "receipt1")
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+)
+
+func RenameCollection(collectionsService collections.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodPatch != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleRenameCollection(w, r, collectionsService)
+	}
+}
+
+func handleRenameCollection(w http.ResponseWriter, r *http.Request, collectionsService collections.ServiceType) {
+	logging.Debugf("handleRenameCollection(), path: %s", r.URL.Path)
+
+	renameReq, parseErr := http_requests.ParseRenameCollectionRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseRenameCollectionRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_COLLECTION,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	c, renameErr := collectionsService.Rename(renameReq.Username, renameReq.CollectionId, renameReq.Name)
+	if renameErr != nil {
+		logging.Errorf("collectionsService.Rename() failed, err: %s", renameErr.Error())
+		sendCollectionError(w, renameErr)
+		return
+	}
+
+	resp := toCollectionItem(c)
+	http_utils.SendCollectionItemResponse(w, &resp, http.StatusOK)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/collections"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameCollectionHandler(t *testing.T) {
+	username := "test_user_collections"
+	collectionsService := collections.NewService("collections", storage.NewMemory(), metadata.NewMemory())
+	c, createErr := collectionsService.Create(username, "Trip")
+	assert.Nil(t, createErr)
+	_, createErr = collectionsService.Create(username, "Project")
+	assert.Nil(t, createErr)
+
+	rename := func(t *testing.T, method, username, collectionId, body string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(method, "/collections/"+collectionId, strings.NewReader(body))
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		RenameCollection(collectionsService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, collection renamed", func(t *testing.T) {
+		rr := rename(t, http.MethodPatch, username, c.CollectionID, `{"name": "Trip to Oslo"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.CollectionItem
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "Trip to Oslo", resp.Name)
+	})
+
+	t.Run("return 409, name is taken", func(t *testing.T) {
+		rr := rename(t, http.MethodPatch, username, c.CollectionID, `{"name": "project"}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("return 400, invalid name", func(t *testing.T) {
+		rr := rename(t, http.MethodPatch, username, c.CollectionID, `{"name": " "}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 404, collection of another user", func(t *testing.T) {
+		rr := rename(t, http.MethodPatch, "test_user_other", c.CollectionID, `{"name": "Mine"}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		rr := rename(t, http.MethodPut, username, c.CollectionID, `{"name": "Trip"}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/trash_entry"
+	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/trash"
+)
+
+func RestoreReceipt(
+	config *configs.Config,
+	trashService trash.ServiceType,
+	resizeQueue resize_queue.ServiceType,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodPost != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleRestore(w, r, config, trashService, resizeQueue)
+	}
+}
+
+func handleRestore(
+	w http.ResponseWriter,
+	r *http.Request,
+	config *configs.Config,
+	trashService trash.ServiceType,
+	resizeQueue resize_queue.ServiceType,
+) {
+	logging.Debugf("handleRestore(), path: %s", r.URL.Path)
+
+	restoreReq, parseErr := http_requests.ParseRestoreRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseRestoreRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	entry, restoreErr := trashService.Restore(restoreReq.Username, restoreReq.ReceiptId)
+	if restoreErr != nil {
+		logging.Errorf("trashService.Restore() failed, err: %s", restoreErr.Error())
+
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		statusCode := http.StatusInternalServerError
+
+		if errors.Is(restoreErr, os.ErrNotExist) {
+			resp = http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_404,
+			}
+			statusCode = http.StatusNotFound
+		}
+		if errors.Is(restoreErr, trash.ErrReceiptExists) {
+			resp = http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_409_RESTORE,
+			}
+			statusCode = http.StatusConflict
+		}
+
+		http_utils.SendErrorResponse(w, &resp, statusCode)
+		return
+	}
+
+	// the receipt may have been deleted before it was resized, unless its original has been
+	// dropped by the garbage collector after all variants existed
+	original := image_meta.FromReceiptID(restoreReq.Username, restoreReq.ReceiptId, config.UploadsDir)
+	if len(entry.Files) < len(config.Dimensions)+2 && hasFile(entry, original.Path) {
+		task := tasks.ResizeTask{
+			ImageMeta: *original,
+			DestDir:   config.ResizedDir,
+		}
+		if !resizeQueue.Enqueue(task) {
+			logging.Warnf("resizeQueue.Enqueue() failed, receiptId: %s", restoreReq.ReceiptId)
+		}
+	}
+
+	logging.Infof("receipt has been restored, receiptId: %s", restoreReq.ReceiptId)
+	resp := http_responses.RestoreResponse{
+		ReceiptID: restoreReq.ReceiptId,
+	}
+	http_utils.SendRestoreResponse(w, &resp)
+}
+
+func hasFile(entry *trash_entry.TrashEntry, originalPath string) bool {
+	for _, file := range entry.Files {
+		if file.OriginalPath == originalPath {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/test_utils"
+	"receipt_uploader/internal/trash"
+	"receipt_uploader/internal/trash/trash_mock"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreReceiptHandler(t *testing.T) {
+	baseDir := "test-restore"
+	config := configs.Config{
+		ResizedDir: filepath.Join(baseDir, "resized"),
+		UploadsDir: filepath.Join(baseDir, "uploads"),
+		TrashDir:   filepath.Join(baseDir, "trash"),
+		Dimensions: configs.AllowedDimensions,
+	}
+
+	test_utils.InitTestServer(&config)
+	defer os.RemoveAll(baseDir)
+
+	recordsService := records.NewService("records", storage.NewMemory())
+	trashService := trash.NewService(&config, storage.NewFileSystem(""), recordsService, metadata.NewMemory(), &quotas_mock.ServiceMock{})
+	mockResizeQueue := &resize_queue_mock.ServiceMock{}
+
+	t.Run("return 200, receipt restored", func(t *testing.T) {
+		username := "test_user_restore"
+		receiptId := "restorereceiptid"
+		paths := createTestReceipt(t, &config, recordsService, username, receiptId)
+
+		imageMeta := image_meta.FromReceiptID(username, receiptId, config.UploadsDir)
+		_, trashErr := trashService.Trash(imageMeta, config.ResizedDir)
+		assert.Nil(t, trashErr)
+
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/"+receiptId+"/restore", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		handler := RestoreReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		for _, path := range paths {
+			_, statErr := os.Stat(path)
+			assert.Nil(t, statErr)
+		}
+		_, recordErr := recordsService.Get(username, receiptId)
+		assert.Nil(t, recordErr)
+	})
+
+	t.Run("return 404, receipt in trash of another user", func(t *testing.T) {
+		owner := "test_user_owner"
+		receiptId := "ownerreceiptid"
+		createTestReceipt(t, &config, recordsService, owner, receiptId)
+
+		imageMeta := image_meta.FromReceiptID(owner, receiptId, config.UploadsDir)
+		_, trashErr := trashService.Trash(imageMeta, config.ResizedDir)
+		assert.Nil(t, trashErr)
+
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/"+receiptId+"/restore", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", "test_user_other")
+
+		rr := httptest.NewRecorder()
+		handler := RestoreReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 409, receipt uploaded again after it was deleted", func(t *testing.T) {
+		username := "test_user_reupload"
+		receiptId := "reuploadreceiptid"
+		createTestReceipt(t, &config, recordsService, username, receiptId)
+
+		imageMeta := image_meta.FromReceiptID(username, receiptId, config.UploadsDir)
+		_, trashErr := trashService.Trash(imageMeta, config.ResizedDir)
+		assert.Nil(t, trashErr)
+		createTestReceipt(t, &config, recordsService, username, receiptId)
+
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/"+receiptId+"/restore", nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		handler := RestoreReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("return 400, invalid receiptId", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/Ab1234/restore", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := RestoreReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 405, not allowed method", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/1234/restore", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := RestoreReceipt(&config, trashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("return 500, Restore() failed", func(t *testing.T) {
+		mockTrashService := trash_mock.ServiceMock{}
+
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/mockrestorefailed/restore", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := RestoreReceipt(&config, &mockTrashService, mockResizeQueue)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/search"
+)
+
+func SearchReceipts(config *configs.Config, searchService search.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodGet != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleSearchReceipts(w, r, config, searchService)
+	}
+}
+
+func handleSearchReceipts(w http.ResponseWriter, r *http.Request, config *configs.Config, searchService search.ServiceType) {
+	logging.Debugf("handleSearchReceipts()")
+
+	searchReq, parseErr := http_requests.ParseSearchRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseSearchRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_QUERY,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	results, searchErr := searchService.Search(searchReq.Username, searchReq.Query)
+	if searchErr != nil {
+		logging.Errorf("searchService.Search() failed, err: %s", searchErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	page, next := paginate(results, &searchReq.ListRequest)
+	resp := http_responses.ReceiptListResponse{
+		Items: []http_responses.ReceiptItem{},
+	}
+	for i := range page {
+		resp.Items = append(resp.Items, toReceiptItem(&page[i], &config.Dimensions))
+	}
+	if next != nil {
+		resp.NextCursor = http_requests.EncodeCursor(next)
+	}
+	http_utils.SendReceiptListResponse(w, &resp)
+}
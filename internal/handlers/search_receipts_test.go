@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/search"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchReceiptsHandler(t *testing.T) {
+	config := configs.Config{
+		Dimensions: configs.AllowedDimensions,
+	}
+	username := "test_user_search"
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	searchService := search.NewService(metadata.NewMemory())
+	for i := 0; i < 5; i++ {
+		annotations := receipt_metadata.Annotations{
+			Merchant: "Cafe Aalto",
+			Amount:   &receipt_metadata.Amount{Value: fmt.Sprintf("%d.50", 10*i), Currency: "EUR"},
+		}
+		if i%2 == 0 {
+			annotations.Tags = []string{"travel"}
+			annotations.Notes = "Lunch with a client"
+		}
+		assert.Nil(t, searchService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID:   fmt.Sprintf("receipt%d", i),
+			Username:    username,
+			CreatedAt:   start.AddDate(0, 0, i),
+			Variants:    map[string]receipt_metadata.Variant{},
+			Annotations: annotations,
+		}))
+	}
+	assert.Nil(t, searchService.Put(&receipt_metadata.ReceiptMetadata{
+		ReceiptID:   "other",
+		Username:    "test_user_other",
+		CreatedAt:   start,
+		Annotations: receipt_metadata.Annotations{Tags: []string{"travel"}},
+	}))
+
+	searchReceipts := func(t *testing.T, query string) (int, *http_responses.ReceiptListResponse) {
+		req, reqErr := http.NewRequest(http.MethodGet, "/receipts/search"+query, nil)
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+
+		rr := httptest.NewRecorder()
+		SearchReceipts(&config, searchService).ServeHTTP(rr, req)
+
+		var resp http_responses.ReceiptListResponse
+		if rr.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		}
+		return rr.Code, &resp
+	}
+
+	receiptIds := func(resp *http_responses.ReceiptListResponse) []string {
+		ids := []string{}
+		for _, item := range resp.Items {
+			ids = append(ids, item.ReceiptID)
+		}
+		return ids
+	}
+
+	t.Run("return 200, matching receipts of the user newest first", func(t *testing.T) {
+		status, resp := searchReceipts(t, "?q="+url.QueryEscape("tag:travel client"))
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt4", "receipt2", "receipt0"}, receiptIds(resp))
+		assert.Equal(t, "Cafe Aalto", resp.Items[0].Annotations.Merchant)
+
+		status, resp = searchReceipts(t, "?q="+url.QueryEscape("merchant:caf amount:10..30.5")+"&order=asc")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt1", "receipt2", "receipt3"}, receiptIds(resp))
+	})
+
+	t.Run("return 200, paginated like the list", func(t *testing.T) {
+		status, resp := searchReceipts(t, "?q=merchant:cafe&limit=2")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt4", "receipt3"}, receiptIds(resp))
+		assert.NotEmpty(t, resp.NextCursor)
+
+		status, resp = searchReceipts(t, "?q=merchant:cafe&limit=2&cursor="+resp.NextCursor)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt2", "receipt1"}, receiptIds(resp))
+
+		status, resp = searchReceipts(t, "?q=merchant:cafe&limit=2&cursor="+resp.NextCursor)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"receipt0"}, receiptIds(resp))
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("return 200, no match", func(t *testing.T) {
+		status, resp := searchReceipts(t, "?q=tag:food")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{}, receiptIds(resp))
+	})
+
+	t.Run("return 400, invalid query", func(t *testing.T) {
+		for _, query := range []string{
+			"?q=unknown:value",
+			"?q=" + url.QueryEscape("amount:abc"),
+			"?q=a&q=b",
+			"?q=tag:travel&limit=0",
+			"?q=tag:travel&unknown=1",
+		} {
+			status, _ := searchReceipts(t, query)
+			assert.Equal(t, http.StatusBadRequest, status, query)
+		}
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPost, "/receipts/search", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		SearchReceipts(&config, searchService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
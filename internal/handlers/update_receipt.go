@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/http_utils"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_requests"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// errModified is returned if If-Match of an update does not match the annotations
+var errModified = errors.New("receipt has been modified")
+
+func UpdateReceipt(config *configs.Config, metadataService metadata.ServiceType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Infof("received request, %s, %s, %s", r.Method, r.URL.Path, r.Header.Get("username_token"))
+
+		if http.MethodPatch != r.Method {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_405,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleUpdate(w, r, config, metadataService)
+	}
+}
+
+func handleUpdate(w http.ResponseWriter, r *http.Request, config *configs.Config, metadataService metadata.ServiceType) {
+	logging.Debugf("handleUpdate(), path: %s", r.URL.Path)
+
+	updateReq, parseErr := http_requests.ParseUpdateRequest(r)
+	if parseErr != nil {
+		logging.Errorf("http_requests.ParseUpdateRequest() failed, err: %s", parseErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_400_METADATA,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusBadRequest)
+		return
+	}
+
+	updated, updateErr := metadataService.Update(updateReq.Username, updateReq.ReceiptId, func(m *receipt_metadata.ReceiptMetadata) error {
+		if updateReq.IfMatch != "" && !http_utils.MatchesIfMatch(updateReq.IfMatch, strconv.Itoa(m.Revision)) {
+			return errModified
+		}
+
+		annotations, patchErr := m.Annotations.Patch(updateReq.Patch)
+		if patchErr != nil {
+			return patchErr
+		}
+		if reflect.DeepEqual(*annotations, m.Annotations) {
+			return nil
+		}
+		m.Annotations = *annotations
+		m.Revision++
+		m.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if updateErr != nil {
+		logging.Errorf("metadataService.Update() failed, err: %s", updateErr.Error())
+
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		statusCode := http.StatusInternalServerError
+
+		switch {
+		case errors.Is(updateErr, os.ErrNotExist):
+			resp.Error = constants.HTTP_ERR_MSG_404
+			statusCode = http.StatusNotFound
+		case errors.Is(updateErr, receipt_metadata.ErrInvalidAnnotations):
+			resp.Error = constants.HTTP_ERR_MSG_400_METADATA
+			statusCode = http.StatusBadRequest
+		case errors.Is(updateErr, errModified):
+			resp.Error = constants.HTTP_ERR_MSG_412
+			statusCode = http.StatusPreconditionFailed
+		}
+
+		http_utils.SendErrorResponse(w, &resp, statusCode)
+		return
+	}
+
+	logging.Infof("receipt has been updated, receiptId: %s, revision: %d", updated.ReceiptID, updated.Revision)
+	resp := toReceiptItem(updated, &config.Dimensions)
+	http_utils.SendReceiptMetadataResponse(w, &resp)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateReceiptHandler(t *testing.T) {
+	config := configs.Config{
+		Dimensions: configs.AllowedDimensions,
+	}
+	username := "test_user_update"
+
+	metadataService := metadata.NewMemory()
+	putErr := metadataService.Put(&receipt_metadata.ReceiptMetadata{
+		ReceiptID: "updatereceiptid",
+		Username:  username,
+		CreatedAt: time.Now().UTC(),
+		Variants:  map[string]receipt_metadata.Variant{},
+	})
+	assert.Nil(t, putErr)
+
+	patch := func(t *testing.T, username, receiptId, body, ifMatch string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequest(http.MethodPatch, "/receipts/"+receiptId, strings.NewReader(body))
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		UpdateReceipt(&config, metadataService).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("return 200, annotations updated", func(t *testing.T) {
+		rr := patch(t, username, "updatereceiptid", `{"merchant": "Cafe Aalto", "amount": {"value": "12.50", "currency": "EUR"}}`, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp http_responses.ReceiptItem
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "Cafe Aalto", resp.Annotations.Merchant)
+		assert.Equal(t, &receipt_metadata.Amount{Value: "12.50", Currency: "EUR"}, resp.Annotations.Amount)
+		assert.Equal(t, rr.Header().Get("ETag"), resp.ETag)
+
+		receiptMetadata, getErr := metadataService.Get(username, "updatereceiptid")
+		assert.Nil(t, getErr)
+		assert.Equal(t, "Cafe Aalto", receiptMetadata.Annotations.Merchant)
+
+		// the ETag only changes with the annotations
+		rr = patch(t, username, "updatereceiptid", `{"merchant": "Cafe Aalto"}`, resp.ETag)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, resp.ETag, rr.Header().Get("ETag"))
+	})
+
+	t.Run("return 412, If-Match does not match", func(t *testing.T) {
+		rr := patch(t, username, "updatereceiptid", `{"notes": "first"}`, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+
+		rr = patch(t, username, "updatereceiptid", `{"notes": "second"}`, etag)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = patch(t, username, "updatereceiptid", `{"notes": "stale"}`, etag)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		var resp http_responses.ErrorResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, constants.HTTP_ERR_MSG_412, resp.Error)
+
+		receiptMetadata, _ := metadataService.Get(username, "updatereceiptid")
+		assert.Equal(t, "second", receiptMetadata.Annotations.Notes)
+	})
+
+	t.Run("return 400, invalid annotations", func(t *testing.T) {
+		for _, body := range []string{
+			`{"amount": {"value": "abc", "currency": "EUR"}}`,
+			`{"unknown": "field"}`,
+			`not json`,
+		} {
+			rr := patch(t, username, "updatereceiptid", body, "")
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+
+		req, reqErr := http.NewRequest(http.MethodPatch, "/receipts/updatereceiptid", strings.NewReader(`{}`))
+		assert.Nil(t, reqErr)
+		req.Header.Set("username_token", username)
+		req.Header.Set("Content-Type", "text/plain")
+		rr := httptest.NewRecorder()
+		UpdateReceipt(&config, metadataService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("return 404, receipt of another user", func(t *testing.T) {
+		rr := patch(t, "test_user_other", "updatereceiptid", `{"notes": "mine"}`, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("return 405, method not allowed", func(t *testing.T) {
+		req, reqErr := http.NewRequest(http.MethodPut, "/receipts/updatereceiptid", nil)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		UpdateReceipt(&config, metadataService).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
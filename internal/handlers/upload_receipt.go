@@ -1,20 +1,32 @@
 package handlers
 
 import (
+	"errors"
+	"io/fs"
 	"net/http"
 	"receipt_uploader/internal/constants"
 	"receipt_uploader/internal/http_utils"
 	"receipt_uploader/internal/images"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
 	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/records"
 	"receipt_uploader/internal/resize_queue"
+	"time"
 )
 
 func UploadReceipt(
 	config *configs.Config,
 	imagesService images.ServiceType,
+	recordsService records.ServiceType,
+	metadataService metadata.ServiceType,
+	quotasService quotas.ServiceType,
 	resizeQueue resize_queue.ServiceType,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -28,7 +40,7 @@ func UploadReceipt(
 			return
 		}
 
-		handlePost(w, r, config, imagesService, resizeQueue)
+		handlePost(w, r, config, imagesService, recordsService, metadataService, quotasService, resizeQueue)
 	}
 }
 
@@ -37,12 +49,15 @@ func handlePost(
 	r *http.Request,
 	config *configs.Config,
 	imagesService images.ServiceType,
+	recordsService records.ServiceType,
+	metadataService metadata.ServiceType,
+	quotasService quotas.ServiceType,
 	resizeQueue resize_queue.ServiceType,
 ) {
 	logging.Debugf("handlePost()")
 	username := r.Header.Get("username_token")
 
-	bytes, decodeErr := imagesService.ParseImage(r)
+	bytes, exifData, decodeErr := imagesService.ParseImage(r)
 	if decodeErr != nil {
 		logging.Errorf("imagesService.ParseImage() failed, err: %s", decodeErr.Error())
 		resp := http_responses.ErrorResponse{
@@ -53,7 +68,40 @@ func handlePost(
 	}
 	logging.Debugf("len(bytes): %d", len(bytes))
 
-	imageMeta, saveErr := imagesService.SaveUpload(&bytes, username, config.UploadsDir)
+	// the content hash is claimed before the upload is stored, a concurrent upload of the same
+	// content gets the receiptId of this one
+	contentHash := receipt_record.HashContent(bytes)
+	receiptId := receipt_record.ReceiptIDOf(username, contentHash)
+	owner, claimed, claimErr := recordsService.ClaimHash(username, contentHash, receiptId)
+	if claimErr != nil {
+		logging.Errorf("recordsService.ClaimHash() failed, err: %s", claimErr.Error())
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		logging.Infof("duplicate upload, receiptId: %s, contentHash: %s", owner, contentHash)
+		resp := http_responses.UploadResponse{
+			ReceiptID: owner,
+			Duplicate: true,
+		}
+		http_utils.SendUploadResponse(w, &resp)
+		return
+	}
+	defer recordsService.ReleaseHash(username, contentHash, receiptId)
+
+	quotaErr := quotasService.Reserve(username, int64(len(bytes)))
+	if quotaErr != nil {
+		logging.Warnf("quotasService.Reserve() failed, err: %s", quotaErr.Error())
+		sendQuotaErrorResponse(w, quotaErr)
+		return
+	}
+	// the stored upload is counted by its usage once SaveUpload returned
+	defer quotasService.Release(username, int64(len(bytes)))
+
+	imageMeta, saveErr := imagesService.SaveUpload(&bytes, username, receiptId, config.UploadsDir)
 	if saveErr != nil {
 		logging.Errorf("utils.SaveUpload() failed, err: %s", saveErr.Error())
 		resp := http_responses.ErrorResponse{
@@ -64,12 +112,34 @@ func handlePost(
 	}
 	logging.Infof("image has been saved, path: %s", imageMeta.Path)
 
-	task := tasks.ResizeTask{
-		ImageMeta: *imageMeta,
-		DestDir:   config.ResizedDir,
+	createdAt := time.Now().UTC()
+	receiptMetadata, metadataErr := receipt_metadata.New(imageMeta.ReceiptID, username, imageMeta.Path, bytes, exifData, createdAt, &config.Dimensions)
+	if metadataErr == nil {
+		metadataErr = metadataService.Put(receiptMetadata)
 	}
-	if !resizeQueue.Enqueue(task) {
-		logging.Warnf("resizeQueue.Enqueue() failed")
+	if metadataErr != nil {
+		logging.Errorf("metadataService.Put() failed, err: %s", metadataErr.Error())
+		discardUpload(imagesService, metadataService, imageMeta)
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+		return
+	}
+
+	record := receipt_record.ReceiptRecord{
+		ReceiptID:   imageMeta.ReceiptID,
+		Username:    username,
+		ContentHash: contentHash,
+		Path:        imageMeta.Path,
+		Size:        int64(len(bytes)),
+		CreatedAt:   createdAt,
+		Tier:        constants.TIER_HOT,
+	}
+	putErr := recordsService.Put(&record)
+	if putErr != nil {
+		logging.Errorf("recordsService.Put() failed, err: %s", putErr.Error())
+		discardUpload(imagesService, metadataService, imageMeta)
 		resp := http_responses.ErrorResponse{
 			Error: constants.HTTP_ERR_MSG_500,
 		}
@@ -77,9 +147,59 @@ func handlePost(
 		return
 	}
 
+	// the receipt is stored at this point, a task which can not be enqueued is picked up by
+	// the reconciler on the next start as the variants of the original are missing
+	task := tasks.ResizeTask{
+		ImageMeta: *imageMeta,
+		DestDir:   config.ResizedDir,
+	}
+	if !resizeQueue.Enqueue(task) {
+		logging.Warnf("resizeQueue.Enqueue() failed, receiptId: %s", imageMeta.ReceiptID)
+	}
+
 	receiptID := imageMeta.ReceiptID
 	resp := http_responses.UploadResponse{
 		ReceiptID: receiptID,
 	}
 	http_utils.SendUploadResponse(w, &resp)
 }
+
+// discardUpload removes the original and the metadata of an upload whose receipt could not be
+// stored, so a retry neither finds a leftover original nor counts the receipt twice
+func discardUpload(imagesService images.ServiceType, metadataService metadata.ServiceType, imageMeta *image_meta.ImageMeta) {
+	discardErr := imagesService.DiscardUpload(imageMeta)
+	if discardErr != nil {
+		logging.Errorf("imagesService.DiscardUpload() failed, err: %s", discardErr.Error())
+	}
+	deleteErr := metadataService.Delete(imageMeta.Username, imageMeta.ReceiptID)
+	if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+		logging.Errorf("metadataService.Delete() failed, err: %s", deleteErr.Error())
+	}
+}
+
+// sendQuotaErrorResponse responds 413 if the upload alone is larger than the quota of user,
+// or 507 if storing it would exceed the remaining quota
+func sendQuotaErrorResponse(w http.ResponseWriter, quotaErr error) {
+	switch {
+	case errors.Is(quotaErr, quotas.ErrUploadTooLarge):
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_413,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusRequestEntityTooLarge)
+	case errors.Is(quotaErr, quotas.ErrBytesExceeded):
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_507,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInsufficientStorage)
+	case errors.Is(quotaErr, quotas.ErrReceiptsExceeded):
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_507_RECEIPTS,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInsufficientStorage)
+	default:
+		resp := http_responses.ErrorResponse{
+			Error: constants.HTTP_ERR_MSG_500,
+		}
+		http_utils.SendErrorResponse(w, &resp, http.StatusInternalServerError)
+	}
+}
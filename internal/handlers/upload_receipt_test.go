@@ -1,14 +1,26 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/exif"
 	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
 	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/storage/storage_mock"
 	"receipt_uploader/internal/test_utils"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,13 +32,15 @@ func TestUploadReceiptHandler(t *testing.T) {
 		ResizedDir: "./mock-images",
 		Dimensions: configs.AllowedDimensions,
 	}
-	userToken := ""
+	userToken := "test_user"
 
 	test_utils.InitTestServer(&config)
 	defer os.RemoveAll(config.ResizedDir)
 	defer os.RemoveAll(config.UploadsDir)
 
-	imagesService := images.NewService(&config.Dimensions)
+	imagesService := images.NewService(&config.Dimensions, storage.NewFileSystem(""), &quotas_mock.ServiceMock{}, nil)
+	recordsService := records.NewService("records", storage.NewMemory())
+	quotasService := &quotas_mock.ServiceMock{}
 	mockResizeQueue := &resize_queue_mock.ServiceMock{}
 
 	t.Run("succeed, POST, 1200x1200 image", func(t *testing.T) {
@@ -40,7 +54,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&config, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
@@ -48,6 +62,222 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, status)
 	})
 
+	t.Run("succeed, POST, metadata of the receipt is stored", func(t *testing.T) {
+		fileName := "test_image_upload_metadata.jpg"
+
+		createErr := test_utils.CreateTestImageJPG(fileName, 1000, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+		assert.Nil(t, reqErr)
+
+		metadataService := metadata.NewMemory()
+		rr := httptest.NewRecorder()
+		UploadReceipt(&config, imagesService, recordsService, metadataService, quotasService, mockResizeQueue).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var resp http_responses.UploadResponse
+		unmarshalErr := json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Nil(t, unmarshalErr)
+
+		receiptMetadata, getErr := metadataService.Get(userToken, resp.ReceiptID)
+		assert.Nil(t, getErr)
+		assert.Equal(t, 1000, receiptMetadata.Width)
+		assert.Equal(t, 1200, receiptMetadata.Height)
+		assert.Len(t, receiptMetadata.Variants, len(config.Dimensions)+1)
+		for _, variant := range receiptMetadata.Variants {
+			assert.Equal(t, constants.VARIANT_STATUS_QUEUED, variant.Status)
+		}
+		assert.Nil(t, receiptMetadata.Exif)
+	})
+
+	t.Run("succeed, POST, EXIF of the receipt is stored", func(t *testing.T) {
+		fileName := "test_image_upload_exif.jpg"
+
+		createErr := test_utils.CreateTestImageWithExif(fileName, 1000, 1200, "2024:05:01 10:30:00", "+02:00", "Pixel 8")
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+		assert.Nil(t, reqErr)
+
+		metadataService := metadata.NewMemory()
+		rr := httptest.NewRecorder()
+		UploadReceipt(&config, imagesService, recordsService, metadataService, quotasService, mockResizeQueue).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var resp http_responses.UploadResponse
+		unmarshalErr := json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Nil(t, unmarshalErr)
+
+		receiptMetadata, getErr := metadataService.Get(userToken, resp.ReceiptID)
+		assert.Nil(t, getErr)
+		assert.Equal(t, 1000, receiptMetadata.Width)
+		assert.Equal(t, 1200, receiptMetadata.Height)
+		assert.Equal(t, &exif.Exif{
+			CapturedAt:  "2024-05-01T10:30:00+02:00",
+			Orientation: 6,
+			Model:       "Pixel 8",
+			HasGPS:      true,
+		}, receiptMetadata.Exif)
+	})
+
+	t.Run("succeed, POST, duplicate upload returns existing receiptId", func(t *testing.T) {
+		fileName := "test_image_duplicate_upload.jpg"
+		userToken := "duplicate_user"
+
+		createErr := test_utils.CreateTestImageJPG(fileName, 1200, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
+
+		req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+		assert.Nil(t, reqErr)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var firstResp http_responses.UploadResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &firstResp))
+		assert.False(t, firstResp.Duplicate)
+
+		dupReq, dupReqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+		assert.Nil(t, dupReqErr)
+		dupRR := httptest.NewRecorder()
+		handler.ServeHTTP(dupRR, dupReq)
+		assert.Equal(t, http.StatusOK, dupRR.Code)
+
+		var dupResp http_responses.UploadResponse
+		assert.Nil(t, json.Unmarshal(dupRR.Body.Bytes(), &dupResp))
+		assert.True(t, dupResp.Duplicate)
+		assert.Equal(t, firstResp.ReceiptID, dupResp.ReceiptID)
+
+		uploads, readErr := os.ReadDir(config.UploadsDir)
+		assert.Nil(t, readErr)
+		count := 0
+		for _, upload := range uploads {
+			if strings.HasPrefix(upload.Name(), userToken+"#") {
+				count++
+			}
+		}
+		assert.Equal(t, 1, count)
+
+		otherReq, otherReqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, "other_user")
+		assert.Nil(t, otherReqErr)
+		otherRR := httptest.NewRecorder()
+		handler.ServeHTTP(otherRR, otherReq)
+		assert.Equal(t, http.StatusCreated, otherRR.Code)
+	})
+
+	t.Run("succeed, POST, concurrent duplicate uploads store the receipt once", func(t *testing.T) {
+		fileName := "test_image_concurrent_upload.jpg"
+		userToken := "concurrent_user"
+
+		createErr := test_utils.CreateTestImageJPG(fileName, 1000, 1000)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
+
+		numUploads := 5
+		reqs := []*http.Request{}
+		for i := 0; i < numUploads; i++ {
+			req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+			assert.Nil(t, reqErr)
+			reqs = append(reqs, req)
+		}
+
+		var wg sync.WaitGroup
+		recorders := make([]*httptest.ResponseRecorder, numUploads)
+		for i, req := range reqs {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(rr *httptest.ResponseRecorder, req *http.Request) {
+				defer wg.Done()
+				handler.ServeHTTP(rr, req)
+			}(recorders[i], req)
+		}
+		wg.Wait()
+
+		created := 0
+		receiptIds := map[string]bool{}
+		for _, rr := range recorders {
+			var resp http_responses.UploadResponse
+			assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			receiptIds[resp.ReceiptID] = true
+			if rr.Code == http.StatusCreated {
+				created++
+				assert.False(t, resp.Duplicate)
+			} else {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.True(t, resp.Duplicate)
+			}
+		}
+		assert.Equal(t, 1, created)
+		assert.Len(t, receiptIds, 1)
+
+		uploads, readErr := os.ReadDir(config.UploadsDir)
+		assert.Nil(t, readErr)
+		count := 0
+		for _, upload := range uploads {
+			if strings.HasPrefix(upload.Name(), userToken+"#") {
+				count++
+			}
+		}
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("succeed, POST, concurrent uploads do not exceed the quota", func(t *testing.T) {
+		userToken := "quota_user"
+		quotaConfig := config
+		quotaConfig.RecordsDir = "records"
+		quotaConfig.Quota = configs.Quota{MaxReceipts: 2}
+		realQuotas := quotas.NewService(&quotaConfig, storage.NewMemory())
+		quotaImages := images.NewService(&config.Dimensions, storage.NewFileSystem(""), realQuotas, nil)
+		handler := UploadReceipt(&quotaConfig, quotaImages, recordsService, metadata.NewMemory(), realQuotas, mockResizeQueue)
+
+		numUploads := 5
+		reqs := []*http.Request{}
+		for i := 0; i < numUploads; i++ {
+			fileName := fmt.Sprintf("test_image_quota_%d.jpg", i)
+			createErr := test_utils.CreateTestImageJPG(fileName, 1000+i, 1000)
+			assert.Nil(t, createErr)
+			defer os.Remove(fileName)
+
+			req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+			assert.Nil(t, reqErr)
+			reqs = append(reqs, req)
+		}
+
+		var wg sync.WaitGroup
+		recorders := make([]*httptest.ResponseRecorder, numUploads)
+		for i, req := range reqs {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(rr *httptest.ResponseRecorder, req *http.Request) {
+				defer wg.Done()
+				handler.ServeHTTP(rr, req)
+			}(recorders[i], req)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, rr := range recorders {
+			if rr.Code == http.StatusCreated {
+				created++
+				continue
+			}
+			assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+		}
+		assert.Equal(t, 2, created)
+
+		current, getErr := realQuotas.GetUsage(userToken)
+		assert.Nil(t, getErr)
+		assert.Equal(t, 2, current.Receipts)
+	})
+
 	t.Run("should fail, POST, too small width", func(t *testing.T) {
 		fileName := "test_image_save_upload.jpg"
 
@@ -59,7 +289,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&config, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
@@ -78,7 +308,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&config, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
@@ -101,7 +331,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&config, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
@@ -124,7 +354,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&config, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
@@ -137,7 +367,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&config, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
@@ -145,7 +375,31 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Equal(t, http.StatusMethodNotAllowed, status)
 	})
 
-	t.Run("should fail, enqueue() failed", func(t *testing.T) {
+	t.Run("should fail, SaveUpload() failed", func(t *testing.T) {
+		fileName := "test_image_save_failed.jpg"
+		mockConfig := configs.Config{
+			UploadsDir: "mock_put_failed",
+			ResizedDir: "./mock-images",
+			Dimensions: configs.AllowedDimensions,
+		}
+		mockImagesService := images.NewService(&mockConfig.Dimensions, storage_mock.NewServiceMock(), &quotas_mock.ServiceMock{}, nil)
+
+		createErr := test_utils.CreateTestImageJPG(fileName, 1200, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := UploadReceipt(&mockConfig, mockImagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+
+	t.Run("succeed, POST, receipt is stored if enqueue() failed", func(t *testing.T) {
 		fileName := "test_image_enqueue_failed.jpg"
 		mockConfig := configs.Config{
 			UploadsDir: "./mock-uploads",
@@ -156,7 +410,7 @@ func TestUploadReceiptHandler(t *testing.T) {
 		defer os.RemoveAll(mockConfig.ResizedDir)
 		defer os.RemoveAll(mockConfig.UploadsDir)
 
-		userToken := ""
+		userToken := "enqueue_user"
 
 		createErr := test_utils.CreateTestImageJPG(fileName, 1200, 1200)
 		assert.Nil(t, createErr)
@@ -166,11 +420,90 @@ func TestUploadReceiptHandler(t *testing.T) {
 		assert.Nil(t, reqErr)
 
 		rr := httptest.NewRecorder()
-		handler := UploadReceipt(&mockConfig, imagesService, mockResizeQueue)
+		handler := UploadReceipt(&mockConfig, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
 
 		handler.ServeHTTP(rr, req)
 
-		status := rr.Code
-		assert.Equal(t, http.StatusInternalServerError, status)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var resp http_responses.UploadResponse
+		decodeErr := json.NewDecoder(rr.Body).Decode(&resp)
+		assert.Nil(t, decodeErr)
+		_, getErr := recordsService.Get(userToken, resp.ReceiptID)
+		assert.Nil(t, getErr)
+	})
+
+	t.Run("should fail, recordsService.Put() failed, the upload is discarded", func(t *testing.T) {
+		fileName := "test_image_record_failed.jpg"
+		userToken := "discard_user"
+		mockConfig := configs.Config{
+			UploadsDir: "./test_image_record_failed_uploads",
+			ResizedDir: "./test_image_record_failed_resized",
+			Dimensions: configs.AllowedDimensions,
+			Quota:      configs.Quota{MaxReceipts: 2},
+		}
+		defer os.RemoveAll(mockConfig.UploadsDir)
+		realQuotas := quotas.NewService(&mockConfig, storage.NewMemory())
+		discardImages := images.NewService(&mockConfig.Dimensions, storage.NewFileSystem(""), realQuotas, nil)
+		failingRecords := records.NewService("mock_put_failed", storage_mock.NewServiceMock())
+		metadataService := metadata.NewMemory()
+
+		createErr := test_utils.CreateTestImageJPG(fileName, 1200, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, userToken)
+		assert.Nil(t, reqErr)
+
+		rr := httptest.NewRecorder()
+		handler := UploadReceipt(&mockConfig, discardImages, failingRecords, metadataService, realQuotas, mockResizeQueue)
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+		entries, _ := os.ReadDir(mockConfig.UploadsDir)
+		assert.Empty(t, entries)
+		list, listErr := metadataService.List(userToken)
+		assert.Nil(t, listErr)
+		assert.Empty(t, list)
+		current, usageErr := realQuotas.GetUsage(userToken)
+		assert.Nil(t, usageErr)
+		assert.Equal(t, 0, current.Receipts)
+		assert.Equal(t, int64(0), current.Bytes)
+	})
+
+	t.Run("should fail, quota exceeded", func(t *testing.T) {
+		tests := []struct {
+			username string
+			status   int
+			errMsg   string
+		}{
+			{"mock_upload_too_large", http.StatusRequestEntityTooLarge, constants.HTTP_ERR_MSG_413},
+			{"mock_bytes_exceeded", http.StatusInsufficientStorage, constants.HTTP_ERR_MSG_507},
+			{"mock_receipts_exceeded", http.StatusInsufficientStorage, constants.HTTP_ERR_MSG_507_RECEIPTS},
+			{"mock_reserve_failed", http.StatusInternalServerError, constants.HTTP_ERR_MSG_500},
+		}
+
+		fileName := "test_image_quota_exceeded.jpg"
+		createErr := test_utils.CreateTestImageJPG(fileName, 1200, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(fileName)
+
+		for _, tc := range tests {
+			req, reqErr := test_utils.GenerateUploadRequest(t, "/receipts", fileName, tc.username)
+			assert.Nil(t, reqErr)
+
+			rr := httptest.NewRecorder()
+			handler := UploadReceipt(&config, imagesService, recordsService, metadata.NewMemory(), quotasService, mockResizeQueue)
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.status, rr.Code)
+			var resp http_responses.ErrorResponse
+			unmarshalErr := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.Nil(t, unmarshalErr)
+			assert.Equal(t, tc.errMsg, resp.Error)
+		}
 	})
 }
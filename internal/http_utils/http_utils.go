@@ -1,16 +1,21 @@
 package http_utils
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"receipt_uploader/internal/constants"
 	"receipt_uploader/internal/logging"
 	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/import_report"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -28,26 +33,159 @@ func SendErrorResponse(w http.ResponseWriter, resp *http_responses.ErrorResponse
 	sendJSONResponse(w, &errMap, status)
 }
 
+// SendUploadResponse responds 201 for a new receipt and 200 for a duplicate of an existing receipt
 func SendUploadResponse(w http.ResponseWriter, resp *http_responses.UploadResponse) {
-	respMap := map[string]string{
-		"receiptId": resp.ReceiptID,
+	status := http.StatusCreated
+	if resp.Duplicate {
+		status = http.StatusOK
 	}
-	sendJSONResponse(w, &respMap, http.StatusCreated)
+	w.Header().Set("Location", "/receipts/"+resp.ReceiptID)
+	sendJSONResponse(w, resp, status)
 }
 
-func SendGetImageResponse(w http.ResponseWriter, fileName string, fileBytes *[]byte) {
+// SendGetImageResponse streams the image of size bytes from reader, checksum is the hex encoded
+// SHA-256 of the image which is exposed as ETag and Digest headers, they are omitted if checksum is
+// empty. Once streaming started the status can not be changed anymore, a failure truncates the image.
+func SendGetImageResponse(w http.ResponseWriter, fileName string, reader io.Reader, size int64, checksum string) {
 	w.Header().Set("Content-Type", "image/jpeg")
 	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(*fileBytes)))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	setChecksumHeaders(w, checksum)
 
-	reader := bytes.NewReader(*fileBytes)
-	_, err := io.Copy(w, reader)
+	copied, err := io.Copy(w, reader)
 	if err != nil {
-		resp := http_responses.ErrorResponse{
-			Error: constants.HTTP_ERR_MSG_500,
+		logging.Errorf("io.Copy(fileName: %s) failed, copied: %d, err: %s", fileName, copied, err.Error())
+	}
+}
+
+// SendNotModifiedResponse responds 304 to a download whose If-None-Match matches the checksum of the image
+func SendNotModifiedResponse(w http.ResponseWriter, checksum string) {
+	setChecksumHeaders(w, checksum)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// ETag formats value as a strong entity tag, value identifies a version of a resource, e.g. the
+// hex encoded SHA-256 checksum of an image or the revision of the annotations of a receipt
+func ETag(value string) string {
+	return `"` + value + `"`
+}
+
+// MatchesIfNoneMatch tells if the If-None-Match header value matches the entity tag of value, tags
+// are compared weakly (RFC 9110)
+func MatchesIfNoneMatch(header, value string) bool {
+	return matchesETag(header, value, true)
+}
+
+// MatchesIfMatch tells if the If-Match header value matches the entity tag of value, tags are
+// compared strongly (RFC 9110), a weak tag never matches
+func MatchesIfMatch(header, value string) bool {
+	return matchesETag(header, value, false)
+}
+
+// matchesETag tells if one of the entity tags listed in header, or "*", matches the entity tag of
+// value. A weak tag matches only if weak is set.
+func matchesETag(header, value string, weak bool) bool {
+	if header == "" || value == "" {
+		return false
+	}
+	etag := ETag(value)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
 		}
-		SendErrorResponse(w, &resp, http.StatusInternalServerError)
 	}
+	return false
+}
+
+// setChecksumHeaders sets ETag and Digest (RFC 3230) headers of an image with checksum
+func setChecksumHeaders(w http.ResponseWriter, checksum string) {
+	if checksum == "" {
+		return
+	}
+	sum, decodeErr := hex.DecodeString(checksum)
+	if decodeErr != nil || len(sum) != sha256.Size {
+		logging.Warnf("invalid checksum: %s", checksum)
+		return
+	}
+	w.Header().Set("ETag", ETag(checksum))
+	w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+}
+
+func SendDeleteResponse(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func SendRestoreResponse(w http.ResponseWriter, resp *http_responses.RestoreResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendTrashListResponse(w http.ResponseWriter, resp *http_responses.TrashListResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendReceiptListResponse(w http.ResponseWriter, resp *http_responses.ReceiptListResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendReceiptStatusResponse(w http.ResponseWriter, resp *http_responses.ReceiptStatusResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+// SendPendingDownloadResponse responds 202 to a download of an image which is queued or being
+// generated, and 409 if generating it failed
+func SendPendingDownloadResponse(w http.ResponseWriter, resp *http_responses.PendingDownloadResponse) {
+	status := http.StatusAccepted
+	if resp.Status == constants.VARIANT_STATUS_FAILED {
+		status = http.StatusConflict
+	}
+	sendJSONResponse(w, resp, status)
+}
+
+// SendReceiptMetadataResponse responds with the metadata of a receipt, its ETag is set as header
+// so it can be sent back as If-Match of PATCH /receipts/{receiptId}
+func SendReceiptMetadataResponse(w http.ResponseWriter, resp *http_responses.ReceiptItem) {
+	w.Header().Set("ETag", resp.ETag)
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendCollectionItemResponse(w http.ResponseWriter, resp *http_responses.CollectionItem, status int) {
+	sendJSONResponse(w, resp, status)
+}
+
+func SendCollectionListResponse(w http.ResponseWriter, resp *http_responses.CollectionListResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendCollectionResponse(w http.ResponseWriter, resp *http_responses.CollectionResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendAuditListResponse(w http.ResponseWriter, resp *http_responses.AuditListResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendWorkerMetricsResponse(w http.ResponseWriter, resp *http_responses.WorkerMetricsResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendUsageResponse(w http.ResponseWriter, resp *http_responses.UsageResponse) {
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func SendImportResponse(w http.ResponseWriter, report *import_report.Report) {
+	sendJSONResponse(w, report, http.StatusOK)
+}
+
+// WriteExportHeaders sends the headers of a tar.gz archive, the archive is streamed afterwards
+// without Content-Length, so errors while streaming can only abort the response
+func WriteExportHeaders(w http.ResponseWriter, fileName string) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.WriteHeader(http.StatusOK)
 }
 
 func ValidateGetImageRequest(r *http.Request, dimensions *configs.Dimensions) (string, string, error) {
@@ -56,8 +194,7 @@ func ValidateGetImageRequest(r *http.Request, dimensions *configs.Dimensions) (s
 	receiptID := strings.TrimPrefix(r.URL.Path, "/receipts/")
 	logging.Debugf("receiptID: %s", receiptID)
 
-	re := regexp.MustCompile(`^[a-z0-9]+$`)
-	if !re.MatchString(receiptID) {
+	if !IsValidReceiptId(receiptID) {
 		return "", "", fmt.Errorf("invalid receiptId")
 	}
 
@@ -85,8 +222,190 @@ func ValidateGetImageRequest(r *http.Request, dimensions *configs.Dimensions) (s
 	return receiptID, size, nil
 }
 
-func sendJSONResponse(w http.ResponseWriter, response *map[string]string, status int) {
+// ValidateDeleteImageRequest validates DELETE /receipts/{receiptId}, no query parameter is accepted
+func ValidateDeleteImageRequest(r *http.Request) (string, error) {
+	logging.Debugf("ValidateDeleteImageRequest(r.URL.Path: %s)", r.URL.Path)
+
+	receiptID := strings.TrimPrefix(r.URL.Path, "/receipts/")
+	if !IsValidReceiptId(receiptID) {
+		return "", fmt.Errorf("invalid receiptId")
+	}
+
+	for key := range r.URL.Query() {
+		return "", fmt.Errorf("unrecognized parameter: %s", key)
+	}
+
+	return receiptID, nil
+}
+
+// ValidateUpdateRequest validates PATCH /receipts/{receiptId}, no query parameter is accepted and
+// the body must be JSON if its Content-Type is set
+func ValidateUpdateRequest(r *http.Request) (string, error) {
+	logging.Debugf("ValidateUpdateRequest(r.URL.Path: %s)", r.URL.Path)
+
+	receiptID := strings.TrimPrefix(r.URL.Path, "/receipts/")
+	if !IsValidReceiptId(receiptID) {
+		return "", fmt.Errorf("invalid receiptId")
+	}
+
+	for key := range r.URL.Query() {
+		return "", fmt.Errorf("unrecognized parameter: %s", key)
+	}
+
+	contentErr := validateContentType(r, "application/json", "application/merge-patch+json")
+	if contentErr != nil {
+		return "", contentErr
+	}
+
+	return receiptID, nil
+}
+
+// ValidateReceiptActionRequest validates requests to /receipts/{receiptId}/{action}, no query
+// parameter is accepted
+func ValidateReceiptActionRequest(r *http.Request, action string) (string, error) {
+	logging.Debugf("ValidateReceiptActionRequest(r.URL.Path: %s, action: %s)", r.URL.Path, action)
+
+	path := strings.TrimPrefix(r.URL.Path, "/receipts/")
+	receiptID, found := strings.CutSuffix(path, "/"+action)
+	if !found || !IsValidReceiptId(receiptID) {
+		return "", fmt.Errorf("invalid receiptId")
+	}
+
+	for key := range r.URL.Query() {
+		return "", fmt.Errorf("unrecognized parameter: %s", key)
+	}
+
+	return receiptID, nil
+}
+
+// ValidateExportRequest validates GET /receipts/export?sizes=small,large, it returns the requested
+// sizes, which must be names of dimensions. Only "sizes" parameter is accepted.
+func ValidateExportRequest(r *http.Request, dimensions *configs.Dimensions) ([]string, error) {
+	logging.Debugf("ValidateExportRequest(r.URL.RawQuery: %s)", r.URL.RawQuery)
+
+	for key := range r.URL.Query() {
+		if key != "sizes" {
+			return nil, fmt.Errorf("unrecognized parameter: %s", key)
+		}
+	}
+
+	sizes := []string{}
+	value := r.URL.Query().Get("sizes")
+	if value == "" {
+		return sizes, nil
+	}
+
+	for _, size := range strings.Split(value, ",") {
+		isValidSize := false
+		for _, dimension := range *dimensions {
+			if dimension.Name == size {
+				isValidSize = true
+				break
+			}
+		}
+		if !isValidSize {
+			return nil, fmt.Errorf("invalid sizes parameter, size: %s", size)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// ValidateCreateCollectionRequest validates POST /collections, no query parameter is accepted and
+// the body must be JSON if its Content-Type is set
+func ValidateCreateCollectionRequest(r *http.Request) error {
+	logging.Debugf("ValidateCreateCollectionRequest(r.URL.Path: %s)", r.URL.Path)
+
+	for key := range r.URL.Query() {
+		return fmt.Errorf("unrecognized parameter: %s", key)
+	}
+
+	return validateContentType(r, "application/json")
+}
+
+// ValidateCollectionRequest validates requests to /collections/{collectionId}, no query parameter
+// is accepted and the body must be JSON if its Content-Type is set
+func ValidateCollectionRequest(r *http.Request) (string, error) {
+	logging.Debugf("ValidateCollectionRequest(r.URL.Path: %s)", r.URL.Path)
+
+	collectionID := strings.TrimPrefix(r.URL.Path, "/collections/")
+	if !IsValidCollectionId(collectionID) {
+		return "", fmt.Errorf("invalid collectionId")
+	}
+
+	for key := range r.URL.Query() {
+		return "", fmt.Errorf("unrecognized parameter: %s", key)
+	}
+
+	contentErr := validateContentType(r, "application/json")
+	if contentErr != nil {
+		return "", contentErr
+	}
+
+	return collectionID, nil
+}
+
+// ValidateCollectionReceiptsRequest validates the path of GET /collections/{collectionId}/receipts,
+// its query parameters are the ones of GET /receipts
+func ValidateCollectionReceiptsRequest(r *http.Request) (string, error) {
+	logging.Debugf("ValidateCollectionReceiptsRequest(r.URL.Path: %s)", r.URL.Path)
+
+	path := strings.TrimPrefix(r.URL.Path, "/collections/")
+	collectionID, found := strings.CutSuffix(path, "/receipts")
+	if !found || !IsValidCollectionId(collectionID) {
+		return "", fmt.Errorf("invalid collectionId")
+	}
+
+	return collectionID, nil
+}
+
+// ValidateCollectionReceiptRequest validates requests to /collections/{collectionId}/receipts/{receiptId},
+// no query parameter is accepted
+func ValidateCollectionReceiptRequest(r *http.Request) (string, string, error) {
+	logging.Debugf("ValidateCollectionReceiptRequest(r.URL.Path: %s)", r.URL.Path)
+
+	path := strings.TrimPrefix(r.URL.Path, "/collections/")
+	collectionID, receiptID, found := strings.Cut(path, "/receipts/")
+	if !found || !IsValidCollectionId(collectionID) {
+		return "", "", fmt.Errorf("invalid collectionId")
+	}
+	if !IsValidReceiptId(receiptID) {
+		return "", "", fmt.Errorf("invalid receiptId")
+	}
+
+	for key := range r.URL.Query() {
+		return "", "", fmt.Errorf("unrecognized parameter: %s", key)
+	}
+
+	return collectionID, receiptID, nil
+}
+
+// validateContentType returns an error if the Content-Type of r is set and is not one of mediaTypes
+func validateContentType(r *http.Request, mediaTypes ...string) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil || !slices.Contains(mediaTypes, mediaType) {
+		return fmt.Errorf("unsupported Content-Type: %s", contentType)
+	}
+	return nil
+}
+
+func IsValidReceiptId(receiptID string) bool {
+	re := regexp.MustCompile(`^[a-z0-9]+$`)
+	return re.MatchString(receiptID)
+}
+
+// IsValidCollectionId reports if collectionID has the format of generated ids, the same as receiptIds
+func IsValidCollectionId(collectionID string) bool {
+	return IsValidReceiptId(collectionID)
+}
+
+func sendJSONResponse(w http.ResponseWriter, response interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(*response)
+	json.NewEncoder(w).Encode(response)
 }
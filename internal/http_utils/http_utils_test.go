@@ -129,3 +129,163 @@ func TestValidateGetImageRequest(t *testing.T) {
 		assert.Equal(t, "", size)
 	})
 }
+
+func TestValidateDeleteImageRequest(t *testing.T) {
+
+	t.Run("succeed", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "http://example.com/receipts/12345", nil)
+		receiptID, err := http_utils.ValidateDeleteImageRequest(req)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "12345", receiptID)
+	})
+
+	t.Run("should fail, invalid receiptId", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "http://example.com/receipts/456-78", nil)
+		receiptID, err := http_utils.ValidateDeleteImageRequest(req)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", receiptID)
+	})
+
+	t.Run("should fail, query parameter", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "http://example.com/receipts/12345?size=small", nil)
+		receiptID, err := http_utils.ValidateDeleteImageRequest(req)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", receiptID)
+	})
+}
+
+func TestValidateReceiptActionRequest(t *testing.T) {
+
+	t.Run("succeed", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "http://example.com/receipts/12345/restore", nil)
+		receiptID, err := http_utils.ValidateReceiptActionRequest(req, "restore")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "12345", receiptID)
+	})
+
+	t.Run("should fail, missing action", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "http://example.com/receipts/12345", nil)
+		receiptID, err := http_utils.ValidateReceiptActionRequest(req, "restore")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", receiptID)
+	})
+
+	t.Run("should fail, invalid receiptId", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "http://example.com/receipts/12/34/restore", nil)
+		receiptID, err := http_utils.ValidateReceiptActionRequest(req, "restore")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", receiptID)
+	})
+
+	t.Run("should fail, query parameter", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "http://example.com/receipts/12345/restore?size=small", nil)
+		receiptID, err := http_utils.ValidateReceiptActionRequest(req, "restore")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", receiptID)
+	})
+}
+
+func TestValidateExportRequest(t *testing.T) {
+	dimensions := configs.AllowedDimensions
+
+	t.Run("succeed, originals only", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/receipts/export", nil)
+		sizes, err := http_utils.ValidateExportRequest(req, &dimensions)
+
+		assert.Nil(t, err)
+		assert.Empty(t, sizes)
+	})
+
+	t.Run("succeed, with sizes", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/receipts/export?sizes=small,large", nil)
+		sizes, err := http_utils.ValidateExportRequest(req, &dimensions)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"small", "large"}, sizes)
+	})
+
+	t.Run("should fail, invalid size", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/receipts/export?sizes=small,huge", nil)
+		sizes, err := http_utils.ValidateExportRequest(req, &dimensions)
+
+		assert.NotNil(t, err)
+		assert.Nil(t, sizes)
+	})
+
+	t.Run("should fail, unrecognized parameter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/receipts/export?size=small", nil)
+		sizes, err := http_utils.ValidateExportRequest(req, &dimensions)
+
+		assert.NotNil(t, err)
+		assert.Nil(t, sizes)
+	})
+}
+
+func TestValidateCollectionReceiptRequest(t *testing.T) {
+
+	t.Run("succeed", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "http://example.com/collections/abc123/receipts/12345", nil)
+		collectionID, receiptID, err := http_utils.ValidateCollectionReceiptRequest(req)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "abc123", collectionID)
+		assert.Equal(t, "12345", receiptID)
+	})
+
+	t.Run("should fail, invalid collectionId", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "http://example.com/collections/abc/123/receipts/12345", nil)
+		_, _, err := http_utils.ValidateCollectionReceiptRequest(req)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should fail, invalid receiptId", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "http://example.com/collections/abc123/receipts/12/345", nil)
+		_, _, err := http_utils.ValidateCollectionReceiptRequest(req)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should fail, query parameter", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "http://example.com/collections/abc123/receipts/12345?size=small", nil)
+		_, _, err := http_utils.ValidateCollectionReceiptRequest(req)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMatchesETag(t *testing.T) {
+
+	t.Run("succeed, If-None-Match", func(t *testing.T) {
+		assert.True(t, http_utils.MatchesIfNoneMatch(`"abc"`, "abc"))
+		assert.True(t, http_utils.MatchesIfNoneMatch(`"xyz", W/"abc"`, "abc"))
+		assert.True(t, http_utils.MatchesIfNoneMatch("*", "abc"))
+	})
+
+	t.Run("succeed, If-Match", func(t *testing.T) {
+		assert.True(t, http_utils.MatchesIfMatch(`"3"`, "3"))
+		assert.True(t, http_utils.MatchesIfMatch(`"2", "3"`, "3"))
+		assert.True(t, http_utils.MatchesIfMatch("*", "3"))
+	})
+
+	t.Run("should fail, other entity tag", func(t *testing.T) {
+		assert.False(t, http_utils.MatchesIfNoneMatch(`"xyz"`, "abc"))
+		assert.False(t, http_utils.MatchesIfMatch(`"2"`, "3"))
+	})
+
+	t.Run("should fail, weak entity tag in If-Match", func(t *testing.T) {
+		assert.False(t, http_utils.MatchesIfMatch(`W/"3"`, "3"))
+	})
+
+	t.Run("should fail, no value", func(t *testing.T) {
+		assert.False(t, http_utils.MatchesIfNoneMatch(`"abc"`, ""))
+		assert.False(t, http_utils.MatchesIfMatch("", "3"))
+	})
+}
@@ -2,35 +2,50 @@ package images
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
+	"io"
+	"io/fs"
 	"net/http"
-	"os"
 	"path/filepath"
 	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/exif"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/http_requests"
 	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/storage"
+	"time"
 
 	"github.com/nfnt/resize"
 )
 
 type Service struct {
 	Dimensions *configs.Dimensions
+	Storage    storage.ServiceType
+	Usage      quotas.UsageTracker  // notified about bytes written for each user
+	Metadata   metadata.ServiceType // records the status of generated variants, nothing is recorded if nil
 }
 
-func NewService(d *configs.Dimensions) ServiceType {
+func NewService(d *configs.Dimensions, s storage.ServiceType, u quotas.UsageTracker, m metadata.ServiceType) ServiceType {
 	return &Service{
 		Dimensions: d,
+		Storage:    s,
+		Usage:      u,
+		Metadata:   m,
 	}
 }
 
 // GenerateResizedImages generates resized versions of an image based on
 // specified dimensions and saves them to a given destination directory.
 //
-// This method reads the original image file specified by imageMeta.Path,
+// This method reads the original image specified by imageMeta.Path from storage,
 // creates a directory structure for the specified username, and then
 // generates resized images according to predefined dimensions.
 // The resized images are saved in the destination directory.
@@ -61,51 +76,178 @@ func NewService(d *configs.Dimensions) ServiceType {
 func (s *Service) GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir string) error {
 	logging.Infof("GenerateResizedImages(srcPath: %s, destDir: %s)", imageMeta.Path, destDir)
 
-	fileBytes, readErr := os.ReadFile(imageMeta.Path)
+	s.markProcessing(imageMeta)
+	generated := map[string]receipt_metadata.Variant{}
+	generateErr := s.generate(imageMeta, destDir, generated)
+	s.recordVariants(imageMeta, generated, generateErr)
+	return generateErr
+}
+
+// resizeError is an error of generating variants with its constants.RESIZE_ERR_xxx category
+type resizeError struct {
+	category string
+	err      error
+}
+
+func (e *resizeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *resizeError) Unwrap() error {
+	return e.err
+}
+
+func newResizeError(category string, format string, a ...any) error {
+	return &resizeError{category: category, err: fmt.Errorf(format, a...)}
+}
+
+// errorCategory returns the constants.RESIZE_ERR_xxx category of an error returned by generate
+func errorCategory(err error) string {
+	var resizeErr *resizeError
+	if errors.As(err, &resizeErr) {
+		return resizeErr.category
+	}
+	return constants.RESIZE_ERR_RESIZE
+}
+
+// generate writes the copy and the resized images of imageMeta, every written image is added to
+// generated keyed by its variant name
+func (s *Service) generate(imageMeta *image_meta.ImageMeta, destDir string, generated map[string]receipt_metadata.Variant) error {
+	fileBytes, readErr := s.readImage(imageMeta.Path)
 	if readErr != nil {
-		return fmt.Errorf("os.ReadFile() failed: %v", readErr)
+		return newResizeError(constants.RESIZE_ERR_READ, "s.readImage() failed: %w", readErr)
 	}
 
 	destDir = filepath.Join(destDir, imageMeta.Username)
-	mkErr := os.MkdirAll(destDir, 0755)
+	mkErr := s.Storage.EnsureDir(destDir)
 	if mkErr != nil {
-		err := fmt.Errorf("os.Mkdir() failed, err: %s", mkErr.Error())
-		return err
+		return newResizeError(constants.RESIZE_ERR_WRITE, "s.Storage.EnsureDir() failed, err: %w", mkErr)
 	}
 
 	copyDestPath := image_meta.GetResizedPath(imageMeta, destDir, "")
 	logging.Debugf("copyDestPath: %s)", copyDestPath)
 
-	copyErr := saveImage(&fileBytes, copyDestPath)
+	written, copyErr := s.saveImage(&fileBytes, copyDestPath)
 	if copyErr != nil {
-		return fmt.Errorf("saveImage(copyDestPath: %s) failed, err: %s", copyDestPath, copyErr.Error())
+		return newResizeError(constants.RESIZE_ERR_WRITE, "saveImage(copyDestPath: %s) failed, err: %w", copyDestPath, copyErr)
 	}
+	defer func() {
+		s.trackUsage(imageMeta.Username, written, 0)
+	}()
 
 	img, _, decodeErr := image.Decode(bytes.NewReader(fileBytes))
 	if decodeErr != nil {
-		return fmt.Errorf("image.Decode() failed, err: %s", decodeErr.Error())
+		return newResizeError(constants.RESIZE_ERR_DECODE, "image.Decode() failed, err: %w", decodeErr)
 	}
+	generated[constants.VARIANT_ORIGINAL] = newVariant(&fileBytes, img.Bounds().Dx(), img.Bounds().Dy())
 
 	for _, d := range *s.Dimensions {
 		resizedImg, resizeErr := resizeImage(&img, d.Width, d.Height)
 		if resizeErr != nil {
-			return fmt.Errorf(
-				"resizeImage(srcPath: %s, width: %d, height: %d) failed, err: %s",
-				imageMeta.Path, d.Width, d.Height, resizeErr.Error(),
+			return newResizeError(
+				constants.RESIZE_ERR_RESIZE,
+				"resizeImage(srcPath: %s, width: %d, height: %d) failed, err: %w",
+				imageMeta.Path, d.Width, d.Height, resizeErr,
 			)
 		}
 
 		destPath := image_meta.GetResizedPath(imageMeta, destDir, d.Name)
 		logging.Debugf("destPath: %s", destPath)
-		saveErr := saveImage(&resizedImg, destPath)
+		resizedWritten, saveErr := s.saveImage(&resizedImg, destPath)
 		if saveErr != nil {
-			return fmt.Errorf("saveImage(destPath: %s) failed, err: %s", destPath, saveErr.Error())
+			return newResizeError(constants.RESIZE_ERR_WRITE, "saveImage(destPath: %s) failed, err: %w", destPath, saveErr)
 		}
+		written += resizedWritten
+
+		resizedConfig, _, configErr := image.DecodeConfig(bytes.NewReader(resizedImg))
+		if configErr != nil {
+			return newResizeError(constants.RESIZE_ERR_RESIZE, "image.DecodeConfig(destPath: %s) failed, err: %w", destPath, configErr)
+		}
+		generated[d.Name] = newVariant(&resizedImg, resizedConfig.Width, resizedConfig.Height)
 	}
 
 	return nil
 }
 
+// markProcessing marks all variants of imageMeta as being generated
+func (s *Service) markProcessing(imageMeta *image_meta.ImageMeta) {
+	s.updateVariants(imageMeta, func(name string, variant *receipt_metadata.Variant, now time.Time) bool {
+		variant.Status = constants.VARIANT_STATUS_PROCESSING
+		variant.StartedAt = now
+		return true
+	})
+}
+
+// recordVariants marks the generated variants of imageMeta as ready and the others as failed if
+// generating failed
+func (s *Service) recordVariants(imageMeta *image_meta.ImageMeta, generated map[string]receipt_metadata.Variant, generateErr error) {
+	s.updateVariants(imageMeta, func(name string, variant *receipt_metadata.Variant, now time.Time) bool {
+		ready, ok := generated[name]
+		if ok {
+			ready.StartedAt = variant.StartedAt
+			*variant = ready
+			return true
+		}
+		if generateErr == nil {
+			return false
+		}
+		variant.Status = constants.VARIANT_STATUS_FAILED
+		variant.Error = generateErr.Error()
+		variant.ErrorCategory = errorCategory(generateErr)
+		return true
+	})
+}
+
+// RecordFailure marks the variants of imageMeta which are still queued or being generated as
+// failed, e.g. once generating them timed out. Variants generated afterwards are marked as ready.
+func (s *Service) RecordFailure(imageMeta *image_meta.ImageMeta, category string, failure error) {
+	s.updateVariants(imageMeta, func(name string, variant *receipt_metadata.Variant, now time.Time) bool {
+		if !variant.IsPending() {
+			return false
+		}
+		variant.Status = constants.VARIANT_STATUS_FAILED
+		variant.Error = failure.Error()
+		variant.ErrorCategory = category
+		return true
+	})
+}
+
+// updateVariants applies update to every variant of imageMeta in the metadata store, update
+// returns if it changed the variant. Receipts without metadata, e.g. uploaded before it was
+// recorded, are skipped.
+func (s *Service) updateVariants(imageMeta *image_meta.ImageMeta, update func(name string, variant *receipt_metadata.Variant, now time.Time) bool) {
+	if s.Metadata == nil {
+		return
+	}
+
+	_, updateErr := s.Metadata.Update(imageMeta.Username, imageMeta.ReceiptID, func(m *receipt_metadata.ReceiptMetadata) error {
+		now := time.Now().UTC()
+		for _, name := range receipt_metadata.VariantNames(s.Dimensions) {
+			variant := m.Variants[name]
+			if !update(name, &variant, now) {
+				continue
+			}
+			variant.UpdatedAt = now
+			m.Variants[name] = variant
+			m.UpdatedAt = now
+		}
+		return nil
+	})
+	if updateErr != nil && !errors.Is(updateErr, fs.ErrNotExist) {
+		logging.Errorf("s.Metadata.Update(receiptId: %s) failed, err: %s", imageMeta.ReceiptID, updateErr.Error())
+	}
+}
+
+func newVariant(data *[]byte, width, height int) receipt_metadata.Variant {
+	return receipt_metadata.Variant{
+		Status:   constants.VARIANT_STATUS_READY,
+		Width:    width,
+		Height:   height,
+		Size:     int64(len(*data)),
+		Checksum: receipt_record.HashContent(*data),
+	}
+}
+
 // ParseImage processes an HTTP request to extract and validate an uploaded image file.
 //
 // This method parses a multipart form from the incoming HTTP request and attempts to
@@ -118,6 +260,7 @@ func (s *Service) GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir
 // - Reads the file's content and decodes it to check if it is a valid image.
 // - Validates the image format to ensure it is a JPEG image.
 // - Validates the dimensions of the image against specified minimum width and height.
+// - Parses the EXIF block of the image, see ParseExif.
 //
 // Parameters:
 //   - r: A pointer to an http.Request that contains the uploaded image
@@ -125,76 +268,160 @@ func (s *Service) GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir
 //
 // Returns:
 //   - A byte slice containing the raw image data if successful.
+//   - The parsed EXIF block, nil if the image has none.
 //   - An error if any of the following fail:
 //
 // Example:
 //
 //	func handler(w http.ResponseWriter, r *http.Request) {
 //	    service := &Service{}
-//	    imgData, err := service.ParseImage(r)
+//	    imgData, exifData, err := service.ParseImage(r)
 //	    if err != nil {
 //	        http.Error(w, err.Error(), http.StatusBadRequest)
 //	        return
 //	    }
-//	    // Process imgData as needed
+//	    // Process imgData and exifData as needed
 //	}
-func (s *Service) ParseImage(r *http.Request) ([]byte, error) {
+func (s *Service) ParseImage(r *http.Request) ([]byte, *exif.Exif, error) {
 	parseErr := r.ParseMultipartForm(constants.MAX_UPLOAD_SIZE)
 	if parseErr != nil {
-		return nil, fmt.Errorf("r.ParseMultipartForm() failed, err: %s", parseErr.Error())
+		return nil, nil, fmt.Errorf("r.ParseMultipartForm() failed, err: %s", parseErr.Error())
 	}
 	uploadRequest, reqErr := http_requests.ParseUploadRequest(r)
 	if reqErr != nil {
-		return nil, fmt.Errorf("http_requests.FromRequest() failed: %w", reqErr)
+		return nil, nil, fmt.Errorf("http_requests.FromRequest() failed: %w", reqErr)
+	}
+
+	validateErr := s.ValidateImage(uploadRequest.Payload)
+	if validateErr != nil {
+		return nil, nil, validateErr
+	}
+
+	return uploadRequest.Payload, s.ParseExif(uploadRequest.Payload), nil
+}
+
+// ParseExif returns the capture time, orientation, device and GPS presence recorded in the EXIF
+// block of a validated image, it is applied to every upload and import. An invalid EXIF block does
+// not reject the image, it is logged and nil is returned like for images without one.
+func (s *Service) ParseExif(payload []byte) *exif.Exif {
+	exifData, parseErr := exif.Parse(payload)
+	if parseErr != nil {
+		logging.Warnf("exif.Parse() failed, err: %s", parseErr.Error())
+		return nil
 	}
+	return exifData
+}
 
-	payloadSize := int64(len(uploadRequest.Payload))
+// ValidateImage checks that payload is a JPEG image within constants.MAX_UPLOAD_SIZE and at least
+// constants.IMAGE_SIZE_MIN_W x constants.IMAGE_SIZE_MIN_H, it is applied to every upload and import
+func (s *Service) ValidateImage(payload []byte) error {
+	payloadSize := int64(len(payload))
 	if payloadSize > constants.MAX_UPLOAD_SIZE {
-		return nil, fmt.Errorf("image size is too big, payloadSize=%d", payloadSize)
+		return fmt.Errorf("image size is too big, payloadSize=%d", payloadSize)
 	}
 
-	img, format, decodeErr := image.Decode(bytes.NewReader(uploadRequest.Payload))
+	img, format, decodeErr := image.Decode(bytes.NewReader(payload))
 	if decodeErr != nil {
-		return nil, fmt.Errorf("image.Decode() failed, err: %s", decodeErr.Error())
+		return fmt.Errorf("image.Decode() failed, err: %w", decodeErr)
 	}
 	if img.Bounds().Dx() < constants.IMAGE_SIZE_MIN_W || img.Bounds().Dy() < constants.IMAGE_SIZE_MIN_H {
-		return nil, fmt.Errorf("invalid image size, minHeight=%d, minWidth=%d", constants.IMAGE_SIZE_MIN_H, constants.IMAGE_SIZE_MIN_W)
+		return fmt.Errorf("invalid image size, minHeight=%d, minWidth=%d", constants.IMAGE_SIZE_MIN_H, constants.IMAGE_SIZE_MIN_W)
 	}
 
 	if format != "jpeg" {
-		return nil, fmt.Errorf("invalid image format, format=%s, only jpeg format is allowed", format)
+		return fmt.Errorf("invalid image format, format=%s, only jpeg format is allowed", format)
 	}
 
-	return uploadRequest.Payload, nil
+	return nil
 }
 
-func (s *Service) SaveUpload(bytes *[]byte, username, uploadDir string) (*image_meta.ImageMeta, error) {
-	logging.Debugf("SaveUpload(len(bytes): %d, uploadDir: %s)", len(*bytes), uploadDir)
+// SaveUpload stores an uploaded original of username's receipt receiptId in uploadDir
+func (s *Service) SaveUpload(bytes *[]byte, username, receiptId, uploadDir string) (*image_meta.ImageMeta, error) {
+	logging.Debugf("SaveUpload(len(bytes): %d, receiptId: %s, uploadDir: %s)", len(*bytes), receiptId, uploadDir)
 
-	mkErr := os.MkdirAll(uploadDir, 0755)
+	mkErr := s.Storage.EnsureDir(uploadDir)
 	if mkErr != nil {
-		err := fmt.Errorf("os.Mkdir() failed, err: %s", mkErr.Error())
+		err := fmt.Errorf("s.Storage.EnsureDir() failed, err: %s", mkErr.Error())
 		return nil, err
 	}
 
 	extension := "jpg"
-	imageMeta := image_meta.FromFormData(username, extension, uploadDir)
-	saveImage(bytes, imageMeta.Path)
+	imageMeta := image_meta.FromFormData(username, receiptId, extension, uploadDir)
+	written, saveErr := s.saveImage(bytes, imageMeta.Path)
+	if saveErr != nil {
+		return nil, fmt.Errorf("s.saveImage(path: %s) failed, err: %w", imageMeta.Path, saveErr)
+	}
+	s.trackUsage(username, written, 1)
 
 	return imageMeta, nil
 }
 
-func (s *Service) GetImage(imageMeta *image_meta.ImageMeta) ([]byte, string, error) {
+// DiscardUpload removes an original stored by SaveUpload whose receipt could not be stored,
+// the usage SaveUpload added for it is released
+func (s *Service) DiscardUpload(imageMeta *image_meta.ImageMeta) error {
+	logging.Debugf("DiscardUpload(imageMeta.Path: %s)", imageMeta.Path)
+
+	info, statErr := s.Storage.Stat(imageMeta.Path)
+	if statErr != nil {
+		return fmt.Errorf("s.Storage.Stat(path: %s) failed, err: %w", imageMeta.Path, statErr)
+	}
+	deleteErr := s.Storage.Delete(imageMeta.Path)
+	if deleteErr != nil {
+		return fmt.Errorf("s.Storage.Delete(path: %s) failed, err: %w", imageMeta.Path, deleteErr)
+	}
+	s.trackUsage(imageMeta.Username, -info.Size, -1)
+
+	return nil
+}
+
+// GetImage opens the image described by imageMeta for streaming and returns its size, the caller
+// must close it
+func (s *Service) GetImage(imageMeta *image_meta.ImageMeta) (io.ReadCloser, int64, error) {
 	logging.Debugf("GetImage(imageMeta.Path: %s, filaName: %s)", imageMeta.Path, imageMeta.FileName)
 
-	fileBytes, readErr := os.ReadFile(imageMeta.Path)
-	if readErr != nil {
-		if os.IsNotExist(readErr) {
-			return nil, "", readErr
+	info, statErr := s.Storage.Stat(imageMeta.Path)
+	if statErr != nil {
+		if errors.Is(statErr, fs.ErrNotExist) {
+			return nil, 0, statErr
+		}
+		return nil, 0, fmt.Errorf("s.Storage.Stat() failed: %v", statErr)
+	}
+	reader, getErr := s.Storage.Get(imageMeta.Path)
+	if getErr != nil {
+		if errors.Is(getErr, fs.ErrNotExist) {
+			return nil, 0, getErr
+		}
+		return nil, 0, fmt.Errorf("s.Storage.Get() failed: %v", getErr)
+	}
+	return reader, info.Size, nil
+}
+
+// DeleteImages removes the original upload described by imageMeta together with its copy and
+// all resized variants under resizedDir/{username}. An error wrapping fs.ErrNotExist is returned
+// if neither the original nor its copy exist, so a receipt of another user is reported as not found.
+func (s *Service) DeleteImages(imageMeta *image_meta.ImageMeta, resizedDir string) error {
+	logging.Debugf("DeleteImages(imageMeta.Path: %s, resizedDir: %s)", imageMeta.Path, resizedDir)
+
+	paths := image_meta.GetReceiptPaths(imageMeta, resizedDir, s.Dimensions)
+
+	deleted := 0
+	for i, path := range paths {
+		deleteErr := s.Storage.Delete(path)
+		if deleteErr == nil {
+			if i < 2 {
+				deleted++
+			}
+			continue
 		}
-		return nil, "", fmt.Errorf("os.ReadFile() failed: %v", readErr)
+		if !errors.Is(deleteErr, fs.ErrNotExist) {
+			return fmt.Errorf("s.Storage.Delete(path: %s) failed, err: %w", path, deleteErr)
+		}
+	}
+
+	if deleted == 0 {
+		return &fs.PathError{Op: "delete", Path: imageMeta.Path, Err: fs.ErrNotExist}
 	}
-	return fileBytes, imageMeta.FileName, nil
+	return nil
 }
 
 func resizeImage(img *image.Image, width, height int) ([]byte, error) {
@@ -210,19 +437,42 @@ func resizeImage(img *image.Image, width, height int) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func saveImage(bytes *[]byte, destPath string) error {
-	logging.Debugf("saveImage(len(bytes): %d, destPath: %s)", len(*bytes), destPath)
+// saveImage writes data to destPath and returns by how many bytes the stored size changed,
+// overwriting an existing file only counts the difference
+func (s *Service) saveImage(data *[]byte, destPath string) (int64, error) {
+	logging.Debugf("saveImage(len(data): %d, destPath: %s)", len(*data), destPath)
 
-	destFile, createErr := os.Create(destPath)
-	if createErr != nil {
-		return fmt.Errorf("os.Create() failed, err: %s", createErr.Error())
+	previousSize := int64(0)
+	info, statErr := s.Storage.Stat(destPath)
+	if statErr == nil {
+		previousSize = info.Size
 	}
-	defer destFile.Close()
 
-	_, writeErr := destFile.Write(*bytes)
-	if writeErr != nil {
-		return fmt.Errorf("file.Write() failed: %w", writeErr)
+	putErr := s.Storage.Put(destPath, bytes.NewReader(*data))
+	if putErr != nil {
+		return 0, fmt.Errorf("s.Storage.Put() failed: %w", putErr)
 	}
 
-	return nil
+	return int64(len(*data)) - previousSize, nil
+}
+
+// trackUsage reports written bytes to s.Usage, a failure only skews the usage and is logged
+func (s *Service) trackUsage(username string, written int64, receipts int) {
+	if written == 0 && receipts == 0 {
+		return
+	}
+	usageErr := s.Usage.AddUsage(username, written, receipts)
+	if usageErr != nil {
+		logging.Errorf("s.Usage.AddUsage(username: %s) failed, err: %s", username, usageErr.Error())
+	}
+}
+
+func (s *Service) readImage(srcPath string) ([]byte, error) {
+	reader, getErr := s.Storage.Get(srcPath)
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
 }
@@ -2,13 +2,23 @@ package images
 
 import (
 	"bytes"
+	"errors"
 	"image"
+	"io"
 	"os"
 	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/storage/storage_mock"
 	"receipt_uploader/internal/test_utils"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -25,7 +35,7 @@ func TestGenerateImages(t *testing.T) {
 	os.MkdirAll(destDir, 0755)
 	defer os.RemoveAll(baseDir)
 
-	service := NewService(&configs.AllowedDimensions)
+	service := NewService(&configs.AllowedDimensions, storage.NewFileSystem(""), &quotas_mock.ServiceMock{}, nil)
 
 	t.Run("succeed", func(t *testing.T) {
 		createErr := test_utils.CreateTestImageJPG(srcPath, 800, 1200)
@@ -54,6 +64,89 @@ func TestGenerateImages(t *testing.T) {
 	})
 }
 
+func TestRecordVariants(t *testing.T) {
+	username := "user1"
+	srcPath := filepath.Join("uploads", username+"#123456.jpg")
+
+	setup := func(t *testing.T) (ServiceType, metadata.ServiceType, *image_meta.ImageMeta) {
+		store := storage_mock.NewServiceMock()
+		metadataService := metadata.NewMemory()
+		service := NewService(&configs.AllowedDimensions, store, &quotas_mock.ServiceMock{}, metadataService)
+
+		testFilePath := filepath.Join(t.TempDir(), "test_record_variants.jpg")
+		createErr := test_utils.CreateTestImageJPG(testFilePath, 800, 1200)
+		assert.Nil(t, createErr)
+		data, readErr := os.ReadFile(testFilePath)
+		assert.Nil(t, readErr)
+		assert.Nil(t, store.Put(srcPath, bytes.NewReader(data)))
+
+		imageMeta, imageErr := image_meta.FromUploadDir(srcPath)
+		assert.Nil(t, imageErr)
+		receiptMetadata, newErr := receipt_metadata.New(imageMeta.ReceiptID, username, srcPath, data, nil, time.Now().UTC(), &configs.AllowedDimensions)
+		assert.Nil(t, newErr)
+		assert.Nil(t, metadataService.Put(receiptMetadata))
+		return service, metadataService, imageMeta
+	}
+
+	t.Run("succeed, generated variants are ready", func(t *testing.T) {
+		service, metadataService, imageMeta := setup(t)
+
+		genErr := service.GenerateResizedImages(imageMeta, "resized")
+		assert.Nil(t, genErr)
+
+		receiptMetadata, getErr := metadataService.Get(username, imageMeta.ReceiptID)
+		assert.Nil(t, getErr)
+		for _, name := range receipt_metadata.VariantNames(&configs.AllowedDimensions) {
+			variant := receiptMetadata.Variants[name]
+			assert.Equal(t, constants.VARIANT_STATUS_READY, variant.Status, name)
+			assert.NotEmpty(t, variant.Checksum, name)
+			assert.Greater(t, variant.Size, int64(0), name)
+			assert.False(t, variant.StartedAt.IsZero(), name)
+		}
+		assert.Equal(t, 800, receiptMetadata.Variants[constants.VARIANT_ORIGINAL].Width)
+	})
+
+	t.Run("should fail, variants which were not generated are failed", func(t *testing.T) {
+		service, metadataService, imageMeta := setup(t)
+
+		genErr := service.GenerateResizedImages(imageMeta, "mock_put_failed")
+		assert.NotNil(t, genErr)
+
+		receiptMetadata, getErr := metadataService.Get(username, imageMeta.ReceiptID)
+		assert.Nil(t, getErr)
+		for _, variant := range receiptMetadata.Variants {
+			assert.Equal(t, constants.VARIANT_STATUS_FAILED, variant.Status)
+			assert.Equal(t, constants.RESIZE_ERR_WRITE, variant.ErrorCategory)
+			assert.NotEmpty(t, variant.Error)
+		}
+	})
+
+	t.Run("succeed, pending variants fail on timeout, ready ones are kept", func(t *testing.T) {
+		service, metadataService, imageMeta := setup(t)
+		_, updateErr := metadataService.Update(username, imageMeta.ReceiptID, func(m *receipt_metadata.ReceiptMetadata) error {
+			m.Variants["small"] = receipt_metadata.Variant{Status: constants.VARIANT_STATUS_READY}
+			m.Variants["large"] = receipt_metadata.Variant{Status: constants.VARIANT_STATUS_PROCESSING}
+			return nil
+		})
+		assert.Nil(t, updateErr)
+
+		service.RecordFailure(imageMeta, constants.RESIZE_ERR_TIMEOUT, errors.New("timed out"))
+
+		receiptMetadata, getErr := metadataService.Get(username, imageMeta.ReceiptID)
+		assert.Nil(t, getErr)
+		assert.Equal(t, constants.VARIANT_STATUS_READY, receiptMetadata.Variants["small"].Status)
+		assert.Equal(t, constants.VARIANT_STATUS_FAILED, receiptMetadata.Variants["large"].Status)
+		assert.Equal(t, constants.RESIZE_ERR_TIMEOUT, receiptMetadata.Variants["large"].ErrorCategory)
+		assert.Equal(t, constants.VARIANT_STATUS_FAILED, receiptMetadata.Variants[constants.VARIANT_ORIGINAL].Status)
+
+		genErr := service.GenerateResizedImages(imageMeta, "resized")
+		assert.Nil(t, genErr)
+		receiptMetadata, _ = metadataService.Get(username, imageMeta.ReceiptID)
+		assert.Equal(t, constants.VARIANT_STATUS_READY, receiptMetadata.Variants["large"].Status)
+		assert.Empty(t, receiptMetadata.Variants["large"].ErrorCategory)
+	})
+}
+
 func TestResizeImage(t *testing.T) {
 
 	t.Run("succeed", func(t *testing.T) {
@@ -86,6 +179,36 @@ func TestResizeImage(t *testing.T) {
 	})
 }
 
+func TestValidateImage(t *testing.T) {
+	service := NewService(&configs.AllowedDimensions, storage.NewMemory(), &quotas_mock.ServiceMock{}, nil)
+
+	t.Run("succeed", func(t *testing.T) {
+		testFilePath := "test_validate_image.jpg"
+		createErr := test_utils.CreateTestImageJPG(testFilePath, 800, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(testFilePath)
+
+		fileBytes, readErr := os.ReadFile(testFilePath)
+		assert.Nil(t, readErr)
+		assert.Nil(t, service.ValidateImage(fileBytes))
+	})
+
+	t.Run("should fail, image too small", func(t *testing.T) {
+		testFilePath := "test_validate_image_small.jpg"
+		createErr := test_utils.CreateTestImageJPG(testFilePath, 100, 100)
+		assert.Nil(t, createErr)
+		defer os.Remove(testFilePath)
+
+		fileBytes, readErr := os.ReadFile(testFilePath)
+		assert.Nil(t, readErr)
+		assert.NotNil(t, service.ValidateImage(fileBytes))
+	})
+
+	t.Run("should fail, not an image", func(t *testing.T) {
+		assert.NotNil(t, service.ValidateImage([]byte("receipt")))
+	})
+}
+
 func TestGetImage(t *testing.T) {
 	username := "test_user"
 	baseDir := "mock-get-images"
@@ -94,7 +217,7 @@ func TestGetImage(t *testing.T) {
 	os.MkdirAll(srcDir, 0755)
 	defer os.RemoveAll(baseDir)
 
-	service := NewService(&configs.AllowedDimensions)
+	service := NewService(&configs.AllowedDimensions, storage.NewFileSystem(""), &quotas_mock.ServiceMock{}, nil)
 
 	t.Run("succeed, no size", func(t *testing.T) {
 		receiptId := "receiptId1"
@@ -109,10 +232,11 @@ func TestGetImage(t *testing.T) {
 			FileName: fileName,
 		}
 
-		fileBytes, fName, getErr := service.GetImage(imageMeta)
+		reader, imageSize, getErr := service.GetImage(imageMeta)
 		assert.Nil(t, getErr)
+		fileBytes := readAll(t, reader)
 		assert.Greater(t, len(fileBytes), 0)
-		assert.Equal(t, fileName, fName)
+		assert.Equal(t, int64(len(fileBytes)), imageSize)
 
 	})
 
@@ -130,10 +254,11 @@ func TestGetImage(t *testing.T) {
 			FileName: fileName,
 		}
 
-		fileBytes, fName, getErr := service.GetImage(imageMeta)
+		reader, imageSize, getErr := service.GetImage(imageMeta)
 		assert.Nil(t, getErr)
+		fileBytes := readAll(t, reader)
 		assert.Greater(t, len(fileBytes), 0)
-		assert.Equal(t, fileName, fName)
+		assert.Equal(t, int64(len(fileBytes)), imageSize)
 
 	})
 
@@ -151,10 +276,11 @@ func TestGetImage(t *testing.T) {
 			FileName: fileName,
 		}
 
-		fileBytes, fName, getErr := service.GetImage(imageMeta)
+		reader, imageSize, getErr := service.GetImage(imageMeta)
 		assert.Nil(t, getErr)
+		fileBytes := readAll(t, reader)
 		assert.Greater(t, len(fileBytes), 0)
-		assert.Equal(t, fileName, fName)
+		assert.Equal(t, int64(len(fileBytes)), imageSize)
 
 	})
 
@@ -169,11 +295,96 @@ func TestGetImage(t *testing.T) {
 			FileName: fileName,
 		}
 
-		fileBytes, fName, getErr := service.GetImage(imageMeta)
+		reader, imageSize, getErr := service.GetImage(imageMeta)
 		assert.NotNil(t, getErr)
 		assert.ErrorIs(t, getErr, os.ErrNotExist)
-		assert.Nil(t, fileBytes)
-		assert.Equal(t, "", fName)
+		assert.Nil(t, reader)
+		assert.Equal(t, int64(0), imageSize)
 
 	})
 }
+
+func TestGenerateImagesInMemory(t *testing.T) {
+	username := "user1"
+	uploadDir := "uploads"
+	destDir := "resized"
+	store := storage.NewMemory()
+	quotasService := quotas.NewService(&configs.Config{RecordsDir: "records"}, store)
+	service := NewService(&configs.AllowedDimensions, store, quotasService, nil)
+
+	t.Run("succeed", func(t *testing.T) {
+		testFilePath := "test_generate_in_memory.jpg"
+		createErr := test_utils.CreateTestImageJPG(testFilePath, 800, 1200)
+		assert.Nil(t, createErr)
+		defer os.Remove(testFilePath)
+
+		fileBytes, readErr := os.ReadFile(testFilePath)
+		assert.Nil(t, readErr)
+
+		imageMeta, saveErr := service.SaveUpload(&fileBytes, username, "inmemoryreceipt", uploadDir)
+		assert.Nil(t, saveErr)
+
+		genErr := service.GenerateResizedImages(imageMeta, destDir)
+		assert.Nil(t, genErr)
+
+		objects, listErr := store.List(filepath.Join(destDir, username))
+		assert.Nil(t, listErr)
+		assert.Len(t, objects, len(configs.AllowedDimensions)+1)
+
+		getMeta := image_meta.FromGetRequset(imageMeta.ReceiptID, "small", username, destDir)
+		reader, imageSize, getErr := service.GetImage(getMeta)
+		assert.Nil(t, getErr)
+		smallBytes := readAll(t, reader)
+		assert.Equal(t, int64(len(smallBytes)), imageSize)
+
+		img, _, decodeErr := image.Decode(bytes.NewReader(smallBytes))
+		assert.Nil(t, decodeErr)
+		assert.Equal(t, configs.AllowedDimensions[0].Height, img.Bounds().Dy())
+
+		expectedBytes := int64(len(fileBytes))
+		for _, object := range objects {
+			expectedBytes += object.Size
+		}
+		current, usageErr := quotasService.GetUsage(username)
+		assert.Nil(t, usageErr)
+		assert.Equal(t, expectedBytes, current.Bytes)
+		assert.Equal(t, 1, current.Receipts)
+
+		regenErr := service.GenerateResizedImages(imageMeta, destDir)
+		assert.Nil(t, regenErr)
+		regenerated, usageErr := quotasService.GetUsage(username)
+		assert.Nil(t, usageErr)
+		assert.Equal(t, expectedBytes, regenerated.Bytes, "overwriting variants should not count twice")
+	})
+}
+
+func TestSaveUpload(t *testing.T) {
+	service := NewService(&configs.AllowedDimensions, storage_mock.NewServiceMock(), &quotas_mock.ServiceMock{}, nil)
+	fileBytes := []byte("receipt")
+
+	t.Run("succeed", func(t *testing.T) {
+		imageMeta, saveErr := service.SaveUpload(&fileBytes, "user1", "savedreceipt", "uploads")
+		assert.Nil(t, saveErr)
+		assert.Equal(t, "user1", imageMeta.Username)
+		assert.Equal(t, "savedreceipt", imageMeta.ReceiptID)
+
+		reader, imageSize, getErr := service.GetImage(imageMeta)
+		assert.Nil(t, getErr)
+		assert.Equal(t, "receipt", string(readAll(t, reader)))
+		assert.Equal(t, int64(len(fileBytes)), imageSize)
+	})
+
+	t.Run("should fail, storage write failed", func(t *testing.T) {
+		imageMeta, saveErr := service.SaveUpload(&fileBytes, "user1", "savedreceipt", "mock_put_failed")
+		assert.NotNil(t, saveErr)
+		assert.Nil(t, imageMeta)
+	})
+}
+
+// readAll reads and closes an image opened by GetImage
+func readAll(t *testing.T, reader io.ReadCloser) []byte {
+	defer reader.Close()
+	data, readErr := io.ReadAll(reader)
+	assert.Nil(t, readErr)
+	return data
+}
@@ -2,18 +2,31 @@ package images_mock
 
 import (
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/exif"
 	"receipt_uploader/internal/models/image_meta"
+	"strings"
 	"time"
 )
 
 type ServiceMock struct{}
 
-func (s *ServiceMock) ParseImage(r *http.Request) ([]byte, error) {
+func (s *ServiceMock) ParseImage(r *http.Request) ([]byte, *exif.Exif, error) {
 	log.Println("images_mock.ParseImage()")
-	return nil, nil
+	return nil, nil, nil
+}
+
+func (s *ServiceMock) ParseExif(payload []byte) *exif.Exif {
+	log.Println("images_mock.ParseExif()")
+	return nil
+}
+
+func (s *ServiceMock) ValidateImage(payload []byte) error {
+	log.Println("images_mock.ValidateImage()")
+	return nil
 }
 
 func (s *ServiceMock) GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir string) error {
@@ -30,15 +43,32 @@ func (s *ServiceMock) GenerateResizedImages(imageMeta *image_meta.ImageMeta, des
 	return nil
 }
 
-func (s *ServiceMock) SaveUpload(bytes *[]byte, username, destDir string) (*image_meta.ImageMeta, error) {
+func (s *ServiceMock) RecordFailure(imageMeta *image_meta.ImageMeta, category string, failure error) {
+	log.Printf("images_mock.RecordFailure(srcPath: %s, category: %s)", imageMeta.Path, category)
+}
+
+func (s *ServiceMock) SaveUpload(bytes *[]byte, username, receiptId, destDir string) (*image_meta.ImageMeta, error) {
 	log.Println("images_mock.SaveUpload()")
 	return nil, nil
 }
 
-func (s *ServiceMock) GetImage(imageMeta *image_meta.ImageMeta) ([]byte, string, error) {
+func (s *ServiceMock) DiscardUpload(imageMeta *image_meta.ImageMeta) error {
+	log.Printf("images_mock.DiscardUpload(receiptId: %s)", imageMeta.ReceiptID)
+	return nil
+}
+
+func (s *ServiceMock) GetImage(imageMeta *image_meta.ImageMeta) (io.ReadCloser, int64, error) {
 	log.Printf("images_mock.GetImage(receiptId: %s)", imageMeta.ReceiptID)
 	if imageMeta.ReceiptID == "mockgetimagefailed" {
-		return nil, "", errors.New("mock GetImage() failed")
+		return nil, 0, errors.New("mock GetImage() failed")
 	}
-	return nil, "", nil
+	return io.NopCloser(strings.NewReader("")), 0, nil
+}
+
+func (s *ServiceMock) DeleteImages(imageMeta *image_meta.ImageMeta, resizedDir string) error {
+	log.Printf("images_mock.DeleteImages(receiptId: %s)", imageMeta.ReceiptID)
+	if imageMeta.ReceiptID == "mockdeleteimagesfailed" {
+		return errors.New("mock DeleteImages() failed")
+	}
+	return nil
 }
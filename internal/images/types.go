@@ -1,13 +1,20 @@
 package images
 
 import (
+	"io"
 	"net/http"
+	"receipt_uploader/internal/exif"
 	"receipt_uploader/internal/models/image_meta"
 )
 
 type ServiceType interface {
 	GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir string) error
-	SaveUpload(bytes *[]byte, username, destDir string) (*image_meta.ImageMeta, error)
-	ParseImage(r *http.Request) ([]byte, error)
-	GetImage(imageMeta *image_meta.ImageMeta) ([]byte, string, error)
+	RecordFailure(imageMeta *image_meta.ImageMeta, category string, failure error)
+	SaveUpload(bytes *[]byte, username, receiptId, destDir string) (*image_meta.ImageMeta, error)
+	DiscardUpload(imageMeta *image_meta.ImageMeta) error
+	ParseImage(r *http.Request) ([]byte, *exif.Exif, error)
+	ValidateImage(payload []byte) error
+	ParseExif(payload []byte) *exif.Exif
+	GetImage(imageMeta *image_meta.ImageMeta) (io.ReadCloser, int64, error)
+	DeleteImages(imageMeta *image_meta.ImageMeta, resizedDir string) error
 }
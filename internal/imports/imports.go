@@ -0,0 +1,378 @@
+package imports
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/export_manifest"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/import_report"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/storage"
+	"time"
+)
+
+// ErrInvalidArchive is returned if an archive is not a readable tar.gz, files read before
+// the error have been imported
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Service creates receipts from the JPEG images of a tar.gz archive or a directory, e.g. an archive
+// created by GET /receipts/export. An optional manifest.json, which must be the first entry of an
+// archive or in the root of a directory, provides the original timestamps and marks resized images,
+// which are skipped because they are generated again from the originals.
+type Service struct {
+	config         *configs.Config
+	storage        storage.ServiceType
+	imagesService  images.ServiceType
+	recordsService records.ServiceType
+	metadata       metadata.ServiceType
+	quotasService  quotas.ServiceType
+	resizeQueue    resize_queue.ServiceType
+	enqueueTimeout time.Duration
+}
+
+func NewService(
+	config *configs.Config,
+	s storage.ServiceType,
+	imagesService images.ServiceType,
+	recordsService records.ServiceType,
+	metadataService metadata.ServiceType,
+	quotasService quotas.ServiceType,
+	resizeQueue resize_queue.ServiceType,
+) ServiceType {
+	return &Service{
+		config:         config,
+		storage:        s,
+		imagesService:  imagesService,
+		recordsService: recordsService,
+		metadata:       metadataService,
+		quotasService:  quotasService,
+		resizeQueue:    resizeQueue,
+		enqueueTimeout: constants.IMPORT_ENQUEUE_TIMEOUT,
+	}
+}
+
+// ImportArchive imports every regular file of the tar.gz stream r for username. Files are read one
+// by one, the archive is never held in memory. The report is returned together with
+// ErrInvalidArchive if the archive turns out to be broken.
+func (s *Service) ImportArchive(username string, r io.Reader) (*import_report.Report, error) {
+	logging.Infof("imports.ImportArchive(username: %s)", username)
+
+	report := &import_report.Report{
+		Username: username,
+		Files:    []import_report.FileResult{},
+	}
+
+	gzipReader, gzipErr := gzip.NewReader(r)
+	if gzipErr != nil {
+		return report, fmt.Errorf("%w, gzip.NewReader() failed, err: %s", ErrInvalidArchive, gzipErr.Error())
+	}
+	defer gzipReader.Close()
+
+	manifest := map[string]export_manifest.ManifestFile{}
+	tarReader := tar.NewReader(gzipReader)
+	isFirstFile := true
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return report, fmt.Errorf("%w, tarReader.Next() failed, err: %s", ErrInvalidArchive, nextErr.Error())
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name) // e.g. ./receipts/123.jpg created by tar -C dir .
+		if isFirstFile && name == export_manifest.MANIFEST_FILE_NAME {
+			isFirstFile = false
+			var manifestErr error
+			manifest, manifestErr = readManifest(tarReader)
+			if manifestErr != nil {
+				return report, fmt.Errorf("%w, readManifest() failed, err: %s", ErrInvalidArchive, manifestErr.Error())
+			}
+			continue
+		}
+		isFirstFile = false
+
+		data, readErr := readLimited(tarReader, header.Size)
+		if readErr != nil {
+			report.Add(failed(name, readErr.Error()))
+			continue
+		}
+		report.Add(s.importFile(username, name, data, header.ModTime, manifest))
+	}
+
+	logging.Infof(
+		"import completed, username: %s, imported: %d, duplicates: %d, skipped: %d, failed: %d",
+		username, report.Imported, report.Duplicates, report.Skipped, report.Failed,
+	)
+	return report, nil
+}
+
+// ImportDir imports every regular file under dir of the local filesystem for username
+func (s *Service) ImportDir(username, dir string) (*import_report.Report, error) {
+	logging.Infof("imports.ImportDir(username: %s, dir: %s)", username, dir)
+
+	report := &import_report.Report{
+		Username: username,
+		Files:    []import_report.FileResult{},
+	}
+
+	manifest := map[string]export_manifest.ManifestFile{}
+	manifestFile, openErr := os.Open(filepath.Join(dir, export_manifest.MANIFEST_FILE_NAME))
+	if openErr == nil {
+		var manifestErr error
+		manifest, manifestErr = readManifest(manifestFile)
+		manifestFile.Close()
+		if manifestErr != nil {
+			return nil, fmt.Errorf("readManifest() failed, err: %w", manifestErr)
+		}
+	} else if !errors.Is(openErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("os.Open(manifest) failed, err: %w", openErr)
+	}
+
+	walkErr := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		name, relErr := filepath.Rel(dir, filePath)
+		if relErr != nil {
+			return relErr
+		}
+		name = filepath.ToSlash(name)
+		if name == export_manifest.MANIFEST_FILE_NAME {
+			return nil
+		}
+
+		info, infoErr := d.Info()
+		if infoErr != nil {
+			report.Add(failed(name, infoErr.Error()))
+			return nil
+		}
+		data, readErr := readFile(filePath, info.Size())
+		if readErr != nil {
+			report.Add(failed(name, readErr.Error()))
+			return nil
+		}
+		report.Add(s.importFile(username, name, data, info.ModTime(), manifest))
+		return nil
+	})
+	if walkErr != nil {
+		return report, fmt.Errorf("filepath.WalkDir() failed, err: %w", walkErr)
+	}
+
+	logging.Infof(
+		"import completed, username: %s, imported: %d, duplicates: %d, skipped: %d, failed: %d",
+		username, report.Imported, report.Duplicates, report.Skipped, report.Failed,
+	)
+	return report, nil
+}
+
+// importFile runs data through the same checks as POST /receipts and creates a receipt which
+// keeps modTime, or the timestamp recorded in manifest, as its creation time
+func (s *Service) importFile(
+	username, name string,
+	data []byte,
+	modTime time.Time,
+	manifest map[string]export_manifest.ManifestFile,
+) import_report.FileResult {
+	logging.Debugf("importFile(name: %s, len(data): %d)", name, len(data))
+
+	if file, ok := manifest[name]; ok {
+		if file.Variant != "" {
+			return import_report.FileResult{Name: name, Status: import_report.STATUS_SKIPPED}
+		}
+		modTime = file.ModTime
+	}
+	createdAt := modTime.UTC()
+
+	validateErr := s.imagesService.ValidateImage(data)
+	if validateErr != nil {
+		return failed(name, validateErr.Error())
+	}
+
+	contentHash := receipt_record.HashContent(data)
+	receiptId := receipt_record.ReceiptIDOf(username, contentHash)
+	owner, claimed, claimErr := s.recordsService.ClaimHash(username, contentHash, receiptId)
+	if claimErr != nil {
+		logging.Errorf("s.recordsService.ClaimHash() failed, err: %s", claimErr.Error())
+		return failed(name, constants.HTTP_ERR_MSG_500)
+	}
+	if !claimed {
+		result := import_report.FileResult{
+			Name:      name,
+			Status:    import_report.STATUS_DUPLICATE,
+			ReceiptID: owner,
+		}
+		if existing, getErr := s.recordsService.Get(username, owner); getErr == nil {
+			result.CreatedAt = existing.CreatedAt
+		}
+		return result
+	}
+	defer s.recordsService.ReleaseHash(username, contentHash, receiptId)
+
+	quotaErr := s.quotasService.Reserve(username, int64(len(data)))
+	if quotaErr != nil {
+		logging.Warnf("s.quotasService.Reserve() failed, err: %s", quotaErr.Error())
+		return failed(name, quotaMessage(quotaErr))
+	}
+	defer s.quotasService.Release(username, int64(len(data)))
+
+	imageMeta, saveErr := s.imagesService.SaveUpload(&data, username, receiptId, s.config.UploadsDir)
+	if saveErr != nil {
+		logging.Errorf("s.imagesService.SaveUpload() failed, err: %s", saveErr.Error())
+		return failed(name, constants.HTTP_ERR_MSG_500)
+	}
+
+	if setter, ok := s.storage.(storage.ModTimeSetter); ok {
+		setErr := setter.SetModTime(imageMeta.Path, createdAt)
+		if setErr != nil {
+			logging.Warnf("setter.SetModTime(path: %s) failed, err: %s", imageMeta.Path, setErr.Error())
+		}
+	}
+
+	exifData := s.imagesService.ParseExif(data)
+	receiptMetadata, metadataErr := receipt_metadata.New(imageMeta.ReceiptID, username, imageMeta.Path, data, exifData, createdAt, &s.config.Dimensions)
+	if metadataErr == nil {
+		metadataErr = s.metadata.Put(receiptMetadata)
+	}
+	if metadataErr != nil {
+		logging.Errorf("s.metadata.Put() failed, err: %s", metadataErr.Error())
+		s.discardUpload(imageMeta)
+		return failed(name, constants.HTTP_ERR_MSG_500)
+	}
+
+	record := receipt_record.ReceiptRecord{
+		ReceiptID:   imageMeta.ReceiptID,
+		Username:    username,
+		ContentHash: contentHash,
+		Path:        imageMeta.Path,
+		Size:        int64(len(data)),
+		CreatedAt:   createdAt,
+		Tier:        constants.TIER_HOT,
+	}
+	putErr := s.recordsService.Put(&record)
+	if putErr != nil {
+		logging.Errorf("s.recordsService.Put() failed, err: %s", putErr.Error())
+		s.discardUpload(imageMeta)
+		return failed(name, constants.HTTP_ERR_MSG_500)
+	}
+
+	task := tasks.ResizeTask{
+		ImageMeta: *imageMeta,
+		DestDir:   s.config.ResizedDir,
+	}
+	return import_report.FileResult{
+		Name:         name,
+		Status:       import_report.STATUS_IMPORTED,
+		ReceiptID:    imageMeta.ReceiptID,
+		CreatedAt:    createdAt,
+		ResizeQueued: s.enqueue(task),
+	}
+}
+
+// discardUpload removes the original and the metadata of a file whose receipt could not be
+// stored, so importing the archive again neither finds a leftover original nor counts it twice
+func (s *Service) discardUpload(imageMeta *image_meta.ImageMeta) {
+	discardErr := s.imagesService.DiscardUpload(imageMeta)
+	if discardErr != nil {
+		logging.Errorf("s.imagesService.DiscardUpload() failed, err: %s", discardErr.Error())
+	}
+	deleteErr := s.metadata.Delete(imageMeta.Username, imageMeta.ReceiptID)
+	if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+		logging.Errorf("s.metadata.Delete() failed, err: %s", deleteErr.Error())
+	}
+}
+
+// enqueue retries until resize_queue has space or s.enqueueTimeout is over, an import can
+// easily submit more tasks than config.QueueCapacity
+func (s *Service) enqueue(task tasks.ResizeTask) bool {
+	deadline := time.Now().Add(s.enqueueTimeout)
+	for {
+		if s.resizeQueue.Enqueue(task) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			logging.Warnf("resizeQueue.Enqueue() failed, path: %s", task.ImageMeta.Path)
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func readManifest(r io.Reader) (map[string]export_manifest.ManifestFile, error) {
+	var manifest export_manifest.Manifest
+	decodeErr := json.NewDecoder(r).Decode(&manifest)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("json.Decode() failed, err: %w", decodeErr)
+	}
+
+	files := map[string]export_manifest.ManifestFile{}
+	for _, file := range manifest.Files {
+		files[file.ArchivePath] = file
+	}
+	return files, nil
+}
+
+// readLimited reads a file of size bytes, files larger than constants.MAX_UPLOAD_SIZE are rejected
+// without being read
+func readLimited(r io.Reader, size int64) ([]byte, error) {
+	if size > constants.MAX_UPLOAD_SIZE {
+		return nil, fmt.Errorf("image size is too big, payloadSize=%d", size)
+	}
+	return io.ReadAll(io.LimitReader(r, size))
+}
+
+func readFile(filePath string, size int64) ([]byte, error) {
+	file, openErr := os.Open(filePath)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+
+	return readLimited(file, size)
+}
+
+func failed(name, message string) import_report.FileResult {
+	return import_report.FileResult{
+		Name:   name,
+		Status: import_report.STATUS_FAILED,
+		Error:  message,
+	}
+}
+
+// quotaMessage returns the same error message as POST /receipts for quotaErr
+func quotaMessage(quotaErr error) string {
+	switch {
+	case errors.Is(quotaErr, quotas.ErrUploadTooLarge):
+		return constants.HTTP_ERR_MSG_413
+	case errors.Is(quotaErr, quotas.ErrBytesExceeded):
+		return constants.HTTP_ERR_MSG_507
+	case errors.Is(quotaErr, quotas.ErrReceiptsExceeded):
+		return constants.HTTP_ERR_MSG_507_RECEIPTS
+	default:
+		return constants.HTTP_ERR_MSG_500
+	}
+}
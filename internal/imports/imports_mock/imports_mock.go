@@ -0,0 +1,29 @@
+package imports_mock
+
+import (
+	"errors"
+	"io"
+	"receipt_uploader/internal/imports"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/import_report"
+)
+
+type ServiceMock struct{}
+
+func (s *ServiceMock) ImportArchive(username string, r io.Reader) (*import_report.Report, error) {
+	logging.Debugf("imports_mock.ImportArchive(username: %s)", username)
+	report := &import_report.Report{Username: username, Files: []import_report.FileResult{}}
+
+	switch username {
+	case "mock_invalid_archive":
+		return report, imports.ErrInvalidArchive
+	case "mock_import_failed":
+		return report, errors.New("mock ImportArchive() failed")
+	}
+	return report, nil
+}
+
+func (s *ServiceMock) ImportDir(username, dir string) (*import_report.Report, error) {
+	logging.Debugf("imports_mock.ImportDir(username: %s, dir: %s)", username, dir)
+	return &import_report.Report{Username: username, Files: []import_report.FileResult{}}, nil
+}
@@ -0,0 +1,198 @@
+package imports
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/export_manifest"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/import_report"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/resize_queue/resize_queue_mock"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/storage/storage_mock"
+	"receipt_uploader/internal/test_utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type archiveEntry struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+func buildArchive(t *testing.T, entries []archiveEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{
+			Name:    entry.name,
+			Mode:    0644,
+			Size:    int64(len(entry.data)),
+			ModTime: entry.modTime,
+		}))
+		_, writeErr := tarWriter.Write(entry.data)
+		assert.Nil(t, writeErr)
+	}
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+	return &buf
+}
+
+func readTestImage(t *testing.T, fileName string, width, height int) []byte {
+	createErr := test_utils.CreateTestImageJPG(fileName, width, height)
+	assert.Nil(t, createErr)
+	defer os.Remove(fileName)
+
+	data, readErr := os.ReadFile(fileName)
+	assert.Nil(t, readErr)
+	return data
+}
+
+func TestImports(t *testing.T) {
+	config := &configs.Config{
+		UploadsDir: "uploads",
+		ResizedDir: "resized",
+		RecordsDir: "records",
+		Dimensions: configs.AllowedDimensions,
+	}
+	store := storage.NewMemory()
+	imagesService := images.NewService(&config.Dimensions, store, &quotas_mock.ServiceMock{}, nil)
+	recordsService := records.NewService(config.RecordsDir, store)
+	service := NewService(config, store, imagesService, recordsService, metadata.NewMemory(), &quotas_mock.ServiceMock{}, &resize_queue_mock.ServiceMock{})
+
+	receipt := readTestImage(t, "test_import_receipt.jpg", 800, 1200)
+	other := readTestImage(t, "test_import_other.jpg", 800, 1200)
+	tooSmall := readTestImage(t, "test_import_small.jpg", 100, 100)
+	createdAt := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("succeed, archive with manifest", func(t *testing.T) {
+		manifest := export_manifest.Manifest{
+			Username: "user1",
+			Files: []export_manifest.ManifestFile{
+				{ArchivePath: "receipts/123.jpg", ModTime: createdAt},
+				{ArchivePath: "receipts/123_small.jpg", Variant: "small"},
+			},
+		}
+		manifestBytes, marshalErr := json.Marshal(manifest)
+		assert.Nil(t, marshalErr)
+
+		archive := buildArchive(t, []archiveEntry{
+			{name: export_manifest.MANIFEST_FILE_NAME, data: manifestBytes},
+			{name: "receipts/123.jpg", data: receipt, modTime: time.Now()},
+			{name: "receipts/123_small.jpg", data: tooSmall},
+			{name: "receipts/notes.txt", data: []byte("not an image")},
+		})
+
+		report, importErr := service.ImportArchive("user1", archive)
+		assert.Nil(t, importErr)
+		assert.Equal(t, 1, report.Imported)
+		assert.Equal(t, 1, report.Skipped)
+		assert.Equal(t, 1, report.Failed)
+		assert.Len(t, report.Files, 3)
+
+		imported := report.Files[0]
+		assert.Equal(t, import_report.STATUS_IMPORTED, imported.Status)
+		assert.True(t, imported.ResizeQueued)
+		assert.True(t, createdAt.Equal(imported.CreatedAt))
+
+		record, getErr := recordsService.Get("user1", imported.ReceiptID)
+		assert.Nil(t, getErr)
+		assert.True(t, createdAt.Equal(record.CreatedAt))
+
+		info, statErr := store.Stat(image_meta.FromReceiptID("user1", imported.ReceiptID, config.UploadsDir).Path)
+		assert.Nil(t, statErr)
+		assert.True(t, createdAt.Equal(info.ModTime))
+
+		assert.Equal(t, import_report.STATUS_FAILED, report.Files[2].Status)
+		assert.NotEmpty(t, report.Files[2].Error)
+	})
+
+	t.Run("succeed, archive without manifest keeps timestamps of entries", func(t *testing.T) {
+		archive := buildArchive(t, []archiveEntry{
+			{name: "./other.jpg", data: other, modTime: createdAt},
+			{name: "./again.jpg", data: receipt, modTime: createdAt},
+		})
+
+		report, importErr := service.ImportArchive("user1", archive)
+		assert.Nil(t, importErr)
+		assert.Equal(t, 1, report.Imported)
+		assert.Equal(t, 1, report.Duplicates)
+		assert.Equal(t, "other.jpg", report.Files[0].Name)
+		assert.True(t, createdAt.Equal(report.Files[0].CreatedAt))
+		assert.Equal(t, import_report.STATUS_DUPLICATE, report.Files[1].Status)
+		assert.NotEmpty(t, report.Files[1].ReceiptID)
+	})
+
+	t.Run("succeed, directory", func(t *testing.T) {
+		dir := "test-import-dir"
+		defer os.RemoveAll(dir)
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, "2019"), 0755))
+		path := filepath.Join(dir, "2019", "receipt.jpg")
+		assert.Nil(t, os.WriteFile(path, receipt, 0644))
+		assert.Nil(t, os.Chtimes(path, createdAt, createdAt))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "small.jpg"), tooSmall, 0644))
+
+		report, importErr := service.ImportDir("user2", dir)
+		assert.Nil(t, importErr)
+		assert.Equal(t, 1, report.Imported)
+		assert.Equal(t, 1, report.Failed)
+		for _, file := range report.Files {
+			if file.Name == "2019/receipt.jpg" {
+				assert.True(t, createdAt.Equal(file.CreatedAt))
+			}
+		}
+	})
+
+	t.Run("should fail, recordsService.Put() failed, the file is discarded", func(t *testing.T) {
+		failingStore := storage_mock.NewServiceMock()
+		failingRecords := records.NewService("mock_put_failed", failingStore)
+		metadataService := metadata.NewMemory()
+		failing := NewService(config, store, imagesService, failingRecords, metadataService, &quotas_mock.ServiceMock{}, &resize_queue_mock.ServiceMock{})
+
+		archive := buildArchive(t, []archiveEntry{{name: "receipt.jpg", data: receipt}})
+
+		report, importErr := failing.ImportArchive("user4", archive)
+		assert.Nil(t, importErr)
+		assert.Equal(t, 1, report.Failed)
+
+		receiptId := receipt_record.ReceiptIDOf("user4", receipt_record.HashContent(receipt))
+		_, statErr := store.Stat(image_meta.FromReceiptID("user4", receiptId, config.UploadsDir).Path)
+		assert.ErrorIs(t, statErr, fs.ErrNotExist)
+		list, metadataErr := metadataService.List("user4")
+		assert.Nil(t, metadataErr)
+		assert.Empty(t, list)
+	})
+
+	t.Run("should fail, not a tar.gz", func(t *testing.T) {
+		report, importErr := service.ImportArchive("user1", bytes.NewReader([]byte("receipts")))
+		assert.ErrorIs(t, importErr, ErrInvalidArchive)
+		assert.Empty(t, report.Files)
+	})
+
+	t.Run("should fail, truncated archive", func(t *testing.T) {
+		archive := buildArchive(t, []archiveEntry{{name: "receipt.jpg", data: receipt}})
+		truncated := archive.Bytes()[:archive.Len()/2]
+
+		_, importErr := service.ImportArchive("user3", bytes.NewReader(truncated))
+		assert.ErrorIs(t, importErr, ErrInvalidArchive)
+	})
+
+	t.Run("should fail, directory does not exist", func(t *testing.T) {
+		_, importErr := service.ImportDir("user1", "test-import-non-existing")
+		assert.NotNil(t, importErr)
+	})
+}
@@ -0,0 +1,11 @@
+package imports
+
+import (
+	"io"
+	"receipt_uploader/internal/models/import_report"
+)
+
+type ServiceType interface {
+	ImportArchive(username string, r io.Reader) (*import_report.Report, error)
+	ImportDir(username, dir string) (*import_report.Report, error)
+}
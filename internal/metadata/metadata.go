@@ -0,0 +1,478 @@
+package metadata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+const (
+	opPut         = "put"
+	opDelete      = "delete"
+	maxEntrySize  = 1024 * 1024 // max size of a line of the log
+	tempExtension = ".tmp"      // extension of the log being compacted
+	lockExtension = ".lock"     // extension of the file locked by the process owning the log
+)
+
+// Service keeps the metadata of all receipts in memory and persists every change to an append-only
+// log file, one JSON entry per line:
+//
+//	{"version":1}
+//	{"op":"put","metadata":{"receiptId":"...","username":"...",...}}
+//	{"op":"delete","receiptId":"..."}
+//
+// The first line is the schema version the entries were written with. When the log is opened, entries
+// of an older version are migrated and the log is compacted, i.e. rewritten with the current metadata
+// of every receipt only. It is compacted again once it holds more overwritten than current entries.
+// A torn last entry left by a crash is dropped. The log is locked, it can only be opened by one process.
+// Without path nothing is persisted.
+type Service struct {
+	path     string
+	file     *os.File
+	lock     *os.File
+	mu       sync.RWMutex
+	receipts map[string]*receipt_metadata.ReceiptMetadata // keyed by receiptId
+	byUser   map[string]map[string]bool                   // receiptIds keyed by username
+	entries  int                                          // number of entries in the log
+}
+
+type header struct {
+	Version int `json:"version"`
+}
+
+type entry struct {
+	Op        string                            `json:"op"`
+	ReceiptID string                            `json:"receiptId,omitempty"` // set by delete
+	Metadata  *receipt_metadata.ReceiptMetadata `json:"metadata,omitempty"`  // set by put
+}
+
+// rawEntry is an entry whose metadata has not been migrated yet
+type rawEntry struct {
+	Op        string          `json:"op"`
+	ReceiptID string          `json:"receiptId"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// NewService opens the log at path, it is created if it does not exist
+func NewService(path string) (ServiceType, error) {
+	if path == "" {
+		return NewMemory(), nil
+	}
+
+	s := &Service{
+		path:     path,
+		receipts: make(map[string]*receipt_metadata.ReceiptMetadata),
+		byUser:   make(map[string]map[string]bool),
+	}
+
+	mkErr := os.MkdirAll(filepath.Dir(path), 0755)
+	if mkErr != nil {
+		return nil, fmt.Errorf("os.MkdirAll() failed, err: %w", mkErr)
+	}
+
+	lock, lockErr := lockFile(path + lockExtension)
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	s.lock = lock
+
+	loadErr := s.load()
+	if loadErr != nil {
+		s.Close()
+		return nil, fmt.Errorf("s.load(path: %s) failed, err: %w", path, loadErr)
+	}
+	return s, nil
+}
+
+// NewMemory creates a store which keeps metadata in memory only, it is meant for tests
+func NewMemory() ServiceType {
+	return &Service{
+		receipts: make(map[string]*receipt_metadata.ReceiptMetadata),
+		byUser:   make(map[string]map[string]bool),
+	}
+}
+
+func (s *Service) Put(metadata *receipt_metadata.ReceiptMetadata) error {
+	logging.Debugf("metadata.Put(username: %s, receiptId: %s)", metadata.Username, metadata.ReceiptID)
+	if metadata.ReceiptID == "" || metadata.Username == "" {
+		return errors.New("invalid metadata, receiptId and username are required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.receipts[metadata.ReceiptID]
+	if ok && existing.Username != metadata.Username {
+		return fmt.Errorf("receipt belongs to another user, receiptId=%s", metadata.ReceiptID)
+	}
+	return s.put(metadata.Clone())
+}
+
+func (s *Service) Get(username, receiptId string) (*receipt_metadata.ReceiptMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metadata, getErr := s.get(username, receiptId)
+	if getErr != nil {
+		return nil, getErr
+	}
+	return metadata.Clone(), nil
+}
+
+// Update applies update to the metadata of username's receipt and stores the result, nothing is
+// stored if update returns an error
+func (s *Service) Update(
+	username, receiptId string,
+	update func(metadata *receipt_metadata.ReceiptMetadata) error,
+) (*receipt_metadata.ReceiptMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, getErr := s.get(username, receiptId)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	metadata := existing.Clone()
+	updateErr := update(metadata)
+	if updateErr != nil {
+		return nil, updateErr
+	}
+	metadata.ReceiptID = existing.ReceiptID
+	metadata.Username = existing.Username
+
+	putErr := s.put(metadata)
+	if putErr != nil {
+		return nil, putErr
+	}
+	return metadata.Clone(), nil
+}
+
+func (s *Service) List(username string) ([]receipt_metadata.ReceiptMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []receipt_metadata.ReceiptMetadata{}
+	for receiptId := range s.byUser[username] {
+		list = append(list, *s.receipts[receiptId].Clone())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].ReceiptID < list[j].ReceiptID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (s *Service) Delete(username, receiptId string) error {
+	logging.Debugf("metadata.Delete(username: %s, receiptId: %s)", username, receiptId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, getErr := s.get(username, receiptId)
+	if getErr != nil {
+		return getErr
+	}
+
+	appendErr := s.append(&entry{Op: opDelete, ReceiptID: receiptId})
+	if appendErr != nil {
+		return appendErr
+	}
+	s.remove(receiptId)
+	return nil
+}
+
+// Close closes the log, the metadata can not be changed afterwards
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var closeErr error
+	if s.file != nil {
+		closeErr = s.file.Close()
+		s.file = nil
+	}
+	if s.lock != nil {
+		s.lock.Close() // releases the lock
+		s.lock = nil
+	}
+	return closeErr
+}
+
+// get returns the stored metadata of username's receipt, s.mu must be held
+func (s *Service) get(username, receiptId string) (*receipt_metadata.ReceiptMetadata, error) {
+	metadata, ok := s.receipts[receiptId]
+	if !ok || metadata.Username != username {
+		return nil, &fs.PathError{Op: "get", Path: receiptId, Err: fs.ErrNotExist}
+	}
+	return metadata, nil
+}
+
+// put persists metadata and keeps it in memory, s.mu must be held
+func (s *Service) put(metadata *receipt_metadata.ReceiptMetadata) error {
+	appendErr := s.append(&entry{Op: opPut, Metadata: metadata})
+	if appendErr != nil {
+		return appendErr
+	}
+	s.apply(metadata)
+	return nil
+}
+
+func (s *Service) apply(metadata *receipt_metadata.ReceiptMetadata) {
+	s.receipts[metadata.ReceiptID] = metadata
+	if s.byUser[metadata.Username] == nil {
+		s.byUser[metadata.Username] = make(map[string]bool)
+	}
+	s.byUser[metadata.Username][metadata.ReceiptID] = true
+}
+
+func (s *Service) remove(receiptId string) {
+	metadata, ok := s.receipts[receiptId]
+	if !ok {
+		return
+	}
+	delete(s.receipts, receiptId)
+	delete(s.byUser[metadata.Username], receiptId)
+	if len(s.byUser[metadata.Username]) == 0 {
+		delete(s.byUser, metadata.Username)
+	}
+}
+
+// append writes e to the end of the log and syncs it, the log is compacted once it has grown
+// enough. A log which could not be written is compacted to drop a partially written entry.
+// s.mu must be held.
+func (s *Service) append(e *entry) error {
+	if s.path == "" {
+		return nil
+	}
+	if s.file == nil {
+		return errors.New("metadata store is closed")
+	}
+
+	data, marshalErr := json.Marshal(e)
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+
+	_, writeErr := s.file.Write(append(data, '\n'))
+	if writeErr == nil {
+		writeErr = s.file.Sync()
+	}
+	if writeErr != nil {
+		compactErr := s.compact()
+		if compactErr != nil {
+			logging.Errorf("s.compact() failed, err: %s", compactErr.Error())
+		}
+		return fmt.Errorf("s.file.Write() failed, err: %w", writeErr)
+	}
+	s.entries++
+
+	if s.entries > constants.METADATA_COMPACT_AFTER && s.entries > 2*len(s.receipts) {
+		compactErr := s.compact()
+		if compactErr != nil {
+			logging.Errorf("s.compact() failed, err: %s", compactErr.Error())
+		}
+	}
+	return nil
+}
+
+// load reads the log into memory, migrating entries of an older schema version, and compacts it
+func (s *Service) load() error {
+	file, openErr := os.OpenFile(s.path, os.O_RDONLY|os.O_CREATE, 0644)
+	if openErr != nil {
+		return fmt.Errorf("os.OpenFile() failed, err: %w", openErr)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+
+	version := currentVersion()
+	if scanner.Scan() {
+		var h header
+		unmarshalErr := json.Unmarshal(scanner.Bytes(), &h)
+		if unmarshalErr != nil || h.Version <= 0 {
+			return fmt.Errorf("invalid header: %s", scanner.Text())
+		}
+		if h.Version > currentVersion() {
+			return fmt.Errorf("log was written with schema version %d, newer than %d", h.Version, currentVersion())
+		}
+		version = h.Version
+	}
+
+	var invalidErr error // an invalid entry is only accepted as the last one
+	for line := 2; scanner.Scan(); line++ {
+		if invalidErr != nil {
+			return invalidErr
+		}
+		readErr := s.read(scanner.Bytes(), version)
+		if readErr != nil {
+			invalidErr = fmt.Errorf("invalid entry at line %d, err: %w", line, readErr)
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return fmt.Errorf("scanner.Scan() failed, err: %w", scanErr)
+	}
+	if invalidErr != nil {
+		logging.Warnf("dropping torn last entry of metadata log, %s", invalidErr.Error())
+	}
+
+	if version < currentVersion() {
+		logging.Infof("migrated metadata of %d receipts from schema version %d to %d", len(s.receipts), version, currentVersion())
+	}
+	return s.compact()
+}
+
+// read applies an entry of the log written with schema version
+func (s *Service) read(line []byte, version int) error {
+	var raw rawEntry
+	unmarshalErr := json.Unmarshal(line, &raw)
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	switch raw.Op {
+	case opDelete:
+		s.remove(raw.ReceiptID)
+		return nil
+	case opPut:
+	default:
+		return fmt.Errorf("unknown op: %s", raw.Op)
+	}
+
+	data := []byte(raw.Metadata)
+	if version < currentVersion() {
+		var fields map[string]interface{}
+		fieldsErr := json.Unmarshal(data, &fields)
+		if fieldsErr != nil {
+			return fieldsErr
+		}
+		migrateErr := migrate(fields, version)
+		if migrateErr != nil {
+			return migrateErr
+		}
+		migrated, marshalErr := json.Marshal(fields)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		data = migrated
+	}
+
+	var metadata receipt_metadata.ReceiptMetadata
+	metadataErr := json.Unmarshal(data, &metadata)
+	if metadataErr != nil {
+		return metadataErr
+	}
+	if metadata.ReceiptID == "" || metadata.Username == "" {
+		return errors.New("receiptId and username are required")
+	}
+	s.remove(metadata.ReceiptID) // the owner never changes, but an entry is trusted as it is
+	s.apply(&metadata)
+	return nil
+}
+
+// compact rewrites the log with the current metadata of every receipt and reopens it for appending,
+// the new log is written to a temp file first which replaces the log once it is synced. s.mu must be
+// held unless the log is being loaded.
+func (s *Service) compact() error {
+	tempPath := s.path + tempExtension
+	temp, createErr := os.Create(tempPath)
+	if createErr != nil {
+		return fmt.Errorf("os.Create() failed, err: %w", createErr)
+	}
+
+	writeErr := s.writeAll(temp)
+	if writeErr == nil {
+		writeErr = temp.Sync()
+	}
+	closeErr := temp.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tempPath)
+		return writeErr
+	}
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	renameErr := os.Rename(tempPath, s.path)
+	if renameErr != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("os.Rename() failed, err: %w", renameErr)
+	}
+	syncErr := syncDir(filepath.Dir(s.path))
+	if syncErr != nil {
+		return fmt.Errorf("syncDir() failed, err: %w", syncErr)
+	}
+
+	file, openErr := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if openErr != nil {
+		return fmt.Errorf("os.OpenFile() failed, err: %w", openErr)
+	}
+	s.file = file
+	s.entries = len(s.receipts)
+	return nil
+}
+
+// writeAll writes the header and a put entry for every receipt, ordered by receiptId
+func (s *Service) writeAll(file *os.File) error {
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	encodeErr := encoder.Encode(&header{Version: currentVersion()})
+	if encodeErr != nil {
+		return fmt.Errorf("encoder.Encode(header) failed, err: %w", encodeErr)
+	}
+
+	receiptIds := make([]string, 0, len(s.receipts))
+	for receiptId := range s.receipts {
+		receiptIds = append(receiptIds, receiptId)
+	}
+	sort.Strings(receiptIds)
+	for _, receiptId := range receiptIds {
+		encodeErr = encoder.Encode(&entry{Op: opPut, Metadata: s.receipts[receiptId]})
+		if encodeErr != nil {
+			return fmt.Errorf("encoder.Encode(receiptId: %s) failed, err: %w", receiptId, encodeErr)
+		}
+	}
+	return writer.Flush()
+}
+
+// lockFile locks the file at path exclusively, the lock is released when the file is closed
+func lockFile(path string) (*os.File, error) {
+	file, openErr := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if openErr != nil {
+		return nil, fmt.Errorf("os.OpenFile() failed, err: %w", openErr)
+	}
+	lockErr := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if lockErr != nil {
+		file.Close()
+		return nil, fmt.Errorf("metadata log is in use by another process, err: %w", lockErr)
+	}
+	return file, nil
+}
+
+func syncDir(dir string) error {
+	d, openErr := os.Open(dir)
+	if openErr != nil {
+		return openErr
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,248 @@
+package metadata
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	newMetadata := func(username, receiptId string, createdAt time.Time) *receipt_metadata.ReceiptMetadata {
+		return &receipt_metadata.ReceiptMetadata{
+			ReceiptID: receiptId,
+			Username:  username,
+			Path:      "uploads/" + username + "#" + receiptId + ".jpg",
+			CreatedAt: createdAt,
+			Width:     1000,
+			Height:    1200,
+			Size:      1024,
+			Checksum:  "checksum",
+			Variants: map[string]receipt_metadata.Variant{
+				constants.VARIANT_ORIGINAL: {Status: constants.VARIANT_STATUS_QUEUED},
+			},
+		}
+	}
+
+	readLines := func(t *testing.T, path string) []string {
+		file, openErr := os.Open(path)
+		assert.Nil(t, openErr)
+		defer file.Close()
+
+		lines := []string{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		return lines
+	}
+
+	now := time.Now().UTC()
+
+	t.Run("succeed, put, get, update and delete", func(t *testing.T) {
+		service, newErr := NewService("")
+		assert.Nil(t, newErr)
+
+		assert.Nil(t, service.Put(newMetadata("user1", "123456", now)))
+
+		metadata, getErr := service.Get("user1", "123456")
+		assert.Nil(t, getErr)
+		assert.Equal(t, 1000, metadata.Width)
+
+		// returned metadata is a copy
+		metadata.Variants[constants.VARIANT_ORIGINAL] = receipt_metadata.Variant{Status: constants.VARIANT_STATUS_READY}
+		metadata, _ = service.Get("user1", "123456")
+		assert.Equal(t, constants.VARIANT_STATUS_QUEUED, metadata.Variants[constants.VARIANT_ORIGINAL].Status)
+
+		updated, updateErr := service.Update("user1", "123456", func(m *receipt_metadata.ReceiptMetadata) error {
+			m.Variants[constants.VARIANT_ORIGINAL] = receipt_metadata.Variant{Status: constants.VARIANT_STATUS_READY}
+			m.Username = "user2"
+			return nil
+		})
+		assert.Nil(t, updateErr)
+		assert.Equal(t, "user1", updated.Username)
+		metadata, _ = service.Get("user1", "123456")
+		assert.Equal(t, constants.VARIANT_STATUS_READY, metadata.Variants[constants.VARIANT_ORIGINAL].Status)
+
+		_, updateErr = service.Update("user1", "123456", func(m *receipt_metadata.ReceiptMetadata) error {
+			m.Size = 0
+			return errors.New("invalid")
+		})
+		assert.NotNil(t, updateErr)
+		metadata, _ = service.Get("user1", "123456")
+		assert.Equal(t, int64(1024), metadata.Size)
+
+		assert.Nil(t, service.Delete("user1", "123456"))
+		_, getErr = service.Get("user1", "123456")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, receipts of other users are not found", func(t *testing.T) {
+		service, _ := NewService("")
+		assert.Nil(t, service.Put(newMetadata("user1", "123456", now)))
+
+		_, getErr := service.Get("user2", "123456")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+		_, updateErr := service.Update("user2", "123456", func(m *receipt_metadata.ReceiptMetadata) error { return nil })
+		assert.ErrorIs(t, updateErr, os.ErrNotExist)
+		assert.ErrorIs(t, service.Delete("user2", "123456"), os.ErrNotExist)
+		assert.NotNil(t, service.Put(newMetadata("user2", "123456", now)))
+
+		list, listErr := service.List("user2")
+		assert.Nil(t, listErr)
+		assert.Empty(t, list)
+	})
+
+	t.Run("succeed, list receipts of a user, oldest first", func(t *testing.T) {
+		service, _ := NewService("")
+		assert.Nil(t, service.Put(newMetadata("user1", "b", now)))
+		assert.Nil(t, service.Put(newMetadata("user1", "a", now.Add(time.Hour))))
+		assert.Nil(t, service.Put(newMetadata("user1", "c", now.Add(-time.Hour))))
+		assert.Nil(t, service.Put(newMetadata("user2", "d", now)))
+
+		list, listErr := service.List("user1")
+		assert.Nil(t, listErr)
+		assert.Len(t, list, 3)
+		assert.Equal(t, []string{"c", "b", "a"}, []string{list[0].ReceiptID, list[1].ReceiptID, list[2].ReceiptID})
+	})
+
+	t.Run("succeed, persist metadata across restarts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata", "metadata.log")
+		service, newErr := NewService(path)
+		assert.Nil(t, newErr)
+		assert.Nil(t, service.Put(newMetadata("user1", "123456", now)))
+		assert.Nil(t, service.Put(newMetadata("user1", "654321", now)))
+		assert.Nil(t, service.Delete("user1", "654321"))
+		assert.Nil(t, service.Close())
+		assert.Len(t, readLines(t, path), 4)
+
+		service, newErr = NewService(path)
+		assert.Nil(t, newErr)
+		defer service.Close()
+
+		metadata, getErr := service.Get("user1", "123456")
+		assert.Nil(t, getErr)
+		assert.True(t, now.Equal(metadata.CreatedAt))
+		_, getErr = service.Get("user1", "654321")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+
+		// opening compacts the log
+		assert.Len(t, readLines(t, path), 2)
+	})
+
+	t.Run("succeed, compact log with many overwritten entries", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		service, _ := NewService(path)
+		defer service.Close()
+
+		for i := 0; i <= constants.METADATA_COMPACT_AFTER; i++ {
+			_, updateErr := service.Update("user1", "123456", func(m *receipt_metadata.ReceiptMetadata) error { return nil })
+			if i == 0 {
+				assert.ErrorIs(t, updateErr, os.ErrNotExist)
+				assert.Nil(t, service.Put(newMetadata("user1", "123456", now)))
+			}
+		}
+		assert.Less(t, len(readLines(t, path)), 10)
+	})
+
+	t.Run("succeed, drop torn last entry", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		service, _ := NewService(path)
+		assert.Nil(t, service.Put(newMetadata("user1", "123456", now)))
+		assert.Nil(t, service.Close())
+
+		file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		file.WriteString(`{"op":"put","metadata":{"receiptId":"654`)
+		file.Close()
+
+		service, newErr := NewService(path)
+		assert.Nil(t, newErr)
+		defer service.Close()
+		list, _ := service.List("user1")
+		assert.Len(t, list, 1)
+	})
+
+	t.Run("should fail, invalid entry before the last one", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		content := `{"version":1}` + "\n" + `{"op":"unknown"}` + "\n" + `{"op":"delete","receiptId":"123456"}` + "\n"
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+
+		_, newErr := NewService(path)
+		assert.NotNil(t, newErr)
+	})
+
+	t.Run("should fail, log is in use by another process", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		service, newErr := NewService(path)
+		assert.Nil(t, newErr)
+
+		_, newErr = NewService(path)
+		assert.NotNil(t, newErr)
+
+		assert.Nil(t, service.Close())
+		service, newErr = NewService(path)
+		assert.Nil(t, newErr)
+		service.Close()
+	})
+
+	t.Run("should fail, log was written by a newer schema version", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		assert.Nil(t, os.WriteFile(path, []byte(`{"version":999}`+"\n"), 0644))
+
+		_, newErr := NewService(path)
+		assert.NotNil(t, newErr)
+	})
+
+	t.Run("succeed, migrate entries of an older schema version", func(t *testing.T) {
+		original := migrations
+		defer func() { migrations = original }()
+
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		service, _ := NewService(path)
+		assert.Nil(t, service.Put(newMetadata("user1", "123456", now)))
+		assert.Nil(t, service.Close())
+
+		migrations = append(migrations, migration{
+			version:     currentVersion() + 1,
+			description: "rename checksum",
+			migrate: func(metadata map[string]interface{}) error {
+				metadata["checksum"] = "sha256:" + metadata["checksum"].(string)
+				return nil
+			},
+		})
+
+		service, newErr := NewService(path)
+		assert.Nil(t, newErr)
+		defer service.Close()
+
+		metadata, getErr := service.Get("user1", "123456")
+		assert.Nil(t, getErr)
+		assert.Equal(t, "sha256:checksum", metadata.Checksum)
+
+		lines := readLines(t, path)
+		assert.True(t, strings.Contains(lines[0], fmt.Sprintf(`"version":%d`, currentVersion())))
+		assert.True(t, strings.Contains(lines[1], `"checksum":"sha256:checksum"`))
+	})
+
+	t.Run("succeed, metadata written before tiers were recorded is hot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metadata.log")
+		content := `{"version":2}` + "\n" + `{"op":"put","metadata":{"receiptId":"123456","username":"user1"}}` + "\n"
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+
+		service, newErr := NewService(path)
+		assert.Nil(t, newErr)
+		defer service.Close()
+
+		metadata, getErr := service.Get("user1", "123456")
+		assert.Nil(t, getErr)
+		assert.Equal(t, constants.TIER_HOT, metadata.Tier)
+	})
+}
@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"fmt"
+	"receipt_uploader/internal/constants"
+)
+
+// migration upgrades the metadata of a receipt written with schema version-1 to version
+type migration struct {
+	version     int
+	description string
+	migrate     func(metadata map[string]interface{}) error
+}
+
+// migrations of the schema in order, the version of the last one is the current version. A log
+// records the version its entries were written with, so migrations must never change once released,
+// a change of the schema appends a new one.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "initial schema",
+		migrate:     func(metadata map[string]interface{}) error { return nil },
+	},
+	{
+		version:     2,
+		description: "EXIF of the original",
+		// the EXIF of receipts uploaded before is not known, "exif" stays unset
+		migrate: func(metadata map[string]interface{}) error { return nil },
+	},
+	{
+		version:     3,
+		description: "storage tier of the original",
+		// receipts uploaded before are recorded as hot, tiering records "cold" once it moves one
+		migrate: func(metadata map[string]interface{}) error {
+			if _, ok := metadata["tier"]; !ok {
+				metadata["tier"] = constants.TIER_HOT
+			}
+			return nil
+		},
+	},
+}
+
+// currentVersion returns the schema version new entries are written with
+func currentVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate upgrades the metadata of a receipt from schema version from to the current version
+func migrate(metadata map[string]interface{}, from int) error {
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+		migrateErr := m.migrate(metadata)
+		if migrateErr != nil {
+			return fmt.Errorf("migration %d (%s) failed, err: %w", m.version, m.description, migrateErr)
+		}
+	}
+	return nil
+}
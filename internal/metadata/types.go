@@ -0,0 +1,14 @@
+package metadata
+
+import "receipt_uploader/internal/models/receipt_metadata"
+
+// ServiceType stores the metadata of every receipt, keyed by receiptId and scoped by owner:
+// metadata of a receipt owned by another user is reported as not found
+type ServiceType interface {
+	Put(metadata *receipt_metadata.ReceiptMetadata) error
+	Get(username, receiptId string) (*receipt_metadata.ReceiptMetadata, error) // wraps fs.ErrNotExist if there is none
+	Update(username, receiptId string, update func(metadata *receipt_metadata.ReceiptMetadata) error) (*receipt_metadata.ReceiptMetadata, error)
+	List(username string) ([]receipt_metadata.ReceiptMetadata, error) // oldest receipt first
+	Delete(username, receiptId string) error
+	Close() error
+}
@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"receipt_uploader/internal/audit"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/audit_entry"
+	"time"
+)
+
+// Audit records every request of action to auditService once it has been answered, whatever its
+// outcome. Wrapping Auth, requests with an invalid username_token are recorded as denied. The
+// receiptId is taken from the path, or from the Location header of an upload.
+func Audit(auditService audit.ServiceType, action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		entry := audit_entry.AuditEntry{
+			Time:       time.Now().UTC(),
+			Actor:      r.Header.Get("username_token"),
+			Action:     action,
+			ReceiptID:  r.PathValue("receiptId"),
+			Size:       r.URL.Query().Get("size"),
+			Status:     recorder.Status(),
+			Outcome:    audit_entry.Outcome(recorder.Status()),
+			ClientAddr: clientAddr(r),
+		}
+		if len(entry.Actor) > constants.AUDIT_ACTOR_MAX {
+			entry.Actor = entry.Actor[:constants.AUDIT_ACTOR_MAX]
+		}
+		if location := w.Header().Get("Location"); entry.ReceiptID == "" && location != "" {
+			entry.ReceiptID = path.Base(location)
+		}
+
+		recordErr := auditService.Record(&entry)
+		if recordErr != nil {
+			logging.Errorf("auditService.Record(action: %s, receiptId: %s) failed, err: %s", action, entry.ReceiptID, recordErr.Error())
+		}
+	})
+}
+
+// statusRecorder remembers the status of the response written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying http.ResponseWriter
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Status returns the status sent, 200 if nothing was written
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// clientAddr returns the IP address of the client which sent r, X-Forwarded-For is not trusted
+func clientAddr(r *http.Request) string {
+	host, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+	if splitErr != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"receipt_uploader/internal/audit"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/models/audit_query"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	auditService := audit.NewMemory()
+	mux := http.NewServeMux()
+	mux.Handle("/receipts/{receiptId}", Audit(auditService, constants.AUDIT_ACTION_DOWNLOAD, Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("receiptId") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("image"))
+	}))))
+	mux.Handle("/receipts", Audit(auditService, constants.AUDIT_ACTION_UPLOAD, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/receipts/uploaded")
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	send := func(path, token string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("username_token", token)
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("succeed, download, denied and not found requests are recorded", func(t *testing.T) {
+		send("/receipts/found?size=small", "user_a")
+		send("/receipts/missing", "user_a")
+		send("/receipts/found", "INVALID-TOKEN")
+
+		entries, queryErr := auditService.Query(&audit_query.Query{})
+		assert.Nil(t, queryErr)
+		assert.Len(t, entries, 3)
+
+		assert.Equal(t, "user_a", entries[0].Actor)
+		assert.Equal(t, constants.AUDIT_ACTION_DOWNLOAD, entries[0].Action)
+		assert.Equal(t, "found", entries[0].ReceiptID)
+		assert.Equal(t, "small", entries[0].Size)
+		assert.Equal(t, http.StatusOK, entries[0].Status)
+		assert.Equal(t, constants.AUDIT_OUTCOME_SUCCESS, entries[0].Outcome)
+		assert.Equal(t, "192.0.2.1", entries[0].ClientAddr)
+
+		assert.Equal(t, http.StatusNotFound, entries[1].Status)
+		assert.Equal(t, constants.AUDIT_OUTCOME_NOT_FOUND, entries[1].Outcome)
+
+		assert.Equal(t, "INVALID-TOKEN", entries[2].Actor)
+		assert.Equal(t, constants.AUDIT_OUTCOME_DENIED, entries[2].Outcome)
+	})
+
+	t.Run("succeed, receiptId of an upload is taken from Location", func(t *testing.T) {
+		send("/receipts", "user_a")
+
+		entries, queryErr := auditService.Query(&audit_query.Query{After: 3})
+		assert.Nil(t, queryErr)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, constants.AUDIT_ACTION_UPLOAD, entries[0].Action)
+		assert.Equal(t, "uploaded", entries[0].ReceiptID)
+		assert.Equal(t, http.StatusCreated, entries[0].Status)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"receipt_uploader/internal/http_utils"
 	"receipt_uploader/internal/models/http_responses"
 	"regexp"
+	"slices"
 )
 
 func Auth(next http.Handler) http.Handler {
@@ -24,6 +25,21 @@ func Auth(next http.Handler) http.Handler {
 	})
 }
 
+// Admin only lets requests of adminUsers through, it must be wrapped by Auth
+func Admin(adminUsers []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(adminUsers, r.Header.Get("username_token")) {
+			resp := http_responses.ErrorResponse{
+				Error: constants.HTTP_ERR_MSG_403,
+			}
+			http_utils.SendErrorResponse(w, &resp, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func isValidUsernameToken(token string) bool {
 	p := regexp.MustCompile("^[a-z0-9_]+$")
 	return p.MatchString(token)
@@ -56,6 +56,44 @@ func TestAuth(t *testing.T) {
 	})
 }
 
+func TestAdmin(t *testing.T) {
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	admin := Admin([]string{"admin_user"}, testHandler)
+
+	t.Run("succeed, token=admin_user", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin/audit", nil)
+		req.Header.Set("username_token", "admin_user")
+
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should fail, not an admin", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin/audit", nil)
+		req.Header.Set("username_token", "user_123")
+
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should fail, no admins configured", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin/audit", nil)
+		req.Header.Set("username_token", "admin_user")
+
+		rr := httptest.NewRecorder()
+		Admin(nil, testHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
 func TestIsValidUsernameToken(t *testing.T) {
 	t.Run("valid_token", func(t *testing.T) {
 		valid := isValidUsernameToken("valid_token")
@@ -0,0 +1,36 @@
+package audit_entry
+
+import (
+	"net/http"
+	"receipt_uploader/internal/constants"
+	"time"
+)
+
+// AuditEntry records a request accessing a receipt, whether it succeeded or not
+type AuditEntry struct {
+	Seq        int64     `json:"seq"`                 // position in the audit log, starting at 1
+	Time       time.Time `json:"time"`                // when the response was sent
+	Actor      string    `json:"actor"`               // username_token of the request, as sent
+	Action     string    `json:"action"`              // constants.AUDIT_ACTION_xxx
+	ReceiptID  string    `json:"receiptId,omitempty"` // unset if the upload failed
+	Size       string    `json:"size,omitempty"`      // requested size of a download, unset for the original
+	Status     int       `json:"status"`              // HTTP status of the response
+	Outcome    string    `json:"outcome"`             // constants.AUDIT_OUTCOME_xxx of Status
+	ClientAddr string    `json:"clientAddr"`          // IP address of the client
+}
+
+// Outcome returns the constants.AUDIT_OUTCOME_xxx of an HTTP status
+func Outcome(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return constants.AUDIT_OUTCOME_SUCCESS
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return constants.AUDIT_OUTCOME_DENIED
+	case status == http.StatusNotFound:
+		return constants.AUDIT_OUTCOME_NOT_FOUND
+	case status < http.StatusInternalServerError:
+		return constants.AUDIT_OUTCOME_REJECTED
+	default:
+		return constants.AUDIT_OUTCOME_ERROR
+	}
+}
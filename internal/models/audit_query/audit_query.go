@@ -0,0 +1,32 @@
+package audit_query
+
+import (
+	"receipt_uploader/internal/models/audit_entry"
+	"time"
+)
+
+// Query selects entries of the audit log, unset fields match all entries
+type Query struct {
+	Actor string    // username_token of the requests
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+	After int64     // only entries after this Seq, to continue a previous query
+	Limit int       // max number of entries returned, 0 returns all
+}
+
+// Matches reports if entry is selected by q, Limit is applied by the audit log
+func (q *Query) Matches(entry *audit_entry.AuditEntry) bool {
+	if entry.Seq <= q.After {
+		return false
+	}
+	if q.Actor != "" && entry.Actor != q.Actor {
+		return false
+	}
+	if !q.From.IsZero() && entry.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !entry.Time.Before(q.To) {
+		return false
+	}
+	return true
+}
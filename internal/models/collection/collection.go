@@ -0,0 +1,28 @@
+package collection
+
+import (
+	"slices"
+	"time"
+)
+
+// Collection is a named group of receipts of one user, e.g. the receipts of a trip or a project
+type Collection struct {
+	CollectionID string    `json:"collectionId"`
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	ReceiptIDs   []string  `json:"receiptIds"` // in the order they were added
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"` // last time the name or the receipts changed
+}
+
+// Total is the sum of the amounts of the receipts of a collection in one currency
+type Total struct {
+	Currency string `json:"currency"`
+	Value    string `json:"value"`    // decimal string, as precise as the most precise amount
+	Receipts int    `json:"receipts"` // number of receipts summed
+}
+
+// Contains reports if the receipt has been added to c
+func (c *Collection) Contains(receiptId string) bool {
+	return slices.Contains(c.ReceiptIDs, receiptId)
+}
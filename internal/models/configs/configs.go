@@ -2,6 +2,7 @@ package configs
 
 import (
 	"receipt_uploader/internal/constants"
+	"time"
 )
 
 // defines resized image's size and name of the size
@@ -29,11 +30,82 @@ var AllowedDimensions = Dimensions{
 	},
 }
 
+// S3Config defines how to reach a S3-compatible object storage
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-north-1.amazonaws.com
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// Quota limits the storage a user can consume, 0 means unlimited
+type Quota struct {
+	MaxBytes    int64 `json:"maxBytes"`    // bytes of originals and resized variants
+	MaxReceipts int   `json:"maxReceipts"` // number of receipts
+}
+
+// RetentionPolicy defines how long each storage class of a receipt is kept, 0 means forever
+type RetentionPolicy struct {
+	Originals                 time.Duration // originals in UploadsDir
+	Variants                  time.Duration // copy and resized images in ResizedDir, the original is removed with them
+	DropOriginalsWithVariants bool          // remove originals once the copy and all resized images exist
+}
+
+// TieringConfig defines when originals are moved to cold storage and where cold storage is
+type TieringConfig struct {
+	Age      time.Duration // originals older than this are moved once all variants exist, 0 disables tiering
+	Interval time.Duration // how often originals are checked
+	Backend  string        // filesystem, memory, s3, tiering is disabled if empty
+	Dir      string        // root dir of cold storage when Backend is filesystem
+	S3       S3Config      // used when Backend is s3
+}
+
+// ReplicationConfig defines the replica every write is mirrored to
+type ReplicationConfig struct {
+	Backend       string   // filesystem, memory, s3, replication is disabled if empty
+	Dir           string   // root dir of the replica when Backend is filesystem
+	S3            S3Config // used when Backend is s3
+	Quorum        string   // primary, both, writes succeed once the primary or both have been written
+	TombstonesDir string   // dir in the primary recording deletes which failed on the replica, none are recorded if empty
+}
+
+// EncryptionConfig defines the master keys wrapping the data key of every user
+type EncryptionConfig struct {
+	MasterKey         []byte // AES-256 key wrapping data keys, encryption is disabled if empty
+	PreviousMasterKey []byte // master key before rotation, data keys wrapped by it are readable until they are re-wrapped
+	KeysDir           string // dir to store wrapped data keys
+}
+
 type Config struct {
-	ResizedDir    string // dir to store resize images
-	UploadsDir    string // dir to store uploads
-	Port          string
-	Dimensions    Dimensions // allowed resizing options
-	Mode          string     // dev, qa, release
-	QueueCapacity int        // number of jobs resize_queue can take
+	ResizedDir         string   // dir to store resize images
+	UploadsDir         string   // dir to store uploads
+	RecordsDir         string   // dir to store receipt records
+	TrashDir           string   // dir to store deleted receipts until they are purged
+	CollectionsDir     string   // dir to store collections of receipts
+	ChecksumsDir       string   // dir to store checksums of images, no checksums are recorded if empty
+	MetadataFile       string   // file of the metadata store, metadata is only kept in memory if empty
+	AuditFile          string   // file of the audit log, entries are only kept in memory if empty
+	QueueDir           string   // dir of the durable resize queue, tasks are only kept in memory if empty
+	AdminUsers         []string // username tokens allowed to query the audit log
+	Port               string
+	Dimensions         Dimensions                 // allowed resizing options
+	Mode               string                     // dev, qa, release
+	QueueCapacity      int                        // number of jobs the in-memory resize_queue can take
+	ResizeWorkers      int                        // number of workers processing resize jobs, one per CPU if not positive
+	ReconcileRate      int                        // max number of resize jobs re-submitted per second at startup
+	StorageBackend     string                     // filesystem, memory, s3
+	TrashRetention     time.Duration              // how long deleted receipts are kept in trash
+	TrashPurgeInterval time.Duration              // how often expired receipts are purged from trash
+	S3                 S3Config                   // used when StorageBackend is s3
+	Quota              Quota                      // default quota of every user
+	QuotaOverrides     map[string]Quota           // quotas of specific users, keyed by username
+	Retention          RetentionPolicy            // default retention of every user
+	RetentionOverrides map[string]RetentionPolicy // retention of specific users, keyed by username
+	GCInterval         time.Duration              // how often the retention policies are applied
+	GCDryRun           bool                       // only report what the garbage collector would delete
+	ScrubInterval      time.Duration              // how often checksums of all images are verified
+	Tiering            TieringConfig              // cold storage of originals
+	Replication        ReplicationConfig          // replica of all stored objects
+	Encryption         EncryptionConfig           // encryption of images at rest
 }
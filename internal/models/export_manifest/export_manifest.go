@@ -0,0 +1,35 @@
+package export_manifest
+
+import (
+	"receipt_uploader/internal/models/image_meta"
+	"time"
+)
+
+const (
+	MANIFEST_FILE_NAME = "manifest.json" // first entry of an export archive
+	RECEIPTS_DIR       = "receipts"      // dir of images in an export archive
+)
+
+// ManifestFile describes an image in an export archive, ImageMeta refers to its location in storage
+type ManifestFile struct {
+	image_meta.ImageMeta
+	Variant     string    `json:"variant"`     // "" for the original, otherwise name of the dimension
+	ArchivePath string    `json:"archivePath"` // path of the image inside the archive
+	Bytes       int64     `json:"bytes"`
+	ModTime     time.Time `json:"modTime"` // last time the image was written
+}
+
+// ManifestFailure is a receipt which could not be exported
+type ManifestFailure struct {
+	ReceiptID string `json:"receiptId"`
+	Error     string `json:"error"`
+}
+
+// Manifest lists all images in an export archive of a user
+type Manifest struct {
+	Username   string            `json:"username"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Variants   []string          `json:"variants"` // dimensions exported in addition to the originals
+	Files      []ManifestFile    `json:"files"`
+	Failures   []ManifestFailure `json:"failures"` // receipts without copy nor original
+}
@@ -1,12 +1,22 @@
 package http_requests
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"receipt_uploader/internal/constants"
 	"receipt_uploader/internal/http_utils"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/audit_query"
 	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/search_query"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // UploadRequest represents the incoming request for uploading an image
@@ -21,6 +31,106 @@ type DownloadRequest struct {
 	Username  string `json:"username"`
 }
 
+type DeleteRequest struct {
+	ReceiptId string `json:"receiptId"`
+	Username  string `json:"username"`
+}
+
+type RestoreRequest struct {
+	ReceiptId string `json:"receiptId"`
+	Username  string `json:"username"`
+}
+
+// ListRequest represents GET /receipts, zero From and To are not filtering
+type ListRequest struct {
+	Username string      `json:"username"`
+	Limit    int         `json:"limit"`  // max number of receipts returned
+	Order    string      `json:"order"`  // asc or desc by upload time
+	From     time.Time   `json:"from"`   // receipts uploaded at or after
+	To       time.Time   `json:"to"`     // receipts uploaded before
+	Status   string      `json:"status"` // receipts with this status only, all if empty
+	Cursor   *ListCursor `json:"cursor"` // position after which the page starts, first page if nil
+}
+
+// ListCursor is the position of the last receipt of a page, receipts are ordered by upload time
+// and then by receiptId
+type ListCursor struct {
+	CreatedAt time.Time
+	ReceiptID string
+}
+
+// SearchRequest represents GET /receipts/search, the results are paginated and filtered like GET /receipts
+type SearchRequest struct {
+	ListRequest
+	Query *search_query.Query `json:"query"`
+}
+
+// UpdateRequest represents PATCH /receipts/{receiptId}, Patch is a JSON merge patch of the annotations
+type UpdateRequest struct {
+	ReceiptId string `json:"receiptId"`
+	Username  string `json:"username"`
+	IfMatch   string `json:"ifMatch"` // update only if the annotations have not changed, unconditional if empty
+	Patch     []byte `json:"patch"`
+}
+
+type StatusRequest struct {
+	ReceiptId string `json:"receiptId"`
+	Username  string `json:"username"`
+}
+
+type MetadataRequest struct {
+	ReceiptId string `json:"receiptId"`
+	Username  string `json:"username"`
+}
+
+// CreateCollectionRequest represents POST /collections
+type CreateCollectionRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// RenameCollectionRequest represents PATCH /collections/{collectionId}
+type RenameCollectionRequest struct {
+	CollectionId string `json:"collectionId"`
+	Username     string `json:"username"`
+	Name         string `json:"name"`
+}
+
+// CollectionRequest represents GET and DELETE /collections/{collectionId}
+type CollectionRequest struct {
+	CollectionId string `json:"collectionId"`
+	Username     string `json:"username"`
+}
+
+// CollectionReceiptRequest represents PUT and DELETE /collections/{collectionId}/receipts/{receiptId}
+type CollectionReceiptRequest struct {
+	CollectionId string `json:"collectionId"`
+	ReceiptId    string `json:"receiptId"`
+	Username     string `json:"username"`
+}
+
+// CollectionReceiptsRequest represents GET /collections/{collectionId}/receipts, the receipts are
+// paginated and filtered like GET /receipts
+type CollectionReceiptsRequest struct {
+	ListRequest
+	CollectionId string `json:"collectionId"`
+}
+
+// collectionBody is the body of POST /collections and PATCH /collections/{collectionId}
+type collectionBody struct {
+	Name string `json:"name"`
+}
+
+// AuditRequest represents GET /admin/audit, Query.After is the cursor of the page
+type AuditRequest struct {
+	Query audit_query.Query
+}
+
+type ExportRequest struct {
+	Sizes    []string `json:"sizes"` // resized images exported in addition to the originals
+	Username string   `json:"username"`
+}
+
 func ParseUploadRequest(r *http.Request) (*UploadRequest, error) {
 
 	file, header, fromErr := r.FormFile("receipt")
@@ -55,3 +165,376 @@ func ParseDownloadRequest(r *http.Request, dimensions *configs.Dimensions) (*Dow
 		Username:  username,
 	}, nil
 }
+
+func ParseDeleteRequest(r *http.Request) (*DeleteRequest, error) {
+
+	receiptId, err := http_utils.ValidateDeleteImageRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateDeleteImageRequest() failed, err: %s", err.Error())
+	}
+	username := r.Header.Get("username_token")
+
+	return &DeleteRequest{
+		ReceiptId: receiptId,
+		Username:  username,
+	}, nil
+}
+
+func ParseRestoreRequest(r *http.Request) (*RestoreRequest, error) {
+
+	receiptId, err := http_utils.ValidateReceiptActionRequest(r, "restore")
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateReceiptActionRequest() failed, err: %s", err.Error())
+	}
+	username := r.Header.Get("username_token")
+
+	return &RestoreRequest{
+		ReceiptId: receiptId,
+		Username:  username,
+	}, nil
+}
+
+func ParseUpdateRequest(r *http.Request) (*UpdateRequest, error) {
+
+	receiptId, err := http_utils.ValidateUpdateRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateUpdateRequest() failed, err: %s", err.Error())
+	}
+
+	patch, readErr := io.ReadAll(io.LimitReader(r.Body, constants.MAX_PATCH_SIZE+1))
+	if readErr != nil {
+		return nil, fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+	if int64(len(patch)) > constants.MAX_PATCH_SIZE {
+		return nil, fmt.Errorf("body is larger than %d bytes", constants.MAX_PATCH_SIZE)
+	}
+
+	return &UpdateRequest{
+		ReceiptId: receiptId,
+		Username:  r.Header.Get("username_token"),
+		IfMatch:   r.Header.Get("If-Match"),
+		Patch:     patch,
+	}, nil
+}
+
+func ParseStatusRequest(r *http.Request) (*StatusRequest, error) {
+
+	receiptId, err := http_utils.ValidateReceiptActionRequest(r, "status")
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateReceiptActionRequest() failed, err: %s", err.Error())
+	}
+	username := r.Header.Get("username_token")
+
+	return &StatusRequest{
+		ReceiptId: receiptId,
+		Username:  username,
+	}, nil
+}
+
+func ParseMetadataRequest(r *http.Request) (*MetadataRequest, error) {
+
+	receiptId, err := http_utils.ValidateReceiptActionRequest(r, "meta")
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateReceiptActionRequest() failed, err: %s", err.Error())
+	}
+	username := r.Header.Get("username_token")
+
+	return &MetadataRequest{
+		ReceiptId: receiptId,
+		Username:  username,
+	}, nil
+}
+
+func ParseExportRequest(r *http.Request, dimensions *configs.Dimensions) (*ExportRequest, error) {
+
+	sizes, err := http_utils.ValidateExportRequest(r, dimensions)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateExportRequest() failed, err: %s", err.Error())
+	}
+	username := r.Header.Get("username_token")
+
+	return &ExportRequest{
+		Sizes:    sizes,
+		Username: username,
+	}, nil
+}
+
+// ParseListRequest parses GET /receipts?limit=&cursor=&order=&from=&to=&status=, all parameters
+// are optional. from and to are RFC 3339 times or dates, a date of to includes the whole day.
+func ParseListRequest(r *http.Request) (*ListRequest, error) {
+	logging.Debugf("ParseListRequest(r.URL.RawQuery: %s)", r.URL.RawQuery)
+
+	return parseListParams(r.Header.Get("username_token"), r.URL.Query())
+}
+
+// ParseSearchRequest parses GET /receipts/search?q=, q is a query of search_query.ParseQuery, the other
+// parameters are the ones of GET /receipts
+func ParseSearchRequest(r *http.Request) (*SearchRequest, error) {
+	logging.Debugf("ParseSearchRequest(r.URL.RawQuery: %s)", r.URL.RawQuery)
+
+	params := r.URL.Query()
+	q := params["q"]
+	if len(q) > 1 {
+		return nil, fmt.Errorf("repeated parameter: q")
+	}
+	params.Del("q")
+
+	listReq, listErr := parseListParams(r.Header.Get("username_token"), params)
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	query, queryErr := search_query.ParseQuery(strings.Join(q, ""))
+	if queryErr != nil {
+		return nil, fmt.Errorf("search_query.ParseQuery() failed, err: %w", queryErr)
+	}
+
+	return &SearchRequest{
+		ListRequest: *listReq,
+		Query:       query,
+	}, nil
+}
+
+func ParseCreateCollectionRequest(r *http.Request) (*CreateCollectionRequest, error) {
+
+	err := http_utils.ValidateCreateCollectionRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateCreateCollectionRequest() failed, err: %s", err.Error())
+	}
+
+	body, bodyErr := parseCollectionBody(r)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+
+	return &CreateCollectionRequest{
+		Username: r.Header.Get("username_token"),
+		Name:     body.Name,
+	}, nil
+}
+
+func ParseRenameCollectionRequest(r *http.Request) (*RenameCollectionRequest, error) {
+
+	collectionId, err := http_utils.ValidateCollectionRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateCollectionRequest() failed, err: %s", err.Error())
+	}
+
+	body, bodyErr := parseCollectionBody(r)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+
+	return &RenameCollectionRequest{
+		CollectionId: collectionId,
+		Username:     r.Header.Get("username_token"),
+		Name:         body.Name,
+	}, nil
+}
+
+func ParseCollectionRequest(r *http.Request) (*CollectionRequest, error) {
+
+	collectionId, err := http_utils.ValidateCollectionRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateCollectionRequest() failed, err: %s", err.Error())
+	}
+
+	return &CollectionRequest{
+		CollectionId: collectionId,
+		Username:     r.Header.Get("username_token"),
+	}, nil
+}
+
+func ParseCollectionReceiptRequest(r *http.Request) (*CollectionReceiptRequest, error) {
+
+	collectionId, receiptId, err := http_utils.ValidateCollectionReceiptRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateCollectionReceiptRequest() failed, err: %s", err.Error())
+	}
+
+	return &CollectionReceiptRequest{
+		CollectionId: collectionId,
+		ReceiptId:    receiptId,
+		Username:     r.Header.Get("username_token"),
+	}, nil
+}
+
+// ParseCollectionReceiptsRequest parses GET /collections/{collectionId}/receipts, the query parameters
+// are the ones of GET /receipts
+func ParseCollectionReceiptsRequest(r *http.Request) (*CollectionReceiptsRequest, error) {
+
+	collectionId, err := http_utils.ValidateCollectionReceiptsRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("http_utils.ValidateCollectionReceiptsRequest() failed, err: %s", err.Error())
+	}
+
+	listReq, listErr := parseListParams(r.Header.Get("username_token"), r.URL.Query())
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	return &CollectionReceiptsRequest{
+		ListRequest:  *listReq,
+		CollectionId: collectionId,
+	}, nil
+}
+
+// ParseAuditRequest parses GET /admin/audit?user=&from=&to=&limit=&cursor=, user is the
+// username_token of the audited requests, from and to are RFC 3339 times or dates like in
+// GET /receipts and cursor is the seq of the last entry of the previous page
+func ParseAuditRequest(r *http.Request) (*AuditRequest, error) {
+	logging.Debugf("ParseAuditRequest(r.URL.RawQuery: %s)", r.URL.RawQuery)
+
+	req := &AuditRequest{
+		Query: audit_query.Query{Limit: constants.AUDIT_LIMIT_DEFAULT},
+	}
+	for key, values := range r.URL.Query() {
+		value := values[0]
+		if len(values) > 1 {
+			return nil, fmt.Errorf("repeated parameter: %s", key)
+		}
+
+		var parseErr error
+		switch key {
+		case "user":
+			req.Query.Actor = value
+			if value == "" || len(value) > constants.AUDIT_ACTOR_MAX {
+				parseErr = fmt.Errorf("user must have 1 to %d characters", constants.AUDIT_ACTOR_MAX)
+			}
+		case "from":
+			req.Query.From, parseErr = parseTime(value, false)
+		case "to":
+			req.Query.To, parseErr = parseTime(value, true)
+		case "limit":
+			req.Query.Limit, parseErr = strconv.Atoi(value)
+			if parseErr == nil && (req.Query.Limit < 1 || req.Query.Limit > constants.AUDIT_LIMIT_MAX) {
+				parseErr = fmt.Errorf("limit must be between 1 and %d", constants.AUDIT_LIMIT_MAX)
+			}
+		case "cursor":
+			req.Query.After, parseErr = strconv.ParseInt(value, 10, 64)
+			if parseErr == nil && req.Query.After < 1 {
+				parseErr = fmt.Errorf("cursor must be positive")
+			}
+		default:
+			parseErr = fmt.Errorf("unrecognized parameter")
+		}
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid parameter %s=%s, err: %w", key, value, parseErr)
+		}
+	}
+
+	if !req.Query.From.IsZero() && !req.Query.To.IsZero() && !req.Query.From.Before(req.Query.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	return req, nil
+}
+
+// parseCollectionBody reads {"name": "..."}, unknown fields are refused
+func parseCollectionBody(r *http.Request) (*collectionBody, error) {
+	data, readErr := io.ReadAll(io.LimitReader(r.Body, constants.MAX_COLLECTION_BODY_SIZE+1))
+	if readErr != nil {
+		return nil, fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+	if int64(len(data)) > constants.MAX_COLLECTION_BODY_SIZE {
+		return nil, fmt.Errorf("body is larger than %d bytes", constants.MAX_COLLECTION_BODY_SIZE)
+	}
+
+	var body collectionBody
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	decodeErr := decoder.Decode(&body)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decoder.Decode() failed, err: %w", decodeErr)
+	}
+	return &body, nil
+}
+
+// parseListParams parses the query parameters of GET /receipts
+func parseListParams(username string, params url.Values) (*ListRequest, error) {
+	req := &ListRequest{
+		Username: username,
+		Limit:    constants.LIST_LIMIT_DEFAULT,
+		Order:    constants.SORT_ORDER_DESC,
+	}
+
+	for key, values := range params {
+		value := values[0]
+		if len(values) > 1 {
+			return nil, fmt.Errorf("repeated parameter: %s", key)
+		}
+
+		var parseErr error
+		switch key {
+		case "limit":
+			req.Limit, parseErr = strconv.Atoi(value)
+			if parseErr == nil && (req.Limit < 1 || req.Limit > constants.LIST_LIMIT_MAX) {
+				parseErr = fmt.Errorf("limit must be between 1 and %d", constants.LIST_LIMIT_MAX)
+			}
+		case "cursor":
+			req.Cursor, parseErr = DecodeCursor(value)
+		case "order":
+			req.Order = value
+			if value != constants.SORT_ORDER_ASC && value != constants.SORT_ORDER_DESC {
+				parseErr = fmt.Errorf("unknown order")
+			}
+		case "from":
+			req.From, parseErr = parseTime(value, false)
+		case "to":
+			req.To, parseErr = parseTime(value, true)
+		case "status":
+			req.Status = value
+			switch value {
+			case constants.VARIANT_STATUS_QUEUED, constants.VARIANT_STATUS_PROCESSING, constants.VARIANT_STATUS_READY, constants.VARIANT_STATUS_FAILED:
+			default:
+				parseErr = fmt.Errorf("unknown status")
+			}
+		default:
+			parseErr = fmt.Errorf("unrecognized parameter")
+		}
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid parameter %s=%s, err: %w", key, value, parseErr)
+		}
+	}
+
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	return req, nil
+}
+
+// parseTime parses an RFC 3339 time or a date, a date is the start of the day in UTC, or the start
+// of the next day if endOfDay
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	date, dateErr := time.Parse(time.DateOnly, value)
+	if dateErr == nil {
+		if endOfDay {
+			return date.AddDate(0, 0, 1), nil
+		}
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// EncodeCursor returns the opaque cursor of a position in GET /receipts
+func EncodeCursor(cursor *ListCursor) string {
+	value := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ReceiptID
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// DecodeCursor parses a cursor created by EncodeCursor
+func DecodeCursor(value string) (*ListCursor, error) {
+	decoded, decodeErr := base64.RawURLEncoding.DecodeString(value)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("base64.DecodeString() failed, err: %w", decodeErr)
+	}
+
+	createdAt, receiptId, found := strings.Cut(string(decoded), "|")
+	if !found || receiptId == "" {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	t, parseErr := time.Parse(time.RFC3339Nano, createdAt)
+	if parseErr != nil {
+		return nil, fmt.Errorf("time.Parse() failed, err: %w", parseErr)
+	}
+	return &ListCursor{CreatedAt: t, ReceiptID: receiptId}, nil
+}
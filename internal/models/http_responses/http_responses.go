@@ -1,5 +1,14 @@
 package http_responses
 
+import (
+	"receipt_uploader/internal/exif"
+	"receipt_uploader/internal/models/audit_entry"
+	"receipt_uploader/internal/models/collection"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/worker_metrics"
+	"time"
+)
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -10,6 +19,69 @@ type HealthResponse struct {
 
 type UploadResponse struct {
 	ReceiptID string `json:"receiptId"`
+	Duplicate bool   `json:"duplicate,omitempty"` // true if the same image has been uploaded before
+}
+
+type RestoreResponse struct {
+	ReceiptID string `json:"receiptId"`
+}
+
+type TrashItem struct {
+	ReceiptID string    `json:"receiptId"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"` // time after which the receipt can no longer be restored
+}
+
+type TrashListResponse struct {
+	Items []TrashItem `json:"items"`
+}
+
+// ReceiptSize is an image of a receipt which can be downloaded
+type ReceiptSize struct {
+	Size   string `json:"size"`   // "original" or name of a dimension
+	Width  int    `json:"width"`  // pixels
+	Height int    `json:"height"` // pixels
+	Bytes  int64  `json:"bytes"`
+	URL    string `json:"url"` // download URL, relative to the server
+}
+
+type ReceiptItem struct {
+	ReceiptID   string                       `json:"receiptId"`
+	UploadedAt  time.Time                    `json:"uploadedAt"`
+	Status      string                       `json:"status"`         // queued, processing, ready or failed
+	Sizes       []ReceiptSize                `json:"sizes"`          // original first, then the resized images which are ready
+	Exif        *exif.Exif                   `json:"exif,omitempty"` // capture time and device of the original, unset if unknown
+	Annotations receipt_metadata.Annotations `json:"annotations"`
+	ETag        string                       `json:"etag"` // changes with the annotations, sent as If-Match to update them
+	Tier        string                       `json:"tier"` // hot or cold, storage tier of the original
+}
+
+type ReceiptListResponse struct {
+	Items      []ReceiptItem `json:"items"`
+	NextCursor string        `json:"nextCursor,omitempty"` // cursor of the next page, empty on the last page
+}
+
+// VariantStatus is the processing status of the copy or a resized image of a receipt
+type VariantStatus struct {
+	Size          string     `json:"size"`                    // "original" or name of a dimension
+	Status        string     `json:"status"`                  // queued, processing, ready or failed
+	ErrorCategory string     `json:"errorCategory,omitempty"` // why generating the image failed last: read, decode, resize, write or timeout
+	StartedAt     *time.Time `json:"startedAt,omitempty"`     // last time generating the image started
+	UpdatedAt     time.Time  `json:"updatedAt"`               // last time the status changed
+}
+
+type ReceiptStatusResponse struct {
+	ReceiptID  string          `json:"receiptId"`
+	Status     string          `json:"status"` // status of the receipt as a whole
+	UploadedAt time.Time       `json:"uploadedAt"`
+	Sizes      []VariantStatus `json:"sizes"` // original first, then every dimension
+}
+
+// PendingDownloadResponse is returned instead of an image which has not been generated yet or
+// failed to be generated
+type PendingDownloadResponse struct {
+	ReceiptID string `json:"receiptId"`
+	VariantStatus
 }
 
 type DownloadResponseHeader struct {
@@ -17,3 +89,40 @@ type DownloadResponseHeader struct {
 	ContentType   string `json:"contentType"`
 	ContentLength int64  `json:"contentLength"`
 }
+
+// UsageResponse reports the storage used by a user and its quota, a limit of 0 means unlimited
+type UsageResponse struct {
+	UsedBytes    int64 `json:"usedBytes"`
+	UsedReceipts int   `json:"usedReceipts"`
+	MaxBytes     int64 `json:"maxBytes"`
+	MaxReceipts  int   `json:"maxReceipts"`
+}
+
+type CollectionItem struct {
+	CollectionID string    `json:"collectionId"`
+	Name         string    `json:"name"`
+	ReceiptIDs   []string  `json:"receiptIds"` // in the order they were added, including receipts in trash
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type CollectionListResponse struct {
+	Items []CollectionItem `json:"items"`
+}
+
+// CollectionResponse is a collection with the totals of its receipts, receipts in trash are not counted
+type CollectionResponse struct {
+	CollectionItem
+	Receipts      int                `json:"receipts"`      // number of receipts counted
+	WithoutAmount int                `json:"withoutAmount"` // number of receipts counted which have no amount
+	Totals        []collection.Total `json:"totals"`        // sum of the amounts per currency
+}
+
+type AuditListResponse struct {
+	Items      []audit_entry.AuditEntry `json:"items"`                // oldest entry first
+	NextCursor string                   `json:"nextCursor,omitempty"` // cursor of the next page, empty on the last page
+}
+
+type WorkerMetricsResponse struct {
+	Workers []worker_metrics.WorkerMetrics `json:"workers"` // ordered by worker
+}
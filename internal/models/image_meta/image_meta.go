@@ -5,9 +5,8 @@ import (
 	"fmt"
 	"path/filepath"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
 	"strings"
-
-	"github.com/google/uuid"
 )
 
 // ImageMeta represents the metadata associated with an image file.
@@ -40,10 +39,34 @@ func FromUploadDir(fullPath string) (*ImageMeta, error) {
 	}, nil
 }
 
-// FromFormData creates an ImageMeta object from upload request, based on the provided username, extension,
-// and config.DIR_UPLOADS directory
-func FromFormData(username, extension, uploadDir string) *ImageMeta {
-	receiptId := strings.ReplaceAll(uuid.New().String(), "-", "")
+// FromResizedDir creates an ImageMeta object from the full file path of a copy or a resized image in
+// config.DIR_RESIZED/{username} folder, it also returns the size of the image, "" for the copy
+func FromResizedDir(fullPath string) (*ImageMeta, string, error) {
+	fileName := filepath.Base(fullPath)
+	extension := filepath.Ext(fullPath)
+	username := filepath.Base(filepath.Dir(fullPath))
+	if username == "." || username == string(filepath.Separator) {
+		return nil, "", errors.New("invalid path, missing username")
+	}
+
+	receiptId, size, _ := strings.Cut(strings.TrimSuffix(fileName, extension), "_")
+	if receiptId == "" {
+		return nil, "", errors.New("invalid path, missing receiptId")
+	}
+
+	return &ImageMeta{
+		Path:      fullPath,
+		Dir:       filepath.Dir(fullPath),
+		FileName:  fileName,
+		Extension: extension,
+		Username:  username,
+		ReceiptID: receiptId,
+	}, size, nil
+}
+
+// FromFormData creates an ImageMeta object from upload request, based on the provided username, receiptId,
+// extension, and config.DIR_UPLOADS directory
+func FromFormData(username, receiptId, extension, uploadDir string) *ImageMeta {
 	fileName := username + "#" + receiptId + "." + extension
 	path := filepath.Join(uploadDir, fileName)
 
@@ -51,6 +74,16 @@ func FromFormData(username, extension, uploadDir string) *ImageMeta {
 	return imgFile
 }
 
+// FromReceiptID creates an ImageMeta object of the original upload of username's receipt in
+// config.DIR_UPLOADS directory
+func FromReceiptID(username, receiptId, uploadDir string) *ImageMeta {
+	fileName := username + "#" + receiptId + ".jpg"
+	path := filepath.Join(uploadDir, fileName)
+
+	imgFile, _ := FromUploadDir(path) // Ignoring error here as the path always contains username
+	return imgFile
+}
+
 // FromGetRequset constructs an ImageMeta object from the provided receiptID, size,
 // username in GET request and source directory.
 func FromGetRequset(receiptID, size, username, srcDir string) *ImageMeta {
@@ -85,3 +118,17 @@ func GetResizedPath(imgFile *ImageMeta, destDir, size string) string {
 	fPath := filepath.Join(destDir, newFilename)
 	return fPath
 }
+
+// GetReceiptPaths returns the paths of all files of a receipt: the original upload, its copy in
+// resizedDir/{username} and one resized variant per dimension
+func GetReceiptPaths(imgFile *ImageMeta, resizedDir string, dimensions *configs.Dimensions) []string {
+	destDir := filepath.Join(resizedDir, imgFile.Username)
+	paths := []string{
+		imgFile.Path,
+		GetResizedPath(imgFile, destDir, ""),
+	}
+	for _, d := range *dimensions {
+		paths = append(paths, GetResizedPath(imgFile, destDir, d.Name))
+	}
+	return paths
+}
@@ -2,6 +2,7 @@ package image_meta
 
 import (
 	"path/filepath"
+	"receipt_uploader/internal/models/configs"
 	"strings"
 	"testing"
 
@@ -48,9 +49,9 @@ func TestFromUpload(t *testing.T) {
 		extension := "png"
 		uploadDir := "test-image-files/uploads"
 
-		imgFile := FromFormData(username, extension, uploadDir)
+		imgFile := FromFormData(username, "123456", extension, uploadDir)
 
-		expectedPath := filepath.Join(uploadDir, username+"#"+imgFile.ReceiptID+"."+extension)
+		expectedPath := filepath.Join(uploadDir, username+"#123456."+extension)
 
 		assert.NotNil(t, imgFile)
 		assert.Equal(t, username, imgFile.Username)
@@ -59,6 +60,20 @@ func TestFromUpload(t *testing.T) {
 	})
 }
 
+func TestFromReceiptID(t *testing.T) {
+	t.Run("Valid Input", func(t *testing.T) {
+		uploadDir := "test-image-files/uploads"
+
+		imgFile := FromReceiptID("user1", "123456", uploadDir)
+
+		assert.NotNil(t, imgFile)
+		assert.Equal(t, filepath.Join(uploadDir, "user1#123456.jpg"), imgFile.Path)
+		assert.Equal(t, "user1", imgFile.Username)
+		assert.Equal(t, "123456", imgFile.ReceiptID)
+		assert.Equal(t, ".jpg", imgFile.Extension)
+	})
+}
+
 func TestGetResizedPath(t *testing.T) {
 	baseDir := "test-get-resized-path"
 	uploadDir := filepath.Join(baseDir, "uploads")
@@ -93,6 +108,23 @@ func TestGetResizedPath(t *testing.T) {
 	})
 }
 
+func TestGetReceiptPaths(t *testing.T) {
+	t.Run("Valid Input", func(t *testing.T) {
+		imgFile := FromReceiptID("user1", "123456", "uploads")
+
+		paths := GetReceiptPaths(imgFile, "resized", &configs.AllowedDimensions)
+
+		expected := []string{
+			filepath.Join("uploads", "user1#123456.jpg"),
+			filepath.Join("resized", "user1", "123456.jpg"),
+			filepath.Join("resized", "user1", "123456_small.jpg"),
+			filepath.Join("resized", "user1", "123456_medium.jpg"),
+			filepath.Join("resized", "user1", "123456_large.jpg"),
+		}
+		assert.Equal(t, expected, paths)
+	})
+}
+
 func TestFromGetRequset(t *testing.T) {
 	baseDir := "test-from-get-request"
 
@@ -136,3 +168,33 @@ func TestFromGetRequset(t *testing.T) {
 		assert.Equal(t, filepath.Join(srcDir, username), imgMeta.Dir)
 	})
 }
+
+func TestFromResizedDir(t *testing.T) {
+	t.Run("Valid Input, copy", func(t *testing.T) {
+		path := filepath.Join("resized", "user1", "123456.jpg")
+
+		imgMeta, size, err := FromResizedDir(path)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", size)
+		assert.Equal(t, "user1", imgMeta.Username)
+		assert.Equal(t, "123456", imgMeta.ReceiptID)
+		assert.Equal(t, path, imgMeta.Path)
+	})
+
+	t.Run("Valid Input, with size", func(t *testing.T) {
+		path := filepath.Join("resized", "user1", "123456_small.jpg")
+
+		imgMeta, size, err := FromResizedDir(path)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "small", size)
+		assert.Equal(t, "user1", imgMeta.Username)
+		assert.Equal(t, "123456", imgMeta.ReceiptID)
+	})
+
+	t.Run("Invalid Input (missing username)", func(t *testing.T) {
+		_, _, err := FromResizedDir("123456.jpg")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,45 @@
+package import_report
+
+import "time"
+
+const (
+	STATUS_IMPORTED  = "imported"  // a new receipt has been created
+	STATUS_DUPLICATE = "duplicate" // the same image has been uploaded before, receiptId refers to it
+	STATUS_SKIPPED   = "skipped"   // resized image listed in the manifest, it is generated from the original
+	STATUS_FAILED    = "failed"    // see error
+)
+
+// FileResult is the outcome of importing a single file
+type FileResult struct {
+	Name         string    `json:"name"` // path of the file inside the archive or directory
+	Status       string    `json:"status"`
+	ReceiptID    string    `json:"receiptId,omitempty"`
+	CreatedAt    time.Time `json:"createdAt,omitempty"`    // original timestamp kept for the receipt
+	ResizeQueued bool      `json:"resizeQueued,omitempty"` // false if resize_queue was full, the reconciler resizes it on next start
+	Error        string    `json:"error,omitempty"`
+}
+
+// Report lists the outcome of every file of an import
+type Report struct {
+	Username   string       `json:"username"`
+	Imported   int          `json:"imported"`
+	Duplicates int          `json:"duplicates"`
+	Skipped    int          `json:"skipped"`
+	Failed     int          `json:"failed"`
+	Files      []FileResult `json:"files"`
+}
+
+// Add appends result to the report and counts it by status
+func (r *Report) Add(result FileResult) {
+	switch result.Status {
+	case STATUS_IMPORTED:
+		r.Imported++
+	case STATUS_DUPLICATE:
+		r.Duplicates++
+	case STATUS_SKIPPED:
+		r.Skipped++
+	case STATUS_FAILED:
+		r.Failed++
+	}
+	r.Files = append(r.Files, result)
+}
@@ -0,0 +1,144 @@
+package receipt_metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"receipt_uploader/internal/constants"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidAnnotations is wrapped by errors of annotations which can not be stored
+var ErrInvalidAnnotations = errors.New("invalid annotations")
+
+var (
+	tagPattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	amountPattern   = regexp.MustCompile(`^-?(0|[1-9][0-9]{0,11})(\.[0-9]{1,3})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Annotations are set by the owner of a receipt, all of them are optional
+type Annotations struct {
+	Notes           string   `json:"notes,omitempty"`           // free text
+	Tags            []string `json:"tags,omitempty"`            // lower case, unique
+	Merchant        string   `json:"merchant,omitempty"`        // name of the merchant
+	Amount          *Amount  `json:"amount,omitempty"`          // total amount of the receipt
+	TransactionDate string   `json:"transactionDate,omitempty"` // date of the transaction, YYYY-MM-DD
+}
+
+// Amount is a decimal amount of money, kept as text so it is never rounded
+type Amount struct {
+	Value    string `json:"value"`    // e.g. "12.50", negative for refunds
+	Currency string `json:"currency"` // ISO 4217 code, e.g. "EUR"
+}
+
+// Patch returns a with the JSON merge patch (RFC 7396) applied: fields in patch replace those of a,
+// fields set to null are removed. Amount and tags are replaced as a whole. The result is normalized
+// and validated, errors wrap ErrInvalidAnnotations.
+func (a *Annotations) Patch(patch []byte) (*Annotations, error) {
+	var changes map[string]json.RawMessage
+	unmarshalErr := json.Unmarshal(patch, &changes)
+	if unmarshalErr != nil || changes == nil {
+		return nil, fmt.Errorf("%w, patch must be a JSON object", ErrInvalidAnnotations)
+	}
+
+	current, marshalErr := json.Marshal(a)
+	if marshalErr != nil {
+		return nil, fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+	fields := map[string]json.RawMessage{}
+	unmarshalErr = json.Unmarshal(current, &fields)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("json.Unmarshal() failed, err: %w", unmarshalErr)
+	}
+	for key, value := range changes {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(fields, key)
+			continue
+		}
+		fields[key] = value
+	}
+
+	merged, marshalErr := json.Marshal(fields)
+	if marshalErr != nil {
+		return nil, fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	patched := &Annotations{}
+	decodeErr := decoder.Decode(patched)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("%w, err: %s", ErrInvalidAnnotations, decodeErr.Error())
+	}
+
+	normalizeErr := patched.normalize()
+	if normalizeErr != nil {
+		return nil, fmt.Errorf("%w, err: %s", ErrInvalidAnnotations, normalizeErr.Error())
+	}
+	return patched, nil
+}
+
+// normalize trims and lower cases the fields of a and validates them
+func (a *Annotations) normalize() error {
+	a.Notes = strings.TrimSpace(a.Notes)
+	if utf8.RuneCountInString(a.Notes) > constants.ANNOTATION_NOTES_MAX {
+		return fmt.Errorf("notes are longer than %d characters", constants.ANNOTATION_NOTES_MAX)
+	}
+
+	a.Merchant = strings.TrimSpace(a.Merchant)
+	if utf8.RuneCountInString(a.Merchant) > constants.ANNOTATION_MERCHANT_MAX {
+		return fmt.Errorf("merchant is longer than %d characters", constants.ANNOTATION_MERCHANT_MAX)
+	}
+
+	tags := []string{}
+	for _, tag := range a.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) > constants.ANNOTATION_TAG_MAX || !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag: %q", tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > constants.ANNOTATION_TAGS_MAX {
+		return fmt.Errorf("more than %d tags", constants.ANNOTATION_TAGS_MAX)
+	}
+	a.Tags = nil
+	if len(tags) > 0 {
+		a.Tags = tags
+	}
+
+	if a.Amount != nil {
+		a.Amount.Currency = strings.ToUpper(strings.TrimSpace(a.Amount.Currency))
+		if !amountPattern.MatchString(a.Amount.Value) {
+			return fmt.Errorf("invalid amount: %q", a.Amount.Value)
+		}
+		if !currencyPattern.MatchString(a.Amount.Currency) {
+			return fmt.Errorf("invalid currency: %q", a.Amount.Currency)
+		}
+	}
+
+	if a.TransactionDate != "" {
+		_, parseErr := time.Parse(time.DateOnly, a.TransactionDate)
+		if parseErr != nil {
+			return fmt.Errorf("invalid transactionDate: %q", a.TransactionDate)
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of a which does not share its tags and amount
+func (a *Annotations) clone() Annotations {
+	clone := *a
+	clone.Tags = slices.Clone(a.Tags)
+	if a.Amount != nil {
+		amount := *a.Amount
+		clone.Amount = &amount
+	}
+	return clone
+}
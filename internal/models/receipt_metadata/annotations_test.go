@@ -0,0 +1,56 @@
+package receipt_metadata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatch(t *testing.T) {
+	t.Run("succeed, set, normalize and remove fields", func(t *testing.T) {
+		annotations := &Annotations{}
+
+		patched, patchErr := annotations.Patch([]byte(`{
+			"notes": " lunch with client ",
+			"tags": ["Travel", "travel", "client-a"],
+			"merchant": "Cafe Aalto",
+			"amount": {"value": "12.50", "currency": "eur"},
+			"transactionDate": "2026-01-31"
+		}`))
+		assert.Nil(t, patchErr)
+		assert.Equal(t, &Annotations{
+			Notes:           "lunch with client",
+			Tags:            []string{"travel", "client-a"},
+			Merchant:        "Cafe Aalto",
+			Amount:          &Amount{Value: "12.50", Currency: "EUR"},
+			TransactionDate: "2026-01-31",
+		}, patched)
+
+		patched, patchErr = patched.Patch([]byte(`{"notes": null, "tags": ["food"]}`))
+		assert.Nil(t, patchErr)
+		assert.Empty(t, patched.Notes)
+		assert.Equal(t, []string{"food"}, patched.Tags)
+		assert.Equal(t, "Cafe Aalto", patched.Merchant)
+	})
+
+	t.Run("should fail, invalid patch", func(t *testing.T) {
+		tests := []string{
+			`[]`,
+			`null`,
+			`{"unknown": "field"}`,
+			`{"notes": 1}`,
+			`{"notes": "` + strings.Repeat("a", 2001) + `"}`,
+			`{"tags": ["has space"]}`,
+			`{"tags": ["` + strings.Repeat("a", 33) + `"]}`,
+			`{"amount": {"value": "12,50", "currency": "EUR"}}`,
+			`{"amount": {"value": "12.5", "currency": "EURO"}}`,
+			`{"amount": {"value": 12.5, "currency": "EUR"}}`,
+			`{"transactionDate": "31.01.2026"}`,
+		}
+		for _, patch := range tests {
+			_, patchErr := (&Annotations{}).Patch([]byte(patch))
+			assert.ErrorIs(t, patchErr, ErrInvalidAnnotations, patch)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package receipt_metadata
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/exif"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/receipt_record"
+	"time"
+)
+
+// ReceiptMetadata is the entry of a receipt in the metadata store, it identifies the owner of
+// the receipt and describes its original and variants without reading them from storage
+type ReceiptMetadata struct {
+	ReceiptID string             `json:"receiptId"`      // Unique identifier for the receipt
+	Username  string             `json:"username"`       // Username of the owner
+	Path      string             `json:"path"`           // Path of the original in config.UploadsDir
+	CreatedAt time.Time          `json:"createdAt"`      // Time of the upload
+	UpdatedAt time.Time          `json:"updatedAt"`      // Last time the metadata changed
+	Width     int                `json:"width"`          // Width of the original in pixels
+	Height    int                `json:"height"`         // Height of the original in pixels
+	Size      int64              `json:"size"`           // Size of the original in bytes
+	Checksum  string             `json:"checksum"`       // SHA-256 of the original, hex encoded
+	Tier      string             `json:"tier"`           // constants.TIER_xxx, storage tier of the original
+	Variants  map[string]Variant `json:"variants"`       // keyed by "original" for the copy and by dimension name
+	Exif      *exif.Exif         `json:"exif,omitempty"` // nil if the original has no EXIF block
+
+	Annotations Annotations `json:"annotations"` // set by the owner
+	Revision    int         `json:"revision"`    // incremented on every change of Annotations
+}
+
+// Variant describes the copy or a resized image of a receipt
+type Variant struct {
+	Status        string    `json:"status"`                  // queued, processing, ready, failed
+	Width         int       `json:"width,omitempty"`         // set once ready
+	Height        int       `json:"height,omitempty"`        // set once ready
+	Size          int64     `json:"size,omitempty"`          // bytes, set once ready
+	Checksum      string    `json:"checksum,omitempty"`      // SHA-256, hex encoded, set once ready
+	Error         string    `json:"error,omitempty"`         // why generating the variant failed last, cleared once ready
+	ErrorCategory string    `json:"errorCategory,omitempty"` // constants.RESIZE_ERR_xxx of Error
+	StartedAt     time.Time `json:"startedAt"`               // last time generating the variant started
+	UpdatedAt     time.Time `json:"updatedAt"`               // last time the status changed
+}
+
+// New creates the metadata of an original stored at path with its parsed EXIF block, the copy and
+// all resized images of dimensions are queued
+func New(receiptId, username, path string, data []byte, exifData *exif.Exif, createdAt time.Time, dimensions *configs.Dimensions) (*ReceiptMetadata, error) {
+	config, _, decodeErr := image.DecodeConfig(bytes.NewReader(data))
+	if decodeErr != nil {
+		return nil, fmt.Errorf("image.DecodeConfig() failed, err: %w", decodeErr)
+	}
+
+	now := time.Now().UTC()
+	metadata := &ReceiptMetadata{
+		ReceiptID: receiptId,
+		Username:  username,
+		Path:      path,
+		CreatedAt: createdAt,
+		UpdatedAt: now,
+		Width:     config.Width,
+		Height:    config.Height,
+		Size:      int64(len(data)),
+		Checksum:  receipt_record.HashContent(data),
+		Tier:      constants.TIER_HOT,
+		Variants:  map[string]Variant{},
+		Exif:      exifData,
+	}
+	for _, name := range VariantNames(dimensions) {
+		metadata.Variants[name] = Variant{
+			Status:    constants.VARIANT_STATUS_QUEUED,
+			UpdatedAt: now,
+		}
+	}
+	return metadata, nil
+}
+
+// VariantNames returns the name of the copy followed by the names of dimensions
+func VariantNames(dimensions *configs.Dimensions) []string {
+	names := []string{constants.VARIANT_ORIGINAL}
+	for _, d := range *dimensions {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// VariantName returns the variant served for a download of size, "" is the copy
+func VariantName(size string) string {
+	if size == "" {
+		return constants.VARIANT_ORIGINAL
+	}
+	return size
+}
+
+// Status returns the processing status of the receipt: failed if any variant failed, ready once
+// all variants are ready, processing while any variant is being generated, queued otherwise
+func (m *ReceiptMetadata) Status() string {
+	status := constants.VARIANT_STATUS_READY
+	for _, variant := range m.Variants {
+		switch variant.Status {
+		case constants.VARIANT_STATUS_FAILED:
+			return constants.VARIANT_STATUS_FAILED
+		case constants.VARIANT_STATUS_READY:
+		case constants.VARIANT_STATUS_PROCESSING:
+			status = constants.VARIANT_STATUS_PROCESSING
+		default:
+			if status == constants.VARIANT_STATUS_READY {
+				status = constants.VARIANT_STATUS_QUEUED
+			}
+		}
+	}
+	return status
+}
+
+// IsPending reports if the variant is still waiting to be generated or being generated
+func (v *Variant) IsPending() bool {
+	return v.Status == constants.VARIANT_STATUS_QUEUED || v.Status == constants.VARIANT_STATUS_PROCESSING
+}
+
+// Clone returns a copy of m which does not share its variants, annotations and EXIF
+func (m *ReceiptMetadata) Clone() *ReceiptMetadata {
+	clone := *m
+	clone.Annotations = m.Annotations.clone()
+	if m.Exif != nil {
+		exifData := *m.Exif
+		clone.Exif = &exifData
+	}
+	clone.Variants = make(map[string]Variant, len(m.Variants))
+	for name, variant := range m.Variants {
+		clone.Variants[name] = variant
+	}
+	return &clone
+}
@@ -0,0 +1,33 @@
+package receipt_record
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ReceiptRecord is the per-user record of an uploaded receipt, it references the stored
+// original by its content hash so that the same image is only stored once for a user
+type ReceiptRecord struct {
+	ReceiptID   string    `json:"receiptId"`   // Unique identifier for the receipt
+	Username    string    `json:"username"`    // Username of the uploader
+	ContentHash string    `json:"contentHash"` // SHA-256 of the original upload, hex encoded
+	Path        string    `json:"path"`        // Path of the original in config.UploadsDir
+	Size        int64     `json:"size"`        // Size of the original in bytes
+	CreatedAt   time.Time `json:"createdAt"`   // Time of the upload
+	Tier        string    `json:"tier"`        // hot, cold, storage tier of the original
+}
+
+// HashContent returns the hex encoded SHA-256 of an uploaded image
+func HashContent(bytes []byte) string {
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReceiptIDOf returns the receiptId of username's receipt storing the content with contentHash, the
+// first 128 bits of the SHA-256 of both. The original of a user is stored once under its content,
+// receiptIds of the same content of different users differ.
+func ReceiptIDOf(username, contentHash string) string {
+	sum := sha256.Sum256([]byte(username + "#" + contentHash))
+	return hex.EncodeToString(sum[:16])
+}
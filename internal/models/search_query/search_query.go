@@ -0,0 +1,197 @@
+package search_query
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"receipt_uploader/internal/constants"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	decimalPattern  = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Query is a parsed search query, a receipt matches if it matches all conditions which are set
+type Query struct {
+	Tags           []string // receipt has all tags
+	MerchantPrefix string   // merchant starts with, lower case
+	Currency       string   // currency of the amount, upper case
+	MinAmount      *big.Rat // amount is at least
+	MaxAmount      *big.Rat // amount is at most
+	FromDate       string   // transaction date is on or after, YYYY-MM-DD
+	ToDate         string   // transaction date is on or before, YYYY-MM-DD
+	Words          []string // notes contain all words, lower case
+}
+
+// token is a term of a query, quoted if it started with a double quote
+type token struct {
+	text   string
+	quoted bool
+}
+
+// ParseQuery parses a query of whitespace separated terms, all of which must match:
+//   - tag:travel, the receipt has the tag
+//   - merchant:caf, the merchant starts with caf, ignoring case
+//   - currency:EUR, the amount is in EUR
+//   - amount:10..50, amount:10.., amount:..50 or amount:12.50, the amount is in the range, inclusive
+//   - date:2026-01-01..2026-01-31, date:2026-01-01.. or date:2026-01-31, the transaction date is in the range, inclusive
+//   - any other word, the notes contain the word, ignoring case
+//
+// Values containing spaces are quoted, e.g. merchant:"cafe aa" or "client meeting".
+func ParseQuery(q string) (*Query, error) {
+	if len(q) > constants.SEARCH_QUERY_MAX {
+		return nil, fmt.Errorf("query is longer than %d bytes", constants.SEARCH_QUERY_MAX)
+	}
+
+	tokens, tokenizeErr := tokenize(q)
+	if tokenizeErr != nil {
+		return nil, tokenizeErr
+	}
+
+	query := &Query{}
+	for _, t := range tokens {
+		field, value, found := strings.Cut(t.text, ":")
+		if t.quoted || !found {
+			query.Words = append(query.Words, SplitWords(t.text)...)
+			continue
+		}
+
+		parseErr := query.set(field, value)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid term %q, err: %w", t.text, parseErr)
+		}
+	}
+	return query, nil
+}
+
+// set sets the condition of field to value
+func (q *Query) set(field, value string) error {
+	if value == "" {
+		return errors.New("empty value")
+	}
+
+	switch field {
+	case "tag":
+		q.Tags = append(q.Tags, strings.ToLower(value))
+	case "merchant":
+		if q.MerchantPrefix != "" {
+			return errors.New("repeated field")
+		}
+		q.MerchantPrefix = strings.ToLower(value)
+	case "currency":
+		if q.Currency != "" {
+			return errors.New("repeated field")
+		}
+		q.Currency = strings.ToUpper(value)
+		if !currencyPattern.MatchString(q.Currency) {
+			return errors.New("invalid currency")
+		}
+	case "amount":
+		if q.MinAmount != nil || q.MaxAmount != nil {
+			return errors.New("repeated field")
+		}
+		return parseRange(value, func(bound string) (*big.Rat, error) {
+			if !decimalPattern.MatchString(bound) {
+				return nil, errors.New("invalid amount")
+			}
+			amount, _ := new(big.Rat).SetString(bound)
+			return amount, nil
+		}, &q.MinAmount, &q.MaxAmount)
+	case "date":
+		if q.FromDate != "" || q.ToDate != "" {
+			return errors.New("repeated field")
+		}
+		var from, to *string
+		rangeErr := parseRange(value, func(bound string) (*string, error) {
+			_, parseErr := time.Parse(time.DateOnly, bound)
+			if parseErr != nil {
+				return nil, errors.New("invalid date")
+			}
+			return &bound, nil
+		}, &from, &to)
+		if from != nil {
+			q.FromDate = *from
+		}
+		if to != nil {
+			q.ToDate = *to
+		}
+		return rangeErr
+	default:
+		return errors.New("unknown field")
+	}
+	return nil
+}
+
+// parseRange parses a range min..max, either bound can be omitted, or a single value which is
+// both bounds
+func parseRange[T any](value string, parse func(bound string) (*T, error), min, max **T) error {
+	minValue, maxValue, isRange := strings.Cut(value, "..")
+	if !isRange {
+		maxValue = minValue
+	}
+	if minValue == "" && maxValue == "" {
+		return errors.New("empty range")
+	}
+
+	var parseErr error
+	if minValue != "" {
+		*min, parseErr = parse(minValue)
+		if parseErr != nil {
+			return parseErr
+		}
+	}
+	if maxValue != "" {
+		*max, parseErr = parse(maxValue)
+		if parseErr != nil {
+			return parseErr
+		}
+	}
+	return nil
+}
+
+// tokenize splits q at whitespace outside of double quotes
+func tokenize(q string) ([]token, error) {
+	tokens := []token{}
+	current := token{}
+	started := false
+	inQuotes := false
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			if !started {
+				current.quoted = true
+			}
+			inQuotes = !inQuotes
+			started = true
+		case unicode.IsSpace(r) && !inQuotes:
+			if started {
+				tokens = append(tokens, current)
+			}
+			current = token{}
+			started = false
+		default:
+			current.text += string(r)
+			started = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quote")
+	}
+	if started {
+		tokens = append(tokens, current)
+	}
+	return tokens, nil
+}
+
+// SplitWords splits text into lower case words of letters and digits, notes are indexed by them
+func SplitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
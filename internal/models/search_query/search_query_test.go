@@ -0,0 +1,60 @@
+package search_query
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Run("succeed, all fields", func(t *testing.T) {
+		query, err := ParseQuery(`tag:Travel tag:work merchant:"Cafe Aa" currency:eur amount:10..50.5 date:2026-01-01.. client "Lunch, meeting"`)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"travel", "work"}, query.Tags)
+		assert.Equal(t, "cafe aa", query.MerchantPrefix)
+		assert.Equal(t, "EUR", query.Currency)
+		assert.Equal(t, 0, query.MinAmount.Cmp(big.NewRat(10, 1)))
+		assert.Equal(t, 0, query.MaxAmount.Cmp(big.NewRat(101, 2)))
+		assert.Equal(t, "2026-01-01", query.FromDate)
+		assert.Equal(t, "", query.ToDate)
+		assert.Equal(t, []string{"client", "lunch", "meeting"}, query.Words)
+	})
+
+	t.Run("succeed, single values are both bounds", func(t *testing.T) {
+		query, err := ParseQuery("amount:12.50 date:2026-02-03")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, query.MinAmount.Cmp(query.MaxAmount))
+		assert.Equal(t, "2026-02-03", query.FromDate)
+		assert.Equal(t, "2026-02-03", query.ToDate)
+	})
+
+	t.Run("succeed, empty query and quoted colon", func(t *testing.T) {
+		query, err := ParseQuery("  ")
+		assert.Nil(t, err)
+		assert.Equal(t, &Query{}, query)
+
+		query, err = ParseQuery(`"meeting at 10:30"`)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"meeting", "at", "10", "30"}, query.Words)
+	})
+
+	t.Run("should fail, invalid terms", func(t *testing.T) {
+		for _, q := range []string{
+			"unknown:value",
+			"tag:",
+			"amount:abc",
+			"amount:1/3",
+			"amount:..",
+			"amount:1 amount:2",
+			"date:2026-13-01",
+			"date:yesterday..",
+			"currency:EURO",
+			"merchant:a merchant:b",
+			`"unterminated`,
+		} {
+			_, err := ParseQuery(q)
+			assert.NotNil(t, err, q)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package trash_entry
+
+import (
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
+	"time"
+)
+
+// TrashedFile maps a file of a deleted receipt to its location in the trash
+type TrashedFile struct {
+	OriginalPath string `json:"originalPath"`
+	TrashPath    string `json:"trashPath"`
+}
+
+// TrashEntry describes a receipt which has been moved to the trash of its owner
+type TrashEntry struct {
+	ReceiptID string                            `json:"receiptId"`
+	Username  string                            `json:"username"`
+	DeletedAt time.Time                         `json:"deletedAt"`
+	Files     []TrashedFile                     `json:"files"`
+	Record    *receipt_record.ReceiptRecord     `json:"record,omitempty"`   // record of the receipt before deletion
+	Metadata  *receipt_metadata.ReceiptMetadata `json:"metadata,omitempty"` // metadata of the receipt before deletion
+}
+
+// PurgeAt returns the time after which the entry is removed for good
+func (e *TrashEntry) PurgeAt(retention time.Duration) time.Time {
+	return e.DeletedAt.Add(retention)
+}
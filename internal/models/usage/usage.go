@@ -0,0 +1,12 @@
+package usage
+
+import "time"
+
+// Usage is the storage consumed by a user, it includes originals, copies and resized variants
+// of all receipts, including receipts in trash which have not been purged yet
+type Usage struct {
+	Username  string    `json:"username"`
+	Bytes     int64     `json:"bytes"`     // bytes written for the user
+	Receipts  int       `json:"receipts"`  // number of stored receipts
+	UpdatedAt time.Time `json:"updatedAt"` // last time the usage changed
+}
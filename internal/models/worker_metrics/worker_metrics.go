@@ -0,0 +1,9 @@
+package worker_metrics
+
+// WorkerMetrics tells how much a worker of resize_queue has processed since it was started
+type WorkerMetrics struct {
+	Worker         int   `json:"worker"`         // index of the worker, starting at 0
+	TasksCompleted int64 `json:"tasksCompleted"` // tasks whose images have been generated
+	TasksFailed    int64 `json:"tasksFailed"`    // tasks which failed or timed out
+	BusyMs         int64 `json:"busyMs"`         // time spent processing tasks, in milliseconds
+}
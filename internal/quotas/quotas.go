@@ -0,0 +1,195 @@
+package quotas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/usage"
+	"receipt_uploader/internal/storage"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadTooLarge   = errors.New("upload is larger than the storage quota")
+	ErrBytesExceeded    = errors.New("storage quota exceeded")
+	ErrReceiptsExceeded = errors.New("receipt quota exceeded")
+)
+
+// Service tracks the storage used by each user incrementally and enforces the quota defined
+// by config.Quota or config.QuotaOverrides. Usage is kept in memory and written through to
+// {recordsDir}/{username}/usage.json on every change.
+type Service struct {
+	config   *configs.Config
+	storage  storage.ServiceType
+	mu       sync.Mutex
+	usages   map[string]*usage.Usage
+	reserved map[string]reservation // uploads of every user being stored, kept in memory only
+}
+
+// reservation is the storage reserved by the uploads of a user being stored
+type reservation struct {
+	bytes    int64
+	receipts int
+}
+
+func NewService(config *configs.Config, s storage.ServiceType) ServiceType {
+	return &Service{
+		config:   config,
+		storage:  s,
+		usages:   make(map[string]*usage.Usage),
+		reserved: make(map[string]reservation),
+	}
+}
+
+// GetQuota returns the quota of username, a limit of 0 means unlimited
+func (s *Service) GetQuota(username string) configs.Quota {
+	if quota, ok := s.config.QuotaOverrides[username]; ok {
+		return quota
+	}
+	return s.config.Quota
+}
+
+// Reserve reserves storing an upload of uploadSize bytes for username, an error is returned if it
+// would exceed username's quota together with the usage and the uploads reserved so far. Checking
+// and reserving is atomic, so concurrent uploads can not exceed the quota. The reservation must be
+// released by Release once the upload is stored, AddUsage counts it from then on, or failed. An
+// upload is stored twice, as the original and as its copy, so twice uploadSize is reserved.
+// Resized variants are counted once they are written.
+func (s *Service) Reserve(username string, uploadSize int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, loadErr := s.load(username)
+	if loadErr != nil {
+		return loadErr
+	}
+	reserved := s.reserved[username]
+	bytes := current.Bytes + reserved.bytes
+	receipts := current.Receipts + reserved.receipts
+	required := storedSize(uploadSize)
+
+	quota := s.GetQuota(username)
+	if quota.MaxReceipts > 0 && receipts+1 > quota.MaxReceipts {
+		return fmt.Errorf("%w, receipts: %d, maxReceipts: %d", ErrReceiptsExceeded, receipts, quota.MaxReceipts)
+	}
+	if quota.MaxBytes > 0 && required > quota.MaxBytes {
+		return fmt.Errorf("%w, required: %d, maxBytes: %d", ErrUploadTooLarge, required, quota.MaxBytes)
+	}
+	if quota.MaxBytes > 0 && bytes+required > quota.MaxBytes {
+		return fmt.Errorf("%w, bytes: %d, required: %d, maxBytes: %d", ErrBytesExceeded, bytes, required, quota.MaxBytes)
+	}
+
+	s.reserved[username] = reservation{bytes: reserved.bytes + required, receipts: reserved.receipts + 1}
+	return nil
+}
+
+// Release releases a reservation of Reserve
+func (s *Service) Release(username string, uploadSize int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reserved := s.reserved[username]
+	reserved.bytes -= storedSize(uploadSize)
+	reserved.receipts--
+	if reserved.receipts <= 0 {
+		delete(s.reserved, username)
+		return
+	}
+	s.reserved[username] = reserved
+}
+
+// storedSize is how many bytes an upload of uploadSize bytes takes, the original and its copy
+func storedSize(uploadSize int64) int64 {
+	return 2 * uploadSize
+}
+
+// AddUsage adds bytes and receipts to the usage of username, negative values release storage
+func (s *Service) AddUsage(username string, bytes int64, receipts int) error {
+	logging.Debugf("quotas.AddUsage(username: %s, bytes: %d, receipts: %d)", username, bytes, receipts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, loadErr := s.load(username)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	updated := *current
+	updated.Bytes = max(updated.Bytes+bytes, 0)
+	updated.Receipts = max(updated.Receipts+receipts, 0)
+	updated.UpdatedAt = time.Now().UTC()
+
+	putErr := s.put(&updated)
+	if putErr != nil {
+		return putErr
+	}
+	s.usages[username] = &updated
+	return nil
+}
+
+func (s *Service) GetUsage(username string) (*usage.Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, loadErr := s.load(username)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	copied := *current
+	return &copied, nil
+}
+
+// load returns the cached usage of username, reading it from storage on first access
+func (s *Service) load(username string) (*usage.Usage, error) {
+	if cached, ok := s.usages[username]; ok {
+		return cached, nil
+	}
+
+	loaded := &usage.Usage{Username: username}
+	reader, getErr := s.storage.Get(s.usagePath(username))
+	if getErr != nil {
+		if !errors.Is(getErr, fs.ErrNotExist) {
+			return nil, fmt.Errorf("s.storage.Get() failed, err: %w", getErr)
+		}
+		s.usages[username] = loaded
+		return loaded, nil
+	}
+	defer reader.Close()
+
+	data, readErr := io.ReadAll(reader)
+	if readErr != nil {
+		return nil, fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+	unmarshalErr := json.Unmarshal(data, loaded)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("json.Unmarshal() failed, err: %w", unmarshalErr)
+	}
+
+	s.usages[username] = loaded
+	return loaded, nil
+}
+
+func (s *Service) put(u *usage.Usage) error {
+	data, marshalErr := json.Marshal(u)
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+
+	putErr := s.storage.Put(s.usagePath(u.Username), bytes.NewReader(data))
+	if putErr != nil {
+		return fmt.Errorf("s.storage.Put() failed, err: %w", putErr)
+	}
+	return nil
+}
+
+func (s *Service) usagePath(username string) string {
+	return filepath.Join(s.config.RecordsDir, username, "usage.json")
+}
@@ -0,0 +1,49 @@
+package quotas_mock
+
+import (
+	"fmt"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/usage"
+	"receipt_uploader/internal/quotas"
+)
+
+// ServiceMock has unlimited quota, except for users named after the error they trigger
+type ServiceMock struct{}
+
+func (s *ServiceMock) AddUsage(username string, bytes int64, receipts int) error {
+	logging.Debugf("quotas_mock.AddUsage(username: %s, bytes: %d, receipts: %d)", username, bytes, receipts)
+	return nil
+}
+
+func (s *ServiceMock) Reserve(username string, uploadSize int64) error {
+	logging.Debugf("quotas_mock.Reserve(username: %s, uploadSize: %d)", username, uploadSize)
+
+	switch username {
+	case "mock_upload_too_large":
+		return fmt.Errorf("mock Reserve() failed, %w", quotas.ErrUploadTooLarge)
+	case "mock_bytes_exceeded":
+		return fmt.Errorf("mock Reserve() failed, %w", quotas.ErrBytesExceeded)
+	case "mock_receipts_exceeded":
+		return fmt.Errorf("mock Reserve() failed, %w", quotas.ErrReceiptsExceeded)
+	case "mock_reserve_failed":
+		return fmt.Errorf("mock Reserve() failed")
+	}
+	return nil
+}
+
+func (s *ServiceMock) Release(username string, uploadSize int64) {
+	logging.Debugf("quotas_mock.Release(username: %s, uploadSize: %d)", username, uploadSize)
+}
+
+func (s *ServiceMock) GetUsage(username string) (*usage.Usage, error) {
+	logging.Debugf("quotas_mock.GetUsage(username: %s)", username)
+	if username == "mock_get_usage_failed" {
+		return nil, fmt.Errorf("mock GetUsage() failed")
+	}
+	return &usage.Usage{Username: username}, nil
+}
+
+func (s *ServiceMock) GetQuota(username string) configs.Quota {
+	return configs.Quota{}
+}
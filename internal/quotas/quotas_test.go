@@ -0,0 +1,104 @@
+package quotas
+
+import (
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/storage"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotas(t *testing.T) {
+	config := &configs.Config{
+		RecordsDir: "records",
+		Quota: configs.Quota{
+			MaxBytes:    1000,
+			MaxReceipts: 2,
+		},
+		QuotaOverrides: map[string]configs.Quota{
+			"unlimited_user": {},
+		},
+	}
+	store := storage.NewMemory()
+	service := NewService(config, store)
+
+	t.Run("succeed, quota of user", func(t *testing.T) {
+		assert.Equal(t, config.Quota, service.GetQuota("user1"))
+		assert.Equal(t, configs.Quota{}, service.GetQuota("unlimited_user"))
+	})
+
+	t.Run("succeed, add and get usage", func(t *testing.T) {
+		assert.Nil(t, service.Reserve("user1", 300))
+		assert.Nil(t, service.AddUsage("user1", 600, 1))
+		service.Release("user1", 300)
+
+		current, getErr := service.GetUsage("user1")
+		assert.Nil(t, getErr)
+		assert.Equal(t, int64(600), current.Bytes)
+		assert.Equal(t, 1, current.Receipts)
+
+		other, otherErr := service.GetUsage("user2")
+		assert.Nil(t, otherErr)
+		assert.Equal(t, int64(0), other.Bytes)
+	})
+
+	t.Run("succeed, usage is persisted", func(t *testing.T) {
+		reloaded, getErr := NewService(config, store).GetUsage("user1")
+		assert.Nil(t, getErr)
+		assert.Equal(t, int64(600), reloaded.Bytes)
+		assert.Equal(t, 1, reloaded.Receipts)
+	})
+
+	t.Run("should fail, quota exceeded", func(t *testing.T) {
+		assert.ErrorIs(t, service.Reserve("user1", 501), ErrUploadTooLarge)
+		assert.ErrorIs(t, service.Reserve("user1", 201), ErrBytesExceeded)
+		assert.Nil(t, service.Reserve("user1", 200))
+		service.Release("user1", 200)
+
+		assert.Nil(t, service.AddUsage("user1", 100, 1))
+		assert.ErrorIs(t, service.Reserve("user1", 1), ErrReceiptsExceeded)
+	})
+
+	t.Run("succeed, concurrent reservations do not exceed the quota", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var reserved atomic.Int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if service.Reserve("user3", 200) == nil {
+					reserved.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(2), reserved.Load())
+
+		service.Release("user3", 200)
+		assert.Nil(t, service.Reserve("user3", 200))
+		assert.ErrorIs(t, service.Reserve("user3", 200), ErrReceiptsExceeded)
+	})
+
+	t.Run("succeed, the copy of an upload is reserved", func(t *testing.T) {
+		assert.Nil(t, service.Reserve("user4", 400))
+		assert.ErrorIs(t, service.Reserve("user4", 101), ErrBytesExceeded)
+		service.Release("user4", 400)
+		assert.Nil(t, service.Reserve("user4", 500))
+	})
+
+	t.Run("succeed, unlimited quota", func(t *testing.T) {
+		assert.Nil(t, service.AddUsage("unlimited_user", 5000, 10))
+		assert.Nil(t, service.Reserve("unlimited_user", 5000))
+	})
+
+	t.Run("succeed, released usage does not go below zero", func(t *testing.T) {
+		assert.Nil(t, service.AddUsage("user1", -2000, -5))
+
+		current, getErr := service.GetUsage("user1")
+		assert.Nil(t, getErr)
+		assert.Equal(t, int64(0), current.Bytes)
+		assert.Equal(t, 0, current.Receipts)
+	})
+}
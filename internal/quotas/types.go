@@ -0,0 +1,19 @@
+package quotas
+
+import (
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/usage"
+)
+
+// UsageTracker is notified about every change of the storage used by a user
+type UsageTracker interface {
+	AddUsage(username string, bytes int64, receipts int) error
+}
+
+type ServiceType interface {
+	UsageTracker
+	Reserve(username string, uploadSize int64) error
+	Release(username string, uploadSize int64)
+	GetUsage(username string) (*usage.Usage, error)
+	GetQuota(username string) configs.Quota
+}
@@ -0,0 +1,143 @@
+package reconciler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/storage"
+	"time"
+)
+
+// Service finds uploads in config.UploadsDir which have missing or partial variants in
+// config.ResizedDir, e.g. because their tasks were dropped when the resize_queue was closed,
+// and re-submits them to the resize_queue. Uploads whose task is still pending in the
+// resize_queue, e.g. replayed by the durable queue, are not re-submitted.
+type Service struct {
+	config      *configs.Config
+	storage     storage.ServiceType
+	resizeQueue resize_queue.ServiceType
+	interval    time.Duration // minimum time between two re-submitted tasks
+}
+
+func NewService(config *configs.Config, s storage.ServiceType, resizeQueue resize_queue.ServiceType) ServiceType {
+	rate := config.ReconcileRate
+	if rate <= 0 {
+		rate = constants.RECONCILE_RATE
+	}
+
+	return &Service{
+		config:      config,
+		storage:     s,
+		resizeQueue: resizeQueue,
+		interval:    time.Second / time.Duration(rate),
+	}
+}
+
+// Run walks config.UploadsDir once and re-submits the uploads with missing or partial variants,
+// at most config.ReconcileRate tasks per second. A full queue is retried at the same rate until
+// stopChan is closed.
+func (s *Service) Run(stopChan <-chan struct{}) (*Report, error) {
+	logging.Infof("reconciler.Run(uploadsDir: %s, resizedDir: %s)", s.config.UploadsDir, s.config.ResizedDir)
+
+	objects, listErr := s.storage.List(s.config.UploadsDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List() failed, err: %w", listErr)
+	}
+
+	report := &Report{}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for _, obj := range objects {
+		report.Scanned++
+
+		imageMeta, parseErr := image_meta.FromUploadDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromUploadDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			report.Invalid++
+			continue
+		}
+
+		existing, countErr := s.countVariants(imageMeta)
+		if countErr != nil {
+			logging.Errorf("s.countVariants(path: %s) failed, err: %s", obj.Key, countErr.Error())
+			report.Failed++
+			continue
+		}
+
+		switch existing {
+		case len(s.config.Dimensions) + 1:
+			report.Complete++
+			continue
+		case 0:
+			report.Missing++
+		default:
+			report.Partial++
+		}
+
+		if s.resizeQueue.Pending(imageMeta.Username, imageMeta.ReceiptID) {
+			report.Pending++
+			continue
+		}
+
+		task := tasks.ResizeTask{
+			ImageMeta: *imageMeta,
+			DestDir:   s.config.ResizedDir,
+		}
+		if !s.enqueue(task, ticker, stopChan) {
+			report.Failed++
+			logging.Warnf("reconciliation stopped, report: %+v", *report)
+			return report, nil
+		}
+		report.Enqueued++
+	}
+
+	logging.Infof("reconciliation completed, report: %+v", *report)
+	return report, nil
+}
+
+// countVariants returns how many of the copy and the resized variants of an upload exist
+func (s *Service) countVariants(imageMeta *image_meta.ImageMeta) (int, error) {
+	destDir := filepath.Join(s.config.ResizedDir, imageMeta.Username)
+	sizes := []string{""}
+	for _, d := range s.config.Dimensions {
+		sizes = append(sizes, d.Name)
+	}
+
+	existing := 0
+	for _, size := range sizes {
+		_, statErr := s.storage.Stat(image_meta.GetResizedPath(imageMeta, destDir, size))
+		if statErr == nil {
+			existing++
+			continue
+		}
+		if !errors.Is(statErr, fs.ErrNotExist) {
+			return 0, statErr
+		}
+	}
+	return existing, nil
+}
+
+// enqueue waits for the next tick before each attempt, it returns false if stopChan is closed first
+func (s *Service) enqueue(task tasks.ResizeTask, ticker *time.Ticker, stopChan <-chan struct{}) bool {
+	for {
+		select {
+		case <-stopChan:
+			return false
+		case <-ticker.C:
+		}
+
+		if s.resizeQueue.Enqueue(task) {
+			logging.Debugf("re-submitted resize task, path: %s", task.ImageMeta.Path)
+			return true
+		}
+		logging.Debugf("resize queue is full, retrying path: %s", task.ImageMeta.Path)
+	}
+}
@@ -0,0 +1,140 @@
+package reconciler
+
+import (
+	"bytes"
+	"path/filepath"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/worker_metrics"
+	"receipt_uploader/internal/storage"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingQueue accepts a limited number of tasks and records them, the receipts in pending
+// already have a task
+type recordingQueue struct {
+	mu       sync.Mutex
+	capacity int
+	tasks    []tasks.ResizeTask
+	pending  []string
+}
+
+func (q *recordingQueue) Start(stopChan <-chan struct{}) {}
+func (q *recordingQueue) Process()                       {}
+func (q *recordingQueue) Wait()                          {}
+func (q *recordingQueue) Close()                         {}
+func (q *recordingQueue) Metrics() []worker_metrics.WorkerMetrics {
+	return nil
+}
+func (q *recordingQueue) Cancel(username, receiptId string) bool {
+	return false
+}
+
+func (q *recordingQueue) Pending(username, receiptId string) bool {
+	return slices.Contains(q.pending, receiptId)
+}
+
+func (q *recordingQueue) Enqueue(task tasks.ResizeTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.tasks) >= q.capacity {
+		return false
+	}
+	q.tasks = append(q.tasks, task)
+	return true
+}
+
+func putObject(t *testing.T, store storage.ServiceType, key string) {
+	putErr := store.Put(key, bytes.NewReader([]byte(key)))
+	assert.Nil(t, putErr)
+}
+
+func TestRun(t *testing.T) {
+	config := &configs.Config{
+		UploadsDir:    "uploads",
+		ResizedDir:    "resized",
+		Dimensions:    configs.AllowedDimensions,
+		ReconcileRate: 100,
+	}
+
+	newStore := func(t *testing.T) storage.ServiceType {
+		store := storage.NewMemory()
+
+		// complete, all variants exist
+		putObject(t, store, filepath.Join(config.UploadsDir, "user1#complete.jpg"))
+		putObject(t, store, filepath.Join(config.ResizedDir, "user1", "complete.jpg"))
+		for _, d := range config.Dimensions {
+			putObject(t, store, filepath.Join(config.ResizedDir, "user1", "complete_"+d.Name+".jpg"))
+		}
+
+		// partial, only the copy and the small variant exist
+		putObject(t, store, filepath.Join(config.UploadsDir, "user1#partial.jpg"))
+		putObject(t, store, filepath.Join(config.ResizedDir, "user1", "partial.jpg"))
+		putObject(t, store, filepath.Join(config.ResizedDir, "user1", "partial_small.jpg"))
+
+		// missing, no variant exists
+		putObject(t, store, filepath.Join(config.UploadsDir, "user2#missing.jpg"))
+
+		// invalid, file name without username
+		putObject(t, store, filepath.Join(config.UploadsDir, "invalid.jpg"))
+		return store
+	}
+
+	t.Run("succeed", func(t *testing.T) {
+		queue := &recordingQueue{capacity: 10}
+		service := NewService(config, newStore(t), queue)
+
+		report, runErr := service.Run(make(chan struct{}))
+		assert.Nil(t, runErr)
+		assert.Equal(t, Report{Scanned: 4, Invalid: 1, Complete: 1, Missing: 1, Partial: 1, Enqueued: 2}, *report)
+
+		assert.Len(t, queue.tasks, 2)
+		receiptIds := []string{queue.tasks[0].ImageMeta.ReceiptID, queue.tasks[1].ImageMeta.ReceiptID}
+		assert.ElementsMatch(t, []string{"partial", "missing"}, receiptIds)
+		assert.Equal(t, config.ResizedDir, queue.tasks[0].DestDir)
+	})
+
+	t.Run("succeed, upload whose task is pending is not re-submitted", func(t *testing.T) {
+		queue := &recordingQueue{capacity: 10, pending: []string{"missing"}}
+		service := NewService(config, newStore(t), queue)
+
+		report, runErr := service.Run(make(chan struct{}))
+		assert.Nil(t, runErr)
+		assert.Equal(t, Report{Scanned: 4, Invalid: 1, Complete: 1, Missing: 1, Partial: 1, Pending: 1, Enqueued: 1}, *report)
+
+		assert.Len(t, queue.tasks, 1)
+		assert.Equal(t, "partial", queue.tasks[0].ImageMeta.ReceiptID)
+	})
+
+	t.Run("succeed, empty uploads dir", func(t *testing.T) {
+		queue := &recordingQueue{capacity: 10}
+		service := NewService(config, storage.NewMemory(), queue)
+
+		report, runErr := service.Run(make(chan struct{}))
+		assert.Nil(t, runErr)
+		assert.Equal(t, Report{}, *report)
+	})
+
+	t.Run("succeed, stops while queue is full", func(t *testing.T) {
+		queue := &recordingQueue{capacity: 1}
+		service := NewService(config, newStore(t), queue)
+		stopChan := make(chan struct{})
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			close(stopChan)
+		}()
+
+		report, runErr := service.Run(stopChan)
+		assert.Nil(t, runErr)
+		assert.Equal(t, 1, report.Enqueued)
+		assert.Equal(t, 1, report.Failed)
+		assert.Len(t, queue.tasks, 1)
+	})
+}
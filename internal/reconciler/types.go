@@ -0,0 +1,17 @@
+package reconciler
+
+type ServiceType interface {
+	Run(stopChan <-chan struct{}) (*Report, error)
+}
+
+// Report summarizes what a reconciliation run found in config.UploadsDir
+type Report struct {
+	Scanned  int `json:"scanned"`  // number of uploads found
+	Invalid  int `json:"invalid"`  // uploads whose file name can not be parsed
+	Complete int `json:"complete"` // uploads which have all variants
+	Missing  int `json:"missing"`  // uploads which have no variant at all
+	Partial  int `json:"partial"`  // uploads which have some but not all variants
+	Pending  int `json:"pending"`  // uploads with missing variants whose task is still in resize_queue
+	Enqueued int `json:"enqueued"` // resize tasks re-submitted to resize_queue
+	Failed   int `json:"failed"`   // uploads which could not be checked or re-submitted
+}
@@ -0,0 +1,225 @@
+package records
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"sync"
+)
+
+// Service stores receipt records as json objects in storage, organized per user:
+//
+//	{recordsDir}/{username}/receipts/{receiptId}.json
+//	{recordsDir}/{username}/hashes/{contentHash}.json
+//
+// the hash entries map the content hash of an original to the receipt which stores it. A receipt
+// being uploaded claims its content hash first, so that only one of concurrent uploads of the same
+// content stores it.
+type Service struct {
+	recordsDir string
+	storage    storage.ServiceType
+	mu         sync.RWMutex
+	claims     map[string]string // receiptId claiming a content hash until it is stored, keyed by username#contentHash
+}
+
+type hashEntry struct {
+	ReceiptID string `json:"receiptId"`
+}
+
+func NewService(recordsDir string, s storage.ServiceType) ServiceType {
+	return &Service{
+		recordsDir: recordsDir,
+		storage:    s,
+		claims:     make(map[string]string),
+	}
+}
+
+func (s *Service) Put(record *receipt_record.ReceiptRecord) error {
+	logging.Debugf("records.Put(username: %s, receiptId: %s)", record.Username, record.ReceiptID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	putErr := s.putJSON(s.recordPath(record.Username, record.ReceiptID), record)
+	if putErr != nil {
+		return fmt.Errorf("s.putJSON(record) failed, err: %w", putErr)
+	}
+
+	if record.ContentHash == "" {
+		return nil
+	}
+	entry := hashEntry{ReceiptID: record.ReceiptID}
+	hashErr := s.putJSON(s.hashPath(record.Username, record.ContentHash), &entry)
+	if hashErr != nil {
+		return fmt.Errorf("s.putJSON(hashEntry) failed, err: %w", hashErr)
+	}
+
+	return nil
+}
+
+func (s *Service) Get(username, receiptId string) (*receipt_record.ReceiptRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var record receipt_record.ReceiptRecord
+	getErr := s.getJSON(s.recordPath(username, receiptId), &record)
+	if getErr != nil {
+		return nil, getErr
+	}
+	return &record, nil
+}
+
+// FindByHash returns the record of username's receipt which has the same content hash,
+// an error wrapping fs.ErrNotExist is returned if there is none
+func (s *Service) FindByHash(username, contentHash string) (*receipt_record.ReceiptRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entry hashEntry
+	getErr := s.getJSON(s.hashPath(username, contentHash), &entry)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	var record receipt_record.ReceiptRecord
+	recordErr := s.getJSON(s.recordPath(username, entry.ReceiptID), &record)
+	if recordErr != nil {
+		return nil, recordErr
+	}
+	return &record, nil
+}
+
+// ClaimHash claims contentHash for username's receipt receiptId before it is stored. If another
+// receipt stores or is storing the same content, its receiptId and false are returned. The claim
+// must be released with ReleaseHash once the record has been put or storing failed.
+func (s *Service) ClaimHash(username, contentHash, receiptId string) (string, bool, error) {
+	logging.Debugf("records.ClaimHash(username: %s, contentHash: %s, receiptId: %s)", username, contentHash, receiptId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := claimKey(username, contentHash)
+	if owner, ok := s.claims[key]; ok {
+		return owner, false, nil
+	}
+
+	var entry hashEntry
+	getErr := s.getJSON(s.hashPath(username, contentHash), &entry)
+	if getErr == nil {
+		_, statErr := s.storage.Stat(s.recordPath(username, entry.ReceiptID))
+		if statErr == nil {
+			return entry.ReceiptID, false, nil
+		}
+		if !errors.Is(statErr, fs.ErrNotExist) {
+			return "", false, fmt.Errorf("s.storage.Stat(record) failed, err: %w", statErr)
+		}
+	} else if !errors.Is(getErr, fs.ErrNotExist) {
+		return "", false, fmt.Errorf("s.getJSON(hashEntry) failed, err: %w", getErr)
+	}
+
+	s.claims[key] = receiptId
+	return receiptId, true, nil
+}
+
+// ReleaseHash releases the claim of receiptId on contentHash, the hash entry written by Put is kept
+func (s *Service) ReleaseHash(username, contentHash, receiptId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := claimKey(username, contentHash)
+	if s.claims[key] == receiptId {
+		delete(s.claims, key)
+	}
+}
+
+func (s *Service) List(username string) ([]receipt_record.ReceiptRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	objects, listErr := s.storage.List(filepath.Join(s.recordsDir, username, "receipts"))
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List() failed, err: %w", listErr)
+	}
+
+	records := []receipt_record.ReceiptRecord{}
+	for _, obj := range objects {
+		if !strings.HasSuffix(obj.Key, ".json") {
+			continue
+		}
+		var record receipt_record.ReceiptRecord
+		getErr := s.getJSON(obj.Key, &record)
+		if getErr != nil {
+			return nil, getErr
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *Service) Delete(username, receiptId string) error {
+	logging.Debugf("records.Delete(username: %s, receiptId: %s)", username, receiptId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var record receipt_record.ReceiptRecord
+	getErr := s.getJSON(s.recordPath(username, receiptId), &record)
+	if getErr != nil {
+		return getErr
+	}
+
+	if record.ContentHash != "" {
+		hashErr := s.storage.Delete(s.hashPath(username, record.ContentHash))
+		if hashErr != nil && !errors.Is(hashErr, fs.ErrNotExist) {
+			return fmt.Errorf("s.storage.Delete(hashEntry) failed, err: %w", hashErr)
+		}
+	}
+
+	return s.storage.Delete(s.recordPath(username, receiptId))
+}
+
+func claimKey(username, contentHash string) string {
+	return username + "#" + contentHash
+}
+
+func (s *Service) recordPath(username, receiptId string) string {
+	return filepath.Join(s.recordsDir, username, "receipts", receiptId+".json")
+}
+
+func (s *Service) hashPath(username, contentHash string) string {
+	return filepath.Join(s.recordsDir, username, "hashes", contentHash+".json")
+}
+
+func (s *Service) putJSON(key string, v interface{}) error {
+	data, marshalErr := json.Marshal(v)
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+	return s.storage.Put(key, bytes.NewReader(data))
+}
+
+func (s *Service) getJSON(key string, v interface{}) error {
+	reader, getErr := s.storage.Get(key)
+	if getErr != nil {
+		return getErr
+	}
+	defer reader.Close()
+
+	data, readErr := io.ReadAll(reader)
+	if readErr != nil {
+		return fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+	unmarshalErr := json.Unmarshal(data, v)
+	if unmarshalErr != nil {
+		return fmt.Errorf("json.Unmarshal(key: %s) failed, err: %w", key, unmarshalErr)
+	}
+	return nil
+}
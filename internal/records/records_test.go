@@ -0,0 +1,99 @@
+package records
+
+import (
+	"os"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecords(t *testing.T) {
+	service := NewService("records", storage.NewMemory())
+	record := receipt_record.ReceiptRecord{
+		ReceiptID:   "123456",
+		Username:    "user1",
+		ContentHash: receipt_record.HashContent([]byte("receipt")),
+		Path:        "uploads/user1#123456.jpg",
+		Size:        7,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	t.Run("succeed, put and get", func(t *testing.T) {
+		putErr := service.Put(&record)
+		assert.Nil(t, putErr)
+
+		got, getErr := service.Get(record.Username, record.ReceiptID)
+		assert.Nil(t, getErr)
+		assert.Equal(t, record.ContentHash, got.ContentHash)
+		assert.Equal(t, record.Path, got.Path)
+	})
+
+	t.Run("succeed, find by hash", func(t *testing.T) {
+		got, findErr := service.FindByHash(record.Username, record.ContentHash)
+		assert.Nil(t, findErr)
+		assert.Equal(t, record.ReceiptID, got.ReceiptID)
+	})
+
+	t.Run("should fail, find by hash of another user", func(t *testing.T) {
+		_, findErr := service.FindByHash("user2", record.ContentHash)
+		assert.ErrorIs(t, findErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, claim hash", func(t *testing.T) {
+		contentHash := receipt_record.HashContent([]byte("claimed"))
+
+		owner, claimed, claimErr := service.ClaimHash("user1", contentHash, "claimed1")
+		assert.Nil(t, claimErr)
+		assert.True(t, claimed)
+		assert.Equal(t, "claimed1", owner)
+
+		// a concurrent upload of the same content gets the receipt being stored
+		owner, claimed, claimErr = service.ClaimHash("user1", contentHash, "claimed2")
+		assert.Nil(t, claimErr)
+		assert.False(t, claimed)
+		assert.Equal(t, "claimed1", owner)
+
+		_, claimed, _ = service.ClaimHash("user2", contentHash, "claimed3")
+		assert.True(t, claimed)
+		service.ReleaseHash("user2", contentHash, "claimed3")
+
+		// storing failed, the content can be claimed again
+		service.ReleaseHash("user1", contentHash, "claimed1")
+		owner, claimed, claimErr = service.ClaimHash("user1", contentHash, "claimed2")
+		assert.Nil(t, claimErr)
+		assert.True(t, claimed)
+		assert.Equal(t, "claimed2", owner)
+		service.ReleaseHash("user1", contentHash, "claimed2")
+	})
+
+	t.Run("succeed, claim hash of a stored receipt", func(t *testing.T) {
+		owner, claimed, claimErr := service.ClaimHash(record.Username, record.ContentHash, "other")
+		assert.Nil(t, claimErr)
+		assert.False(t, claimed)
+		assert.Equal(t, record.ReceiptID, owner)
+	})
+
+	t.Run("succeed, list", func(t *testing.T) {
+		list, listErr := service.List(record.Username)
+		assert.Nil(t, listErr)
+		assert.Len(t, list, 1)
+
+		empty, emptyErr := service.List("user2")
+		assert.Nil(t, emptyErr)
+		assert.Empty(t, empty)
+	})
+
+	t.Run("succeed, delete", func(t *testing.T) {
+		deleteErr := service.Delete(record.Username, record.ReceiptID)
+		assert.Nil(t, deleteErr)
+
+		_, getErr := service.Get(record.Username, record.ReceiptID)
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+
+		_, findErr := service.FindByHash(record.Username, record.ContentHash)
+		assert.ErrorIs(t, findErr, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,13 @@
+package records
+
+import "receipt_uploader/internal/models/receipt_record"
+
+type ServiceType interface {
+	Put(record *receipt_record.ReceiptRecord) error
+	Get(username, receiptId string) (*receipt_record.ReceiptRecord, error)
+	FindByHash(username, contentHash string) (*receipt_record.ReceiptRecord, error)
+	ClaimHash(username, contentHash, receiptId string) (string, bool, error)
+	ReleaseHash(username, contentHash, receiptId string)
+	List(username string) ([]receipt_record.ReceiptRecord, error)
+	Delete(username, receiptId string) error
+}
@@ -0,0 +1,455 @@
+package replication
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/storage"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Service wraps the primary storage and mirrors every write and delete to a replica synchronously.
+// With quorum "both" a write fails if the replica could not be written, with quorum "primary"
+// failures of the replica are only logged and repaired by Resync.
+//
+// Reads fall back to the replica if the object is missing in the primary, or if it does not match
+// the checksum recorded when it was written, a corrupted primary is then repaired from the replica.
+// Without replica all calls go to the primary.
+type Service struct {
+	storage.ServiceType
+	replica storage.ServiceType
+	config  *configs.Config
+}
+
+func NewService(config *configs.Config, primary, replica storage.ServiceType) ServiceType {
+	return &Service{
+		ServiceType: primary,
+		replica:     replica,
+		config:      config,
+	}
+}
+
+func (s *Service) Put(key string, r io.Reader) error {
+	if s.replica == nil {
+		return s.ServiceType.Put(key, r)
+	}
+
+	data, readErr := io.ReadAll(r)
+	if readErr != nil {
+		return fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+
+	putErr := s.ServiceType.Put(key, bytes.NewReader(data))
+	if putErr != nil {
+		return putErr
+	}
+	return s.checkQuorum("put", key, s.replica.Put(key, bytes.NewReader(data)))
+}
+
+// Get reads the object from the primary, or from the replica if the primary is missing or corrupted
+func (s *Service) Get(key string) (io.ReadCloser, error) {
+	if s.replica == nil {
+		return s.ServiceType.Get(key)
+	}
+
+	expected := s.expectedChecksum(key)
+	if expected == "" {
+		reader, getErr := s.ServiceType.Get(key)
+		if getErr == nil {
+			return reader, nil
+		}
+		replicaReader, replicaErr := s.replica.Get(key)
+		if replicaErr != nil {
+			return nil, getErr
+		}
+		logging.Warnf("reading from replica, key: %s, err: %s", key, getErr.Error())
+		return replicaReader, nil
+	}
+
+	data, getErr := readObject(s.ServiceType, key)
+	if getErr == nil && receipt_record.HashContent(data) == expected {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	replicaData, replicaErr := readObject(s.replica, key)
+	if replicaErr != nil || receipt_record.HashContent(replicaData) != expected {
+		// neither matches, the corrupted primary is returned for the caller to detect it
+		if getErr != nil {
+			return nil, getErr
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	if getErr != nil {
+		logging.Warnf("reading from replica, key: %s, err: %s", key, getErr.Error())
+	} else {
+		logging.Warnf("checksum mismatch in primary, repairing from replica, key: %s", key)
+		repairErr := s.ServiceType.Put(key, bytes.NewReader(replicaData))
+		if repairErr != nil {
+			logging.Errorf("s.ServiceType.Put(key: %s) failed, err: %s", key, repairErr.Error())
+		}
+	}
+	return io.NopCloser(bytes.NewReader(replicaData)), nil
+}
+
+// Stat falls back to the replica if the object is missing in the primary
+func (s *Service) Stat(key string) (*storage.ObjectInfo, error) {
+	info, statErr := s.ServiceType.Stat(key)
+	if statErr == nil || s.replica == nil {
+		return info, statErr
+	}
+
+	replicaInfo, replicaErr := s.replica.Stat(key)
+	if replicaErr != nil {
+		return nil, statErr
+	}
+	return replicaInfo, nil
+}
+
+// Delete removes the object from primary and replica, an error wrapping fs.ErrNotExist is returned
+// if it is in neither of them
+func (s *Service) Delete(key string) error {
+	deleteErr := s.ServiceType.Delete(key)
+	if s.replica == nil {
+		return deleteErr
+	}
+	if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+		return deleteErr
+	}
+
+	replicaErr := s.replica.Delete(key)
+	if replicaErr == nil {
+		return nil
+	}
+	if errors.Is(replicaErr, fs.ErrNotExist) {
+		return deleteErr
+	}
+	s.putTombstone(key)
+
+	quorumErr := s.checkQuorum("delete", key, replicaErr)
+	if quorumErr != nil {
+		return quorumErr
+	}
+	return deleteErr
+}
+
+func (s *Service) EnsureDir(dir string) error {
+	ensureErr := s.ServiceType.EnsureDir(dir)
+	if ensureErr != nil || s.replica == nil {
+		return ensureErr
+	}
+	return s.checkQuorum("ensureDir", dir, s.replica.EnsureDir(dir))
+}
+
+// SweepTempFiles implements storage.Sweeper, temp files are removed from primary and replica
+func (s *Service) SweepTempFiles(dir string) (int, error) {
+	removed := 0
+	for _, target := range []storage.ServiceType{s.ServiceType, s.replica} {
+		sweeper, ok := target.(storage.Sweeper)
+		if !ok {
+			continue
+		}
+		count, sweepErr := sweeper.SweepTempFiles(dir)
+		removed += count
+		if sweepErr != nil {
+			return removed, sweepErr
+		}
+	}
+	return removed, nil
+}
+
+// SetModTime implements storage.ModTimeSetter if the primary does, the replica is updated if it can
+func (s *Service) SetModTime(key string, modTime time.Time) error {
+	setter, ok := s.ServiceType.(storage.ModTimeSetter)
+	if !ok {
+		return fmt.Errorf("storage does not support setting modification time, key=%s", key)
+	}
+	setErr := setter.SetModTime(key, modTime)
+	if setErr != nil {
+		return setErr
+	}
+
+	if replicaSetter, ok := s.replica.(storage.ModTimeSetter); ok {
+		replicaErr := replicaSetter.SetModTime(key, modTime)
+		if replicaErr != nil {
+			logging.Warnf("replica SetModTime(key: %s) failed, err: %s", key, replicaErr.Error())
+		}
+	}
+	return nil
+}
+
+// Resync compares all objects of primary and replica and repairs every divergence: a missing
+// object is copied from where it exists, an object which differs is copied from the side matching
+// its recorded checksum, or from the primary if there is none. An object only in the replica whose
+// delete failed there is deleted from the replica instead, unless it has been written again since.
+func (s *Service) Resync() (*ResyncReport, error) {
+	if s.replica == nil {
+		return nil, errors.New("replication is disabled, no replica is configured")
+	}
+	logging.Infof("replication.Resync()")
+
+	tombstones, tombstonesErr := s.tombstones()
+	if tombstonesErr != nil {
+		return nil, tombstonesErr
+	}
+
+	report := &ResyncReport{
+		Divergences: []Divergence{},
+	}
+	for _, dir := range s.dirs() {
+		resyncErr := s.resyncDir(dir, tombstones, report)
+		if resyncErr != nil {
+			return nil, resyncErr
+		}
+	}
+	// the tombstones left are either applied or obsolete
+	for key := range tombstones {
+		s.deleteTombstone(key)
+	}
+
+	logging.Infof(
+		"resync completed, scanned: %d, divergences: %d, repaired: %d, failed: %d",
+		report.Scanned, len(report.Divergences), report.Repaired, report.Failed,
+	)
+	return report, nil
+}
+
+// resyncDir repairs the divergences of the objects in dir, a tombstone whose delete failed again
+// is removed from tombstones so that it is kept for the next resync
+func (s *Service) resyncDir(dir string, tombstones map[string]time.Time, report *ResyncReport) error {
+	primaryObjects, listErr := s.listObjects(s.ServiceType, dir)
+	if listErr != nil {
+		return fmt.Errorf("s.listObjects(primary, dir: %s) failed, err: %w", dir, listErr)
+	}
+	replicaObjects, listErr := s.listObjects(s.replica, dir)
+	if listErr != nil {
+		return fmt.Errorf("s.listObjects(replica, dir: %s) failed, err: %w", dir, listErr)
+	}
+
+	keys := []string{}
+	for key := range primaryObjects {
+		keys = append(keys, key)
+	}
+	for key := range replicaObjects {
+		if _, ok := primaryObjects[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		report.Scanned++
+		primaryObj, inPrimary := primaryObjects[key]
+		replicaObj, inReplica := replicaObjects[key]
+		deletedAt, deleted := tombstones[key]
+
+		divergence := Divergence{Key: key}
+		var repairErr error
+		switch {
+		case !inReplica:
+			divergence.Divergence = DIVERGENCE_MISSING_REPLICA
+			divergence.Action = ACTION_COPIED_TO_REPLICA
+			repairErr = copyObject(s.ServiceType, s.replica, key, primaryObj.ModTime)
+		case !inPrimary && deleted && !replicaObj.ModTime.After(deletedAt):
+			divergence.Divergence = DIVERGENCE_MISSING_PRIMARY
+			divergence.Action = ACTION_DELETED_FROM_REPLICA
+			repairErr = s.replica.Delete(key)
+			if repairErr != nil && errors.Is(repairErr, fs.ErrNotExist) {
+				repairErr = nil
+			}
+			if repairErr != nil {
+				delete(tombstones, key)
+			}
+		case !inPrimary:
+			divergence.Divergence = DIVERGENCE_MISSING_PRIMARY
+			divergence.Action = ACTION_COPIED_TO_PRIMARY
+			repairErr = copyObject(s.replica, s.ServiceType, key, replicaObj.ModTime)
+		default:
+			action, compareErr := s.compare(key)
+			if compareErr != nil {
+				logging.Errorf("s.compare(key: %s) failed, err: %s", key, compareErr.Error())
+				report.Failed++
+				continue
+			}
+			if action == "" {
+				continue
+			}
+			divergence.Divergence = DIVERGENCE_MISMATCH
+			divergence.Action = action
+			if action == ACTION_COPIED_TO_REPLICA {
+				repairErr = copyObject(s.ServiceType, s.replica, key, primaryObj.ModTime)
+			} else {
+				repairErr = copyObject(s.replica, s.ServiceType, key, replicaObj.ModTime)
+			}
+		}
+
+		if repairErr != nil {
+			logging.Errorf("repairing divergence of key: %s failed, err: %s", key, repairErr.Error())
+			divergence.Action = ""
+			report.Failed++
+		} else {
+			report.Repaired++
+		}
+		report.Divergences = append(report.Divergences, divergence)
+	}
+	return nil
+}
+
+// putTombstone records in the primary that deleting key failed on the replica, a failure is
+// logged and the object is copied back to the primary by the next resync
+func (s *Service) putTombstone(key string) {
+	if s.config.Replication.TombstonesDir == "" {
+		return
+	}
+	putErr := s.ServiceType.Put(s.tombstonePath(key), bytes.NewReader(nil))
+	if putErr != nil {
+		logging.Errorf("s.ServiceType.Put(tombstone of key: %s) failed, err: %s", key, putErr.Error())
+	}
+}
+
+// deleteTombstone removes the tombstone of key once it has been applied by a resync
+func (s *Service) deleteTombstone(key string) {
+	deleteErr := s.ServiceType.Delete(s.tombstonePath(key))
+	if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+		logging.Errorf("s.ServiceType.Delete(tombstone of key: %s) failed, err: %s", key, deleteErr.Error())
+	}
+}
+
+// tombstones returns when deleting each object failed on the replica, keyed by the object
+func (s *Service) tombstones() (map[string]time.Time, error) {
+	tombstones := map[string]time.Time{}
+	dir := s.config.Replication.TombstonesDir
+	if dir == "" {
+		return tombstones, nil
+	}
+
+	objects, listErr := s.ServiceType.List(dir)
+	if listErr != nil && !errors.Is(listErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("s.ServiceType.List(dir: %s) failed, err: %w", dir, listErr)
+	}
+	for _, obj := range objects {
+		key := strings.TrimPrefix(obj.Key, filepath.Clean(dir)+string(filepath.Separator))
+		tombstones[key] = obj.ModTime
+	}
+	return tombstones, nil
+}
+
+func (s *Service) tombstonePath(key string) string {
+	return filepath.Join(s.config.Replication.TombstonesDir, key)
+}
+
+// compare returns how an object existing in primary and replica is repaired, empty if both match
+func (s *Service) compare(key string) (string, error) {
+	data, getErr := readObject(s.ServiceType, key)
+	if getErr != nil {
+		return "", getErr
+	}
+	replicaData, replicaErr := readObject(s.replica, key)
+	if replicaErr != nil {
+		return "", replicaErr
+	}
+
+	sum := receipt_record.HashContent(data)
+	if sum == receipt_record.HashContent(replicaData) {
+		return "", nil
+	}
+	expected := s.expectedChecksum(key)
+	if expected != "" && sum != expected && receipt_record.HashContent(replicaData) == expected {
+		return ACTION_COPIED_TO_PRIMARY, nil
+	}
+	return ACTION_COPIED_TO_REPLICA, nil
+}
+
+// dirs returns the dirs which are resynced
+func (s *Service) dirs() []string {
+	dirs := []string{}
+	for _, dir := range []string{s.config.UploadsDir, s.config.ResizedDir, s.config.RecordsDir, s.config.TrashDir, s.config.ChecksumsDir} {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func (s *Service) listObjects(target storage.ServiceType, dir string) (map[string]storage.ObjectInfo, error) {
+	objects, listErr := target.List(dir)
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	byKey := map[string]storage.ObjectInfo{}
+	for _, obj := range objects {
+		byKey[obj.Key] = obj
+	}
+	return byKey, nil
+}
+
+// expectedChecksum returns the checksum recorded when key was written, empty if there is none
+func (s *Service) expectedChecksum(key string) string {
+	if !checksums.IsTracked(s.config, key) {
+		return ""
+	}
+
+	sidecarPath := checksums.SidecarPath(s.config, key)
+	for _, target := range []storage.ServiceType{s.ServiceType, s.replica} {
+		data, readErr := readObject(target, sidecarPath)
+		if readErr == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+	return ""
+}
+
+// checkQuorum decides if a failed write of the replica fails the whole write
+func (s *Service) checkQuorum(op, key string, replicaErr error) error {
+	if replicaErr == nil {
+		return nil
+	}
+	if s.config.Replication.Quorum == constants.REPLICATION_QUORUM_BOTH {
+		return fmt.Errorf("replica %s(key: %s) failed, err: %w", op, key, replicaErr)
+	}
+	logging.Errorf("replica %s(key: %s) failed, err: %s", op, key, replicaErr.Error())
+	return nil
+}
+
+// copyObject copies key from src to dst keeping its modification time
+func copyObject(src, dst storage.ServiceType, key string, modTime time.Time) error {
+	reader, getErr := src.Get(key)
+	if getErr != nil {
+		return getErr
+	}
+	defer reader.Close()
+
+	putErr := dst.Put(key, reader)
+	if putErr != nil {
+		return fmt.Errorf("dst.Put(key: %s) failed, err: %w", key, putErr)
+	}
+
+	if setter, ok := dst.(storage.ModTimeSetter); ok {
+		setErr := setter.SetModTime(key, modTime)
+		if setErr != nil {
+			logging.Warnf("setter.SetModTime(key: %s) failed, err: %s", key, setErr.Error())
+		}
+	}
+	return nil
+}
+
+func readObject(target storage.ServiceType, key string) ([]byte, error) {
+	reader, getErr := target.Get(key)
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
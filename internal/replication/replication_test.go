@@ -0,0 +1,199 @@
+package replication
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/storage/storage_mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingDeletes is a replica whose deletes fail while failing is set
+type failingDeletes struct {
+	storage.ServiceType
+	failing bool
+}
+
+func (f *failingDeletes) Delete(key string) error {
+	if f.failing {
+		return errors.New("mock Delete() failed")
+	}
+	return f.ServiceType.Delete(key)
+}
+
+func TestReplication(t *testing.T) {
+	newConfig := func(quorum string) *configs.Config {
+		return &configs.Config{
+			UploadsDir:   "uploads",
+			ResizedDir:   "resized",
+			RecordsDir:   "records",
+			ChecksumsDir: "checksums",
+			Replication:  configs.ReplicationConfig{Quorum: quorum, TombstonesDir: "tombstones"},
+		}
+	}
+
+	read := func(t *testing.T, s storage.ServiceType, key string) string {
+		reader, getErr := s.Get(key)
+		assert.Nil(t, getErr)
+		if getErr != nil {
+			return ""
+		}
+		defer reader.Close()
+		data, readErr := io.ReadAll(reader)
+		assert.Nil(t, readErr)
+		return string(data)
+	}
+
+	t.Run("succeed, mirror writes and deletes", func(t *testing.T) {
+		primary, replica := storage.NewMemory(), storage.NewMemory()
+		service := NewService(newConfig(constants.REPLICATION_QUORUM_BOTH), primary, replica)
+		key := "uploads/user1#123456.jpg"
+
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("data"))))
+		assert.Equal(t, "data", read(t, primary, key))
+		assert.Equal(t, "data", read(t, replica, key))
+
+		assert.Nil(t, service.Delete(key))
+		_, primaryErr := primary.Stat(key)
+		assert.ErrorIs(t, primaryErr, os.ErrNotExist)
+		_, replicaErr := replica.Stat(key)
+		assert.ErrorIs(t, replicaErr, os.ErrNotExist)
+
+		assert.ErrorIs(t, service.Delete(key), os.ErrNotExist)
+	})
+
+	t.Run("succeed, read missing primary from replica", func(t *testing.T) {
+		primary, replica := storage.NewMemory(), storage.NewMemory()
+		service := NewService(newConfig(constants.REPLICATION_QUORUM_BOTH), primary, replica)
+		key := "records/user1/receipts/123456.json"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("{}"))))
+		assert.Nil(t, primary.Delete(key))
+
+		assert.Equal(t, "{}", read(t, service, key))
+		_, statErr := service.Stat(key)
+		assert.Nil(t, statErr)
+	})
+
+	t.Run("succeed, read and repair corrupted primary from replica", func(t *testing.T) {
+		config := newConfig(constants.REPLICATION_QUORUM_BOTH)
+		primary, replica := storage.NewMemory(), storage.NewMemory()
+		service := checksums.NewService(config, NewService(config, primary, replica))
+		key := "resized/user1/123456_small.jpg"
+		assert.Nil(t, service.Put(key, bytes.NewReader([]byte("data"))))
+		assert.Nil(t, primary.Put(key, bytes.NewReader([]byte("corrupted"))))
+
+		assert.Equal(t, "data", read(t, service, key))
+		assert.Equal(t, "data", read(t, primary, key))
+	})
+
+	t.Run("succeed, quorum primary ignores replica failures", func(t *testing.T) {
+		replica := storage_mock.NewServiceMock()
+		service := NewService(newConfig(constants.REPLICATION_QUORUM_PRIMARY), storage.NewMemory(), replica)
+
+		putErr := service.Put("uploads/mock_put_failed#123456.jpg", bytes.NewReader([]byte("data")))
+		assert.Nil(t, putErr)
+	})
+
+	t.Run("should fail, quorum both with replica failure", func(t *testing.T) {
+		primary := storage.NewMemory()
+		service := NewService(newConfig(constants.REPLICATION_QUORUM_BOTH), primary, storage_mock.NewServiceMock())
+		key := "uploads/mock_put_failed#123456.jpg"
+
+		putErr := service.Put(key, bytes.NewReader([]byte("data")))
+		assert.NotNil(t, putErr)
+	})
+
+	t.Run("succeed, resync repairs divergences", func(t *testing.T) {
+		config := newConfig(constants.REPLICATION_QUORUM_PRIMARY)
+		primary, replica := storage.NewMemory(), storage.NewMemory()
+		replicated := NewService(config, primary, replica)
+		service := checksums.NewService(config, replicated)
+
+		onlyPrimary := "uploads/user1#primary.jpg"
+		onlyReplica := "uploads/user1#replica.jpg"
+		corrupted := "resized/user1/corrupted.jpg"
+		stale := "records/user1/receipts/stale.json"
+		assert.Nil(t, primary.Put(onlyPrimary, bytes.NewReader([]byte("primary"))))
+		assert.Nil(t, replica.Put(onlyReplica, bytes.NewReader([]byte("replica"))))
+		assert.Nil(t, service.Put(corrupted, bytes.NewReader([]byte("data"))))
+		assert.Nil(t, primary.Put(corrupted, bytes.NewReader([]byte("corrupted"))))
+		assert.Nil(t, service.Put(stale, bytes.NewReader([]byte("new"))))
+		assert.Nil(t, replica.Put(stale, bytes.NewReader([]byte("old"))))
+
+		report, resyncErr := replicated.Resync()
+		assert.Nil(t, resyncErr)
+		assert.Len(t, report.Divergences, 4)
+		assert.Equal(t, 4, report.Repaired)
+
+		actions := map[string]string{}
+		for _, divergence := range report.Divergences {
+			actions[divergence.Key] = divergence.Action
+		}
+		assert.Equal(t, ACTION_COPIED_TO_REPLICA, actions[onlyPrimary])
+		assert.Equal(t, ACTION_COPIED_TO_PRIMARY, actions[onlyReplica])
+		assert.Equal(t, ACTION_COPIED_TO_PRIMARY, actions[corrupted])
+		assert.Equal(t, ACTION_COPIED_TO_REPLICA, actions[stale])
+
+		assert.Equal(t, "primary", read(t, replica, onlyPrimary))
+		assert.Equal(t, "replica", read(t, primary, onlyReplica))
+		assert.Equal(t, "data", read(t, primary, corrupted))
+		assert.Equal(t, "new", read(t, replica, stale))
+
+		report, resyncErr = replicated.Resync()
+		assert.Nil(t, resyncErr)
+		assert.Empty(t, report.Divergences)
+	})
+
+	t.Run("succeed, resync deletes objects whose replica delete failed", func(t *testing.T) {
+		primary := storage.NewMemory()
+		replica := &failingDeletes{ServiceType: storage.NewMemory()}
+		service := NewService(newConfig(constants.REPLICATION_QUORUM_PRIMARY), primary, replica)
+		deletedKey := "uploads/user1#deleted.jpg"
+		uploadedAgain := "uploads/user1#again.jpg"
+		assert.Nil(t, service.Put(deletedKey, bytes.NewReader([]byte("deleted"))))
+		assert.Nil(t, service.Put(uploadedAgain, bytes.NewReader([]byte("again"))))
+
+		replica.failing = true
+		assert.Nil(t, service.Delete(deletedKey))
+		assert.Nil(t, service.Delete(uploadedAgain))
+		replica.failing = false
+		assert.Nil(t, replica.ServiceType.(storage.ModTimeSetter).SetModTime(uploadedAgain, time.Now().Add(time.Hour)))
+
+		report, resyncErr := service.Resync()
+		assert.Nil(t, resyncErr)
+		assert.Equal(t, 2, report.Repaired)
+
+		actions := map[string]string{}
+		for _, divergence := range report.Divergences {
+			actions[divergence.Key] = divergence.Action
+		}
+		assert.Equal(t, ACTION_DELETED_FROM_REPLICA, actions[deletedKey])
+		assert.Equal(t, ACTION_COPIED_TO_PRIMARY, actions[uploadedAgain])
+
+		_, replicaErr := replica.Stat(deletedKey)
+		assert.ErrorIs(t, replicaErr, os.ErrNotExist)
+		_, primaryErr := primary.Stat(deletedKey)
+		assert.ErrorIs(t, primaryErr, os.ErrNotExist)
+		tombstones, listErr := primary.List("tombstones")
+		assert.Nil(t, listErr)
+		assert.Empty(t, tombstones)
+
+		report, resyncErr = service.Resync()
+		assert.Nil(t, resyncErr)
+		assert.Empty(t, report.Divergences)
+	})
+
+	t.Run("should fail, resync without replica", func(t *testing.T) {
+		service := NewService(newConfig(""), storage.NewMemory(), nil)
+		_, resyncErr := service.Resync()
+		assert.NotNil(t, resyncErr)
+	})
+}
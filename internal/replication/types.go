@@ -0,0 +1,34 @@
+package replication
+
+import "receipt_uploader/internal/storage"
+
+const (
+	DIVERGENCE_MISSING_REPLICA = "missing_replica" // object only exists in the primary
+	DIVERGENCE_MISSING_PRIMARY = "missing_primary" // object only exists in the replica
+	DIVERGENCE_MISMATCH        = "mismatch"        // object differs between primary and replica
+
+	ACTION_COPIED_TO_REPLICA    = "copied_to_replica"
+	ACTION_COPIED_TO_PRIMARY    = "copied_to_primary"
+	ACTION_DELETED_FROM_REPLICA = "deleted_from_replica" // delete of an object failed on the replica before
+)
+
+// ServiceType is a storage which mirrors every write to a replica
+type ServiceType interface {
+	storage.ServiceType
+	Resync() (*ResyncReport, error)
+}
+
+// Divergence is an object which differed between primary and replica
+type Divergence struct {
+	Key        string `json:"key"`
+	Divergence string `json:"divergence"`       // missing_replica, missing_primary, mismatch
+	Action     string `json:"action,omitempty"` // copied_to_replica, copied_to_primary, deleted_from_replica, empty if repairing failed
+}
+
+// ResyncReport summarizes what a resync compared and repaired
+type ResyncReport struct {
+	Scanned     int          `json:"scanned"`     // number of distinct objects in primary and replica
+	Divergences []Divergence `json:"divergences"` // objects which differed
+	Repaired    int          `json:"repaired"`    // divergences which have been repaired
+	Failed      int          `json:"failed"`      // divergences which could not be repaired
+}
@@ -0,0 +1,529 @@
+package resize_queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/worker_metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	opEnqueue        = "enqueue"
+	opAck            = "ack"
+	segmentExtension = ".log"
+	maxRecordSize    = 64 * 1024 // max size of a line of a segment
+)
+
+// DurableQueue persists every task in an append-only log of segments in dir, one JSON record per
+// line:
+//
+//	{"op":"enqueue","id":1,"task":{"ImageMeta":{...},"DestDir":"..."}}
+//	{"op":"ack","id":1}
+//
+// Tasks are read back from the segments in the order they were enqueued and acked once they have
+// been processed, so the number of queued tasks is only bounded by disk. A new segment is started
+// once the written one is larger than segmentSize, segments whose tasks have all been acked are
+// deleted. When the queue is opened, tasks which have not been acked are compacted into a new
+// segment and replayed once it is started, invalid records, e.g. a torn last record left by a crash,
+// are dropped. Tasks are processed by a pool of workers, tasks left once the queue is closed stay
+// in the log. Only one process can use dir.
+type DurableQueue struct {
+	dir           string
+	segmentSize   int64
+	imagesService images.ServiceType
+	workers       *workerPool
+	mu            sync.Mutex
+	segments      []*segment         // oldest first, records are appended to the last one
+	unacked       map[int64]*segment // segment of every task which has not been acked, keyed by id
+	lastID        int64
+	reader        *segmentReader // next task to process
+	pending       *pendingTasks
+	notify        chan struct{} // signals an enqueued task to the workers
+	done          chan struct{} // closed by Close
+	closed        bool
+}
+
+// record is a line of a segment
+type record struct {
+	Op   string            `json:"op"`
+	ID   int64             `json:"id"`
+	Task *tasks.ResizeTask `json:"task,omitempty"` // set by enqueue
+}
+
+// segment is a file of the log, it is named after its seq
+type segment struct {
+	seq     int64
+	path    string
+	size    int64
+	unacked int // number of tasks enqueued in the segment which have not been acked
+}
+
+// segmentReader reads the segments from the position of the next task to process
+type segmentReader struct {
+	seq    int64 // seq of the segment being read
+	file   *os.File
+	buffer *bufio.Reader
+}
+
+// NewDurableService opens the queue in dir, it is created if it does not exist. It is processed by
+// the given number of workers, DefaultWorkers() if it is not positive.
+func NewDurableService(dir string, segmentSize int64, workers int, service images.ServiceType) (*DurableQueue, error) {
+	mkErr := os.MkdirAll(dir, 0755)
+	if mkErr != nil {
+		return nil, fmt.Errorf("os.MkdirAll() failed, err: %w", mkErr)
+	}
+
+	q := &DurableQueue{
+		dir:           dir,
+		segmentSize:   segmentSize,
+		imagesService: service,
+		workers:       newWorkerPool(workers),
+		unacked:       make(map[int64]*segment),
+		notify:        make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	q.pending = newPendingTasks(&q.mu)
+
+	loadErr := q.load()
+	if loadErr != nil {
+		return nil, fmt.Errorf("q.load(dir: %s) failed, err: %w", dir, loadErr)
+	}
+	return q, nil
+}
+
+func (q *DurableQueue) Start(stopChan <-chan struct{}) {
+	fmt.Println("starting durable task queue...")
+	logging.Infof("queue dir: %s, unacked tasks: %d", q.dir, q.size())
+
+	q.workers.start(q.work)
+
+	<-stopChan
+	fmt.Println("Stopping task queue...")
+
+	q.Close()
+	q.Wait()
+	q.workers.logMetrics()
+	fmt.Println("Task queue stopped")
+}
+
+// Enqueue appends task to the log, it returns false if the queue is closed or writing failed
+func (q *DurableQueue) Enqueue(task tasks.ResizeTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	id := q.lastID + 1
+	s, appendErr := q.append(&record{Op: opEnqueue, ID: id, Task: &task})
+	if appendErr != nil {
+		logging.Errorf("q.append(path: %s) failed, err: %s", task.ImageMeta.Path, appendErr.Error())
+		return false
+	}
+	q.lastID = id
+	q.unacked[id] = s
+	s.unacked++
+	q.pending.add(task)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Cancel marks the queued tasks of a receipt to be skipped and waits for its tasks being processed,
+// it returns false if none is queued nor being processed
+func (q *DurableQueue) Cancel(username, receiptId string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.cancel(username, receiptId)
+}
+
+// Pending returns true if a task of the receipt is queued and not cancelled, or being processed.
+// Tasks replayed from the log are pending once the queue is opened.
+func (q *DurableQueue) Pending(username, receiptId string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.has(username, receiptId)
+}
+
+// Process runs the workers until the queue is closed, tasks are taken in the order they were
+// enqueued. Tasks which have not been taken by then stay in the log.
+func (q *DurableQueue) Process() {
+	fmt.Println("task queue starts running...")
+
+	q.workers.start(q.work)
+	q.workers.wait()
+}
+
+// Metrics returns what every worker processed so far
+func (q *DurableQueue) Metrics() []worker_metrics.WorkerMetrics {
+	return q.workers.snapshot()
+}
+
+// work processes tasks on worker until the queue is closed, the task being processed is finished
+// and acked first
+func (q *DurableQueue) work(worker int) {
+	for {
+		rec, ok := q.next()
+		if !ok {
+			return
+		}
+
+		if q.dequeue(*rec.Task) {
+			logging.Infof("skipping cancelled task, path: '%s'", rec.Task.ImageMeta.Path)
+		} else {
+			q.workers.resize(worker, q.imagesService, *rec.Task, q.finish)
+		}
+		q.ack(rec.ID)
+	}
+}
+
+// Wait waits for the tasks being processed by the workers and closes the log, it must be called
+// after Close
+func (q *DurableQueue) Wait() {
+	q.workers.wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.reader != nil && q.reader.file != nil {
+		q.reader.file.Close()
+		q.reader.file = nil
+	}
+}
+
+// Close stops enqueuing and processing tasks
+func (q *DurableQueue) Close() {
+	fmt.Println("closing task queue...")
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+}
+
+// size returns the number of tasks which have not been acked
+func (q *DurableQueue) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.unacked)
+}
+
+// next waits for the next task to process, it returns false once the queue is closed
+func (q *DurableQueue) next() (*record, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+		rec, readErr := q.read()
+		q.mu.Unlock()
+
+		if readErr != nil {
+			logging.Errorf("q.read() failed, err: %s", readErr.Error())
+			return nil, false
+		}
+		if rec != nil {
+			// a signal may stand for several tasks, another waiting worker checks for the next one
+			select {
+			case q.notify <- struct{}{}:
+			default:
+			}
+			return rec, true
+		}
+
+		select {
+		case <-q.notify:
+		case <-q.done:
+			return nil, false
+		}
+	}
+}
+
+// read returns the next enqueue record after the reader, nil if all have been read. q.mu must be held.
+func (q *DurableQueue) read() (*record, error) {
+	for {
+		if q.reader.file == nil {
+			file, openErr := os.Open(segmentPath(q.dir, q.reader.seq))
+			if openErr != nil {
+				return nil, fmt.Errorf("os.Open() failed, err: %w", openErr)
+			}
+			q.reader.file = file
+			q.reader.buffer = bufio.NewReaderSize(file, maxRecordSize)
+		}
+
+		line, readErr := q.reader.buffer.ReadBytes('\n')
+		if readErr == io.EOF {
+			// records are written as whole lines under q.mu, a partial line is never read
+			last := q.segments[len(q.segments)-1]
+			if q.reader.seq == last.seq {
+				return nil, nil
+			}
+			q.reader.file.Close()
+			q.reader.file = nil
+			q.reader.seq = q.segmentAfter(q.reader.seq).seq
+			q.deleteSegments()
+			continue
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("q.reader.buffer.ReadBytes() failed, err: %w", readErr)
+		}
+
+		var rec record
+		unmarshalErr := json.Unmarshal(line, &rec)
+		if unmarshalErr != nil {
+			logging.Errorf("skipping invalid record of segment %d, err: %s", q.reader.seq, unmarshalErr.Error())
+			continue
+		}
+		if rec.Op == opEnqueue && rec.Task != nil {
+			return &rec, nil
+		}
+	}
+}
+
+// dequeue removes task from the pending tasks, it returns true if task has been cancelled
+func (q *DurableQueue) dequeue(task tasks.ResizeTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.remove(task)
+}
+
+// finish records that generating the images of task returned, it may be later than the worker
+// gave up on it
+func (q *DurableQueue) finish(task tasks.ResizeTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending.finish(task)
+}
+
+// ack records that the task id has been processed. A lost ack only processes the task again.
+func (q *DurableQueue) ack(id int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s, ok := q.unacked[id]
+	if !ok {
+		return
+	}
+	delete(q.unacked, id)
+	s.unacked--
+
+	_, appendErr := q.append(&record{Op: opAck, ID: id})
+	if appendErr != nil {
+		logging.Errorf("q.append(ack: %d) failed, err: %s", id, appendErr.Error())
+	}
+	q.deleteSegments()
+}
+
+// append writes rec to the last segment, a new one is started if it is full. Enqueue records are
+// fsynced. q.mu must be held.
+func (q *DurableQueue) append(rec *record) (*segment, error) {
+	data, marshalErr := json.Marshal(rec)
+	if marshalErr != nil {
+		return nil, fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+
+	s := q.segments[len(q.segments)-1]
+	isNew := s.size >= q.segmentSize
+	if isNew {
+		s = &segment{seq: s.seq + 1, path: segmentPath(q.dir, s.seq+1)}
+	}
+
+	file, openErr := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if openErr != nil {
+		return nil, fmt.Errorf("os.OpenFile() failed, err: %w", openErr)
+	}
+	defer file.Close()
+
+	written, writeErr := file.Write(append(data, '\n'))
+	s.size += int64(written)
+	if writeErr == nil && rec.Op == opEnqueue {
+		writeErr = file.Sync()
+	}
+	if writeErr != nil {
+		return nil, fmt.Errorf("file.Write() failed, err: %w", writeErr)
+	}
+	if isNew {
+		q.segments = append(q.segments, s)
+	}
+	return s, nil
+}
+
+// deleteSegments deletes the oldest segments once they have been read and all their tasks have
+// been acked. Acks are only written after their task, so the acks in a deleted segment are only of
+// tasks in segments deleted before. q.mu must be held.
+func (q *DurableQueue) deleteSegments() {
+	for len(q.segments) > 1 && q.segments[0].seq < q.reader.seq && q.segments[0].unacked == 0 {
+		removeErr := os.Remove(q.segments[0].path)
+		if removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+			logging.Errorf("os.Remove(path: %s) failed, err: %s", q.segments[0].path, removeErr.Error())
+			return
+		}
+		q.segments = q.segments[1:]
+	}
+}
+
+// segmentAfter returns the segment following seq
+func (q *DurableQueue) segmentAfter(seq int64) *segment {
+	for _, s := range q.segments {
+		if s.seq > seq {
+			return s
+		}
+	}
+	return q.segments[len(q.segments)-1]
+}
+
+// load reads all segments in dir and compacts the tasks which have not been acked into a new
+// segment, the old segments are deleted once it has been written
+func (q *DurableQueue) load() error {
+	paths, globErr := filepath.Glob(filepath.Join(q.dir, "*"+segmentExtension))
+	if globErr != nil {
+		return fmt.Errorf("filepath.Glob() failed, err: %w", globErr)
+	}
+
+	old := []*segment{}
+	for _, path := range paths {
+		seq, parseErr := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), segmentExtension), 10, 64)
+		if parseErr != nil {
+			logging.Warnf("ignoring unknown file in queue dir, path: %s", path)
+			continue
+		}
+		old = append(old, &segment{seq: seq, path: path})
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i].seq < old[j].seq })
+
+	unacked := map[int64]tasks.ResizeTask{}
+	order := []int64{}
+	for _, s := range old {
+		readErr := readSegment(s.path, func(rec *record) {
+			q.lastID = max(q.lastID, rec.ID)
+			switch rec.Op {
+			case opEnqueue:
+				if _, ok := unacked[rec.ID]; ok || rec.Task == nil {
+					return // written again by an interrupted compaction
+				}
+				unacked[rec.ID] = *rec.Task
+				order = append(order, rec.ID)
+			case opAck:
+				delete(unacked, rec.ID)
+			}
+		})
+		if readErr != nil {
+			return fmt.Errorf("readSegment(path: %s) failed, err: %w", s.path, readErr)
+		}
+	}
+
+	seq := int64(1)
+	if len(old) > 0 {
+		seq = old[len(old)-1].seq + 1
+	}
+	compacted := &segment{seq: seq, path: segmentPath(q.dir, seq)}
+	q.segments = []*segment{compacted}
+	q.reader = &segmentReader{seq: seq}
+
+	// the compacted segment is written as a temp file first, so a crash never leaves a torn
+	// compacted segment behind
+	temp, createErr := os.Create(compacted.path + ".tmp")
+	if createErr != nil {
+		return fmt.Errorf("os.Create() failed, err: %w", createErr)
+	}
+	writer := bufio.NewWriter(temp)
+	for _, id := range order {
+		task, ok := unacked[id]
+		if !ok {
+			continue
+		}
+		data, marshalErr := json.Marshal(&record{Op: opEnqueue, ID: id, Task: &task})
+		if marshalErr != nil {
+			temp.Close()
+			return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+		}
+		writer.Write(append(data, '\n'))
+		compacted.size += int64(len(data) + 1)
+		compacted.unacked++
+		q.unacked[id] = compacted
+		q.pending.add(task)
+	}
+	writeErr := writer.Flush()
+	if writeErr == nil {
+		writeErr = temp.Sync()
+	}
+	closeErr := temp.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		return fmt.Errorf("writing compacted segment failed, err: %w", writeErr)
+	}
+	renameErr := os.Rename(temp.Name(), compacted.path)
+	if renameErr != nil {
+		return fmt.Errorf("os.Rename() failed, err: %w", renameErr)
+	}
+
+	for _, s := range old {
+		removeErr := os.Remove(s.path)
+		if removeErr != nil {
+			return fmt.Errorf("os.Remove(path: %s) failed, err: %w", s.path, removeErr)
+		}
+	}
+
+	if len(q.unacked) > 0 {
+		logging.Infof("replaying %d unacked tasks of resize queue", len(q.unacked))
+	}
+	return nil
+}
+
+// readSegment calls apply for every record of the segment at path. Invalid records, e.g. the torn
+// last record of a crash, are skipped: a lost task is submitted again by the reconciler on start.
+func readSegment(path string, apply func(rec *record)) error {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return fmt.Errorf("os.Open() failed, err: %w", openErr)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		unmarshalErr := json.Unmarshal(scanner.Bytes(), &rec)
+		if unmarshalErr != nil {
+			logging.Warnf("dropping invalid record of resize queue, path: %s, line: %d, err: %s", path, line, unmarshalErr.Error())
+			continue
+		}
+		apply(&rec)
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return fmt.Errorf("scanner.Scan() failed, err: %w", scanErr)
+	}
+	return nil
+}
+
+func segmentPath(dir string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, segmentExtension))
+}
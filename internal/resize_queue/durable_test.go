@@ -0,0 +1,185 @@
+package resize_queue_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	images_mock "receipt_uploader/internal/images/mock"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/resize_queue"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingImages records the paths of the images it generated, generating takes delay
+type countingImages struct {
+	images_mock.ServiceMock
+	delay     time.Duration
+	mu        sync.Mutex
+	generated []string
+}
+
+func (c *countingImages) GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir string) error {
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generated = append(c.generated, imageMeta.Path)
+	return nil
+}
+
+func (c *countingImages) paths() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string{}, c.generated...)
+}
+
+func newTask(path string) tasks.ResizeTask {
+	return tasks.ResizeTask{
+		ImageMeta: image_meta.ImageMeta{Path: path, Username: "user1", ReceiptID: filepath.Base(path)},
+		DestDir:   "test/dest",
+	}
+}
+
+// process starts q and stops it once it generated n images
+func process(t *testing.T, q *resize_queue.DurableQueue, images *countingImages, n int) {
+	stopChan := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		q.Start(stopChan)
+		close(stopped)
+	}()
+
+	assert.Eventually(t, func() bool { return len(images.paths()) >= n }, 5*time.Second, 10*time.Millisecond)
+	close(stopChan)
+	<-stopped
+}
+
+func segments(t *testing.T, dir string) []string {
+	paths, globErr := filepath.Glob(filepath.Join(dir, "*.log"))
+	assert.Nil(t, globErr)
+	return paths
+}
+
+func TestDurableQueue(t *testing.T) {
+	dir := "test-durable-queue"
+	defer os.RemoveAll(dir)
+
+	t.Run("succeed, unacked tasks are replayed once the queue is opened again", func(t *testing.T) {
+		images := &countingImages{}
+		q, openErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, openErr)
+
+		assert.True(t, q.Enqueue(newTask("test/a")))
+		assert.True(t, q.Enqueue(newTask("test/b")))
+		q.Close()
+		q.Wait()
+		assert.False(t, q.Enqueue(newTask("test/c")))
+		assert.Empty(t, images.paths())
+
+		// e.g. after a crash, nothing has been processed
+		reopened, reopenErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, reopenErr)
+		assert.True(t, reopened.Pending("user1", "a"))
+		assert.False(t, reopened.Pending("user1", "c"))
+		assert.True(t, reopened.Enqueue(newTask("test/c")))
+		process(t, reopened, images, 3)
+		assert.Equal(t, []string{"test/a", "test/b", "test/c"}, images.paths())
+		assert.False(t, reopened.Pending("user1", "a"))
+	})
+
+	t.Run("succeed, acked tasks are not replayed", func(t *testing.T) {
+		images := &countingImages{}
+		q, openErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, openErr)
+		process(t, q, images, 0)
+		assert.Empty(t, images.paths())
+	})
+
+	t.Run("succeed, segments are deleted once all their tasks are acked", func(t *testing.T) {
+		images := &countingImages{}
+		q, openErr := resize_queue.NewDurableService(dir, 200, 1, images)
+		assert.Nil(t, openErr)
+
+		for _, path := range []string{"test/1", "test/2", "test/3", "test/4", "test/5", "test/6"} {
+			assert.True(t, q.Enqueue(newTask(path)))
+		}
+		assert.Greater(t, len(segments(t, dir)), 2)
+
+		process(t, q, images, 6)
+		assert.Len(t, images.paths(), 6)
+		assert.Len(t, segments(t, dir), 1)
+	})
+
+	t.Run("succeed, cancelled task is skipped and acked", func(t *testing.T) {
+		images := &countingImages{}
+		q, openErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, openErr)
+
+		assert.True(t, q.Enqueue(newTask("test/cancelled")))
+		assert.True(t, q.Enqueue(newTask("test/kept")))
+		assert.True(t, q.Cancel("user1", "cancelled"))
+		assert.False(t, q.Cancel("user1", "unknown"))
+		assert.True(t, q.Enqueue(newTask("test/restored")))
+		assert.True(t, q.Cancel("user1", "restored"))
+		assert.True(t, q.Enqueue(newTask("test/restored")))
+
+		process(t, q, images, 2)
+		assert.Equal(t, []string{"test/kept", "test/restored"}, images.paths())
+
+		reopened, reopenErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, reopenErr)
+		assert.False(t, reopened.Cancel("user1", "cancelled"))
+		reopened.Close()
+		reopened.Wait()
+	})
+
+	t.Run("succeed, tasks are processed by several workers", func(t *testing.T) {
+		images := &countingImages{delay: 200 * time.Millisecond}
+		q, openErr := resize_queue.NewDurableService(dir, 1024, 4, images)
+		assert.Nil(t, openErr)
+
+		for _, path := range []string{"test/w1", "test/w2", "test/w3", "test/w4"} {
+			assert.True(t, q.Enqueue(newTask(path)))
+		}
+
+		startTime := time.Now()
+		process(t, q, images, 4)
+		assert.Less(t, time.Since(startTime), 600*time.Millisecond)
+		assert.ElementsMatch(t, []string{"test/w1", "test/w2", "test/w3", "test/w4"}, images.paths())
+
+		metrics := q.Metrics()
+		assert.Len(t, metrics, 4)
+		for _, m := range metrics {
+			assert.Equal(t, int64(1), m.TasksCompleted)
+			assert.GreaterOrEqual(t, m.BusyMs, int64(200))
+		}
+	})
+
+	t.Run("succeed, torn last record is dropped", func(t *testing.T) {
+		images := &countingImages{}
+		q, openErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, openErr)
+		assert.True(t, q.Enqueue(newTask("test/complete")))
+		q.Close()
+		q.Wait()
+
+		paths := segments(t, dir)
+		file, fileErr := os.OpenFile(paths[len(paths)-1], os.O_WRONLY|os.O_APPEND, 0644)
+		assert.Nil(t, fileErr)
+		_, writeErr := file.WriteString(`{"op":"enqueue","id":99,"task":{"ImageM`)
+		assert.Nil(t, writeErr)
+		file.Close()
+
+		reopened, reopenErr := resize_queue.NewDurableService(dir, 1024, 1, images)
+		assert.Nil(t, reopenErr)
+		process(t, reopened, images, 1)
+		assert.Equal(t, []string{"test/complete"}, images.paths())
+	})
+}
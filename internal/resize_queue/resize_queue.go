@@ -3,79 +3,171 @@ package resize_queue
 import (
 	"context"
 	"fmt"
+	"receipt_uploader/internal/constants"
 	"receipt_uploader/internal/images"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/worker_metrics"
 	"sync"
 	"time"
 )
 
 type TaskFunc func() error
 
+// ResizeQueue buffers up to its capacity of tasks in memory, they are processed by a pool of
+// workers. Once it is closed, the workers drain the tasks left before they return.
 type ResizeQueue struct {
 	tasks         chan tasks.ResizeTask
-	wg            sync.WaitGroup
+	workers       *workerPool
 	imagesService images.ServiceType
 	mu            sync.Mutex
+	pending       *pendingTasks
+	closed        bool
 }
 
-func NewService(capacity int, service images.ServiceType) *ResizeQueue {
-	return &ResizeQueue{
+// NewService creates a queue processed by the given number of workers, DefaultWorkers() if it is
+// not positive
+func NewService(capacity, workers int, service images.ServiceType) *ResizeQueue {
+	q := &ResizeQueue{
 		tasks:         make(chan tasks.ResizeTask, capacity),
+		workers:       newWorkerPool(workers),
 		imagesService: service,
 	}
+	q.pending = newPendingTasks(&q.mu)
+	return q
+}
+
+// NewFromConfig creates the durable queue in config.QueueDir, or the in-memory queue holding up to
+// config.QueueCapacity tasks if it is not set. Both are processed by config.ResizeWorkers workers.
+func NewFromConfig(config *configs.Config, service images.ServiceType) (ServiceType, error) {
+	if config.QueueDir == "" {
+		return NewService(config.QueueCapacity, config.ResizeWorkers, service), nil
+	}
+	return NewDurableService(config.QueueDir, constants.QUEUE_SEGMENT_SIZE, config.ResizeWorkers, service)
 }
 
 func (q *ResizeQueue) Start(stopChan <-chan struct{}) {
 	fmt.Println("starting task queue...")
 	logging.Infof("queue size: %d, capacity: %d", len(q.tasks), cap(q.tasks))
 
-	go q.Process()
+	q.workers.start(q.work)
 
 	<-stopChan
 	fmt.Println("Stopping task queue...")
 
 	q.Close()
 	q.Wait()
+	q.workers.logMetrics()
 	fmt.Println("Task queue stopped")
 }
 
+// Enqueue buffers task, it returns false if the queue is full or closed
 func (q *ResizeQueue) Enqueue(task tasks.ResizeTask) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	if q.closed {
+		return false
+	}
 	select {
 	case q.tasks <- task:
+		q.pending.add(task)
 		return true
 	default:
 		return false
 	}
 }
 
+// Cancel marks the queued tasks of a receipt to be skipped and waits for its tasks being processed,
+// it returns false if none is queued nor being processed
+func (q *ResizeQueue) Cancel(username, receiptId string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.cancel(username, receiptId)
+}
+
+// Pending returns true if a task of the receipt is queued and not cancelled, or being processed
+func (q *ResizeQueue) Pending(username, receiptId string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.has(username, receiptId)
+}
+
+// Process runs the workers until the queue is closed and all its tasks are processed
 func (q *ResizeQueue) Process() {
 	fmt.Println("task queue starts running...")
 
+	q.workers.start(q.work)
+	q.workers.wait()
+}
+
+// Metrics returns what every worker processed so far
+func (q *ResizeQueue) Metrics() []worker_metrics.WorkerMetrics {
+	return q.workers.snapshot()
+}
+
+// work processes tasks on worker until the queue is closed and drained
+func (q *ResizeQueue) work(worker int) {
 	for task := range q.tasks {
-		q.wg.Add(1)
-		err := q.WithTimeout(task, 2*time.Second)
-		if err != nil {
-			logging.Errorf("WithTimeout() failed, path: '%s', err: %s", task.ImageMeta.Path, err)
+		if q.dequeue(task) {
+			logging.Infof("skipping cancelled task, path: '%s'", task.ImageMeta.Path)
+			continue
 		}
-		q.wg.Done()
+		q.workers.resize(worker, q.imagesService, task, q.finish)
 	}
 }
 
+// dequeue removes task from the pending tasks, it returns true if task has been cancelled
+func (q *ResizeQueue) dequeue(task tasks.ResizeTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.remove(task)
+}
+
+// finish records that generating the images of task returned, it may be later than the worker
+// gave up on it
+func (q *ResizeQueue) finish(task tasks.ResizeTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending.finish(task)
+}
+
+// Wait waits until the workers drained the queue, it must be called after Close
 func (q *ResizeQueue) Wait() {
-	q.wg.Wait()
+	q.workers.wait()
 }
 
+// Close stops enqueuing tasks, the workers drain the tasks left
 func (q *ResizeQueue) Close() {
 	fmt.Println("closing task queue...")
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
 	close(q.tasks)
 }
 
 func (q *ResizeQueue) WithTimeout(task tasks.ResizeTask, timeout time.Duration) error {
+	return withTimeout(q.imagesService, task, timeout, func(tasks.ResizeTask) {})
+}
 
+// withTimeout generates the images of task, a task taking longer than timeout is recorded as failed
+// and keeps running in background. finish is called once generating returned.
+func withTimeout(
+	imagesService images.ServiceType,
+	task tasks.ResizeTask,
+	timeout time.Duration,
+	finish func(task tasks.ResizeTask),
+) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -84,10 +176,11 @@ func (q *ResizeQueue) WithTimeout(task tasks.ResizeTask, timeout time.Duration)
 	go func() {
 		defer func() {
 			close(errChan)
+			finish(task)
 		}()
 
 		startTime := time.Now()
-		err := q.imagesService.GenerateResizedImages(&task.ImageMeta, task.DestDir)
+		err := imagesService.GenerateResizedImages(&task.ImageMeta, task.DestDir)
 		if err != nil {
 			errChan <- fmt.Errorf("GenerateResizedImages() failed, err: %w", err)
 			return
@@ -100,6 +193,83 @@ func (q *ResizeQueue) WithTimeout(task tasks.ResizeTask, timeout time.Duration)
 	case genErr := <-errChan:
 		return genErr
 	case <-ctx.Done():
-		return fmt.Errorf("resizeImages() timed out")
+		timeoutErr := fmt.Errorf("resizeImages() timed out")
+		imagesService.RecordFailure(&task.ImageMeta, constants.RESIZE_ERR_TIMEOUT, timeoutErr)
+		return timeoutErr
 	}
 }
+
+// pendingTasks counts the queued and running tasks of every receipt, tasks queued before a receipt
+// is cancelled are skipped, tasks enqueued afterwards, e.g. once it is restored, are processed.
+// The queue owning it guards it with the locker passed to newPendingTasks.
+type pendingTasks struct {
+	counts   map[string]int // number of queued tasks per receipt
+	skipped  map[string]int // number of the next dequeued tasks per receipt which must be skipped
+	running  map[string]int // number of tasks per receipt whose images are being generated
+	finished *sync.Cond     // signalled whenever a running task finished
+}
+
+func newPendingTasks(locker sync.Locker) *pendingTasks {
+	return &pendingTasks{
+		counts:   make(map[string]int),
+		skipped:  make(map[string]int),
+		running:  make(map[string]int),
+		finished: sync.NewCond(locker),
+	}
+}
+
+func (p *pendingTasks) add(task tasks.ResizeTask) {
+	p.counts[taskKey(task.ImageMeta.Username, task.ImageMeta.ReceiptID)]++
+}
+
+// cancel marks the queued tasks of a receipt to be skipped and waits for its running tasks to
+// finish, so that no images of the receipt are written once it returns. It returns false if no
+// task is queued nor running. The locker is released while waiting.
+func (p *pendingTasks) cancel(username, receiptId string) bool {
+	key := taskKey(username, receiptId)
+	found := p.counts[key] > 0 || p.running[key] > 0
+	p.skipped[key] = p.counts[key]
+	for p.running[key] > 0 {
+		p.finished.Wait()
+	}
+	return found
+}
+
+// has returns true if a task of the receipt is queued and not cancelled, or running
+func (p *pendingTasks) has(username, receiptId string) bool {
+	key := taskKey(username, receiptId)
+	return p.counts[key] > p.skipped[key] || p.running[key] > 0
+}
+
+// remove removes task once it is taken from the queue, it returns true if task has been cancelled.
+// Otherwise task is running until finish is called.
+func (p *pendingTasks) remove(task tasks.ResizeTask) bool {
+	key := taskKey(task.ImageMeta.Username, task.ImageMeta.ReceiptID)
+	p.counts[key]--
+	isCancelled := p.skipped[key] > 0
+	if isCancelled {
+		p.skipped[key]--
+	}
+	if p.counts[key] <= 0 {
+		delete(p.counts, key)
+		delete(p.skipped, key)
+	}
+	if !isCancelled {
+		p.running[key]++
+	}
+	return isCancelled
+}
+
+// finish records that generating the images of a task returned by remove returned
+func (p *pendingTasks) finish(task tasks.ResizeTask) {
+	key := taskKey(task.ImageMeta.Username, task.ImageMeta.ReceiptID)
+	p.running[key]--
+	if p.running[key] <= 0 {
+		delete(p.running, key)
+	}
+	p.finished.Broadcast()
+}
+
+func taskKey(username, receiptId string) string {
+	return username + "#" + receiptId
+}
@@ -3,6 +3,7 @@ package resize_queue_mock
 import (
 	"receipt_uploader/internal/logging"
 	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/worker_metrics"
 )
 
 type ServiceMock struct{}
@@ -21,10 +22,28 @@ func (tq *ServiceMock) Enqueue(task tasks.ResizeTask) bool {
 	return true
 }
 
+func (q *ServiceMock) Cancel(username, receiptId string) bool {
+	logging.Debugf("resize_queue_mock.Cancel(username: %s, receiptId: %s)", username, receiptId)
+	return false
+}
+
+func (q *ServiceMock) Pending(username, receiptId string) bool {
+	logging.Debugf("resize_queue_mock.Pending(username: %s, receiptId: %s)", username, receiptId)
+	return false
+}
+
 func (q *ServiceMock) Process() {
 	logging.Debugf("resize_queue_mock.Enqueue()")
 }
 
+func (q *ServiceMock) Metrics() []worker_metrics.WorkerMetrics {
+	logging.Debugf("resize_queue_mock.Metrics()")
+	return []worker_metrics.WorkerMetrics{
+		{Worker: 0, TasksCompleted: 3, TasksFailed: 1, BusyMs: 1200},
+		{Worker: 1, TasksCompleted: 2, BusyMs: 800},
+	}
+}
+
 func (q *ServiceMock) Wait() {
 	logging.Debugf("resize_queue_mock.Wait()")
 
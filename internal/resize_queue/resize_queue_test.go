@@ -1,6 +1,9 @@
 package resize_queue_test
 
 import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,7 +19,7 @@ import (
 func TestEnqueue(t *testing.T) {
 	queueCapacity := 3
 	mockImagesService := &images_mock.ServiceMock{}
-	queue := resize_queue.NewService(queueCapacity, mockImagesService)
+	queue := resize_queue.NewService(queueCapacity, 1, mockImagesService)
 
 	task := tasks.ResizeTask{
 		ImageMeta: image_meta.ImageMeta{Path: "test/path"},
@@ -34,10 +37,97 @@ func TestEnqueue(t *testing.T) {
 	assert.False(t, success)
 }
 
+func TestCancel(t *testing.T) {
+	mockImagesService := &images_mock.ServiceMock{}
+
+	t.Run("succeed, cancelled task is skipped", func(t *testing.T) {
+		queue := resize_queue.NewService(3, 1, mockImagesService)
+
+		task := tasks.ResizeTask{
+			ImageMeta: image_meta.ImageMeta{Path: "test/path", Username: "user1", ReceiptID: "123456"},
+			DestDir:   "mock_generate_images_failed",
+		}
+		assert.True(t, queue.Enqueue(task))
+		assert.True(t, queue.Pending("user1", "123456"))
+		assert.True(t, queue.Cancel("user1", "123456"))
+		assert.False(t, queue.Pending("user1", "123456"))
+
+		queue.Close()
+		queue.Process()
+		queue.Wait()
+
+		assert.False(t, queue.Cancel("user1", "123456"))
+	})
+
+	t.Run("succeed, task enqueued after cancelling is processed", func(t *testing.T) {
+		images := &countingImages{}
+		queue := resize_queue.NewService(3, 1, images)
+
+		// deleted and restored before the queue processed the receipt
+		assert.True(t, queue.Enqueue(newTask("test/deleted")))
+		assert.True(t, queue.Cancel("user1", "deleted"))
+		assert.True(t, queue.Enqueue(newTask("test/deleted")))
+
+		queue.Close()
+		queue.Process()
+
+		assert.Equal(t, []string{"test/deleted"}, images.paths())
+		assert.False(t, queue.Cancel("user1", "deleted"))
+	})
+
+	t.Run("succeed, cancel waits for the task being processed", func(t *testing.T) {
+		images := &blockingImages{started: make(chan struct{}), release: make(chan struct{})}
+		queue := resize_queue.NewService(3, 1, images)
+		assert.True(t, queue.Enqueue(newTask("test/123456")))
+		queue.Close()
+		go queue.Process()
+		<-images.started
+
+		cancelled := make(chan bool)
+		go func() {
+			cancelled <- queue.Cancel("user1", "123456")
+		}()
+		select {
+		case <-cancelled:
+			assert.Fail(t, "Cancel() returned while the task was being processed")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(images.release)
+		assert.True(t, <-cancelled)
+		assert.True(t, images.isWritten())
+		queue.Wait()
+	})
+
+	t.Run("should fail, no queued task", func(t *testing.T) {
+		queue := resize_queue.NewService(3, 1, mockImagesService)
+		assert.False(t, queue.Cancel("user1", "123456"))
+	})
+}
+
+// blockingImages signals started once it generates images and writes them once release is closed
+type blockingImages struct {
+	images_mock.ServiceMock
+	started chan struct{}
+	release chan struct{}
+	written atomic.Bool
+}
+
+func (b *blockingImages) GenerateResizedImages(imageMeta *image_meta.ImageMeta, destDir string) error {
+	close(b.started)
+	<-b.release
+	b.written.Store(true)
+	return nil
+}
+
+func (b *blockingImages) isWritten() bool {
+	return b.written.Load()
+}
+
 func TestWithTimeout(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		mockImagesService := &images_mock.ServiceMock{}
-		queue := resize_queue.NewService(2, mockImagesService)
+		queue := resize_queue.NewService(2, 1, mockImagesService)
 
 		task := tasks.ResizeTask{ImageMeta: image_meta.ImageMeta{Path: "test/path"}, DestDir: "test/destDir"}
 		timeout := constants.RESIZE_TIMEOUT
@@ -47,7 +137,7 @@ func TestWithTimeout(t *testing.T) {
 
 	t.Run("should fail, WithTimeout()time out", func(t *testing.T) {
 		mockImagesService := &images_mock.ServiceMock{}
-		queue := resize_queue.NewService(2, mockImagesService)
+		queue := resize_queue.NewService(2, 1, mockImagesService)
 
 		task := tasks.ResizeTask{ImageMeta: image_meta.ImageMeta{Path: "test/path"}, DestDir: "mock_generate_images_timeout"}
 		timeout := constants.RESIZE_TIMEOUT - 1*time.Second
@@ -57,3 +147,57 @@ func TestWithTimeout(t *testing.T) {
 	})
 
 }
+
+func TestWorkers(t *testing.T) {
+	t.Run("succeed, tasks are processed concurrently and drained once closed", func(t *testing.T) {
+		images := &countingImages{delay: 200 * time.Millisecond}
+		queue := resize_queue.NewService(8, 4, images)
+
+		for i := 0; i < 8; i++ {
+			assert.True(t, queue.Enqueue(newTask("test/path"+strconv.Itoa(i))))
+		}
+		queue.Close()
+
+		startTime := time.Now()
+		queue.Process()
+		assert.Less(t, time.Since(startTime), 800*time.Millisecond)
+		assert.Len(t, images.paths(), 8)
+
+		metrics := queue.Metrics()
+		assert.Len(t, metrics, 4)
+		completed := int64(0)
+		for i, m := range metrics {
+			assert.Equal(t, i, m.Worker)
+			assert.Greater(t, m.BusyMs, int64(0))
+			completed += m.TasksCompleted
+		}
+		assert.Equal(t, int64(8), completed)
+	})
+
+	t.Run("succeed, failed tasks are counted", func(t *testing.T) {
+		queue := resize_queue.NewService(2, 1, &images_mock.ServiceMock{})
+
+		task := tasks.ResizeTask{ImageMeta: image_meta.ImageMeta{Path: "test/path"}, DestDir: "mock_generate_images_failed"}
+		assert.True(t, queue.Enqueue(task))
+		queue.Close()
+		queue.Process()
+
+		metrics := queue.Metrics()
+		assert.Equal(t, int64(1), metrics[0].TasksFailed)
+		assert.Equal(t, int64(0), metrics[0].TasksCompleted)
+	})
+
+	t.Run("should fail, enqueue after closing", func(t *testing.T) {
+		queue := resize_queue.NewService(2, 1, &images_mock.ServiceMock{})
+		queue.Close()
+		queue.Close()
+
+		assert.False(t, queue.Enqueue(newTask("test/path")))
+		queue.Process()
+	})
+
+	t.Run("succeed, one worker per CPU by default", func(t *testing.T) {
+		queue := resize_queue.NewService(1, 0, &images_mock.ServiceMock{})
+		assert.Len(t, queue.Metrics(), runtime.NumCPU())
+	})
+}
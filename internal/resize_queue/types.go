@@ -1,11 +1,17 @@
 package resize_queue
 
-import "receipt_uploader/internal/models/tasks"
+import (
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/worker_metrics"
+)
 
 type ServiceType interface {
 	Start(stopChan <-chan struct{})
 	Enqueue(task tasks.ResizeTask) bool
+	Cancel(username, receiptId string) bool
+	Pending(username, receiptId string) bool
 	Process()
+	Metrics() []worker_metrics.WorkerMetrics
 	Wait()
 	Close()
 }
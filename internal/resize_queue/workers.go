@@ -0,0 +1,102 @@
+package resize_queue
+
+import (
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/models/worker_metrics"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultWorkers returns the number of workers used if none is configured, resizing is bound by
+// CPU so there is one per CPU
+func DefaultWorkers() int {
+	return runtime.NumCPU()
+}
+
+// workerPool runs the workers of a queue and records what each of them processed
+type workerPool struct {
+	size    int
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	metrics []worker_metrics.WorkerMetrics
+	busy    []time.Duration // time spent processing tasks per worker, BusyMs is set from it
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size <= 0 {
+		size = DefaultWorkers()
+	}
+
+	metrics := make([]worker_metrics.WorkerMetrics, size)
+	for i := range metrics {
+		metrics[i].Worker = i
+	}
+	return &workerPool{size: size, metrics: metrics, busy: make([]time.Duration, size)}
+}
+
+// start runs work once per worker, each in its own goroutine
+func (p *workerPool) start(work func(worker int)) {
+	logging.Infof("starting %d resize workers", p.size)
+
+	p.wg.Add(p.size)
+	for i := 0; i < p.size; i++ {
+		go func(worker int) {
+			defer p.wg.Done()
+			work(worker)
+		}(i)
+	}
+}
+
+// wait waits until all workers returned
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
+
+// resize generates the images of task on worker and records how long it took, finish is called
+// once generating returned
+func (p *workerPool) resize(
+	worker int,
+	imagesService images.ServiceType,
+	task tasks.ResizeTask,
+	finish func(task tasks.ResizeTask),
+) {
+	startTime := time.Now()
+	err := withTimeout(imagesService, task, constants.RESIZE_TIMEOUT, finish)
+	busy := time.Since(startTime)
+	if err != nil {
+		logging.Errorf("withTimeout() failed, worker: %d, path: '%s', err: %s", worker, task.ImageMeta.Path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.metrics[worker].TasksFailed++
+	} else {
+		p.metrics[worker].TasksCompleted++
+	}
+	p.busy[worker] += busy
+}
+
+// snapshot returns the metrics of every worker
+func (p *workerPool) snapshot() []worker_metrics.WorkerMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := append([]worker_metrics.WorkerMetrics{}, p.metrics...)
+	for i := range result {
+		result[i].BusyMs = p.busy[i].Milliseconds()
+	}
+	return result
+}
+
+// logMetrics logs the metrics of every worker, e.g. once the queue stopped
+func (p *workerPool) logMetrics() {
+	for _, m := range p.snapshot() {
+		logging.Infof("resize worker %d: completed: %d, failed: %d, busy: %d ms", m.Worker, m.TasksCompleted, m.TasksFailed, m.BusyMs)
+	}
+}
@@ -0,0 +1,336 @@
+package scrubber
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/encryption"
+	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/storage"
+	"sort"
+	"time"
+)
+
+// receiptFiles are the files of a receipt found in config.UploadsDir and config.ResizedDir
+type receiptFiles struct {
+	username  string
+	receiptId string
+	original  *storage.ObjectInfo
+	variants  map[string]storage.ObjectInfo // keyed by size, "" for the copy
+}
+
+// Service verifies the checksums of all originals and variants and regenerates corrupted or
+// missing variants from the original, or from the copy if the original is gone.
+// Receipts in trash and originals in cold storage are not verified.
+type Service struct {
+	config        *configs.Config
+	checksums     checksums.ServiceType
+	imagesService images.ServiceType
+	interval      time.Duration
+}
+
+func NewService(config *configs.Config, c checksums.ServiceType, imagesService images.ServiceType) ServiceType {
+	interval := config.ScrubInterval
+	if interval <= 0 {
+		interval = constants.SCRUB_INTERVAL
+	}
+
+	return &Service{
+		config:        config,
+		checksums:     c,
+		imagesService: imagesService,
+		interval:      interval,
+	}
+}
+
+// Run re-hashes every file once and compares it with the checksum recorded when it was written,
+// the current checksum is recorded for files written before checksums were recorded.
+// Corrupted or missing variants are regenerated through images.GenerateResizedImages, a corrupted
+// original is restored from an intact copy. Missing variants of receipts written within
+// constants.SCRUB_GRACE_PERIOD before now are not reported, they are most likely still being resized.
+func (s *Service) Run(now time.Time) (*Report, error) {
+	logging.Infof("scrubber.Run(now: %s)", now.Format(time.RFC3339))
+
+	receipts, collectErr := s.collect()
+	if collectErr != nil {
+		return nil, collectErr
+	}
+
+	report := &Report{
+		Issues: []Issue{},
+	}
+	for _, receipt := range receipts {
+		s.scrub(receipt, now, report)
+	}
+
+	logging.Infof(
+		"scrub completed, scanned: %d, verified: %d, recorded: %d, issues: %d, regenerated: %d, failed: %d",
+		report.Scanned, report.Verified, report.Recorded, len(report.Issues), report.Regenerated, report.Failed,
+	)
+	return report, nil
+}
+
+// Start verifies all files every config.ScrubInterval until stopChan is closed
+func (s *Service) Start(stopChan <-chan struct{}) {
+	fmt.Println("starting scrubber...")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			fmt.Println("Scrubber stopped")
+			return
+		case <-ticker.C:
+			report, runErr := s.Run(time.Now().UTC())
+			if runErr != nil {
+				logging.Errorf("s.Run() failed, err: %s", runErr.Error())
+				continue
+			}
+			if len(report.Issues) > 0 {
+				data, _ := json.Marshal(report.Issues)
+				logging.Warnf("scrubber found issues: %s", string(data))
+			}
+		}
+	}
+}
+
+// scrub verifies the files of receipt and repairs what can be repaired
+func (s *Service) scrub(receipt *receiptFiles, now time.Time, report *Report) {
+	issues := []*Issue{}
+	newest := time.Time{}
+	verify := func(obj storage.ObjectInfo) bool {
+		if obj.ModTime.After(newest) {
+			newest = obj.ModTime
+		}
+		issue, ok := s.verify(obj, report)
+		if issue != nil {
+			issue.Username = receipt.username
+			issue.ReceiptID = receipt.receiptId
+			issues = append(issues, issue)
+		}
+		return ok
+	}
+
+	// a cold original is not verified, reading it would recall it from cold storage
+	originalOk := false
+	if receipt.original != nil {
+		originalOk = receipt.original.Tier == constants.TIER_COLD || verify(*receipt.original)
+	}
+	originalIssues := len(issues)
+
+	intact := map[string]bool{}
+	for _, size := range sortedSizes(receipt.variants) {
+		intact[size] = verify(receipt.variants[size])
+	}
+	damaged := append([]*Issue{}, issues[originalIssues:]...)
+
+	if now.Sub(newest) >= constants.SCRUB_GRACE_PERIOD {
+		sizes := append([]string{""}, dimensionNames(s.config.Dimensions)...)
+		for _, size := range sizes {
+			if _, ok := receipt.variants[size]; ok {
+				continue
+			}
+			issue := &Issue{
+				Path:      s.variantPath(receipt, size),
+				Username:  receipt.username,
+				ReceiptID: receipt.receiptId,
+				Issue:     ISSUE_MISSING,
+			}
+			issues = append(issues, issue)
+			damaged = append(damaged, issue)
+		}
+	}
+
+	copyObj, hasCopy := receipt.variants[""]
+	copyOk := hasCopy && intact[""]
+	if receipt.original != nil && !originalOk && originalIssues > 0 && copyOk {
+		restoreErr := s.restoreOriginal(copyObj.Key, receipt.original.Key)
+		if restoreErr != nil {
+			logging.Errorf("s.restoreOriginal(path: %s) failed, err: %s", receipt.original.Key, restoreErr.Error())
+			report.Failed++
+		} else {
+			issues[0].Repaired = true
+			originalOk = true
+			report.Regenerated++
+		}
+	}
+
+	if len(damaged) > 0 {
+		s.regenerate(receipt, originalOk, copyOk, damaged, report)
+	}
+
+	for _, issue := range issues {
+		report.Issues = append(report.Issues, *issue)
+	}
+}
+
+// verify hashes obj and compares it with its recorded checksum, it returns an issue if it does
+// not match and false if obj is not known to be intact
+func (s *Service) verify(obj storage.ObjectInfo, report *Report) (*Issue, bool) {
+	report.Scanned++
+
+	actual, computeErr := s.checksums.Compute(obj.Key)
+	if errors.Is(computeErr, encryption.ErrDecrypt) {
+		// an encrypted file which has been modified can not be read at all
+		logging.Warnf("s.checksums.Compute(path: %s) failed, err: %s", obj.Key, computeErr.Error())
+		expected, _ := s.checksums.Checksum(obj.Key)
+		return &Issue{Path: obj.Key, Issue: ISSUE_MISMATCH, Expected: expected}, false
+	}
+	if computeErr != nil {
+		logging.Errorf("s.checksums.Compute(path: %s) failed, err: %s", obj.Key, computeErr.Error())
+		report.Failed++
+		return nil, false
+	}
+
+	expected, checksumErr := s.checksums.Checksum(obj.Key)
+	if errors.Is(checksumErr, fs.ErrNotExist) {
+		recordErr := s.checksums.Record(obj.Key, actual)
+		if recordErr != nil {
+			logging.Errorf("s.checksums.Record(path: %s) failed, err: %s", obj.Key, recordErr.Error())
+			report.Failed++
+			return nil, true
+		}
+		report.Recorded++
+		return nil, true
+	}
+	if checksumErr != nil {
+		logging.Errorf("s.checksums.Checksum(path: %s) failed, err: %s", obj.Key, checksumErr.Error())
+		report.Failed++
+		return nil, false
+	}
+
+	if expected != actual {
+		logging.Warnf("checksum mismatch, path: %s, expected: %s, actual: %s", obj.Key, expected, actual)
+		return &Issue{Path: obj.Key, Issue: ISSUE_MISMATCH, Expected: expected, Actual: actual}, false
+	}
+	report.Verified++
+	return nil, true
+}
+
+// regenerate generates the copy and all resized images of receipt again, from the original if it
+// is intact, otherwise from the copy
+func (s *Service) regenerate(receipt *receiptFiles, originalOk, copyOk bool, damaged []*Issue, report *Report) {
+	var source *image_meta.ImageMeta
+	var parseErr error
+	switch {
+	case originalOk:
+		source, parseErr = image_meta.FromUploadDir(receipt.original.Key)
+	case copyOk:
+		source, _, parseErr = image_meta.FromResizedDir(receipt.variants[""].Key)
+	default:
+		logging.Errorf("no intact source to regenerate variants, username: %s, receiptId: %s", receipt.username, receipt.receiptId)
+		return
+	}
+	if parseErr != nil {
+		logging.Errorf("parsing source of receiptId: %s failed, err: %s", receipt.receiptId, parseErr.Error())
+		report.Failed++
+		return
+	}
+
+	generateErr := s.imagesService.GenerateResizedImages(source, s.config.ResizedDir)
+	if generateErr != nil {
+		logging.Errorf("s.imagesService.GenerateResizedImages(path: %s) failed, err: %s", source.Path, generateErr.Error())
+		report.Failed++
+		return
+	}
+
+	for _, issue := range damaged {
+		issue.Repaired = true
+	}
+	report.Regenerated++
+}
+
+// restoreOriginal overwrites a corrupted original with its copy
+func (s *Service) restoreOriginal(copyPath, originalPath string) error {
+	reader, getErr := s.checksums.Get(copyPath)
+	if getErr != nil {
+		return fmt.Errorf("s.checksums.Get(path: %s) failed, err: %w", copyPath, getErr)
+	}
+	defer reader.Close()
+
+	return s.checksums.Put(originalPath, reader)
+}
+
+func (s *Service) variantPath(receipt *receiptFiles, size string) string {
+	imageMeta := image_meta.FromReceiptID(receipt.username, receipt.receiptId, s.config.UploadsDir)
+	return image_meta.GetResizedPath(imageMeta, filepath.Join(s.config.ResizedDir, receipt.username), size)
+}
+
+// collect groups the files in config.UploadsDir and config.ResizedDir by receipt
+func (s *Service) collect() ([]*receiptFiles, error) {
+	receipts := map[string]*receiptFiles{}
+	get := func(username, receiptId string) *receiptFiles {
+		key := username + "#" + receiptId
+		receipt, ok := receipts[key]
+		if !ok {
+			receipt = &receiptFiles{username: username, receiptId: receiptId, variants: map[string]storage.ObjectInfo{}}
+			receipts[key] = receipt
+		}
+		return receipt
+	}
+
+	originals, listErr := s.checksums.List(s.config.UploadsDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.checksums.List(dir: %s) failed, err: %w", s.config.UploadsDir, listErr)
+	}
+	for _, obj := range originals {
+		imageMeta, parseErr := image_meta.FromUploadDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromUploadDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			continue
+		}
+		original := obj
+		get(imageMeta.Username, imageMeta.ReceiptID).original = &original
+	}
+
+	variants, listErr := s.checksums.List(s.config.ResizedDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.checksums.List(dir: %s) failed, err: %w", s.config.ResizedDir, listErr)
+	}
+	for _, obj := range variants {
+		imageMeta, size, parseErr := image_meta.FromResizedDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromResizedDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			continue
+		}
+		get(imageMeta.Username, imageMeta.ReceiptID).variants[size] = obj
+	}
+
+	sorted := make([]*receiptFiles, 0, len(receipts))
+	for _, receipt := range receipts {
+		sorted = append(sorted, receipt)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].username != sorted[j].username {
+			return sorted[i].username < sorted[j].username
+		}
+		return sorted[i].receiptId < sorted[j].receiptId
+	})
+	return sorted, nil
+}
+
+func sortedSizes(variants map[string]storage.ObjectInfo) []string {
+	sizes := make([]string, 0, len(variants))
+	for size := range variants {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+	return sizes
+}
+
+func dimensionNames(dimensions configs.Dimensions) []string {
+	names := make([]string, 0, len(dimensions))
+	for _, d := range dimensions {
+		names = append(names, d.Name)
+	}
+	return names
+}
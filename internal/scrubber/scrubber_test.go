@@ -0,0 +1,249 @@
+package scrubber
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/encryption"
+	"receipt_uploader/internal/images"
+	images_mock "receipt_uploader/internal/images/mock"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/quotas/quotas_mock"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/test_utils"
+	"receipt_uploader/internal/tiering"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubber(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	config := &configs.Config{
+		UploadsDir:   "uploads",
+		ResizedDir:   "resized",
+		ChecksumsDir: "checksums",
+		Dimensions:   configs.AllowedDimensions,
+	}
+
+	testFilePath := "test_scrubber.jpg"
+	createErr := test_utils.CreateTestImageJPG(testFilePath, 800, 1200)
+	assert.Nil(t, createErr)
+	defer os.Remove(testFilePath)
+	fileBytes, readErr := os.ReadFile(testFilePath)
+	assert.Nil(t, readErr)
+
+	newService := func() (ServiceType, checksums.ServiceType, storage.ServiceType, images.ServiceType) {
+		backend := storage.NewMemory()
+		store := checksums.NewService(config, backend)
+		imagesService := images.NewService(&config.Dimensions, store, &quotas_mock.ServiceMock{}, nil)
+		return NewService(config, store, imagesService), store, backend, imagesService
+	}
+
+	// createReceipt stores an original together with its copy and resized images
+	createReceipt := func(t *testing.T, imagesService images.ServiceType, username string) (*image_meta.ImageMeta, []string) {
+		imageMeta, saveErr := imagesService.SaveUpload(&fileBytes, username, "scrubbedreceipt", config.UploadsDir)
+		assert.Nil(t, saveErr)
+		assert.Nil(t, imagesService.GenerateResizedImages(imageMeta, config.ResizedDir))
+		return imageMeta, image_meta.GetReceiptPaths(imageMeta, config.ResizedDir, &config.Dimensions)
+	}
+
+	t.Run("succeed, all files intact", func(t *testing.T) {
+		service, _, _, imagesService := newService()
+		_, paths := createReceipt(t, imagesService, "user1")
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Equal(t, len(paths), report.Scanned)
+		assert.Equal(t, len(paths), report.Verified)
+		assert.Empty(t, report.Issues)
+		assert.Equal(t, 0, report.Regenerated)
+	})
+
+	t.Run("succeed, record checksums of files written without", func(t *testing.T) {
+		service, store, backend, _ := newService()
+		path := "uploads/user1#123456.jpg"
+		assert.Nil(t, backend.Put(path, bytes.NewReader(fileBytes)))
+
+		report, runErr := service.Run(time.Now())
+		assert.Nil(t, runErr)
+		assert.Equal(t, 1, report.Recorded)
+		assert.Empty(t, report.Issues)
+
+		checksum, checksumErr := store.Checksum(path)
+		assert.Nil(t, checksumErr)
+		assert.NotEmpty(t, checksum)
+	})
+
+	t.Run("succeed, regenerate corrupted and missing variants", func(t *testing.T) {
+		service, store, backend, imagesService := newService()
+		_, paths := createReceipt(t, imagesService, "user1")
+		small, medium := paths[2], paths[3]
+
+		expected, checksumErr := store.Checksum(small)
+		assert.Nil(t, checksumErr)
+		assert.Nil(t, backend.Put(small, bytes.NewReader([]byte("corrupted"))))
+		assert.Nil(t, store.Delete(medium))
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Issues, 2)
+		assert.Equal(t, ISSUE_MISMATCH, report.Issues[0].Issue)
+		assert.Equal(t, small, report.Issues[0].Path)
+		assert.Equal(t, expected, report.Issues[0].Expected)
+		assert.Equal(t, ISSUE_MISSING, report.Issues[1].Issue)
+		assert.Equal(t, medium, report.Issues[1].Path)
+		for _, issue := range report.Issues {
+			assert.True(t, issue.Repaired)
+		}
+		assert.Equal(t, 1, report.Regenerated)
+
+		for _, path := range []string{small, medium} {
+			checksum, checksumErr := store.Checksum(path)
+			assert.Nil(t, checksumErr)
+			computed, computeErr := store.Compute(path)
+			assert.Nil(t, computeErr)
+			assert.Equal(t, checksum, computed)
+		}
+
+		report, runErr = service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Empty(t, report.Issues)
+	})
+
+	t.Run("succeed, restore corrupted original from copy", func(t *testing.T) {
+		service, store, backend, imagesService := newService()
+		imageMeta, paths := createReceipt(t, imagesService, "user1")
+		assert.Nil(t, backend.Put(imageMeta.Path, bytes.NewReader([]byte("corrupted"))))
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Issues, 1)
+		assert.Equal(t, imageMeta.Path, report.Issues[0].Path)
+		assert.True(t, report.Issues[0].Repaired)
+
+		original, originalErr := store.Compute(imageMeta.Path)
+		assert.Nil(t, originalErr)
+		copied, copyErr := store.Compute(paths[1])
+		assert.Nil(t, copyErr)
+		assert.Equal(t, copied, original)
+	})
+
+	t.Run("succeed, regenerate variants from copy without original", func(t *testing.T) {
+		service, store, _, imagesService := newService()
+		imageMeta, paths := createReceipt(t, imagesService, "user1")
+		assert.Nil(t, store.Delete(imageMeta.Path))
+		assert.Nil(t, store.Delete(paths[4]))
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Issues, 1)
+		assert.Equal(t, paths[4], report.Issues[0].Path)
+		assert.True(t, report.Issues[0].Repaired)
+
+		_, statErr := store.Stat(paths[4])
+		assert.Nil(t, statErr)
+		_, statErr = store.Stat(imageMeta.Path)
+		assert.ErrorIs(t, statErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, missing variants of new receipts are not reported", func(t *testing.T) {
+		service, _, _, imagesService := newService()
+		_, saveErr := imagesService.SaveUpload(&fileBytes, "user1", "newreceipt", config.UploadsDir)
+		assert.Nil(t, saveErr)
+
+		report, runErr := service.Run(time.Now())
+		assert.Nil(t, runErr)
+		assert.Empty(t, report.Issues)
+
+		report, runErr = service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Issues, len(config.Dimensions)+1)
+		assert.Equal(t, 1, report.Regenerated)
+	})
+
+	t.Run("succeed, cold originals are not recalled", func(t *testing.T) {
+		tieringConfig := *config
+		tieringConfig.Tiering = configs.TieringConfig{Age: time.Minute, Backend: constants.STORAGE_BACKEND_MEMORY}
+		hot := storage.NewMemory()
+		recordsService := records.NewService("records", hot)
+		tieringService := tiering.NewService(&tieringConfig, hot, storage.NewMemory(), recordsService, metadata.NewMemory())
+		store := checksums.NewService(&tieringConfig, tieringService)
+		imagesService := images.NewService(&tieringConfig.Dimensions, store, &quotas_mock.ServiceMock{}, nil)
+		service := NewService(&tieringConfig, store, imagesService)
+		imageMeta, paths := createReceipt(t, imagesService, "user1")
+
+		migrated, migrateErr := tieringService.Run(later)
+		assert.Nil(t, migrateErr)
+		assert.Len(t, migrated.Migrations, 1)
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Equal(t, len(paths)-1, report.Scanned)
+		assert.Empty(t, report.Issues)
+
+		_, hotErr := hot.Stat(imageMeta.Path)
+		assert.ErrorIs(t, hotErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, regenerate variants which can not be decrypted", func(t *testing.T) {
+		encryptedConfig := *config
+		encryptedConfig.Encryption = configs.EncryptionConfig{
+			MasterKey: bytes.Repeat([]byte{1}, encryption.KEY_SIZE),
+			KeysDir:   "keys",
+		}
+		backend := storage.NewMemory()
+		store := checksums.NewService(&encryptedConfig, encryption.NewService(&encryptedConfig, backend))
+		imagesService := images.NewService(&encryptedConfig.Dimensions, store, &quotas_mock.ServiceMock{}, nil)
+		service := NewService(&encryptedConfig, store, imagesService)
+		_, paths := createReceipt(t, imagesService, "user1")
+		small := paths[2]
+
+		expected, checksumErr := store.Checksum(small)
+		assert.Nil(t, checksumErr)
+		reader, getErr := backend.Get(small)
+		assert.Nil(t, getErr)
+		ciphertext, readErr := io.ReadAll(reader)
+		reader.Close()
+		assert.Nil(t, readErr)
+		ciphertext[len(ciphertext)-1] ^= 0xff
+		assert.Nil(t, backend.Put(small, bytes.NewReader(ciphertext)))
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Equal(t, 0, report.Failed)
+		assert.Len(t, report.Issues, 1)
+		assert.Equal(t, ISSUE_MISMATCH, report.Issues[0].Issue)
+		assert.Equal(t, small, report.Issues[0].Path)
+		assert.Equal(t, expected, report.Issues[0].Expected)
+		assert.True(t, report.Issues[0].Repaired)
+		assert.Equal(t, 1, report.Regenerated)
+
+		report, runErr = service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Empty(t, report.Issues)
+	})
+
+	t.Run("should fail, GenerateResizedImages() failed", func(t *testing.T) {
+		mockConfig := *config
+		mockConfig.ResizedDir = "mock_generate_images_failed"
+		store := checksums.NewService(&mockConfig, storage.NewMemory())
+		assert.Nil(t, store.Put(filepath.Join(mockConfig.UploadsDir, "user1#123456.jpg"), bytes.NewReader(fileBytes)))
+		service := NewService(&mockConfig, store, &images_mock.ServiceMock{})
+
+		report, runErr := service.Run(later)
+		assert.Nil(t, runErr)
+		assert.Equal(t, 1, report.Failed)
+		assert.Len(t, report.Issues, len(config.Dimensions)+1)
+		for _, issue := range report.Issues {
+			assert.False(t, issue.Repaired)
+		}
+	})
+}
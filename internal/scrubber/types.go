@@ -0,0 +1,34 @@
+package scrubber
+
+import "time"
+
+const (
+	ISSUE_MISMATCH = "mismatch" // content differs from the checksum recorded when it was written or can not be decrypted
+	ISSUE_MISSING  = "missing"  // copy or resized image does not exist although the receipt does
+)
+
+type ServiceType interface {
+	Run(now time.Time) (*Report, error)
+	Start(stopChan <-chan struct{})
+}
+
+// Issue is a corrupted or missing file found by the scrubber
+type Issue struct {
+	Path      string `json:"path"`
+	Username  string `json:"username"`
+	ReceiptID string `json:"receiptId"`
+	Issue     string `json:"issue"`              // mismatch, missing
+	Expected  string `json:"expected,omitempty"` // recorded checksum
+	Actual    string `json:"actual,omitempty"`   // checksum of the current content
+	Repaired  bool   `json:"repaired"`           // true if the file has been regenerated
+}
+
+// Report summarizes what a scrub run verified and repaired
+type Report struct {
+	Scanned     int     `json:"scanned"`     // number of files hashed
+	Verified    int     `json:"verified"`    // files matching their recorded checksum
+	Recorded    int     `json:"recorded"`    // files without recorded checksum, their current checksum is recorded
+	Issues      []Issue `json:"issues"`      // corrupted and missing files
+	Regenerated int     `json:"regenerated"` // receipts whose files have been regenerated
+	Failed      int     `json:"failed"`      // files or receipts which could not be verified or repaired
+}
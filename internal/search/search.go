@@ -0,0 +1,271 @@
+package search
+
+import (
+	"fmt"
+	"math/big"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/search_query"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Service wraps a metadata store and keeps an inverted index of the annotations of every user who
+// searched. The index of a user is built from the store on the first search, afterwards it is
+// updated by every change written through the Service. Changes written to the store directly are
+// not indexed.
+type Service struct {
+	metadata.ServiceType
+	mu    sync.Mutex
+	users map[string]*userIndex // keyed by username
+}
+
+// userIndex is the index of the receipts of one user
+type userIndex struct {
+	docs      map[string]*document       // keyed by receiptId
+	tags      map[string]map[string]bool // receiptIds keyed by tag
+	words     map[string]map[string]bool // receiptIds keyed by word of the notes
+	merchants []merchantEntry            // ordered by merchant, then by receiptId
+}
+
+type document struct {
+	metadata *receipt_metadata.ReceiptMetadata
+	amount   *big.Rat // nil without amount
+}
+
+type merchantEntry struct {
+	merchant  string // lower case
+	receiptId string
+}
+
+// NewService creates a search index over store, all changes of metadata have to be written through it
+func NewService(store metadata.ServiceType) ServiceType {
+	return &Service{
+		ServiceType: store,
+		users:       make(map[string]*userIndex),
+	}
+}
+
+func (s *Service) Put(m *receipt_metadata.ReceiptMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	putErr := s.ServiceType.Put(m)
+	if putErr != nil {
+		return putErr
+	}
+	if index, ok := s.users[m.Username]; ok {
+		index.add(m.Clone())
+	}
+	return nil
+}
+
+func (s *Service) Update(
+	username, receiptId string,
+	update func(metadata *receipt_metadata.ReceiptMetadata) error,
+) (*receipt_metadata.ReceiptMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated, updateErr := s.ServiceType.Update(username, receiptId, update)
+	if updateErr != nil {
+		return nil, updateErr
+	}
+	if index, ok := s.users[username]; ok {
+		index.add(updated.Clone())
+	}
+	return updated, nil
+}
+
+func (s *Service) Delete(username, receiptId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleteErr := s.ServiceType.Delete(username, receiptId)
+	if deleteErr != nil {
+		return deleteErr
+	}
+	if index, ok := s.users[username]; ok {
+		index.remove(receiptId)
+	}
+	return nil
+}
+
+// Search returns the receipts of username matching query
+func (s *Service) Search(username string, query *search_query.Query) ([]receipt_metadata.ReceiptMetadata, error) {
+	logging.Debugf("search.Search(username: %s, query: %+v)", username, *query)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.users[username]
+	if !ok {
+		list, listErr := s.ServiceType.List(username)
+		if listErr != nil {
+			return nil, fmt.Errorf("metadata.List() failed, err: %w", listErr)
+		}
+		index = newUserIndex()
+		for i := range list {
+			index.add(&list[i])
+		}
+		s.users[username] = index
+	}
+
+	results := []receipt_metadata.ReceiptMetadata{}
+	for _, doc := range index.search(query) {
+		results = append(results, *doc.metadata.Clone())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].CreatedAt.Equal(results[j].CreatedAt) {
+			return results[i].ReceiptID < results[j].ReceiptID
+		}
+		return results[i].CreatedAt.Before(results[j].CreatedAt)
+	})
+	return results, nil
+}
+
+func newUserIndex() *userIndex {
+	return &userIndex{
+		docs:  make(map[string]*document),
+		tags:  make(map[string]map[string]bool),
+		words: make(map[string]map[string]bool),
+	}
+}
+
+// add indexes m, replacing the receipt if it is indexed already
+func (index *userIndex) add(m *receipt_metadata.ReceiptMetadata) {
+	index.remove(m.ReceiptID)
+
+	doc := &document{metadata: m}
+	if m.Annotations.Amount != nil {
+		doc.amount, _ = new(big.Rat).SetString(m.Annotations.Amount.Value)
+	}
+	index.docs[m.ReceiptID] = doc
+
+	for _, tag := range m.Annotations.Tags {
+		addPosting(index.tags, tag, m.ReceiptID)
+	}
+	for _, word := range search_query.SplitWords(m.Annotations.Notes) {
+		addPosting(index.words, word, m.ReceiptID)
+	}
+	if m.Annotations.Merchant != "" {
+		entry := merchantEntry{merchant: strings.ToLower(m.Annotations.Merchant), receiptId: m.ReceiptID}
+		i := sort.Search(len(index.merchants), func(i int) bool { return !index.merchants[i].less(entry) })
+		index.merchants = append(index.merchants, merchantEntry{})
+		copy(index.merchants[i+1:], index.merchants[i:])
+		index.merchants[i] = entry
+	}
+}
+
+// remove removes the receipt from the index, if it is indexed
+func (index *userIndex) remove(receiptId string) {
+	doc, ok := index.docs[receiptId]
+	if !ok {
+		return
+	}
+	delete(index.docs, receiptId)
+
+	for _, tag := range doc.metadata.Annotations.Tags {
+		removePosting(index.tags, tag, receiptId)
+	}
+	for _, word := range search_query.SplitWords(doc.metadata.Annotations.Notes) {
+		removePosting(index.words, word, receiptId)
+	}
+	if doc.metadata.Annotations.Merchant != "" {
+		entry := merchantEntry{merchant: strings.ToLower(doc.metadata.Annotations.Merchant), receiptId: receiptId}
+		i := sort.Search(len(index.merchants), func(i int) bool { return !index.merchants[i].less(entry) })
+		if i < len(index.merchants) && index.merchants[i] == entry {
+			index.merchants = append(index.merchants[:i], index.merchants[i+1:]...)
+		}
+	}
+}
+
+// search returns the documents matching query, unordered. Candidates are taken from the postings
+// of tags, words and merchants, the ranges are checked on each candidate.
+func (index *userIndex) search(query *search_query.Query) []*document {
+	var candidates map[string]bool // all documents if nil
+	for _, tag := range query.Tags {
+		candidates = intersect(candidates, index.tags[tag])
+	}
+	for _, word := range query.Words {
+		candidates = intersect(candidates, index.words[word])
+	}
+	if query.MerchantPrefix != "" {
+		matches := map[string]bool{}
+		start := sort.Search(len(index.merchants), func(i int) bool {
+			return index.merchants[i].merchant >= query.MerchantPrefix
+		})
+		for i := start; i < len(index.merchants) && strings.HasPrefix(index.merchants[i].merchant, query.MerchantPrefix); i++ {
+			matches[index.merchants[i].receiptId] = true
+		}
+		candidates = intersect(candidates, matches)
+	}
+
+	results := []*document{}
+	for receiptId, doc := range index.docs {
+		if candidates != nil && !candidates[receiptId] {
+			continue
+		}
+		if doc.matches(query) {
+			results = append(results, doc)
+		}
+	}
+	return results
+}
+
+// matches reports if the amount and the transaction date of doc are within the ranges of query
+func (doc *document) matches(query *search_query.Query) bool {
+	annotations := &doc.metadata.Annotations
+
+	if query.Currency != "" && (annotations.Amount == nil || annotations.Amount.Currency != query.Currency) {
+		return false
+	}
+	if query.MinAmount != nil && (doc.amount == nil || doc.amount.Cmp(query.MinAmount) < 0) {
+		return false
+	}
+	if query.MaxAmount != nil && (doc.amount == nil || doc.amount.Cmp(query.MaxAmount) > 0) {
+		return false
+	}
+	// dates are YYYY-MM-DD, their order is the order of the strings
+	if query.FromDate != "" && (annotations.TransactionDate == "" || annotations.TransactionDate < query.FromDate) {
+		return false
+	}
+	if query.ToDate != "" && (annotations.TransactionDate == "" || annotations.TransactionDate > query.ToDate) {
+		return false
+	}
+	return true
+}
+
+func (e merchantEntry) less(other merchantEntry) bool {
+	if e.merchant == other.merchant {
+		return e.receiptId < other.receiptId
+	}
+	return e.merchant < other.merchant
+}
+
+func addPosting(postings map[string]map[string]bool, key, receiptId string) {
+	if postings[key] == nil {
+		postings[key] = make(map[string]bool)
+	}
+	postings[key][receiptId] = true
+}
+
+func removePosting(postings map[string]map[string]bool, key, receiptId string) {
+	delete(postings[key], receiptId)
+	if len(postings[key]) == 0 {
+		delete(postings, key)
+	}
+}
+
+// intersect returns the receiptIds in both candidates and postings, candidates is all receipts if nil
+func intersect(candidates, postings map[string]bool) map[string]bool {
+	result := map[string]bool{}
+	for receiptId := range postings {
+		if candidates == nil || candidates[receiptId] {
+			result[receiptId] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/search_query"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	username := "test_user_search"
+	newReceipt := func(receiptId string, createdAt time.Time, annotations receipt_metadata.Annotations) *receipt_metadata.ReceiptMetadata {
+		return &receipt_metadata.ReceiptMetadata{
+			ReceiptID:   receiptId,
+			Username:    username,
+			CreatedAt:   createdAt,
+			Variants:    map[string]receipt_metadata.Variant{},
+			Annotations: annotations,
+		}
+	}
+	receiptIds := func(results []receipt_metadata.ReceiptMetadata) []string {
+		ids := []string{}
+		for _, m := range results {
+			ids = append(ids, m.ReceiptID)
+		}
+		return ids
+	}
+	search := func(t *testing.T, s ServiceType, username, q string) []string {
+		query, parseErr := search_query.ParseQuery(q)
+		assert.Nil(t, parseErr)
+		results, searchErr := s.Search(username, query)
+		assert.Nil(t, searchErr)
+		return receiptIds(results)
+	}
+
+	now := time.Now().UTC()
+	store := metadata.NewMemory()
+	// stored before the index exists, indexed on the first search
+	assert.Nil(t, store.Put(newReceipt("receipt1", now, receipt_metadata.Annotations{
+		Notes:           "Lunch with a client",
+		Tags:            []string{"travel", "work"},
+		Merchant:        "Cafe Aalto",
+		Amount:          &receipt_metadata.Amount{Value: "12.50", Currency: "EUR"},
+		TransactionDate: "2026-01-10",
+	})))
+	assert.Nil(t, store.Put(newReceipt("receipt2", now.Add(time.Second), receipt_metadata.Annotations{
+		Notes:           "Taxi to the client",
+		Tags:            []string{"travel"},
+		Merchant:        "Cab Company",
+		Amount:          &receipt_metadata.Amount{Value: "40", Currency: "USD"},
+		TransactionDate: "2026-02-01",
+	})))
+	assert.Nil(t, store.Put(newReceipt("receipt3", now.Add(2*time.Second), receipt_metadata.Annotations{})))
+
+	s := NewService(store)
+
+	t.Run("succeed, search all fields", func(t *testing.T) {
+		assert.Equal(t, []string{"receipt1", "receipt2", "receipt3"}, search(t, s, username, ""))
+		assert.Equal(t, []string{"receipt1", "receipt2"}, search(t, s, username, "tag:travel"))
+		assert.Equal(t, []string{"receipt1"}, search(t, s, username, "tag:travel tag:work"))
+		assert.Equal(t, []string{"receipt1", "receipt2"}, search(t, s, username, "merchant:ca"))
+		assert.Equal(t, []string{"receipt1"}, search(t, s, username, `merchant:"cafe a"`))
+		assert.Equal(t, []string{"receipt2"}, search(t, s, username, "currency:usd"))
+		assert.Equal(t, []string{"receipt1"}, search(t, s, username, "amount:..12.5"))
+		assert.Equal(t, []string{"receipt1", "receipt2"}, search(t, s, username, "amount:12.5..40"))
+		assert.Equal(t, []string{"receipt2"}, search(t, s, username, "date:2026-01-11.."))
+		assert.Equal(t, []string{"receipt1"}, search(t, s, username, "date:2026-01-10"))
+		assert.Equal(t, []string{"receipt1", "receipt2"}, search(t, s, username, "CLIENT"))
+		assert.Equal(t, []string{"receipt2"}, search(t, s, username, "client taxi"))
+		assert.Equal(t, []string{}, search(t, s, username, "tag:work taxi"))
+	})
+
+	t.Run("succeed, index follows changes", func(t *testing.T) {
+		assert.Nil(t, s.Put(newReceipt("receipt4", now.Add(3*time.Second), receipt_metadata.Annotations{
+			Notes: "Hotel",
+			Tags:  []string{"travel"},
+		})))
+		assert.Equal(t, []string{"receipt1", "receipt2", "receipt4"}, search(t, s, username, "tag:travel"))
+
+		_, updateErr := s.Update(username, "receipt1", func(m *receipt_metadata.ReceiptMetadata) error {
+			m.Annotations.Tags = []string{"food"}
+			m.Annotations.Merchant = "Bakery"
+			m.Annotations.Notes = "Breakfast"
+			return nil
+		})
+		assert.Nil(t, updateErr)
+		assert.Equal(t, []string{"receipt2", "receipt4"}, search(t, s, username, "tag:travel"))
+		assert.Equal(t, []string{"receipt1"}, search(t, s, username, "tag:food merchant:bak breakfast"))
+		assert.Equal(t, []string{"receipt2"}, search(t, s, username, "merchant:ca"))
+		assert.Equal(t, []string{"receipt2"}, search(t, s, username, "client"))
+
+		assert.Nil(t, s.Delete(username, "receipt2"))
+		assert.Equal(t, []string{"receipt4"}, search(t, s, username, "tag:travel"))
+		assert.Equal(t, []string{}, search(t, s, username, "merchant:ca"))
+	})
+
+	t.Run("succeed, scoped to the user", func(t *testing.T) {
+		other := newReceipt("receipt5", now, receipt_metadata.Annotations{Tags: []string{"travel"}})
+		other.Username = "test_user_other"
+		assert.Nil(t, s.Put(other))
+
+		assert.Equal(t, []string{"receipt4"}, search(t, s, username, "tag:travel"))
+		assert.Equal(t, []string{"receipt5"}, search(t, s, "test_user_other", "tag:travel"))
+	})
+
+	t.Run("should fail, failed updates are not indexed", func(t *testing.T) {
+		_, updateErr := s.Update(username, "receipt4", func(m *receipt_metadata.ReceiptMetadata) error {
+			m.Annotations.Tags = []string{"changed"}
+			return assert.AnError
+		})
+		assert.ErrorIs(t, updateErr, assert.AnError)
+		assert.Equal(t, []string{}, search(t, s, username, "tag:changed"))
+		assert.Equal(t, []string{"receipt4"}, search(t, s, username, "tag:travel"))
+	})
+}
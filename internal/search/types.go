@@ -0,0 +1,14 @@
+package search
+
+import (
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/search_query"
+)
+
+// ServiceType is a metadata store which keeps an inverted index of the annotations of receipts,
+// every change of metadata written through it updates the index
+type ServiceType interface {
+	metadata.ServiceType
+	Search(username string, query *search_query.Query) ([]receipt_metadata.ReceiptMetadata, error) // oldest receipt first
+}
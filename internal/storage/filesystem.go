@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"strings"
+	"time"
+)
+
+// FileSystem stores objects as files, each key is a path relative to root
+type FileSystem struct {
+	root string
+}
+
+func NewFileSystem(root string) ServiceType {
+	return &FileSystem{
+		root: root,
+	}
+}
+
+// Put writes the object atomically: data is written to a temp file in the same directory,
+// synced to disk and then renamed to its final path, followed by a sync of the directory.
+// A crash leaves either the previous object or the complete new one, never a truncated file.
+func (s *FileSystem) Put(key string, r io.Reader) error {
+	logging.Debugf("FileSystem.Put(key: %s)", key)
+
+	path := s.path(key)
+	dir := filepath.Dir(path)
+	mkErr := os.MkdirAll(dir, 0755)
+	if mkErr != nil {
+		return fmt.Errorf("os.MkdirAll() failed, err: %w", mkErr)
+	}
+
+	tempFile, createErr := os.CreateTemp(dir, constants.TEMP_FILE_PREFIX+filepath.Base(path)+"-*")
+	if createErr != nil {
+		return fmt.Errorf("os.CreateTemp() failed, err: %w", createErr)
+	}
+	tempPath := tempFile.Name()
+
+	writeErr := writeAndSync(tempFile, r)
+	if writeErr != nil {
+		os.Remove(tempPath)
+		return writeErr
+	}
+
+	chmodErr := os.Chmod(tempPath, 0644)
+	if chmodErr != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("os.Chmod() failed, err: %w", chmodErr)
+	}
+
+	renameErr := os.Rename(tempPath, path)
+	if renameErr != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("os.Rename() failed, err: %w", renameErr)
+	}
+
+	syncErr := syncDir(dir)
+	if syncErr != nil {
+		return fmt.Errorf("syncDir() failed, err: %w", syncErr)
+	}
+
+	return nil
+}
+
+func (s *FileSystem) Get(key string) (io.ReadCloser, error) {
+	logging.Debugf("FileSystem.Get(key: %s)", key)
+
+	file, openErr := os.Open(s.path(key))
+	if openErr != nil {
+		return nil, openErr
+	}
+	return file, nil
+}
+
+// GetRange implements RangeReader
+func (s *FileSystem) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	logging.Debugf("FileSystem.GetRange(key: %s, offset: %d, length: %d)", key, offset, length)
+
+	file, openErr := os.Open(s.path(key))
+	if openErr != nil {
+		return nil, openErr
+	}
+	return &rangeReader{Reader: io.NewSectionReader(file, offset, length), Closer: file}, nil
+}
+
+func (s *FileSystem) Stat(key string) (*ObjectInfo, error) {
+	info, statErr := os.Stat(s.path(key))
+	if statErr != nil {
+		return nil, statErr
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: key, Err: fs.ErrNotExist}
+	}
+
+	return &ObjectInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// SetModTime implements ModTimeSetter
+func (s *FileSystem) SetModTime(key string, modTime time.Time) error {
+	return os.Chtimes(s.path(key), modTime, modTime)
+}
+
+func (s *FileSystem) Delete(key string) error {
+	logging.Debugf("FileSystem.Delete(key: %s)", key)
+	return os.Remove(s.path(key))
+}
+
+// List returns all objects stored under prefix, prefix is treated as a directory
+func (s *FileSystem) List(prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	rootPath := s.path(prefix)
+
+	walkErr := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isTempFile(d.Name()) {
+			return nil
+		}
+		info, infoErr := d.Info()
+		if infoErr != nil {
+			return infoErr
+		}
+		rel, relErr := filepath.Rel(rootPath, path)
+		if relErr != nil {
+			return relErr
+		}
+		objects = append(objects, ObjectInfo{
+			Key:     filepath.Join(prefix, rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if walkErr != nil {
+		if errors.Is(walkErr, fs.ErrNotExist) {
+			return objects, nil
+		}
+		return nil, fmt.Errorf("filepath.WalkDir() failed, err: %w", walkErr)
+	}
+
+	return objects, nil
+}
+
+func (s *FileSystem) EnsureDir(dir string) error {
+	return os.MkdirAll(s.path(dir), 0755)
+}
+
+// SweepTempFiles removes temp files left behind by writes which were interrupted by a crash,
+// it returns the number of removed files
+func (s *FileSystem) SweepTempFiles(dir string) (int, error) {
+	removed := 0
+	walkErr := filepath.WalkDir(s.path(dir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isTempFile(d.Name()) {
+			return nil
+		}
+
+		logging.Infof("removing leftover temp file: %s", path)
+		removeErr := os.Remove(path)
+		if removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			return removeErr
+		}
+		removed++
+		return nil
+	})
+	if walkErr != nil && !errors.Is(walkErr, fs.ErrNotExist) {
+		return removed, fmt.Errorf("filepath.WalkDir() failed, err: %w", walkErr)
+	}
+
+	return removed, nil
+}
+
+func (s *FileSystem) path(key string) string {
+	return filepath.Join(s.root, key)
+}
+
+// rangeReader reads a part of an object and closes the object once it is closed
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+func writeAndSync(file *os.File, r io.Reader) error {
+	defer file.Close()
+
+	_, copyErr := io.Copy(file, r)
+	if copyErr != nil {
+		return fmt.Errorf("io.Copy() failed, err: %w", copyErr)
+	}
+
+	syncErr := file.Sync()
+	if syncErr != nil {
+		return fmt.Errorf("file.Sync() failed, err: %w", syncErr)
+	}
+
+	closeErr := file.Close()
+	if closeErr != nil {
+		return fmt.Errorf("file.Close() failed, err: %w", closeErr)
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, openErr := os.Open(dir)
+	if openErr != nil {
+		return openErr
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, constants.TEMP_FILE_PREFIX)
+}
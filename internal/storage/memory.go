@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps all objects in memory, it is meant for tests and local experiments
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() ServiceType {
+	return &Memory{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+func (s *Memory) Put(key string, r io.Reader) error {
+	data, readErr := io.ReadAll(r)
+	if readErr != nil {
+		return fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[filepath.Clean(key)] = memoryObject{
+		data:    data,
+		modTime: time.Now(),
+	}
+	return nil
+}
+
+func (s *Memory) Get(key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[filepath.Clean(key)]
+	if !ok {
+		return nil, &fs.PathError{Op: "get", Path: key, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// GetRange implements RangeReader
+func (s *Memory) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[filepath.Clean(key)]
+	if !ok {
+		return nil, &fs.PathError{Op: "get", Path: key, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(obj.data), offset, length)), nil
+}
+
+func (s *Memory) Stat(key string) (*ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[filepath.Clean(key)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: key, Err: fs.ErrNotExist}
+	}
+	return &ObjectInfo{
+		Key:     key,
+		Size:    int64(len(obj.data)),
+		ModTime: obj.modTime,
+	}, nil
+}
+
+// SetModTime implements ModTimeSetter
+func (s *Memory) SetModTime(key string, modTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cleanKey := filepath.Clean(key)
+	obj, ok := s.objects[cleanKey]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: key, Err: fs.ErrNotExist}
+	}
+	obj.modTime = modTime
+	s.objects[cleanKey] = obj
+	return nil
+}
+
+func (s *Memory) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cleanKey := filepath.Clean(key)
+	if _, ok := s.objects[cleanKey]; !ok {
+		return &fs.PathError{Op: "delete", Path: key, Err: fs.ErrNotExist}
+	}
+	delete(s.objects, cleanKey)
+	return nil
+}
+
+func (s *Memory) List(prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dirPrefix := filepath.Clean(prefix) + string(filepath.Separator)
+	if filepath.Clean(prefix) == "." {
+		dirPrefix = ""
+	}
+	objects := []ObjectInfo{}
+	for key, obj := range s.objects {
+		if !strings.HasPrefix(key, dirPrefix) {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Key:     key,
+			Size:    int64(len(obj.data)),
+			ModTime: obj.modTime,
+		})
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// EnsureDir is a no-op, directories do not exist in memory
+func (s *Memory) EnsureDir(dir string) error {
+	return nil
+}
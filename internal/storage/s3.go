@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm   = "AWS4-HMAC-SHA256"
+	s3Service     = "s3"
+	s3TimeFormat  = "20060102T150405Z"
+	s3DateFormat  = "20060102"
+	s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3 stores objects in a bucket of a S3-compatible object storage, keys are used as object keys
+// and every request is signed with AWS Signature Version 4. Path-style addressing is used,
+// i.e. {endpoint}/{bucket}/{key}, so that self-hosted S3-compatible servers work as well.
+type S3 struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func NewS3(c *configs.S3Config) ServiceType {
+	return &S3{
+		endpoint:  strings.TrimSuffix(c.Endpoint, "/"),
+		bucket:    c.Bucket,
+		region:    c.Region,
+		accessKey: c.AccessKey,
+		secretKey: c.SecretKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		now:       time.Now,
+	}
+}
+
+// Put uploads the object, the payload is read into memory because it has to be hashed for signing
+func (s *S3) Put(key string, r io.Reader) error {
+	logging.Debugf("S3.Put(key: %s)", key)
+
+	payload, readErr := io.ReadAll(r)
+	if readErr != nil {
+		return fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+
+	resp, doErr := s.do(http.MethodPut, key, nil, nil, payload)
+	if doErr != nil {
+		return doErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError("put", key, resp)
+	}
+	return nil
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	logging.Debugf("S3.Get(key: %s)", key)
+
+	resp, doErr := s.do(http.MethodGet, key, nil, nil, nil)
+	if doErr != nil {
+		return nil, doErr
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s.responseError("get", key, resp)
+	}
+	return resp.Body, nil
+}
+
+// GetRange implements RangeReader, only the requested bytes are transferred
+func (s *S3) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	logging.Debugf("S3.GetRange(key: %s, offset: %d, length: %d)", key, offset, length)
+
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, doErr := s.do(http.MethodGet, key, nil, header, nil)
+	if doErr != nil {
+		return nil, doErr
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// the server ignored the range and sends the whole object
+		_, skipErr := io.CopyN(io.Discard, resp.Body, offset)
+		if skipErr != nil && skipErr != io.EOF {
+			resp.Body.Close()
+			return nil, fmt.Errorf("io.CopyN() failed, err: %w", skipErr)
+		}
+		return &rangeReader{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the object is shorter than offset
+		resp.Body.Close()
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	default:
+		defer resp.Body.Close()
+		return nil, s.responseError("get", key, resp)
+	}
+}
+
+func (s *S3) Stat(key string) (*ObjectInfo, error) {
+	resp, doErr := s.do(http.MethodHead, key, nil, nil, nil)
+	if doErr != nil {
+		return nil, doErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.responseError("stat", key, resp)
+	}
+
+	size, sizeErr := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if sizeErr != nil {
+		return nil, fmt.Errorf("strconv.ParseInt() failed, err: %w", sizeErr)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return &ObjectInfo{
+		Key:     key,
+		Size:    size,
+		ModTime: modTime,
+	}, nil
+}
+
+// Delete removes the object, S3 does not report missing keys on DELETE so the key is checked first
+func (s *S3) Delete(key string) error {
+	logging.Debugf("S3.Delete(key: %s)", key)
+
+	_, statErr := s.Stat(key)
+	if statErr != nil {
+		return statErr
+	}
+
+	resp, doErr := s.do(http.MethodDelete, key, nil, nil, nil)
+	if doErr != nil {
+		return doErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s.responseError("delete", key, resp)
+	}
+	return nil
+}
+
+// List returns all objects stored under prefix with ListObjectsV2, following continuation tokens
+func (s *S3) List(prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	keyPrefix := filepath.ToSlash(filepath.Clean(prefix)) + "/"
+	if filepath.Clean(prefix) == "." {
+		keyPrefix = ""
+	}
+
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", keyPrefix)
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, doErr := s.do(http.MethodGet, "", query, nil, nil)
+		if doErr != nil {
+			return nil, doErr
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, s.responseError("list", prefix, resp)
+		}
+
+		var result s3ListResult
+		decodeErr := xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if decodeErr != nil {
+			return nil, fmt.Errorf("xml.Decode() failed, err: %w", decodeErr)
+		}
+
+		for _, c := range result.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:     filepath.FromSlash(c.Key),
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+// EnsureDir is a no-op, object storages have no directories
+func (s *S3) EnsureDir(dir string) error {
+	return nil
+}
+
+func (s *S3) do(method, key string, query url.Values, header http.Header, payload []byte) (*http.Response, error) {
+	objectPath := "/" + s.bucket
+	if key != "" {
+		objectPath += "/" + filepath.ToSlash(filepath.Clean(key))
+	}
+
+	reqUrl, parseErr := url.Parse(s.endpoint)
+	if parseErr != nil {
+		return nil, fmt.Errorf("url.Parse() failed, err: %w", parseErr)
+	}
+	reqUrl.Path = objectPath
+	reqUrl.RawPath = s3EncodePath(objectPath)
+	reqUrl.RawQuery = s3CanonicalQuery(query)
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, reqErr := http.NewRequest(method, reqUrl.String(), body)
+	if reqErr != nil {
+		return nil, fmt.Errorf("http.NewRequest() failed, err: %w", reqErr)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	signS3Request(req, payload, s.accessKey, s.secretKey, s.region, s.now())
+
+	resp, doErr := s.client.Do(req)
+	if doErr != nil {
+		return nil, fmt.Errorf("client.Do(method: %s, key: %s) failed, err: %w", method, key, doErr)
+	}
+	return resp, nil
+}
+
+func (s *S3) responseError(op, key string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s(key: %s) failed, status: %d, body: %s", op, key, resp.StatusCode, string(body))
+}
+
+// signS3Request adds the x-amz-date, x-amz-content-sha256 and Authorization headers to req
+func signS3Request(req *http.Request, payload []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format(s3TimeFormat)
+	payloadHash := s3EmptySHA256
+	if len(payload) > 0 {
+		payloadHash = sha256Hex(payload)
+	}
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders, signature := s3Signature(req, secretKey, region, amzDate, payloadHash)
+	scope := strings.Join([]string{amzDate[:8], region, s3Service, "aws4_request"}, "/")
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, accessKey, scope, signedHeaders, signature,
+	))
+}
+
+// s3Signature computes the SigV4 signature of req, it returns the signed header names and the signature
+func s3Signature(req *http.Request, secretKey, region, amzDate, payloadHash string) (string, string) {
+	headers := map[string]string{
+		"host":                 req.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if headers["host"] == "" {
+		headers["host"] = req.URL.Host
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EncodePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{amzDate[:8], region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), amzDate[:8])
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	return signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Encode(key, true)+"="+s3Encode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func s3EncodePath(path string) string {
+	return s3Encode(path, false)
+}
+
+// s3Encode percent-encodes every byte except the unreserved characters, "/" is kept unless encodeSlash is set
+func s3Encode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		isUnreserved := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~'
+		if isUnreserved || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
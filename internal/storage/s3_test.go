@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/models/configs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is an in-process S3-compatible server which verifies SigV4 signatures
+type fakeS3 struct {
+	mu        sync.Mutex
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pageSize  int
+	objects   map[string][]byte
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket:    bucket,
+		region:    "eu-north-1",
+		accessKey: "test-access-key",
+		secretKey: "test-secret-key",
+		pageSize:  2,
+		objects:   make(map[string][]byte),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	bucketPrefix := "/" + f.bucket
+	if !strings.HasPrefix(r.URL.Path, bucketPrefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, bucketPrefix), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		status := http.StatusOK
+		var first, last int
+		if _, scanErr := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &first, &last); scanErr == nil {
+			if first >= len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			data = data[first:min(last+1, len(data))]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	end := start + f.pageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	type content struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, content{Key: key, Size: int64(len(f.objects[key])), LastModified: time.Now().UTC()})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	amzDate := r.Header.Get("x-amz-date")
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if auth == "" || amzDate == "" || payloadHash == "" {
+		return false
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > 0 && sha256Hex(body) != payloadHash {
+		return false
+	}
+
+	_, signature := s3Signature(r, f.secretKey, f.region, amzDate, payloadHash)
+	credential := fmt.Sprintf("Credential=%s/%s/%s/s3/aws4_request", f.accessKey, amzDate[:8], f.region)
+	return strings.Contains(auth, credential) && strings.HasSuffix(auth, "Signature="+signature)
+}
+
+func newTestS3(t *testing.T) (ServiceType, *fakeS3) {
+	fake := newFakeS3("receipts-bucket")
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store := NewS3(&configs.S3Config{
+		Endpoint:  server.URL,
+		Bucket:    fake.bucket,
+		Region:    fake.region,
+		AccessKey: fake.accessKey,
+		SecretKey: fake.secretKey,
+	})
+	return store, fake
+}
+
+func TestS3(t *testing.T) {
+	store, fake := newTestS3(t)
+
+	t.Run("succeed, put and get", func(t *testing.T) {
+		key := filepath.Join("receipts", "uploads", "user1#123456.jpg")
+		data := []byte("original receipt")
+
+		putErr := store.Put(key, bytes.NewReader(data))
+		assert.Nil(t, putErr)
+		assert.Contains(t, fake.objects, "receipts/uploads/user1#123456.jpg")
+
+		reader, getErr := store.Get(key)
+		assert.Nil(t, getErr)
+		defer reader.Close()
+		readBytes, readErr := io.ReadAll(reader)
+		assert.Nil(t, readErr)
+		assert.Equal(t, data, readBytes)
+
+		info, statErr := store.Stat(key)
+		assert.Nil(t, statErr)
+		assert.Equal(t, int64(len(data)), info.Size)
+	})
+
+	t.Run("succeed, get range", func(t *testing.T) {
+		key := filepath.Join("receipts", "uploads", "user1#654321.jpg")
+		assert.Nil(t, store.Put(key, bytes.NewReader([]byte("original receipt"))))
+
+		reader, getErr := store.(RangeReader).GetRange(key, 9, 4)
+		assert.Nil(t, getErr)
+		defer reader.Close()
+		readBytes, readErr := io.ReadAll(reader)
+		assert.Nil(t, readErr)
+		assert.Equal(t, []byte("rece"), readBytes)
+
+		empty, emptyErr := store.(RangeReader).GetRange(key, 100, 4)
+		assert.Nil(t, emptyErr)
+		readBytes, readErr = io.ReadAll(empty)
+		assert.Nil(t, readErr)
+		assert.Empty(t, readBytes)
+
+		_, missingErr := store.(RangeReader).GetRange(filepath.Join("receipts", "uploads", "missing.jpg"), 0, 4)
+		assert.ErrorIs(t, missingErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, list resized variants with pagination", func(t *testing.T) {
+		userDir := filepath.Join("receipts", "resized", "user1")
+		for _, size := range []string{"", "_small", "_medium", "_large"} {
+			putErr := store.Put(filepath.Join(userDir, "123456"+size+".jpg"), bytes.NewReader([]byte(size)))
+			assert.Nil(t, putErr)
+		}
+		putErr := store.Put(filepath.Join("receipts", "resized", "user10", "654321.jpg"), bytes.NewReader([]byte("other")))
+		assert.Nil(t, putErr)
+
+		objects, listErr := store.List(userDir)
+		assert.Nil(t, listErr)
+		assert.Len(t, objects, 4)
+		for _, obj := range objects {
+			assert.True(t, strings.HasPrefix(obj.Key, userDir+string(filepath.Separator)))
+		}
+	})
+
+	t.Run("succeed, delete", func(t *testing.T) {
+		key := filepath.Join("receipts", "resized", "user1", "123456_small.jpg")
+
+		deleteErr := store.Delete(key)
+		assert.Nil(t, deleteErr)
+
+		_, getErr := store.Get(key)
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+	})
+
+	t.Run("should fail, non existing key", func(t *testing.T) {
+		key := filepath.Join("receipts", "uploads", "non-existing.jpg")
+
+		_, getErr := store.Get(key)
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+
+		_, statErr := store.Stat(key)
+		assert.ErrorIs(t, statErr, os.ErrNotExist)
+
+		deleteErr := store.Delete(key)
+		assert.ErrorIs(t, deleteErr, os.ErrNotExist)
+	})
+
+	t.Run("should fail, wrong secret key", func(t *testing.T) {
+		badStore := NewS3(&configs.S3Config{
+			Endpoint:  store.(*S3).endpoint,
+			Bucket:    fake.bucket,
+			Region:    fake.region,
+			AccessKey: fake.accessKey,
+			SecretKey: "wrong-secret-key",
+		})
+
+		putErr := badStore.Put(filepath.Join("receipts", "uploads", "user1#forbidden.jpg"), bytes.NewReader([]byte("x")))
+		assert.NotNil(t, putErr)
+		assert.Contains(t, putErr.Error(), "status: 403")
+	})
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Run("succeed, default to filesystem", func(t *testing.T) {
+		store, err := NewFromConfig(&configs.Config{})
+		assert.Nil(t, err)
+		assert.IsType(t, &FileSystem{}, store)
+	})
+
+	t.Run("succeed, s3", func(t *testing.T) {
+		store, err := NewFromConfig(&configs.Config{
+			StorageBackend: "s3",
+			S3:             configs.S3Config{Endpoint: "http://localhost:9000", Bucket: "receipts"},
+		})
+		assert.Nil(t, err)
+		assert.IsType(t, &S3{}, store)
+	})
+
+	t.Run("should fail, s3 without bucket", func(t *testing.T) {
+		_, err := NewFromConfig(&configs.Config{StorageBackend: "s3"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should fail, unknown backend", func(t *testing.T) {
+		_, err := NewFromConfig(&configs.Config{StorageBackend: "ftp"})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/models/configs"
+)
+
+// NewFromConfig creates the storage backend selected by config.StorageBackend,
+// filesystem is used when no backend is configured
+func NewFromConfig(config *configs.Config) (ServiceType, error) {
+	switch config.StorageBackend {
+	case "", constants.STORAGE_BACKEND_FILESYSTEM:
+		return NewFileSystem(""), nil
+	case constants.STORAGE_BACKEND_MEMORY:
+		return NewMemory(), nil
+	case constants.STORAGE_BACKEND_S3:
+		if config.S3.Endpoint == "" || config.S3.Bucket == "" {
+			return nil, fmt.Errorf("invalid s3 config, endpoint and bucket are required")
+		}
+		return NewS3(&config.S3), nil
+	default:
+		return nil, fmt.Errorf("invalid storage backend, backend=%s", config.StorageBackend)
+	}
+}
+
+// NewColdFromConfig creates the cold storage backend selected by config.Tiering.Backend,
+// nil is returned when tiering is disabled
+func NewColdFromConfig(config *configs.Config) (ServiceType, error) {
+	return newSecondary("cold storage", config.Tiering.Backend, config.Tiering.Dir, &config.Tiering.S3)
+}
+
+// NewReplicaFromConfig creates the replica backend selected by config.Replication.Backend,
+// nil is returned when replication is disabled
+func NewReplicaFromConfig(config *configs.Config) (ServiceType, error) {
+	return newSecondary("replica", config.Replication.Backend, config.Replication.Dir, &config.Replication.S3)
+}
+
+// newSecondary creates a storage backend next to the primary one, a filesystem backend
+// requires its own root dir
+func newSecondary(name, backend, dir string, s3Config *configs.S3Config) (ServiceType, error) {
+	switch backend {
+	case "":
+		return nil, nil
+	case constants.STORAGE_BACKEND_FILESYSTEM:
+		if dir == "" {
+			return nil, fmt.Errorf("invalid %s config, dir is required", name)
+		}
+		return NewFileSystem(dir), nil
+	case constants.STORAGE_BACKEND_MEMORY:
+		return NewMemory(), nil
+	case constants.STORAGE_BACKEND_S3:
+		if s3Config.Endpoint == "" || s3Config.Bucket == "" {
+			return nil, fmt.Errorf("invalid %s s3 config, endpoint and bucket are required", name)
+		}
+		return NewS3(s3Config), nil
+	default:
+		return nil, fmt.Errorf("invalid %s backend, backend=%s", name, backend)
+	}
+}
+
+// Move copies the object at srcKey to dstKey and then deletes srcKey
+func Move(s ServiceType, srcKey, dstKey string) error {
+	reader, getErr := s.Get(srcKey)
+	if getErr != nil {
+		return getErr
+	}
+	defer reader.Close()
+
+	putErr := s.Put(dstKey, reader)
+	if putErr != nil {
+		return fmt.Errorf("s.Put(key: %s) failed, err: %w", dstKey, putErr)
+	}
+	reader.Close()
+
+	deleteErr := s.Delete(srcKey)
+	if deleteErr != nil {
+		return fmt.Errorf("s.Delete(key: %s) failed, err: %w", srcKey, deleteErr)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package storage_mock
+
+import (
+	"errors"
+	"io"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/storage"
+	"strings"
+)
+
+// ServiceMock keeps objects in memory and fails writes to keys containing "mock_put_failed"
+type ServiceMock struct {
+	storage.ServiceType
+}
+
+func NewServiceMock() *ServiceMock {
+	return &ServiceMock{
+		ServiceType: storage.NewMemory(),
+	}
+}
+
+func (s *ServiceMock) Put(key string, r io.Reader) error {
+	logging.Debugf("storage_mock.Put(key: %s)", key)
+
+	if strings.Contains(key, "mock_put_failed") {
+		return errors.New("mock Put() failed")
+	}
+	return s.ServiceType.Put(key, r)
+}
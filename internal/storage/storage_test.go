@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStorages(baseDir string) map[string]ServiceType {
+	return map[string]ServiceType{
+		"filesystem": NewFileSystem(baseDir),
+		"memory":     NewMemory(),
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	baseDir := "test-storage-put-get"
+	defer os.RemoveAll(baseDir)
+
+	for name, store := range testStorages(baseDir) {
+		t.Run("succeed, "+name, func(t *testing.T) {
+			key := filepath.Join("uploads", "user1#123456.jpg")
+			data := []byte("receipt bytes")
+
+			putErr := store.Put(key, bytes.NewReader(data))
+			assert.Nil(t, putErr)
+
+			reader, getErr := store.Get(key)
+			assert.Nil(t, getErr)
+			defer reader.Close()
+
+			readBytes, readErr := io.ReadAll(reader)
+			assert.Nil(t, readErr)
+			assert.Equal(t, data, readBytes)
+
+			info, statErr := store.Stat(key)
+			assert.Nil(t, statErr)
+			assert.Equal(t, int64(len(data)), info.Size)
+			assert.Equal(t, key, info.Key)
+		})
+
+		t.Run("should fail, "+name+", non existing key", func(t *testing.T) {
+			_, getErr := store.Get(filepath.Join("uploads", "non-existing.jpg"))
+			assert.ErrorIs(t, getErr, os.ErrNotExist)
+			assert.True(t, os.IsNotExist(getErr))
+
+			_, statErr := store.Stat(filepath.Join("uploads", "non-existing.jpg"))
+			assert.ErrorIs(t, statErr, os.ErrNotExist)
+		})
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	baseDir := "test-storage-get-range"
+	defer os.RemoveAll(baseDir)
+
+	for name, store := range testStorages(baseDir) {
+		t.Run("succeed, "+name, func(t *testing.T) {
+			key := filepath.Join("uploads", "user1#123456.jpg")
+			assert.Nil(t, store.Put(key, bytes.NewReader([]byte("receipt bytes"))))
+
+			reader, getErr := store.(RangeReader).GetRange(key, 8, 10)
+			assert.Nil(t, getErr)
+			defer reader.Close()
+
+			readBytes, readErr := io.ReadAll(reader)
+			assert.Nil(t, readErr)
+			assert.Equal(t, []byte("bytes"), readBytes)
+		})
+
+		t.Run("should fail, "+name+", non existing key", func(t *testing.T) {
+			_, getErr := store.(RangeReader).GetRange(filepath.Join("uploads", "non-existing.jpg"), 0, 4)
+			assert.ErrorIs(t, getErr, os.ErrNotExist)
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	baseDir := "test-storage-delete"
+	defer os.RemoveAll(baseDir)
+
+	for name, store := range testStorages(baseDir) {
+		t.Run("succeed, "+name, func(t *testing.T) {
+			key := filepath.Join("resized", "user1", "123456_small.jpg")
+
+			putErr := store.Put(key, bytes.NewReader([]byte("small")))
+			assert.Nil(t, putErr)
+
+			deleteErr := store.Delete(key)
+			assert.Nil(t, deleteErr)
+
+			_, statErr := store.Stat(key)
+			assert.ErrorIs(t, statErr, os.ErrNotExist)
+		})
+
+		t.Run("should fail, "+name+", non existing key", func(t *testing.T) {
+			deleteErr := store.Delete(filepath.Join("resized", "user1", "non-existing.jpg"))
+			assert.ErrorIs(t, deleteErr, os.ErrNotExist)
+		})
+	}
+}
+
+func TestSetModTime(t *testing.T) {
+	baseDir := "test-storage-set-mod-time"
+	defer os.RemoveAll(baseDir)
+
+	for name, store := range testStorages(baseDir) {
+		setter, ok := store.(ModTimeSetter)
+		assert.True(t, ok)
+
+		t.Run("succeed, "+name, func(t *testing.T) {
+			key := filepath.Join("uploads", "user1#123456.jpg")
+			modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+			putErr := store.Put(key, bytes.NewReader([]byte("receipt")))
+			assert.Nil(t, putErr)
+			assert.Nil(t, setter.SetModTime(key, modTime))
+
+			info, statErr := store.Stat(key)
+			assert.Nil(t, statErr)
+			assert.True(t, modTime.Equal(info.ModTime))
+		})
+
+		t.Run("should fail, "+name+", non existing key", func(t *testing.T) {
+			setErr := setter.SetModTime(filepath.Join("uploads", "non-existing.jpg"), time.Now())
+			assert.ErrorIs(t, setErr, os.ErrNotExist)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	baseDir := "test-storage-list"
+	defer os.RemoveAll(baseDir)
+
+	for name, store := range testStorages(baseDir) {
+		t.Run("succeed, "+name, func(t *testing.T) {
+			keys := []string{
+				filepath.Join("resized", "user1", "123456.jpg"),
+				filepath.Join("resized", "user1", "123456_small.jpg"),
+				filepath.Join("resized", "user2", "654321.jpg"),
+				filepath.Join("uploads", "user1#123456.jpg"),
+			}
+			for _, key := range keys {
+				putErr := store.Put(key, bytes.NewReader([]byte(key)))
+				assert.Nil(t, putErr)
+			}
+
+			objects, listErr := store.List(filepath.Join("resized", "user1"))
+			assert.Nil(t, listErr)
+			assert.Len(t, objects, 2)
+			assert.ElementsMatch(t, keys[:2], []string{objects[0].Key, objects[1].Key})
+
+			objects, listErr = store.List("resized")
+			assert.Nil(t, listErr)
+			assert.Len(t, objects, 3)
+		})
+
+		t.Run("succeed, "+name+", non existing prefix", func(t *testing.T) {
+			objects, listErr := store.List("non-existing")
+			assert.Nil(t, listErr)
+			assert.Empty(t, objects)
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestFileSystemAtomicPut(t *testing.T) {
+	baseDir := "test-storage-atomic-put"
+	defer os.RemoveAll(baseDir)
+	store := NewFileSystem(baseDir)
+
+	t.Run("should fail, interrupted write keeps previous object", func(t *testing.T) {
+		key := filepath.Join("uploads", "user1#123456.jpg")
+		data := []byte("complete receipt")
+
+		putErr := store.Put(key, bytes.NewReader(data))
+		assert.Nil(t, putErr)
+
+		failedErr := store.Put(key, io.MultiReader(bytes.NewReader([]byte("trunc")), &failingReader{}))
+		assert.NotNil(t, failedErr)
+
+		fileBytes, readErr := os.ReadFile(filepath.Join(baseDir, key))
+		assert.Nil(t, readErr)
+		assert.Equal(t, data, fileBytes)
+
+		entries, dirErr := os.ReadDir(filepath.Join(baseDir, "uploads"))
+		assert.Nil(t, dirErr)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("succeed, sweep leftover temp files", func(t *testing.T) {
+		dir := filepath.Join(baseDir, "resized", "user1")
+		os.MkdirAll(dir, 0755)
+		tempPath := filepath.Join(dir, constants.TEMP_FILE_PREFIX+"123456_small.jpg-42")
+		writeErr := os.WriteFile(tempPath, []byte("trunc"), 0644)
+		assert.Nil(t, writeErr)
+
+		objects, listErr := store.List("resized")
+		assert.Nil(t, listErr)
+		assert.Empty(t, objects)
+
+		removed, sweepErr := store.(Sweeper).SweepTempFiles("resized")
+		assert.Nil(t, sweepErr)
+		assert.Equal(t, 1, removed)
+
+		_, statErr := os.Stat(tempPath)
+		assert.ErrorIs(t, statErr, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"io"
+	"time"
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key     string    `json:"key"`     // key of the object, e.g. receipts/uploads/user#id.jpg
+	Size    int64     `json:"size"`    // size of the object in bytes
+	ModTime time.Time `json:"modTime"` // last time the object was written
+	Tier    string    `json:"tier"`    // storage tier of the object, empty unless the storage is tiered
+}
+
+type ServiceType interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Stat(key string) (*ObjectInfo, error)
+	Delete(key string) error
+	List(prefix string) ([]ObjectInfo, error)
+	EnsureDir(dir string) error
+}
+
+// Sweeper is implemented by backends which can leave temp files behind after a crash
+type Sweeper interface {
+	SweepTempFiles(dir string) (int, error)
+}
+
+// ModTimeSetter is implemented by backends which can keep the modification time of an imported object
+type ModTimeSetter interface {
+	SetModTime(key string, modTime time.Time) error
+}
+
+// RangeReader is implemented by backends which can read a part of an object without reading all of it
+type RangeReader interface {
+	GetRange(key string, offset, length int64) (io.ReadCloser, error)
+}
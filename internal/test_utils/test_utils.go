@@ -2,6 +2,7 @@ package test_utils
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -59,6 +60,98 @@ func CreateTestImageWithFormat(filePath string, width, height int, format string
 	return jpeg.Encode(out, img, &opts)
 }
 
+// CreateTestImageWithExif creates a JPEG image with an EXIF block recording capturedAt, e.g.
+// "2024:05:01 10:30:00" and its offset "+02:00", model, orientation 6 and a GPS location
+func CreateTestImageWithExif(filePath string, width, height int, capturedAt, offset, model string) error {
+	createErr := CreateTestImageJPG(filePath, width, height)
+	if createErr != nil {
+		return createErr
+	}
+	data, readErr := os.ReadFile(filePath)
+	if readErr != nil {
+		return readErr
+	}
+
+	segment := append([]byte("Exif\x00\x00"), encodeTiff(capturedAt, offset, model)...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	withExif := append([]byte{}, data[:2]...)
+	withExif = append(withExif, app1...)
+	withExif = append(withExif, segment...)
+	withExif = append(withExif, data[2:]...)
+	return os.WriteFile(filePath, withExif, 0644)
+}
+
+// exifTag is an entry of an IFD written by encodeTiff
+type exifTag struct {
+	tag   uint16
+	kind  uint16
+	value []byte
+}
+
+func asciiTag(tag uint16, value string) exifTag {
+	return exifTag{tag: tag, kind: 2, value: append([]byte(value), 0)}
+}
+
+func longTag(tag uint16, value uint32) exifTag {
+	return exifTag{tag: tag, kind: 4, value: binary.BigEndian.AppendUint32(nil, value)}
+}
+
+// encodeTiff returns a big endian TIFF structure with IFD0, the Exif IFD and the GPS IFD
+func encodeTiff(capturedAt, offset, model string) []byte {
+	exifIFD := []exifTag{asciiTag(0x9003, capturedAt), asciiTag(0x9011, offset)}
+	gpsIFD := []exifTag{
+		{tag: 0x0001, kind: 2, value: []byte("N\x00")},
+		{tag: 0x0002, kind: 5, value: make([]byte, 24)},
+		{tag: 0x0003, kind: 2, value: []byte("E\x00")},
+		{tag: 0x0004, kind: 5, value: make([]byte, 24)},
+	}
+	ifd0 := []exifTag{
+		asciiTag(0x0110, model),
+		{tag: 0x0112, kind: 3, value: []byte{0, 6, 0, 0}},
+		longTag(0x8769, 0),
+		longTag(0x8825, 0),
+	}
+
+	ifd0Size := uint32(len(encodeIFD(0, ifd0)))
+	exifSize := uint32(len(encodeIFD(0, exifIFD)))
+	ifd0[2] = longTag(0x8769, 8+ifd0Size)
+	ifd0[3] = longTag(0x8825, 8+ifd0Size+exifSize)
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	tiff = append(tiff, encodeIFD(8, ifd0)...)
+	tiff = append(tiff, encodeIFD(8+ifd0Size, exifIFD)...)
+	return append(tiff, encodeIFD(8+ifd0Size+exifSize, gpsIFD)...)
+}
+
+// encodeIFD encodes an IFD starting at offset, values longer than 4 bytes follow the IFD
+func encodeIFD(offset uint32, tags []exifTag) []byte {
+	entries := binary.BigEndian.AppendUint16(nil, uint16(len(tags)))
+	values := []byte{}
+	valuesOffset := offset + 2 + uint32(len(tags))*12 + 4
+	for _, t := range tags {
+		count := uint32(len(t.value)) // ASCII
+		switch t.kind {
+		case 3, 4: // SHORT, LONG
+			count = 1
+		case 5: // RATIONAL
+			count = uint32(len(t.value) / 8)
+		}
+		entries = binary.BigEndian.AppendUint16(entries, t.tag)
+		entries = binary.BigEndian.AppendUint16(entries, t.kind)
+		entries = binary.BigEndian.AppendUint32(entries, count)
+		if len(t.value) <= 4 {
+			entries = append(entries, append(t.value, make([]byte, 4-len(t.value))...)...)
+			continue
+		}
+		entries = binary.BigEndian.AppendUint32(entries, valuesOffset+uint32(len(values)))
+		values = append(values, t.value...)
+	}
+	entries = binary.BigEndian.AppendUint32(entries, 0) // no next IFD
+	return append(entries, values...)
+}
+
 func GenerateUploadRequest(t *testing.T, url string, fileName, userToken string) (*http.Request, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -101,6 +194,20 @@ func InitTestServer(config *configs.Config) error {
 	return nil
 }
 
+// WaitForServer polls /health until the server started by utils.StartServer accepts requests
+func WaitForServer(t *testing.T, baseUrl string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(baseUrl + "/health")
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("server %s is not ready", baseUrl)
+}
+
 func GetFileSize(filePath string) (int64, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
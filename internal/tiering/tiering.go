@@ -0,0 +1,346 @@
+package tiering
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service wraps the hot storage and moves originals in config.UploadsDir older than
+// config.Tiering.Age to cold storage once their copy and all resized images exist. Cold originals
+// are listed and stated as if they were in config.UploadsDir, with tier "cold", and reading one
+// moves it back to hot storage first. The tier is recorded in the receipt record and its metadata.
+// Without cold storage all calls go to the hot storage.
+type Service struct {
+	storage.ServiceType
+	cold           storage.ServiceType
+	config         *configs.Config
+	recordsService records.ServiceType
+	metadata       metadata.ServiceType
+	interval       time.Duration
+	mu             sync.Mutex // serializes moving originals between tiers
+}
+
+func NewService(
+	config *configs.Config,
+	hot, cold storage.ServiceType,
+	recordsService records.ServiceType,
+	metadataService metadata.ServiceType,
+) ServiceType {
+	interval := config.Tiering.Interval
+	if interval <= 0 {
+		interval = constants.TIERING_INTERVAL
+	}
+
+	return &Service{
+		ServiceType:    hot,
+		cold:           cold,
+		config:         config,
+		recordsService: recordsService,
+		metadata:       metadataService,
+		interval:       interval,
+	}
+}
+
+// Get reads the object, a cold original is recalled to hot storage first
+func (s *Service) Get(key string) (io.ReadCloser, error) {
+	reader, getErr := s.ServiceType.Get(key)
+	if getErr == nil || !errors.Is(getErr, fs.ErrNotExist) || !s.tracked(key) {
+		return reader, getErr
+	}
+
+	recallErr := s.Recall(key)
+	if recallErr != nil {
+		return nil, recallErr
+	}
+	return s.ServiceType.Get(key)
+}
+
+// Stat falls back to cold storage for originals
+func (s *Service) Stat(key string) (*storage.ObjectInfo, error) {
+	info, statErr := s.ServiceType.Stat(key)
+	if statErr == nil || !errors.Is(statErr, fs.ErrNotExist) || !s.tracked(key) {
+		return info, statErr
+	}
+
+	coldInfo, coldErr := s.cold.Stat(key)
+	if coldErr != nil {
+		return nil, statErr
+	}
+	coldInfo.Tier = constants.TIER_COLD
+	return coldInfo, nil
+}
+
+// Delete removes an original from both tiers, an error wrapping fs.ErrNotExist is returned if
+// it is in neither of them
+func (s *Service) Delete(key string) error {
+	deleteErr := s.ServiceType.Delete(key)
+	if !s.tracked(key) {
+		return deleteErr
+	}
+	if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+		return deleteErr
+	}
+
+	coldErr := s.cold.Delete(key)
+	if coldErr != nil && !errors.Is(coldErr, fs.ErrNotExist) {
+		return fmt.Errorf("s.cold.Delete(key: %s) failed, err: %w", key, coldErr)
+	}
+	if deleteErr != nil && coldErr != nil {
+		return deleteErr
+	}
+	return nil
+}
+
+// List adds cold originals under prefix to the objects of the hot storage
+func (s *Service) List(prefix string) ([]storage.ObjectInfo, error) {
+	objects, listErr := s.ServiceType.List(prefix)
+	if listErr != nil || s.cold == nil {
+		return objects, listErr
+	}
+
+	coldObjects, coldErr := s.cold.List(prefix)
+	if coldErr != nil {
+		return nil, fmt.Errorf("s.cold.List(prefix: %s) failed, err: %w", prefix, coldErr)
+	}
+
+	hot := map[string]bool{}
+	for _, obj := range objects {
+		hot[obj.Key] = true
+	}
+	for _, obj := range coldObjects {
+		if hot[obj.Key] || !s.tracked(obj.Key) {
+			continue
+		}
+		obj.Tier = constants.TIER_COLD
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// SweepTempFiles implements storage.Sweeper if the hot storage does
+func (s *Service) SweepTempFiles(dir string) (int, error) {
+	sweeper, ok := s.ServiceType.(storage.Sweeper)
+	if !ok {
+		return 0, nil
+	}
+	return sweeper.SweepTempFiles(dir)
+}
+
+// SetModTime implements storage.ModTimeSetter if the hot storage does
+func (s *Service) SetModTime(key string, modTime time.Time) error {
+	setter, ok := s.ServiceType.(storage.ModTimeSetter)
+	if !ok {
+		return fmt.Errorf("storage does not support setting modification time, key=%s", key)
+	}
+	return setter.SetModTime(key, modTime)
+}
+
+func (s *Service) Recall(key string) error {
+	if !s.tracked(key) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, statErr := s.ServiceType.Stat(key)
+	if statErr == nil {
+		return nil
+	}
+
+	logging.Infof("recalling original from cold storage, path: %s", key)
+	moveErr := moveObject(s.cold, s.ServiceType, key)
+	if moveErr != nil {
+		return moveErr
+	}
+	s.recordTier(key, constants.TIER_HOT)
+	return nil
+}
+
+// Run moves originals older than config.Tiering.Age at now to cold storage, once their copy and all
+// resized images exist
+func (s *Service) Run(now time.Time) (*Report, error) {
+	logging.Infof("tiering.Run(now: %s)", now.Format(time.RFC3339))
+
+	report := &Report{
+		Migrations: []Migration{},
+	}
+	if s.cold == nil || s.config.Tiering.Age <= 0 {
+		return report, nil
+	}
+
+	originals, listErr := s.ServiceType.List(s.config.UploadsDir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.ServiceType.List(dir: %s) failed, err: %w", s.config.UploadsDir, listErr)
+	}
+
+	for _, obj := range originals {
+		report.Scanned++
+		if now.Sub(obj.ModTime) < s.config.Tiering.Age {
+			continue
+		}
+
+		imageMeta, parseErr := image_meta.FromUploadDir(obj.Key)
+		if parseErr != nil {
+			logging.Warnf("image_meta.FromUploadDir(path: %s) failed, err: %s", obj.Key, parseErr.Error())
+			continue
+		}
+		if !s.variantsExist(imageMeta) {
+			continue
+		}
+
+		migrateErr := s.migrate(obj.Key)
+		if migrateErr != nil {
+			logging.Errorf("s.migrate(path: %s) failed, err: %s", obj.Key, migrateErr.Error())
+			report.Failed++
+			continue
+		}
+		report.Migrations = append(report.Migrations, Migration{
+			Path:      obj.Key,
+			Username:  imageMeta.Username,
+			ReceiptID: imageMeta.ReceiptID,
+			Size:      obj.Size,
+		})
+		report.MovedBytes += obj.Size
+	}
+
+	logging.Infof(
+		"tiering completed, scanned: %d, migrated: %d, movedBytes: %d, failed: %d",
+		report.Scanned, len(report.Migrations), report.MovedBytes, report.Failed,
+	)
+	return report, nil
+}
+
+// Start moves old originals to cold storage every config.Tiering.Interval until stopChan is closed,
+// it returns immediately if tiering is disabled
+func (s *Service) Start(stopChan <-chan struct{}) {
+	if s.cold == nil || s.config.Tiering.Age <= 0 {
+		return
+	}
+	fmt.Println("starting tiering...")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			fmt.Println("Tiering stopped")
+			return
+		case <-ticker.C:
+			_, runErr := s.Run(time.Now().UTC())
+			if runErr != nil {
+				logging.Errorf("s.Run() failed, err: %s", runErr.Error())
+			}
+		}
+	}
+}
+
+// migrate moves an original from hot to cold storage
+func (s *Service) migrate(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	moveErr := moveObject(s.ServiceType, s.cold, key)
+	if moveErr != nil {
+		return moveErr
+	}
+	s.recordTier(key, constants.TIER_COLD)
+	return nil
+}
+
+// variantsExist tells if the copy and all resized images of an original are in hot storage
+func (s *Service) variantsExist(imageMeta *image_meta.ImageMeta) bool {
+	paths := image_meta.GetReceiptPaths(imageMeta, s.config.ResizedDir, &s.config.Dimensions)
+	for _, path := range paths[1:] {
+		_, statErr := s.ServiceType.Stat(path)
+		if statErr != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// recordTier updates the tier in the record and the metadata of an original, a failure is only logged
+func (s *Service) recordTier(key, tier string) {
+	imageMeta, parseErr := image_meta.FromUploadDir(key)
+	if parseErr != nil {
+		logging.Warnf("image_meta.FromUploadDir(path: %s) failed, err: %s", key, parseErr.Error())
+		return
+	}
+
+	record, getErr := s.recordsService.Get(imageMeta.Username, imageMeta.ReceiptID)
+	if getErr == nil {
+		record.Tier = tier
+		putErr := s.recordsService.Put(record)
+		if putErr != nil {
+			logging.Errorf("s.recordsService.Put(receiptId: %s) failed, err: %s", imageMeta.ReceiptID, putErr.Error())
+		}
+	} else if !errors.Is(getErr, fs.ErrNotExist) {
+		logging.Errorf("s.recordsService.Get(receiptId: %s) failed, err: %s", imageMeta.ReceiptID, getErr.Error())
+	}
+
+	_, updateErr := s.metadata.Update(imageMeta.Username, imageMeta.ReceiptID, func(m *receipt_metadata.ReceiptMetadata) error {
+		m.Tier = tier
+		m.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if updateErr != nil && !errors.Is(updateErr, fs.ErrNotExist) {
+		logging.Errorf("s.metadata.Update(receiptId: %s) failed, err: %s", imageMeta.ReceiptID, updateErr.Error())
+	}
+}
+
+// tracked tells if key is an original which can be in cold storage
+func (s *Service) tracked(key string) bool {
+	if s.cold == nil {
+		return false
+	}
+	return strings.HasPrefix(filepath.Clean(key), filepath.Clean(s.config.UploadsDir)+string(filepath.Separator))
+}
+
+// moveObject copies key from src to dst keeping its modification time, then deletes it from src
+func moveObject(src, dst storage.ServiceType, key string) error {
+	info, statErr := src.Stat(key)
+	if statErr != nil {
+		return statErr
+	}
+
+	reader, getErr := src.Get(key)
+	if getErr != nil {
+		return getErr
+	}
+	defer reader.Close()
+
+	putErr := dst.Put(key, reader)
+	if putErr != nil {
+		return fmt.Errorf("dst.Put(key: %s) failed, err: %w", key, putErr)
+	}
+	reader.Close()
+
+	if setter, ok := dst.(storage.ModTimeSetter); ok {
+		setErr := setter.SetModTime(key, info.ModTime)
+		if setErr != nil {
+			logging.Warnf("setter.SetModTime(key: %s) failed, err: %s", key, setErr.Error())
+		}
+	}
+
+	deleteErr := src.Delete(key)
+	if deleteErr != nil {
+		return fmt.Errorf("src.Delete(key: %s) failed, err: %w", key, deleteErr)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package tiering
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTiering(t *testing.T) {
+	day := 24 * time.Hour
+	config := &configs.Config{
+		UploadsDir: "uploads",
+		ResizedDir: "resized",
+		RecordsDir: "records",
+		Dimensions: configs.AllowedDimensions,
+		Tiering: configs.TieringConfig{
+			Age:     30 * day,
+			Backend: constants.STORAGE_BACKEND_MEMORY,
+		},
+	}
+
+	var metadataService metadata.ServiceType
+	newService := func() (ServiceType, storage.ServiceType, storage.ServiceType, records.ServiceType) {
+		hot := storage.NewMemory()
+		cold := storage.NewMemory()
+		recordsService := records.NewService(config.RecordsDir, hot)
+		metadataService = metadata.NewMemory()
+		return NewService(config, hot, cold, recordsService, metadataService), hot, cold, recordsService
+	}
+
+	// createReceipt stores the original and the first `variants` files of the copy and resized images
+	createReceipt := func(t *testing.T, service ServiceType, recordsService records.ServiceType, username, receiptId string, variants int) *image_meta.ImageMeta {
+		imageMeta := image_meta.FromReceiptID(username, receiptId, config.UploadsDir)
+		paths := image_meta.GetReceiptPaths(imageMeta, config.ResizedDir, &config.Dimensions)[:variants+1]
+		for _, path := range paths {
+			assert.Nil(t, service.Put(path, bytes.NewReader([]byte(path))))
+		}
+		assert.Nil(t, recordsService.Put(&receipt_record.ReceiptRecord{
+			ReceiptID: receiptId,
+			Username:  username,
+			Path:      imageMeta.Path,
+			Tier:      constants.TIER_HOT,
+		}))
+		assert.Nil(t, metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID: receiptId,
+			Username:  username,
+			Path:      imageMeta.Path,
+			Tier:      constants.TIER_HOT,
+		}))
+		return imageMeta
+	}
+
+	assertTier := func(t *testing.T, recordsService records.ServiceType, imageMeta *image_meta.ImageMeta, tier string) {
+		record, getErr := recordsService.Get(imageMeta.Username, imageMeta.ReceiptID)
+		assert.Nil(t, getErr)
+		assert.Equal(t, tier, record.Tier)
+
+		receiptMetadata, metadataErr := metadataService.Get(imageMeta.Username, imageMeta.ReceiptID)
+		assert.Nil(t, metadataErr)
+		assert.Equal(t, tier, receiptMetadata.Tier)
+	}
+
+	t.Run("succeed, move old originals with all variants only", func(t *testing.T) {
+		service, hot, cold, recordsService := newService()
+		complete := createReceipt(t, service, recordsService, "user1", "complete", len(config.Dimensions)+1)
+		partial := createReceipt(t, service, recordsService, "user1", "partial", 1)
+
+		recent, runErr := service.Run(time.Now().Add(day))
+		assert.Nil(t, runErr)
+		assert.Equal(t, 2, recent.Scanned)
+		assert.Empty(t, recent.Migrations)
+
+		report, runErr := service.Run(time.Now().Add(31 * day))
+		assert.Nil(t, runErr)
+		assert.Len(t, report.Migrations, 1)
+		assert.Equal(t, complete.Path, report.Migrations[0].Path)
+		assert.Equal(t, int64(len(complete.Path)), report.MovedBytes)
+
+		_, hotErr := hot.Stat(complete.Path)
+		assert.ErrorIs(t, hotErr, os.ErrNotExist)
+		_, coldErr := cold.Stat(complete.Path)
+		assert.Nil(t, coldErr)
+		_, partialErr := hot.Stat(partial.Path)
+		assert.Nil(t, partialErr)
+		assertTier(t, recordsService, complete, constants.TIER_COLD)
+		assertTier(t, recordsService, partial, constants.TIER_HOT)
+
+		info, statErr := service.Stat(complete.Path)
+		assert.Nil(t, statErr)
+		assert.Equal(t, constants.TIER_COLD, info.Tier)
+
+		objects, listErr := service.List(config.UploadsDir)
+		assert.Nil(t, listErr)
+		assert.Len(t, objects, 2)
+	})
+
+	t.Run("succeed, recall cold original on read", func(t *testing.T) {
+		service, hot, cold, recordsService := newService()
+		imageMeta := createReceipt(t, service, recordsService, "user1", "recall", len(config.Dimensions)+1)
+		_, runErr := service.Run(time.Now().Add(31 * day))
+		assert.Nil(t, runErr)
+
+		reader, getErr := service.Get(imageMeta.Path)
+		assert.Nil(t, getErr)
+		data, readErr := io.ReadAll(reader)
+		reader.Close()
+		assert.Nil(t, readErr)
+		assert.Equal(t, imageMeta.Path, string(data))
+
+		_, hotErr := hot.Stat(imageMeta.Path)
+		assert.Nil(t, hotErr)
+		_, coldErr := cold.Stat(imageMeta.Path)
+		assert.ErrorIs(t, coldErr, os.ErrNotExist)
+		assertTier(t, recordsService, imageMeta, constants.TIER_HOT)
+	})
+
+	t.Run("succeed, delete cold original", func(t *testing.T) {
+		service, _, cold, recordsService := newService()
+		imageMeta := createReceipt(t, service, recordsService, "user1", "delete", len(config.Dimensions)+1)
+		_, runErr := service.Run(time.Now().Add(31 * day))
+		assert.Nil(t, runErr)
+
+		deleteErr := service.Delete(imageMeta.Path)
+		assert.Nil(t, deleteErr)
+		_, coldErr := cold.Stat(imageMeta.Path)
+		assert.ErrorIs(t, coldErr, os.ErrNotExist)
+
+		deleteErr = service.Delete(imageMeta.Path)
+		assert.ErrorIs(t, deleteErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, nothing is moved without cold storage", func(t *testing.T) {
+		hot := storage.NewMemory()
+		recordsService := records.NewService(config.RecordsDir, hot)
+		service := NewService(config, hot, nil, recordsService, metadata.NewMemory())
+		imageMeta := createReceipt(t, service, recordsService, "user1", "nocold", len(config.Dimensions)+1)
+
+		report, runErr := service.Run(time.Now().Add(31 * day))
+		assert.Nil(t, runErr)
+		assert.Empty(t, report.Migrations)
+
+		_, statErr := hot.Stat(imageMeta.Path)
+		assert.Nil(t, statErr)
+	})
+
+	t.Run("should fail, get original in neither tier", func(t *testing.T) {
+		service, _, _, _ := newService()
+		_, getErr := service.Get("uploads/user1#notexist.jpg")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+	})
+}
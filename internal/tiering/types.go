@@ -0,0 +1,30 @@
+package tiering
+
+import (
+	"receipt_uploader/internal/storage"
+	"time"
+)
+
+// ServiceType is a storage which keeps old originals in cold storage and recalls them on demand
+type ServiceType interface {
+	storage.ServiceType
+	Recall(key string) error // moves an original back from cold storage, nothing is done if it is not cold
+	Run(now time.Time) (*Report, error)
+	Start(stopChan <-chan struct{})
+}
+
+// Migration is an original moved to cold storage
+type Migration struct {
+	Path      string `json:"path"`
+	Username  string `json:"username"`
+	ReceiptID string `json:"receiptId"`
+	Size      int64  `json:"size"`
+}
+
+// Report summarizes what a tiering run moved to cold storage
+type Report struct {
+	Scanned    int         `json:"scanned"`    // number of originals in config.UploadsDir
+	Migrations []Migration `json:"migrations"` // originals moved to cold storage
+	MovedBytes int64       `json:"movedBytes"` // total size of moved originals
+	Failed     int         `json:"failed"`     // originals which could not be moved
+}
@@ -0,0 +1,379 @@
+package trash
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/trash_entry"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+const entryFileName = "entry.json"
+
+// Service moves the files of deleted receipts into a per-user trash area:
+//
+//	{trashDir}/{username}/{receiptId}/entry.json
+//	{trashDir}/{username}/{receiptId}/{fileName}
+//
+// entry.json records where each file came from and when the receipt was deleted, it is written
+// before any file is moved so that an interrupted deletion can still be restored or purged.
+type Service struct {
+	config         *configs.Config
+	storage        storage.ServiceType
+	recordsService records.ServiceType
+	metadata       metadata.ServiceType
+	usage          quotas.UsageTracker
+	retention      time.Duration
+	purgeInterval  time.Duration
+	mu             sync.Mutex
+}
+
+func NewService(
+	config *configs.Config,
+	s storage.ServiceType,
+	recordsService records.ServiceType,
+	metadataService metadata.ServiceType,
+	u quotas.UsageTracker,
+) ServiceType {
+	retention := config.TrashRetention
+	if retention <= 0 {
+		retention = constants.TRASH_RETENTION
+	}
+	purgeInterval := config.TrashPurgeInterval
+	if purgeInterval <= 0 {
+		purgeInterval = constants.TRASH_PURGE_INTERVAL
+	}
+
+	return &Service{
+		config:         config,
+		storage:        s,
+		recordsService: recordsService,
+		metadata:       metadataService,
+		usage:          u,
+		retention:      retention,
+		purgeInterval:  purgeInterval,
+	}
+}
+
+// Trash moves the original, the copy and all variants of a receipt into the trash of its owner.
+// An error wrapping fs.ErrNotExist is returned if neither the original nor its copy exist.
+func (s *Service) Trash(imageMeta *image_meta.ImageMeta, resizedDir string) (*trash_entry.TrashEntry, error) {
+	logging.Debugf("trash.Trash(imageMeta.Path: %s, resizedDir: %s)", imageMeta.Path, resizedDir)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the same content has been uploaded and deleted before, the older copy is replaced
+	entryDir := s.entryDir(imageMeta.Username, imageMeta.ReceiptID)
+	older, olderErr := s.getEntry(filepath.Join(entryDir, entryFileName))
+	if olderErr == nil {
+		purgeErr := s.purgeEntry(older)
+		if purgeErr != nil {
+			return nil, fmt.Errorf("s.purgeEntry(older) failed, err: %w", purgeErr)
+		}
+	} else if !errors.Is(olderErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("s.getEntry(older) failed, err: %w", olderErr)
+	}
+
+	entry := trash_entry.TrashEntry{
+		ReceiptID: imageMeta.ReceiptID,
+		Username:  imageMeta.Username,
+		DeletedAt: time.Now().UTC(),
+		Files:     []trash_entry.TrashedFile{},
+	}
+
+	paths := image_meta.GetReceiptPaths(imageMeta, resizedDir, &s.config.Dimensions)
+	for _, path := range paths {
+		_, statErr := s.storage.Stat(path)
+		if statErr != nil {
+			if !errors.Is(statErr, fs.ErrNotExist) {
+				return nil, fmt.Errorf("s.storage.Stat(path: %s) failed, err: %w", path, statErr)
+			}
+			continue
+		}
+		entry.Files = append(entry.Files, trash_entry.TrashedFile{
+			OriginalPath: path,
+			TrashPath:    filepath.Join(entryDir, filepath.Base(path)),
+		})
+	}
+	if !hasOriginal(&entry, paths[:2]) {
+		return nil, &fs.PathError{Op: "trash", Path: imageMeta.Path, Err: fs.ErrNotExist}
+	}
+
+	record, recordErr := s.recordsService.Get(imageMeta.Username, imageMeta.ReceiptID)
+	if recordErr == nil {
+		entry.Record = record
+	} else if !errors.Is(recordErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("s.recordsService.Get() failed, err: %w", recordErr)
+	}
+
+	receiptMetadata, metadataErr := s.metadata.Get(imageMeta.Username, imageMeta.ReceiptID)
+	if metadataErr == nil {
+		entry.Metadata = receiptMetadata
+	} else if !errors.Is(metadataErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("s.metadata.Get() failed, err: %w", metadataErr)
+	}
+
+	putErr := s.putEntry(&entry)
+	if putErr != nil {
+		return nil, putErr
+	}
+
+	for _, file := range entry.Files {
+		moveErr := storage.Move(s.storage, file.OriginalPath, file.TrashPath)
+		if moveErr != nil {
+			return nil, fmt.Errorf("storage.Move(path: %s) failed, err: %w", file.OriginalPath, moveErr)
+		}
+	}
+
+	if entry.Record != nil {
+		deleteErr := s.recordsService.Delete(imageMeta.Username, imageMeta.ReceiptID)
+		if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+			return nil, fmt.Errorf("s.recordsService.Delete() failed, err: %w", deleteErr)
+		}
+	}
+
+	if entry.Metadata != nil {
+		deleteErr := s.metadata.Delete(imageMeta.Username, imageMeta.ReceiptID)
+		if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+			return nil, fmt.Errorf("s.metadata.Delete() failed, err: %w", deleteErr)
+		}
+	}
+
+	return &entry, nil
+}
+
+// Restore moves the files of a trashed receipt back to where they were and restores its record
+// and metadata.
+// An error wrapping fs.ErrNotExist is returned if the receipt is not in username's trash, one
+// wrapping ErrReceiptExists if the same content has been uploaded again.
+func (s *Service) Restore(username, receiptId string) (*trash_entry.TrashEntry, error) {
+	logging.Debugf("trash.Restore(username: %s, receiptId: %s)", username, receiptId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, getErr := s.getEntry(filepath.Join(s.entryDir(username, receiptId), entryFileName))
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	_, recordErr := s.recordsService.Get(username, receiptId)
+	if recordErr == nil {
+		return nil, fmt.Errorf("receiptId: %s, err: %w", receiptId, ErrReceiptExists)
+	}
+	if !errors.Is(recordErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("s.recordsService.Get() failed, err: %w", recordErr)
+	}
+
+	for _, file := range entry.Files {
+		moveErr := storage.Move(s.storage, file.TrashPath, file.OriginalPath)
+		if moveErr != nil && !errors.Is(moveErr, fs.ErrNotExist) {
+			return nil, fmt.Errorf("storage.Move(path: %s) failed, err: %w", file.TrashPath, moveErr)
+		}
+	}
+
+	if entry.Record != nil {
+		entry.Record.Tier = constants.TIER_HOT // a trashed original has been recalled from cold storage
+		putErr := s.recordsService.Put(entry.Record)
+		if putErr != nil {
+			return nil, fmt.Errorf("s.recordsService.Put() failed, err: %w", putErr)
+		}
+	}
+
+	if entry.Metadata != nil {
+		putErr := s.metadata.Put(entry.Metadata)
+		if putErr != nil {
+			return nil, fmt.Errorf("s.metadata.Put() failed, err: %w", putErr)
+		}
+	}
+
+	deleteErr := s.storage.Delete(filepath.Join(s.entryDir(username, receiptId), entryFileName))
+	if deleteErr != nil {
+		return nil, fmt.Errorf("s.storage.Delete(entry) failed, err: %w", deleteErr)
+	}
+
+	return entry, nil
+}
+
+// List returns the trashed receipts of username, most recently deleted first
+func (s *Service) List(username string) ([]trash_entry.TrashEntry, error) {
+	entries, listErr := s.listEntries(filepath.Join(s.config.TrashDir, username))
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+	return entries, nil
+}
+
+// Purge removes the trashed receipts of all users which were deleted longer than
+// the retention period before now, it returns the number of purged receipts
+func (s *Service) Purge(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, listErr := s.listEntries(s.config.TrashDir)
+	if listErr != nil {
+		return 0, listErr
+	}
+
+	purged := 0
+	for _, entry := range entries {
+		if now.Before(entry.PurgeAt(s.retention)) {
+			continue
+		}
+
+		purgeErr := s.purgeEntry(&entry)
+		if purgeErr != nil {
+			return purged, purgeErr
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// purgeEntry deletes the files of a trashed receipt and its entry and releases their usage.
+// s.mu must be held.
+func (s *Service) purgeEntry(entry *trash_entry.TrashEntry) error {
+	released := int64(0)
+	for _, file := range entry.Files {
+		info, statErr := s.storage.Stat(file.TrashPath)
+		deleteErr := s.storage.Delete(file.TrashPath)
+		if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+			return fmt.Errorf("s.storage.Delete(path: %s) failed, err: %w", file.TrashPath, deleteErr)
+		}
+		if statErr == nil && deleteErr == nil {
+			released += info.Size
+		}
+	}
+
+	entryPath := filepath.Join(s.entryDir(entry.Username, entry.ReceiptID), entryFileName)
+	deleteErr := s.storage.Delete(entryPath)
+	if deleteErr != nil && !errors.Is(deleteErr, fs.ErrNotExist) {
+		return fmt.Errorf("s.storage.Delete(path: %s) failed, err: %w", entryPath, deleteErr)
+	}
+
+	usageErr := s.usage.AddUsage(entry.Username, -released, -1)
+	if usageErr != nil {
+		logging.Errorf("s.usage.AddUsage(username: %s) failed, err: %s", entry.Username, usageErr.Error())
+	}
+
+	logging.Infof("purged trashed receipt, username: %s, receiptId: %s", entry.Username, entry.ReceiptID)
+	return nil
+}
+
+// Retention returns how long deleted receipts are kept in trash
+func (s *Service) Retention() time.Duration {
+	return s.retention
+}
+
+// Start purges expired receipts every purge interval until stopChan is closed
+func (s *Service) Start(stopChan <-chan struct{}) {
+	fmt.Println("starting trash purger...")
+
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			fmt.Println("Trash purger stopped")
+			return
+		case <-ticker.C:
+			purged, purgeErr := s.Purge(time.Now().UTC())
+			if purgeErr != nil {
+				logging.Errorf("s.Purge() failed, err: %s", purgeErr.Error())
+				continue
+			}
+			logging.Infof("purged %d trashed receipts", purged)
+		}
+	}
+}
+
+func (s *Service) entryDir(username, receiptId string) string {
+	return filepath.Join(s.config.TrashDir, username, receiptId)
+}
+
+func (s *Service) listEntries(dir string) ([]trash_entry.TrashEntry, error) {
+	objects, listErr := s.storage.List(dir)
+	if listErr != nil {
+		return nil, fmt.Errorf("s.storage.List() failed, err: %w", listErr)
+	}
+
+	entries := []trash_entry.TrashEntry{}
+	for _, obj := range objects {
+		if filepath.Base(obj.Key) != entryFileName {
+			continue
+		}
+		entry, getErr := s.getEntry(obj.Key)
+		if getErr != nil {
+			return nil, getErr
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func (s *Service) putEntry(entry *trash_entry.TrashEntry) error {
+	data, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return fmt.Errorf("json.Marshal() failed, err: %w", marshalErr)
+	}
+
+	key := filepath.Join(s.entryDir(entry.Username, entry.ReceiptID), entryFileName)
+	putErr := s.storage.Put(key, bytes.NewReader(data))
+	if putErr != nil {
+		return fmt.Errorf("s.storage.Put(key: %s) failed, err: %w", key, putErr)
+	}
+	return nil
+}
+
+func (s *Service) getEntry(key string) (*trash_entry.TrashEntry, error) {
+	reader, getErr := s.storage.Get(key)
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer reader.Close()
+
+	data, readErr := io.ReadAll(reader)
+	if readErr != nil {
+		return nil, fmt.Errorf("io.ReadAll() failed, err: %w", readErr)
+	}
+
+	var entry trash_entry.TrashEntry
+	unmarshalErr := json.Unmarshal(data, &entry)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("json.Unmarshal(key: %s) failed, err: %w", key, unmarshalErr)
+	}
+	return &entry, nil
+}
+
+// hasOriginal returns true if the original upload or its copy is part of the entry
+func hasOriginal(entry *trash_entry.TrashEntry, originalPaths []string) bool {
+	for _, file := range entry.Files {
+		for _, path := range originalPaths {
+			if file.OriginalPath == path {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package trash_mock
+
+import (
+	"errors"
+	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/trash_entry"
+	"time"
+)
+
+type ServiceMock struct{}
+
+func (s *ServiceMock) Trash(imageMeta *image_meta.ImageMeta, resizedDir string) (*trash_entry.TrashEntry, error) {
+	logging.Debugf("trash_mock.Trash(receiptId: %s)", imageMeta.ReceiptID)
+	if imageMeta.ReceiptID == "mocktrashfailed" {
+		return nil, errors.New("mock Trash() failed")
+	}
+	return &trash_entry.TrashEntry{ReceiptID: imageMeta.ReceiptID, Username: imageMeta.Username}, nil
+}
+
+func (s *ServiceMock) Restore(username, receiptId string) (*trash_entry.TrashEntry, error) {
+	logging.Debugf("trash_mock.Restore(receiptId: %s)", receiptId)
+	if receiptId == "mockrestorefailed" {
+		return nil, errors.New("mock Restore() failed")
+	}
+	return &trash_entry.TrashEntry{ReceiptID: receiptId, Username: username}, nil
+}
+
+func (s *ServiceMock) List(username string) ([]trash_entry.TrashEntry, error) {
+	logging.Debugf("trash_mock.List(username: %s)", username)
+	if username == "mock_list_failed" {
+		return nil, errors.New("mock List() failed")
+	}
+	return []trash_entry.TrashEntry{}, nil
+}
+
+func (s *ServiceMock) Purge(now time.Time) (int, error) {
+	logging.Debugf("trash_mock.Purge()")
+	return 0, nil
+}
+
+func (s *ServiceMock) Retention() time.Duration {
+	return time.Hour
+}
+
+func (s *ServiceMock) Start(stopChan <-chan struct{}) {
+	logging.Debugf("trash_mock.Start()")
+}
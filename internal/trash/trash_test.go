@@ -0,0 +1,168 @@
+package trash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"receipt_uploader/internal/metadata"
+	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/receipt_metadata"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	config := &configs.Config{
+		UploadsDir:     "uploads",
+		ResizedDir:     "resized",
+		RecordsDir:     "records",
+		TrashDir:       "trash",
+		Dimensions:     configs.AllowedDimensions,
+		TrashRetention: 24 * time.Hour,
+	}
+	store := storage.NewMemory()
+	recordsService := records.NewService("records", store)
+	quotasService := quotas.NewService(config, store)
+	metadataService := metadata.NewMemory()
+	service := NewService(config, store, recordsService, metadataService, quotasService)
+
+	createReceipt := func(t *testing.T, username, receiptId string) []string {
+		imageMeta := image_meta.FromReceiptID(username, receiptId, config.UploadsDir)
+		paths := image_meta.GetReceiptPaths(imageMeta, config.ResizedDir, &config.Dimensions)
+		for _, path := range paths {
+			putErr := store.Put(path, bytes.NewReader([]byte(path)))
+			assert.Nil(t, putErr)
+		}
+		putErr := recordsService.Put(&receipt_record.ReceiptRecord{
+			ReceiptID:   receiptId,
+			Username:    username,
+			ContentHash: "hash" + receiptId,
+		})
+		assert.Nil(t, putErr)
+		putErr = metadataService.Put(&receipt_metadata.ReceiptMetadata{
+			ReceiptID: receiptId,
+			Username:  username,
+			Path:      imageMeta.Path,
+			Variants:  map[string]receipt_metadata.Variant{},
+		})
+		assert.Nil(t, putErr)
+		return paths
+	}
+
+	t.Run("succeed, trash and restore", func(t *testing.T) {
+		paths := createReceipt(t, "user1", "123456")
+		imageMeta := image_meta.FromReceiptID("user1", "123456", config.UploadsDir)
+
+		entry, trashErr := service.Trash(imageMeta, config.ResizedDir)
+		assert.Nil(t, trashErr)
+		assert.Len(t, entry.Files, len(paths))
+		assert.NotNil(t, entry.Record)
+
+		for _, path := range paths {
+			_, statErr := store.Stat(path)
+			assert.ErrorIs(t, statErr, os.ErrNotExist)
+		}
+		_, findErr := recordsService.FindByHash("user1", "hash123456")
+		assert.ErrorIs(t, findErr, os.ErrNotExist)
+		_, getErr := metadataService.Get("user1", "123456")
+		assert.ErrorIs(t, getErr, os.ErrNotExist)
+
+		list, listErr := service.List("user1")
+		assert.Nil(t, listErr)
+		assert.Len(t, list, 1)
+		assert.Equal(t, "123456", list[0].ReceiptID)
+
+		restored, restoreErr := service.Restore("user1", "123456")
+		assert.Nil(t, restoreErr)
+		assert.Equal(t, "123456", restored.ReceiptID)
+
+		for _, path := range paths {
+			_, statErr := store.Stat(path)
+			assert.Nil(t, statErr)
+		}
+		_, findErr = recordsService.FindByHash("user1", "hash123456")
+		assert.Nil(t, findErr)
+		_, getErr = metadataService.Get("user1", "123456")
+		assert.Nil(t, getErr)
+
+		list, listErr = service.List("user1")
+		assert.Nil(t, listErr)
+		assert.Empty(t, list)
+	})
+
+	t.Run("should fail, trash receipt of another user", func(t *testing.T) {
+		createReceipt(t, "user2", "654321")
+		imageMeta := image_meta.FromReceiptID("user3", "654321", config.UploadsDir)
+
+		_, trashErr := service.Trash(imageMeta, config.ResizedDir)
+		assert.ErrorIs(t, trashErr, os.ErrNotExist)
+	})
+
+	t.Run("should fail, restore receipt not in trash", func(t *testing.T) {
+		_, restoreErr := service.Restore("user1", "notintrash")
+		assert.ErrorIs(t, restoreErr, os.ErrNotExist)
+	})
+
+	t.Run("succeed, purge expired receipts only", func(t *testing.T) {
+		expiredPaths := createReceipt(t, "user4", "expired")
+		createReceipt(t, "user4", "recent")
+		assert.Nil(t, quotasService.AddUsage("user4", 10000, 2))
+
+		_, trashErr := service.Trash(image_meta.FromReceiptID("user4", "expired", config.UploadsDir), config.ResizedDir)
+		assert.Nil(t, trashErr)
+		time.Sleep(time.Millisecond)
+		now := time.Now().UTC()
+		time.Sleep(time.Millisecond)
+		_, trashErr = service.Trash(image_meta.FromReceiptID("user4", "recent", config.UploadsDir), config.ResizedDir)
+		assert.Nil(t, trashErr)
+
+		purged, purgeErr := service.Purge(now.Add(config.TrashRetention))
+		assert.Nil(t, purgeErr)
+		assert.Equal(t, 1, purged)
+
+		list, listErr := service.List("user4")
+		assert.Nil(t, listErr)
+		assert.Len(t, list, 1)
+		assert.Equal(t, "recent", list[0].ReceiptID)
+
+		objects, objectsErr := store.List(filepath.Join(config.TrashDir, "user4", "expired"))
+		assert.Nil(t, objectsErr)
+		assert.Empty(t, objects)
+
+		released := int64(0)
+		for _, path := range expiredPaths {
+			released += int64(len(path))
+		}
+		current, usageErr := quotasService.GetUsage("user4")
+		assert.Nil(t, usageErr)
+		assert.Equal(t, 10000-released, current.Bytes)
+		assert.Equal(t, 1, current.Receipts)
+	})
+
+	t.Run("succeed, trashing the same receipt again replaces the older one", func(t *testing.T) {
+		imageMeta := image_meta.FromReceiptID("user5", "777777", config.UploadsDir)
+		createReceipt(t, "user5", "777777")
+		_, trashErr := service.Trash(imageMeta, config.ResizedDir)
+		assert.Nil(t, trashErr)
+
+		// receiptIds are derived from the content, uploading it again creates the same receipt
+		createReceipt(t, "user5", "777777")
+		_, restoreErr := service.Restore("user5", "777777")
+		assert.ErrorIs(t, restoreErr, ErrReceiptExists)
+
+		entry, trashErr := service.Trash(imageMeta, config.ResizedDir)
+		assert.Nil(t, trashErr)
+
+		list, listErr := service.List("user5")
+		assert.Nil(t, listErr)
+		assert.Len(t, list, 1)
+		assert.Equal(t, entry.DeletedAt, list[0].DeletedAt)
+	})
+}
@@ -0,0 +1,21 @@
+package trash
+
+import (
+	"errors"
+	"receipt_uploader/internal/models/image_meta"
+	"receipt_uploader/internal/models/trash_entry"
+	"time"
+)
+
+// ErrReceiptExists is wrapped by errors of restoring a receipt which has been uploaded again after it
+// was deleted, receiptIds are derived from the content of receipts
+var ErrReceiptExists = errors.New("receipt has been uploaded again")
+
+type ServiceType interface {
+	Trash(imageMeta *image_meta.ImageMeta, resizedDir string) (*trash_entry.TrashEntry, error)
+	Restore(username, receiptId string) (*trash_entry.TrashEntry, error)
+	List(username string) ([]trash_entry.TrashEntry, error)
+	Purge(now time.Time) (int, error)
+	Retention() time.Duration
+	Start(stopChan <-chan struct{})
+}
@@ -2,18 +2,40 @@ package utils
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"receipt_uploader/internal/audit"
+	"receipt_uploader/internal/checksums"
+	"receipt_uploader/internal/collections"
 	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/encryption"
+	"receipt_uploader/internal/exports"
+	"receipt_uploader/internal/gc"
 	"receipt_uploader/internal/handlers"
 	"receipt_uploader/internal/images"
+	"receipt_uploader/internal/imports"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/middlewares"
 	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/import_report"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/reconciler"
+	"receipt_uploader/internal/records"
+	"receipt_uploader/internal/replication"
 	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/scrubber"
+	"receipt_uploader/internal/search"
+	"receipt_uploader/internal/storage"
+	"receipt_uploader/internal/tiering"
+	"receipt_uploader/internal/trash"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -35,18 +57,392 @@ func LoadConfig() (*configs.Config, error) {
 		return nil, capErr
 	}
 
+	resizeWorkers, workersErr := getEnvInt("RESIZE_WORKERS", resize_queue.DefaultWorkers())
+	if workersErr != nil {
+		return nil, workersErr
+	}
+
+	reconcileRate, rateErr := getEnvInt("RECONCILE_RATE", constants.RECONCILE_RATE)
+	if rateErr != nil {
+		return nil, rateErr
+	}
+
+	trashRetention, retentionErr := getEnvDuration("TRASH_RETENTION", constants.TRASH_RETENTION)
+	if retentionErr != nil {
+		return nil, retentionErr
+	}
+
+	trashPurgeInterval, intervalErr := getEnvDuration("TRASH_PURGE_INTERVAL", constants.TRASH_PURGE_INTERVAL)
+	if intervalErr != nil {
+		return nil, intervalErr
+	}
+
+	quotaMaxBytes, bytesErr := getEnvInt64("QUOTA_MAX_BYTES", constants.QUOTA_MAX_BYTES)
+	if bytesErr != nil {
+		return nil, bytesErr
+	}
+
+	quotaMaxReceipts, receiptsErr := getEnvInt("QUOTA_MAX_RECEIPTS", constants.QUOTA_MAX_RECEIPTS)
+	if receiptsErr != nil {
+		return nil, receiptsErr
+	}
+
+	quotaOverrides, overridesErr := loadQuotaOverrides(os.Getenv("QUOTA_OVERRIDES_FILE"))
+	if overridesErr != nil {
+		return nil, overridesErr
+	}
+
+	retention, retentionPolicyErr := loadRetentionPolicy()
+	if retentionPolicyErr != nil {
+		return nil, retentionPolicyErr
+	}
+
+	retentionOverrides, retentionOverridesErr := loadRetentionOverrides(os.Getenv("RETENTION_OVERRIDES_FILE"))
+	if retentionOverridesErr != nil {
+		return nil, retentionOverridesErr
+	}
+
+	gcInterval, gcIntervalErr := getEnvDuration("GC_INTERVAL", constants.GC_INTERVAL)
+	if gcIntervalErr != nil {
+		return nil, gcIntervalErr
+	}
+
+	gcDryRun, dryRunErr := getEnvBool("GC_DRY_RUN", false)
+	if dryRunErr != nil {
+		return nil, dryRunErr
+	}
+
+	scrubInterval, scrubIntervalErr := getEnvDuration("SCRUB_INTERVAL", constants.SCRUB_INTERVAL)
+	if scrubIntervalErr != nil {
+		return nil, scrubIntervalErr
+	}
+
+	tieringConfig, tieringErr := loadTieringConfig()
+	if tieringErr != nil {
+		return nil, tieringErr
+	}
+
+	replicationConfig, replicationErr := loadReplicationConfig()
+	if replicationErr != nil {
+		return nil, replicationErr
+	}
+
+	encryptionConfig, encryptionErr := loadEncryptionConfig()
+	if encryptionErr != nil {
+		return nil, encryptionErr
+	}
+
 	config := &configs.Config{
-		Port:          os.Getenv("PORT"),
-		ResizedDir:    filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_RESIZED")),
-		UploadsDir:    filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_UPLOADS")),
-		Dimensions:    configs.AllowedDimensions,
-		Mode:          os.Getenv("MODE"),
-		QueueCapacity: capacity,
+		Port:               os.Getenv("PORT"),
+		ResizedDir:         filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_RESIZED")),
+		UploadsDir:         filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_UPLOADS")),
+		RecordsDir:         filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_RECORDS")),
+		TrashDir:           filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_TRASH")),
+		CollectionsDir:     filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_COLLECTIONS")),
+		Dimensions:         configs.AllowedDimensions,
+		Mode:               os.Getenv("MODE"),
+		QueueCapacity:      capacity,
+		ResizeWorkers:      resizeWorkers,
+		ReconcileRate:      reconcileRate,
+		StorageBackend:     os.Getenv("STORAGE_BACKEND"),
+		TrashRetention:     trashRetention,
+		TrashPurgeInterval: trashPurgeInterval,
+		S3: configs.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		},
+		Quota: configs.Quota{
+			MaxBytes:    quotaMaxBytes,
+			MaxReceipts: quotaMaxReceipts,
+		},
+		QuotaOverrides:     quotaOverrides,
+		Retention:          *retention,
+		RetentionOverrides: retentionOverrides,
+		GCInterval:         gcInterval,
+		GCDryRun:           gcDryRun,
+		ScrubInterval:      scrubInterval,
+		Tiering:            *tieringConfig,
+		Replication:        *replicationConfig,
+		Encryption:         *encryptionConfig,
+	}
+
+	if os.Getenv("METADATA_FILE") != "" {
+		config.MetadataFile = filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("METADATA_FILE"))
+	}
+
+	if os.Getenv("AUDIT_FILE") != "" {
+		config.AuditFile = filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("AUDIT_FILE"))
+	}
+
+	if os.Getenv("DIR_QUEUE") != "" {
+		config.QueueDir = filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_QUEUE"))
+	}
+
+	for _, admin := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			config.AdminUsers = append(config.AdminUsers, admin)
+		}
+	}
+
+	if os.Getenv("DIR_CHECKSUMS") != "" {
+		config.ChecksumsDir = filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_CHECKSUMS"))
 	}
 
 	return config, nil
 }
 
+// getEnvInt returns the integer value of env variable key, or defaultValue if it is not set
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// getEnvInt64 returns the int64 value of env variable key, or defaultValue if it is not set
+func getEnvInt64(key string, defaultValue int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// loadQuotaOverrides reads per user quotas from a JSON file, e.g. {"user1": {"maxBytes": 1048576, "maxReceipts": 10}}
+func loadQuotaOverrides(path string) (map[string]configs.Quota, error) {
+	overrides := map[string]configs.Quota{}
+	if path == "" {
+		return overrides, nil
+	}
+
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, fmt.Errorf("os.ReadFile() failed, err: %w", readErr)
+	}
+	unmarshalErr := json.Unmarshal(data, &overrides)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("json.Unmarshal() failed, err: %w", unmarshalErr)
+	}
+	return overrides, nil
+}
+
+// getEnvBool returns the boolean value of env variable key, e.g. "true", or defaultValue if it is not set
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// loadRetentionPolicy reads the default retention policy, durations are e.g. "87600h", empty means forever
+func loadRetentionPolicy() (*configs.RetentionPolicy, error) {
+	originals, originalsErr := getEnvDuration("RETENTION_ORIGINALS", 0)
+	if originalsErr != nil {
+		return nil, originalsErr
+	}
+
+	variants, variantsErr := getEnvDuration("RETENTION_VARIANTS", 0)
+	if variantsErr != nil {
+		return nil, variantsErr
+	}
+
+	dropOriginals, dropErr := getEnvBool("RETENTION_DROP_ORIGINALS", false)
+	if dropErr != nil {
+		return nil, dropErr
+	}
+
+	return &configs.RetentionPolicy{
+		Originals:                 originals,
+		Variants:                  variants,
+		DropOriginalsWithVariants: dropOriginals,
+	}, nil
+}
+
+// loadRetentionOverrides reads per user retention policies from a JSON file,
+// e.g. {"user1": {"originals": "8760h", "variants": "87600h", "dropOriginalsWithVariants": true}}
+func loadRetentionOverrides(path string) (map[string]configs.RetentionPolicy, error) {
+	overrides := map[string]configs.RetentionPolicy{}
+	if path == "" {
+		return overrides, nil
+	}
+
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, fmt.Errorf("os.ReadFile() failed, err: %w", readErr)
+	}
+
+	var policies map[string]struct {
+		Originals                 string `json:"originals"`
+		Variants                  string `json:"variants"`
+		DropOriginalsWithVariants bool   `json:"dropOriginalsWithVariants"`
+	}
+	unmarshalErr := json.Unmarshal(data, &policies)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("json.Unmarshal() failed, err: %w", unmarshalErr)
+	}
+
+	for username, policy := range policies {
+		originals, originalsErr := parseRetention(policy.Originals)
+		if originalsErr != nil {
+			return nil, fmt.Errorf("invalid originals retention of %s, err: %w", username, originalsErr)
+		}
+		variants, variantsErr := parseRetention(policy.Variants)
+		if variantsErr != nil {
+			return nil, fmt.Errorf("invalid variants retention of %s, err: %w", username, variantsErr)
+		}
+		overrides[username] = configs.RetentionPolicy{
+			Originals:                 originals,
+			Variants:                  variants,
+			DropOriginalsWithVariants: policy.DropOriginalsWithVariants,
+		}
+	}
+	return overrides, nil
+}
+
+// parseRetention parses a retention duration, "" means forever
+func parseRetention(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// loadTieringConfig reads the cold storage of originals, tiering is disabled if
+// COLD_STORAGE_BACKEND or TIERING_AGE_DAYS is not set
+func loadTieringConfig() (*configs.TieringConfig, error) {
+	ageDays, ageErr := getEnvInt("TIERING_AGE_DAYS", 0)
+	if ageErr != nil {
+		return nil, ageErr
+	}
+
+	interval, intervalErr := getEnvDuration("TIERING_INTERVAL", constants.TIERING_INTERVAL)
+	if intervalErr != nil {
+		return nil, intervalErr
+	}
+
+	return &configs.TieringConfig{
+		Age:      time.Duration(ageDays) * 24 * time.Hour,
+		Interval: interval,
+		Backend:  os.Getenv("COLD_STORAGE_BACKEND"),
+		Dir:      os.Getenv("COLD_STORAGE_DIR"),
+		S3: configs.S3Config{
+			Endpoint:  os.Getenv("COLD_S3_ENDPOINT"),
+			Bucket:    os.Getenv("COLD_S3_BUCKET"),
+			Region:    os.Getenv("COLD_S3_REGION"),
+			AccessKey: os.Getenv("COLD_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("COLD_S3_SECRET_KEY"),
+		},
+	}, nil
+}
+
+// loadReplicationConfig reads the replica of the storage, replication is disabled if REPLICA_BACKEND
+// is not set. REPLICATION_QUORUM is primary by default.
+func loadReplicationConfig() (*configs.ReplicationConfig, error) {
+	quorum := os.Getenv("REPLICATION_QUORUM")
+	switch quorum {
+	case "":
+		quorum = constants.REPLICATION_QUORUM_PRIMARY
+	case constants.REPLICATION_QUORUM_PRIMARY, constants.REPLICATION_QUORUM_BOTH:
+	default:
+		return nil, fmt.Errorf("invalid replication quorum, quorum=%s", quorum)
+	}
+
+	tombstonesDir := ""
+	if os.Getenv("DIR_TOMBSTONES") != "" {
+		tombstonesDir = filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_TOMBSTONES"))
+	}
+
+	return &configs.ReplicationConfig{
+		Backend: os.Getenv("REPLICA_BACKEND"),
+		Dir:     os.Getenv("REPLICA_DIR"),
+		S3: configs.S3Config{
+			Endpoint:  os.Getenv("REPLICA_S3_ENDPOINT"),
+			Bucket:    os.Getenv("REPLICA_S3_BUCKET"),
+			Region:    os.Getenv("REPLICA_S3_REGION"),
+			AccessKey: os.Getenv("REPLICA_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("REPLICA_S3_SECRET_KEY"),
+		},
+		Quorum:        quorum,
+		TombstonesDir: tombstonesDir,
+	}, nil
+}
+
+// loadEncryptionConfig reads the master keys, encryption is disabled if ENCRYPTION_MASTER_KEY is not set.
+// ENCRYPTION_PREVIOUS_MASTER_KEY is only set while data keys are rotated.
+func loadEncryptionConfig() (*configs.EncryptionConfig, error) {
+	masterKey, masterKeyErr := loadMasterKey("ENCRYPTION_MASTER_KEY")
+	if masterKeyErr != nil {
+		return nil, masterKeyErr
+	}
+
+	previousMasterKey, previousErr := loadMasterKey("ENCRYPTION_PREVIOUS_MASTER_KEY")
+	if previousErr != nil {
+		return nil, previousErr
+	}
+
+	encryptionConfig := &configs.EncryptionConfig{
+		MasterKey:         masterKey,
+		PreviousMasterKey: previousMasterKey,
+	}
+	if os.Getenv("DIR_KEYS") != "" {
+		encryptionConfig.KeysDir = filepath.Join(constants.ROOT_DIR_IMAGES, os.Getenv("DIR_KEYS"))
+	}
+
+	if len(masterKey) == 0 && len(previousMasterKey) > 0 {
+		return nil, fmt.Errorf("invalid encryption config, ENCRYPTION_PREVIOUS_MASTER_KEY requires ENCRYPTION_MASTER_KEY")
+	}
+	if len(masterKey) > 0 && encryptionConfig.KeysDir == "" {
+		return nil, fmt.Errorf("invalid encryption config, DIR_KEYS is required")
+	}
+	return encryptionConfig, nil
+}
+
+// loadMasterKey reads a base64 encoded master key from env variable key, or from the file
+// named by env variable {key}_FILE, nil is returned if neither is set
+func loadMasterKey(key string) ([]byte, error) {
+	value := os.Getenv(key)
+	path := os.Getenv(key + "_FILE")
+	if value != "" && path != "" {
+		return nil, fmt.Errorf("invalid encryption config, only one of %s and %s_FILE can be set", key, key)
+	}
+
+	if path != "" {
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return nil, fmt.Errorf("os.ReadFile() failed, err: %w", readErr)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	masterKey, decodeErr := base64.StdEncoding.DecodeString(value)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid %s, err: %w", key, decodeErr)
+	}
+	if len(masterKey) != encryption.KEY_SIZE {
+		return nil, fmt.Errorf("invalid %s, expected %d bytes, got %d", key, encryption.KEY_SIZE, len(masterKey))
+	}
+	return masterKey, nil
+}
+
+// getEnvDuration returns the duration value of env variable key, e.g. "720h", or defaultValue if it is not set
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// StartServer serves requests and runs the background services until stopChan is closed, it returns
+// once the server shut down and all background services returned
 func StartServer(config *configs.Config, stopChan chan struct{}) {
 	fmt.Println("starting server...")
 	if config.Mode == "release" {
@@ -54,19 +450,66 @@ func StartServer(config *configs.Config, stopChan chan struct{}) {
 		fmt.Println("running in release mode, set log level to INFO")
 	}
 
-	initErr := initDirs(config)
+	metadataStore, metadataErr := metadata.NewService(config.MetadataFile)
+	if metadataErr != nil {
+		fmt.Printf("failed to start server, err: %s", metadataErr.Error())
+		return
+	}
+	defer metadataStore.Close()
+	metadataService := search.NewService(metadataStore)
+
+	store, tieringService, recordsService, storeErr := newStorage(config, metadataService)
+	if storeErr != nil {
+		fmt.Printf("failed to start server, err: %s", storeErr.Error())
+		return
+	}
+
+	initErr := initDirs(config, store)
 	if initErr != nil {
 		fmt.Printf("failed to start server, err: %s", initErr.Error())
 		return
 	}
+	sweepTempFiles(config, store)
 
-	imagesService := images.NewService(&config.Dimensions)
-	resizeQueue := resize_queue.NewService(config.QueueCapacity, imagesService)
-	go resizeQueue.Start(stopChan)
+	auditService, auditErr := audit.NewService(config.AuditFile)
+	if auditErr != nil {
+		fmt.Printf("failed to start server, err: %s", auditErr.Error())
+		return
+	}
+	defer auditService.Close()
+
+	quotasService := quotas.NewService(config, store)
+	imagesService := images.NewService(&config.Dimensions, store, quotasService, metadataService)
+	trashService := trash.NewService(config, store, recordsService, metadataService, quotasService)
+	resizeQueue, queueErr := resize_queue.NewFromConfig(config, imagesService)
+	if queueErr != nil {
+		fmt.Printf("failed to start server, err: %s", queueErr.Error())
+		return
+	}
+	importsService := imports.NewService(config, store, imagesService, recordsService, metadataService, quotasService, resizeQueue)
+	exportsService := exports.NewService(config, store, recordsService)
+	collectionsService := collections.NewService(config.CollectionsDir, store, metadataService)
+
+	// the stores are closed once the background services returned, the resize queue finishes the
+	// tasks being processed first
+	var background sync.WaitGroup
+	runInBackground := func(start func(stopChan <-chan struct{})) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			start(stopChan)
+		}()
+	}
+	runInBackground(resizeQueue.Start)
+	runInBackground(gc.NewService(config, store, recordsService, metadataService, quotasService, resizeQueue).Start)
+	runInBackground(func(stopChan <-chan struct{}) { reconcile(config, store, resizeQueue, stopChan) })
+	runInBackground(trashService.Start)
+	runInBackground(scrubber.NewService(config, store, imagesService).Start)
+	runInBackground(tieringService.Start)
 
 	srv := &http.Server{
 		Addr:    config.Port,
-		Handler: setupRouter(config, imagesService, resizeQueue),
+		Handler: setupRouter(config, store, imagesService, recordsService, metadataService, trashService, quotasService, exportsService, importsService, collectionsService, auditService, resizeQueue),
 	}
 
 	go func() {
@@ -88,25 +531,242 @@ func StartServer(config *configs.Config, stopChan chan struct{}) {
 		fmt.Println("Server exited gracefully")
 	}
 
+	background.Wait()
+	fmt.Println("Background services stopped")
+}
+
+// RunImport imports the images under dir of the local filesystem for username without starting
+// the server, it returns once all imported receipts have been resized
+func RunImport(config *configs.Config, username, dir string) (*import_report.Report, error) {
+	metadataService, metadataErr := metadata.NewService(config.MetadataFile)
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+	defer metadataService.Close()
+
+	store, _, recordsService, storeErr := newStorage(config, metadataService)
+	if storeErr != nil {
+		return nil, storeErr
+	}
+
+	initErr := initDirs(config, store)
+	if initErr != nil {
+		return nil, initErr
+	}
+
+	quotasService := quotas.NewService(config, store)
+	imagesService := images.NewService(&config.Dimensions, store, quotasService, metadataService)
+	resizeQueue := resize_queue.NewService(config.QueueCapacity, config.ResizeWorkers, imagesService)
+	importsService := imports.NewService(config, store, imagesService, recordsService, metadataService, quotasService, resizeQueue)
+
+	processed := make(chan struct{})
+	go func() {
+		resizeQueue.Process()
+		close(processed)
+	}()
+
+	report, importErr := importsService.ImportDir(username, dir)
+	resizeQueue.Close()
+	<-processed
+
+	return report, importErr
 }
 
-func initDirs(config *configs.Config) error {
-	imagesErr := os.MkdirAll(config.ResizedDir, 0755)
+// newStorage stacks the storage of images: the backend mirrored to its replica, cold storage of
+// old originals and checksums. Every backend encrypts images with its own data keys. Records are
+// kept in the replicated backend, tiering updates the tier recorded in them and in metadataService.
+func newStorage(config *configs.Config, metadataService metadata.ServiceType) (checksums.ServiceType, tiering.ServiceType, records.ServiceType, error) {
+	backend, backendErr := storage.NewFromConfig(config)
+	if backendErr != nil {
+		return nil, nil, nil, backendErr
+	}
+
+	replica, replicaErr := storage.NewReplicaFromConfig(config)
+	if replicaErr != nil {
+		return nil, nil, nil, replicaErr
+	}
+
+	cold, coldErr := storage.NewColdFromConfig(config)
+	if coldErr != nil {
+		return nil, nil, nil, coldErr
+	}
+
+	replicated := replication.NewService(config, encrypted(config, backend), encrypted(config, replica))
+	recordsService := records.NewService(config.RecordsDir, replicated)
+	tieringService := tiering.NewService(config, replicated, encrypted(config, cold), recordsService, metadataService)
+	return checksums.NewService(config, tieringService), tieringService, recordsService, nil
+}
+
+// RunResync repairs divergences between the primary storage and its replica without starting the server
+func RunResync(config *configs.Config) (*replication.ResyncReport, error) {
+	backend, backendErr := storage.NewFromConfig(config)
+	if backendErr != nil {
+		return nil, backendErr
+	}
+
+	replica, replicaErr := storage.NewReplicaFromConfig(config)
+	if replicaErr != nil {
+		return nil, replicaErr
+	}
+
+	return replication.NewService(config, encrypted(config, backend), encrypted(config, replica)).Resync()
+}
+
+// RunRotateKeys re-wraps the data keys of every backend by the master key without starting the
+// server, the reports are keyed by primary, replica and cold
+func RunRotateKeys(config *configs.Config) (map[string]*encryption.RotationReport, error) {
+	backend, backendErr := storage.NewFromConfig(config)
+	if backendErr != nil {
+		return nil, backendErr
+	}
+
+	replica, replicaErr := storage.NewReplicaFromConfig(config)
+	if replicaErr != nil {
+		return nil, replicaErr
+	}
+
+	cold, coldErr := storage.NewColdFromConfig(config)
+	if coldErr != nil {
+		return nil, coldErr
+	}
+
+	reports := map[string]*encryption.RotationReport{}
+	for name, s := range map[string]storage.ServiceType{"primary": backend, "replica": replica, "cold": cold} {
+		if s == nil {
+			continue
+		}
+		report, rotateErr := encryption.NewService(config, s).RotateKeys()
+		if rotateErr != nil {
+			return reports, fmt.Errorf("RotateKeys(%s) failed, err: %w", name, rotateErr)
+		}
+		reports[name] = report
+	}
+	return reports, nil
+}
+
+// encrypted wraps a backend to encrypt the images it stores, nil is returned for a backend which is
+// not configured
+func encrypted(config *configs.Config, s storage.ServiceType) storage.ServiceType {
+	if s == nil {
+		return nil
+	}
+	return encryption.NewService(config, s)
+}
+
+func initDirs(config *configs.Config, store storage.ServiceType) error {
+	imagesErr := store.EnsureDir(config.ResizedDir)
 	if imagesErr != nil {
 		return imagesErr
 	}
 
-	uploadsErr := os.MkdirAll(config.UploadsDir, 0755)
+	uploadsErr := store.EnsureDir(config.UploadsDir)
 	if uploadsErr != nil {
 		return uploadsErr
 	}
+
+	recordsErr := store.EnsureDir(config.RecordsDir)
+	if recordsErr != nil {
+		return recordsErr
+	}
+
+	trashErr := store.EnsureDir(config.TrashDir)
+	if trashErr != nil {
+		return trashErr
+	}
+
+	collectionsErr := store.EnsureDir(config.CollectionsDir)
+	if collectionsErr != nil {
+		return collectionsErr
+	}
+
+	if config.ChecksumsDir != "" {
+		checksumsErr := store.EnsureDir(config.ChecksumsDir)
+		if checksumsErr != nil {
+			return checksumsErr
+		}
+	}
+
+	if config.Encryption.KeysDir != "" {
+		keysErr := store.EnsureDir(config.Encryption.KeysDir)
+		if keysErr != nil {
+			return keysErr
+		}
+	}
 	return nil
 }
 
-func setupRouter(config *configs.Config, imagesService images.ServiceType, resizeQueue resize_queue.ServiceType) http.Handler {
+// reconcile re-submits uploads whose resizing was never completed, e.g. because the
+// server stopped before resize_queue processed them
+func reconcile(config *configs.Config, store storage.ServiceType, resizeQueue resize_queue.ServiceType, stopChan <-chan struct{}) {
+	report, runErr := reconciler.NewService(config, store, resizeQueue).Run(stopChan)
+	if runErr != nil {
+		logging.Errorf("reconciler.Run() failed, err: %s", runErr.Error())
+		return
+	}
+	fmt.Printf(
+		"reconciliation done, scanned: %d, complete: %d, missing: %d, partial: %d, invalid: %d, enqueued: %d, failed: %d\n",
+		report.Scanned, report.Complete, report.Missing, report.Partial, report.Invalid, report.Enqueued, report.Failed,
+	)
+}
+
+// sweepTempFiles removes temp files left behind by writes interrupted by a crash
+func sweepTempFiles(config *configs.Config, store storage.ServiceType) {
+	sweeper, ok := store.(storage.Sweeper)
+	if !ok {
+		return
+	}
+
+	for _, dir := range []string{config.UploadsDir, config.ResizedDir, config.RecordsDir, config.TrashDir, config.CollectionsDir, config.ChecksumsDir, config.Encryption.KeysDir} {
+		if dir == "" {
+			continue
+		}
+		removed, sweepErr := sweeper.SweepTempFiles(dir)
+		if sweepErr != nil {
+			logging.Errorf("sweeper.SweepTempFiles(dir: %s) failed, err: %s", dir, sweepErr.Error())
+			continue
+		}
+		logging.Infof("removed %d temp files from %s", removed, dir)
+	}
+}
+
+func setupRouter(
+	config *configs.Config,
+	checksumsService checksums.ServiceType,
+	imagesService images.ServiceType,
+	recordsService records.ServiceType,
+	metadataService search.ServiceType,
+	trashService trash.ServiceType,
+	quotasService quotas.ServiceType,
+	exportsService exports.ServiceType,
+	importsService imports.ServiceType,
+	collectionsService collections.ServiceType,
+	auditService audit.ServiceType,
+	resizeQueue resize_queue.ServiceType,
+) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", handlers.HealthHandler())
-	mux.Handle("/receipts", middlewares.Auth(http.HandlerFunc(handlers.UploadReceipt(config, imagesService, resizeQueue))))
-	mux.Handle("/receipts/{receiptId}", middlewares.Auth(http.HandlerFunc(handlers.DownloadReceipt(config, imagesService))))
+	mux.Handle("/receipts", middlewares.Audit(auditService, constants.AUDIT_ACTION_UPLOAD, middlewares.Auth(http.HandlerFunc(handlers.UploadReceipt(config, imagesService, recordsService, metadataService, quotasService, resizeQueue)))))
+	mux.Handle("GET /receipts", middlewares.Auth(http.HandlerFunc(handlers.ListReceipts(config, metadataService))))
+	mux.Handle("GET /receipts/search", middlewares.Auth(http.HandlerFunc(handlers.SearchReceipts(config, metadataService))))
+	mux.Handle("GET /receipts/export", middlewares.Audit(auditService, constants.AUDIT_ACTION_EXPORT, middlewares.Auth(http.HandlerFunc(handlers.ExportReceipts(config, exportsService)))))
+	mux.Handle("POST /receipts/import", middlewares.Audit(auditService, constants.AUDIT_ACTION_IMPORT, middlewares.Auth(http.HandlerFunc(handlers.ImportReceipts(config, importsService)))))
+	mux.Handle("GET /receipts/{receiptId}", middlewares.Audit(auditService, constants.AUDIT_ACTION_DOWNLOAD, middlewares.Auth(http.HandlerFunc(handlers.DownloadReceipt(config, imagesService, checksumsService, metadataService)))))
+	mux.Handle("PATCH /receipts/{receiptId}", middlewares.Audit(auditService, constants.AUDIT_ACTION_UPDATE, middlewares.Auth(http.HandlerFunc(handlers.UpdateReceipt(config, metadataService)))))
+	mux.Handle("DELETE /receipts/{receiptId}", middlewares.Audit(auditService, constants.AUDIT_ACTION_DELETE, middlewares.Auth(http.HandlerFunc(handlers.DeleteReceipt(config, trashService, resizeQueue)))))
+	mux.Handle("/receipts/{receiptId}/meta", middlewares.Audit(auditService, constants.AUDIT_ACTION_VIEW, middlewares.Auth(http.HandlerFunc(handlers.GetReceiptMetadata(config, metadataService)))))
+	mux.Handle("/receipts/{receiptId}/status", middlewares.Auth(http.HandlerFunc(handlers.ReceiptStatus(config, metadataService))))
+	mux.Handle("/receipts/{receiptId}/restore", middlewares.Audit(auditService, constants.AUDIT_ACTION_RESTORE, middlewares.Auth(http.HandlerFunc(handlers.RestoreReceipt(config, trashService, resizeQueue)))))
+	mux.Handle("/trash", middlewares.Auth(http.HandlerFunc(handlers.ListTrash(config, trashService))))
+	mux.Handle("/usage", middlewares.Auth(http.HandlerFunc(handlers.GetUsage(config, quotasService))))
+	mux.Handle("POST /collections", middlewares.Auth(http.HandlerFunc(handlers.CreateCollection(collectionsService))))
+	mux.Handle("GET /collections", middlewares.Auth(http.HandlerFunc(handlers.ListCollections(collectionsService))))
+	mux.Handle("GET /collections/{collectionId}", middlewares.Auth(http.HandlerFunc(handlers.GetCollection(collectionsService))))
+	mux.Handle("PATCH /collections/{collectionId}", middlewares.Auth(http.HandlerFunc(handlers.RenameCollection(collectionsService))))
+	mux.Handle("DELETE /collections/{collectionId}", middlewares.Auth(http.HandlerFunc(handlers.DeleteCollection(collectionsService))))
+	mux.Handle("GET /collections/{collectionId}/receipts", middlewares.Auth(http.HandlerFunc(handlers.ListCollectionReceipts(config, collectionsService))))
+	mux.Handle("PUT /collections/{collectionId}/receipts/{receiptId}", middlewares.Auth(http.HandlerFunc(handlers.AddCollectionReceipt(collectionsService))))
+	mux.Handle("DELETE /collections/{collectionId}/receipts/{receiptId}", middlewares.Auth(http.HandlerFunc(handlers.RemoveCollectionReceipt(collectionsService))))
+	mux.Handle("GET /admin/audit", middlewares.Auth(middlewares.Admin(config.AdminUsers, http.HandlerFunc(handlers.QueryAudit(auditService)))))
+	mux.Handle("GET /admin/workers", middlewares.Auth(middlewares.Admin(config.AdminUsers, http.HandlerFunc(handlers.GetWorkerMetrics(resizeQueue)))))
 	return mux
 }
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/utils"
 	"syscall"
 )
@@ -18,13 +21,79 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(config, os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "resync" {
+		runResync(config)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		runRotateKeys(config)
+		return
+	}
+
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 	stopChan := make(chan struct{})
 
-	go utils.StartServer(config, stopChan)
+	stopped := make(chan struct{})
+	go func() {
+		utils.StartServer(config, stopChan)
+		close(stopped)
+	}()
+
+	select {
+	case <-signalChan:
+		close(stopChan)
+		fmt.Println("Shutting down server...")
+		<-stopped
+	case <-stopped:
+	}
+}
+
+// runImport imports a server-side directory, e.g. go run main.go import -user user1 -dir ./backup
+func runImport(config *configs.Config, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	username := flags.String("user", "", "username_token of the user who owns the imported receipts")
+	dir := flags.String("dir", "", "directory of JPEG images and an optional manifest.json")
+	flags.Parse(args)
 
-	<-signalChan
-	close(stopChan)
-	fmt.Println("Shutting down server...")
+	if *username == "" || *dir == "" {
+		flags.Usage()
+		return
+	}
+
+	report, importErr := utils.RunImport(config, *username, *dir)
+	if importErr != nil {
+		fmt.Printf("utils.RunImport() failed, err: %s\n", importErr.Error())
+	}
+	if report != nil {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	}
+}
+
+// runResync repairs divergences between the storage and its replica, e.g. go run main.go resync
+func runResync(config *configs.Config) {
+	report, resyncErr := utils.RunResync(config)
+	if resyncErr != nil {
+		fmt.Printf("utils.RunResync() failed, err: %s\n", resyncErr.Error())
+		return
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(data))
+}
+
+// runRotateKeys re-wraps all data keys by the master key, e.g. go run main.go rotate-keys
+func runRotateKeys(config *configs.Config) {
+	reports, rotateErr := utils.RunRotateKeys(config)
+	if rotateErr != nil {
+		fmt.Printf("utils.RunRotateKeys() failed, err: %s\n", rotateErr.Error())
+	}
+	data, _ := json.MarshalIndent(reports, "", "  ")
+	fmt.Println(string(data))
 }
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -8,11 +12,16 @@ import (
 	"os"
 	"path/filepath"
 	"receipt_uploader/internal/constants"
+	"receipt_uploader/internal/encryption"
 	"receipt_uploader/internal/logging"
 	"receipt_uploader/internal/models/configs"
+	"receipt_uploader/internal/models/export_manifest"
 	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/import_report"
+	"receipt_uploader/internal/resize_queue"
 	"receipt_uploader/internal/test_utils"
 	"receipt_uploader/internal/utils"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,24 +31,42 @@ import (
 func TestMain(t *testing.T) {
 	baseDir := "integ-test-images"
 	config := &configs.Config{
-		Port:       ":8080",
-		ResizedDir: filepath.Join(baseDir, "resized"),
-		UploadsDir: filepath.Join(baseDir, "uploads"),
-		Dimensions: configs.AllowedDimensions,
+		Port:           ":8080",
+		ResizedDir:     filepath.Join(baseDir, "resized"),
+		UploadsDir:     filepath.Join(baseDir, "uploads"),
+		RecordsDir:     filepath.Join(baseDir, "records"),
+		TrashDir:       filepath.Join(baseDir, "trash"),
+		CollectionsDir: filepath.Join(baseDir, "collections"),
+		ChecksumsDir:   filepath.Join(baseDir, "checksums"),
+		MetadataFile:   filepath.Join(baseDir, "metadata.log"),
+		AuditFile:      filepath.Join(baseDir, "audit.log"),
+		QueueDir:       filepath.Join(baseDir, "queue"),
+		AdminUsers:     []string{"audit_admin"},
+		Dimensions:     configs.AllowedDimensions,
+		Encryption: configs.EncryptionConfig{
+			MasterKey: bytes.Repeat([]byte{1}, encryption.KEY_SIZE),
+			KeysDir:   filepath.Join(baseDir, "keys"),
+		},
 	}
 	baseUrl := "http://localhost" + config.Port
 	url := baseUrl + "/receipts"
-	defer os.RemoveAll(baseDir)
 
 	client := &http.Client{}
 
 	stopChan := make(chan struct{})
+	stopped := make(chan struct{})
 	t.Cleanup(func() {
 		log.Println("Cleanup integration test")
 		close(stopChan)
+		<-stopped // the server drains the resize queue before its directories are removed
+		os.RemoveAll(baseDir)
 	})
 
-	go utils.StartServer(config, stopChan)
+	go func() {
+		utils.StartServer(config, stopChan)
+		close(stopped)
+	}()
+	test_utils.WaitForServer(t, baseUrl)
 
 	t.Run("return 200, /health", func(t *testing.T) {
 		resp, err := http.Get(baseUrl + "/health")
@@ -144,6 +171,15 @@ func TestMain(t *testing.T) {
 		fileName := uploadResp.ReceiptID + "_" + size + ".jpg"
 		assert.Equal(t, fileName, header.Filename)
 
+		checksum, readErr := os.ReadFile(filepath.Join(config.ChecksumsDir, config.ResizedDir, userToken, fileName+".sha256"))
+		assert.Nil(t, readErr)
+		assert.Equal(t, `"`+string(checksum)+`"`, getResp.Header.Get("ETag"))
+		assert.True(t, strings.HasPrefix(getResp.Header.Get("Digest"), "sha-256="))
+
+		stored, storedErr := os.ReadFile(filepath.Join(config.ResizedDir, userToken, fileName))
+		assert.Nil(t, storedErr)
+		assert.False(t, bytes.HasPrefix(stored, []byte{0xff, 0xd8}), "stored image is not encrypted")
+
 		_, height := test_utils.GetImageDimension(t, getResp)
 		assert.Equal(t, 800, height)
 	})
@@ -231,6 +267,268 @@ func TestMain(t *testing.T) {
 		assert.Equal(t, header.ContentLength, int64(len(getRespBody)))
 	})
 
+	t.Run("return 200, GET /receipts and GET /receipts/{receiptId}/status", func(t *testing.T) {
+		listReq, listReqErr := http.NewRequest(http.MethodGet, url+"?order=asc&limit=1", nil)
+		assert.Nil(t, listReqErr)
+		listReq.Header.Set("username_token", "valid_user")
+
+		listResp, listErr := client.Do(listReq)
+		assert.Nil(t, listErr)
+		defer listResp.Body.Close()
+		assert.Equal(t, http.StatusOK, listResp.StatusCode)
+
+		var receipts http_responses.ReceiptListResponse
+		test_utils.ParseResponseBody(t, listResp, &receipts)
+		assert.Len(t, receipts.Items, 1)
+		assert.NotEmpty(t, receipts.NextCursor)
+		assert.Equal(t, constants.VARIANT_STATUS_READY, receipts.Items[0].Status)
+		assert.Len(t, receipts.Items[0].Sizes, len(config.Dimensions)+1)
+
+		getReq, getReqErr := http.NewRequest(http.MethodGet, baseUrl+receipts.Items[0].Sizes[1].URL, nil)
+		assert.Nil(t, getReqErr)
+		getReq.Header.Set("username_token", "valid_user")
+
+		getResp, getErr := client.Do(getReq)
+		assert.Nil(t, getErr)
+		defer getResp.Body.Close()
+		assert.Equal(t, http.StatusOK, getResp.StatusCode)
+
+		statusReq, statusReqErr := http.NewRequest(http.MethodGet, url+"/"+receipts.Items[0].ReceiptID+"/status", nil)
+		assert.Nil(t, statusReqErr)
+		statusReq.Header.Set("username_token", "valid_user")
+
+		statusResp, statusErr := client.Do(statusReq)
+		assert.Nil(t, statusErr)
+		defer statusResp.Body.Close()
+		assert.Equal(t, http.StatusOK, statusResp.StatusCode)
+
+		var status http_responses.ReceiptStatusResponse
+		test_utils.ParseResponseBody(t, statusResp, &status)
+		assert.Equal(t, constants.VARIANT_STATUS_READY, status.Status)
+		assert.Len(t, status.Sizes, len(config.Dimensions)+1)
+	})
+
+	t.Run("return 200, PATCH /receipts/{receiptId} and GET /receipts/{receiptId}/meta", func(t *testing.T) {
+		userToken := "annotating_user"
+		uploadFilePath := "./integ-test-annotations.jpg"
+		test_utils.CreateTestImageJPG(uploadFilePath, 1000, 1200)
+		defer os.Remove(uploadFilePath)
+
+		req, reqErr := test_utils.GenerateUploadRequest(t, url, uploadFilePath, userToken)
+		assert.Nil(t, reqErr)
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var uploadResp http_responses.UploadResponse
+		test_utils.ParseResponseBody(t, resp, &uploadResp)
+
+		metaReq, metaReqErr := http.NewRequest(http.MethodGet, url+"/"+uploadResp.ReceiptID+"/meta", nil)
+		assert.Nil(t, metaReqErr)
+		metaReq.Header.Set("username_token", userToken)
+		metaResp, metaErr := client.Do(metaReq)
+		assert.Nil(t, metaErr)
+		defer metaResp.Body.Close()
+		assert.Equal(t, http.StatusOK, metaResp.StatusCode)
+		etag := metaResp.Header.Get("ETag")
+
+		body := `{"tags": ["travel"], "amount": {"value": "12.50", "currency": "EUR"}}`
+		patchReq, patchReqErr := http.NewRequest(http.MethodPatch, url+"/"+uploadResp.ReceiptID, strings.NewReader(body))
+		assert.Nil(t, patchReqErr)
+		patchReq.Header.Set("username_token", userToken)
+		patchReq.Header.Set("Content-Type", "application/json")
+		patchReq.Header.Set("If-Match", etag)
+		patchResp, patchErr := client.Do(patchReq)
+		assert.Nil(t, patchErr)
+		defer patchResp.Body.Close()
+		assert.Equal(t, http.StatusOK, patchResp.StatusCode)
+
+		var item http_responses.ReceiptItem
+		test_utils.ParseResponseBody(t, patchResp, &item)
+		assert.Equal(t, []string{"travel"}, item.Annotations.Tags)
+		assert.NotEqual(t, etag, item.ETag)
+
+		patchReq, _ = http.NewRequest(http.MethodPatch, url+"/"+uploadResp.ReceiptID, strings.NewReader(body))
+		patchReq.Header.Set("username_token", userToken)
+		patchReq.Header.Set("If-Match", etag)
+		staleResp, staleErr := client.Do(patchReq)
+		assert.Nil(t, staleErr)
+		defer staleResp.Body.Close()
+		assert.Equal(t, http.StatusPreconditionFailed, staleResp.StatusCode)
+
+		searchReq, searchReqErr := http.NewRequest(http.MethodGet, url+"/search?q=tag:travel+amount:10..20", nil)
+		assert.Nil(t, searchReqErr)
+		searchReq.Header.Set("username_token", userToken)
+		searchResp, searchErr := client.Do(searchReq)
+		assert.Nil(t, searchErr)
+		defer searchResp.Body.Close()
+		assert.Equal(t, http.StatusOK, searchResp.StatusCode)
+
+		var results http_responses.ReceiptListResponse
+		test_utils.ParseResponseBody(t, searchResp, &results)
+		assert.Len(t, results.Items, 1)
+		assert.Equal(t, uploadResp.ReceiptID, results.Items[0].ReceiptID)
+
+		createReq, createReqErr := http.NewRequest(http.MethodPost, baseUrl+"/collections", strings.NewReader(`{"name": "Trip"}`))
+		assert.Nil(t, createReqErr)
+		createReq.Header.Set("username_token", userToken)
+		createResp, createErr := client.Do(createReq)
+		assert.Nil(t, createErr)
+		defer createResp.Body.Close()
+		assert.Equal(t, http.StatusCreated, createResp.StatusCode)
+
+		var created http_responses.CollectionItem
+		test_utils.ParseResponseBody(t, createResp, &created)
+		collectionUrl := baseUrl + "/collections/" + created.CollectionID
+
+		addReq, addReqErr := http.NewRequest(http.MethodPut, collectionUrl+"/receipts/"+uploadResp.ReceiptID, nil)
+		assert.Nil(t, addReqErr)
+		addReq.Header.Set("username_token", "valid_user")
+		addResp, addErr := client.Do(addReq)
+		assert.Nil(t, addErr)
+		defer addResp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, addResp.StatusCode)
+
+		addReq, _ = http.NewRequest(http.MethodPut, collectionUrl+"/receipts/"+uploadResp.ReceiptID, nil)
+		addReq.Header.Set("username_token", userToken)
+		addResp, addErr = client.Do(addReq)
+		assert.Nil(t, addErr)
+		defer addResp.Body.Close()
+		assert.Equal(t, http.StatusOK, addResp.StatusCode)
+
+		collectionReq, collectionReqErr := http.NewRequest(http.MethodGet, collectionUrl, nil)
+		assert.Nil(t, collectionReqErr)
+		collectionReq.Header.Set("username_token", userToken)
+		collectionResp, collectionErr := client.Do(collectionReq)
+		assert.Nil(t, collectionErr)
+		defer collectionResp.Body.Close()
+		assert.Equal(t, http.StatusOK, collectionResp.StatusCode)
+
+		var collection http_responses.CollectionResponse
+		test_utils.ParseResponseBody(t, collectionResp, &collection)
+		assert.Equal(t, 1, collection.Receipts)
+		assert.Len(t, collection.Totals, 1)
+		assert.Equal(t, "12.50", collection.Totals[0].Value)
+	})
+
+	t.Run("return 200, GET /receipts/export", func(t *testing.T) {
+		exportReq, exportReqErr := http.NewRequest(http.MethodGet, url+"/export?sizes=small", nil)
+		assert.Nil(t, exportReqErr)
+		exportReq.Header.Set("username_token", "valid_user")
+
+		exportResp, exportErr := client.Do(exportReq)
+		assert.Nil(t, exportErr)
+		defer exportResp.Body.Close()
+		assert.Equal(t, http.StatusOK, exportResp.StatusCode)
+
+		archive, readErr := io.ReadAll(exportResp.Body)
+		assert.Nil(t, readErr)
+
+		gzipReader, gzipErr := gzip.NewReader(bytes.NewReader(archive))
+		assert.Nil(t, gzipErr)
+		tarReader := tar.NewReader(gzipReader)
+
+		header, nextErr := tarReader.Next()
+		assert.Nil(t, nextErr)
+		assert.Equal(t, export_manifest.MANIFEST_FILE_NAME, header.Name)
+
+		var manifest export_manifest.Manifest
+		assert.Nil(t, json.NewDecoder(tarReader).Decode(&manifest))
+		assert.NotEmpty(t, manifest.Files)
+
+		entries := 0
+		for {
+			_, nextErr := tarReader.Next()
+			if nextErr == io.EOF {
+				break
+			}
+			assert.Nil(t, nextErr)
+			entries++
+		}
+		assert.Equal(t, len(manifest.Files), entries)
+
+		importReq, importReqErr := http.NewRequest(http.MethodPost, url+"/import", bytes.NewReader(archive))
+		assert.Nil(t, importReqErr)
+		importReq.Header.Set("username_token", "import_user")
+
+		importResp, importErr := client.Do(importReq)
+		assert.Nil(t, importErr)
+		defer importResp.Body.Close()
+		assert.Equal(t, http.StatusOK, importResp.StatusCode)
+
+		var report import_report.Report
+		test_utils.ParseResponseBody(t, importResp, &report)
+		assert.Equal(t, len(manifest.Files)/2, report.Imported)
+		assert.Equal(t, len(manifest.Files)/2, report.Skipped)
+		assert.Equal(t, 0, report.Failed)
+
+		time.Sleep(5 * time.Second) // wait imported images to be resized, resize_queue has no capacity
+	})
+
+	t.Run("return 204, DELETE /receipts/{receiptId}", func(t *testing.T) {
+		uploadFilePath := "./integ-test.jpg"
+		userToken := "valid_user"
+
+		test_utils.CreateTestImageJPG(uploadFilePath, 1000, 1200)
+		defer os.Remove(uploadFilePath)
+		req, reqErr := test_utils.GenerateUploadRequest(t, url, uploadFilePath, userToken)
+		assert.Nil(t, reqErr)
+
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var uploadResp http_responses.UploadResponse
+		test_utils.ParseResponseBody(t, resp, &uploadResp)
+		assert.NotEmpty(t, uploadResp.ReceiptID)
+
+		time.Sleep(5 * time.Second) // wait uploaded image to be resized
+
+		receiptUrl := fmt.Sprintf("%s/%s", url, uploadResp.ReceiptID)
+		otherReq, otherReqErr := http.NewRequest(http.MethodDelete, receiptUrl, nil)
+		assert.Nil(t, otherReqErr)
+		otherReq.Header.Set("username_token", "other_user")
+
+		otherResp, otherErr := client.Do(otherReq)
+		assert.Nil(t, otherErr)
+		defer otherResp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, otherResp.StatusCode)
+
+		deleteReq, deleteReqErr := http.NewRequest(http.MethodDelete, receiptUrl, nil)
+		assert.Nil(t, deleteReqErr)
+		deleteReq.Header.Set("username_token", userToken)
+
+		deleteResp, deleteErr := client.Do(deleteReq)
+		assert.Nil(t, deleteErr)
+		defer deleteResp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, deleteResp.StatusCode)
+
+		getReq, getReqErr := http.NewRequest(http.MethodGet, receiptUrl+"?size=small", nil)
+		assert.Nil(t, getReqErr)
+		getReq.Header.Set("username_token", userToken)
+
+		getResp, getErr := client.Do(getReq)
+		assert.Nil(t, getErr)
+		defer getResp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, getResp.StatusCode)
+
+		restoreReq, restoreReqErr := http.NewRequest(http.MethodPost, receiptUrl+"/restore", nil)
+		assert.Nil(t, restoreReqErr)
+		restoreReq.Header.Set("username_token", userToken)
+
+		restoreResp, restoreErr := client.Do(restoreReq)
+		assert.Nil(t, restoreErr)
+		defer restoreResp.Body.Close()
+		assert.Equal(t, http.StatusOK, restoreResp.StatusCode)
+
+		restoredResp, restoredErr := client.Do(getReq)
+		assert.Nil(t, restoredErr)
+		defer restoredResp.Body.Close()
+		assert.Equal(t, http.StatusOK, restoredResp.StatusCode)
+	})
+
 	t.Run("return 403, GET /receipts/{receiptId}?size=large, username_token missing", func(t *testing.T) {
 		getUrl := fmt.Sprintf("%s/%s?size=%s", url, "fakereceiptId", "small")
 		logging.Debugf("getUrl: %s", getUrl)
@@ -260,4 +558,73 @@ func TestMain(t *testing.T) {
 
 		assert.Equal(t, http.StatusForbidden, getResp.StatusCode)
 	})
+
+	t.Run("return 200, GET /admin/audit", func(t *testing.T) {
+		auditUrl := baseUrl + "/admin/audit?user=valid_user&limit=1000"
+
+		forbiddenReq, forbiddenReqErr := http.NewRequest(http.MethodGet, auditUrl, nil)
+		assert.Nil(t, forbiddenReqErr)
+		forbiddenReq.Header.Set("username_token", "valid_user")
+		forbiddenResp, forbiddenErr := client.Do(forbiddenReq)
+		assert.Nil(t, forbiddenErr)
+		defer forbiddenResp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, forbiddenResp.StatusCode)
+
+		auditReq, auditReqErr := http.NewRequest(http.MethodGet, auditUrl, nil)
+		assert.Nil(t, auditReqErr)
+		auditReq.Header.Set("username_token", "audit_admin")
+		auditResp, auditErr := client.Do(auditReq)
+		assert.Nil(t, auditErr)
+		defer auditResp.Body.Close()
+		assert.Equal(t, http.StatusOK, auditResp.StatusCode)
+
+		var resp http_responses.AuditListResponse
+		test_utils.ParseResponseBody(t, auditResp, &resp)
+		outcomes := map[string]map[string]bool{}
+		for _, entry := range resp.Items {
+			assert.Equal(t, "valid_user", entry.Actor)
+			assert.NotEmpty(t, entry.ClientAddr)
+			if outcomes[entry.Action] == nil {
+				outcomes[entry.Action] = map[string]bool{}
+			}
+			outcomes[entry.Action][entry.Outcome] = true
+		}
+		assert.True(t, outcomes[constants.AUDIT_ACTION_UPLOAD][constants.AUDIT_OUTCOME_SUCCESS])
+		assert.True(t, outcomes[constants.AUDIT_ACTION_DOWNLOAD][constants.AUDIT_OUTCOME_SUCCESS])
+		assert.True(t, outcomes[constants.AUDIT_ACTION_DELETE][constants.AUDIT_OUTCOME_SUCCESS])
+		assert.True(t, outcomes[constants.AUDIT_ACTION_EXPORT][constants.AUDIT_OUTCOME_SUCCESS])
+
+		importAuditReq, importAuditReqErr := http.NewRequest(http.MethodGet, baseUrl+"/admin/audit?user=import_user", nil)
+		assert.Nil(t, importAuditReqErr)
+		importAuditReq.Header.Set("username_token", "audit_admin")
+		importAuditResp, importAuditErr := client.Do(importAuditReq)
+		assert.Nil(t, importAuditErr)
+		defer importAuditResp.Body.Close()
+		assert.Equal(t, http.StatusOK, importAuditResp.StatusCode)
+
+		var importResp http_responses.AuditListResponse
+		test_utils.ParseResponseBody(t, importAuditResp, &importResp)
+		assert.Len(t, importResp.Items, 1)
+		assert.Equal(t, constants.AUDIT_ACTION_IMPORT, importResp.Items[0].Action)
+		assert.Equal(t, constants.AUDIT_OUTCOME_SUCCESS, importResp.Items[0].Outcome)
+	})
+
+	t.Run("return 200, GET /admin/workers", func(t *testing.T) {
+		workersReq, workersReqErr := http.NewRequest(http.MethodGet, baseUrl+"/admin/workers", nil)
+		assert.Nil(t, workersReqErr)
+		workersReq.Header.Set("username_token", "audit_admin")
+		workersResp, workersErr := client.Do(workersReq)
+		assert.Nil(t, workersErr)
+		defer workersResp.Body.Close()
+		assert.Equal(t, http.StatusOK, workersResp.StatusCode)
+
+		var resp http_responses.WorkerMetricsResponse
+		test_utils.ParseResponseBody(t, workersResp, &resp)
+		assert.Len(t, resp.Workers, resize_queue.DefaultWorkers())
+		completed := int64(0)
+		for _, worker := range resp.Workers {
+			completed += worker.TasksCompleted
+		}
+		assert.Greater(t, completed, int64(0))
+	})
 }
@@ -6,9 +6,16 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"receipt_uploader/internal/images"
 	"receipt_uploader/internal/logging"
+	"receipt_uploader/internal/metadata"
 	"receipt_uploader/internal/models/configs"
 	"receipt_uploader/internal/models/http_responses"
+	"receipt_uploader/internal/models/receipt_record"
+	"receipt_uploader/internal/models/tasks"
+	"receipt_uploader/internal/quotas"
+	"receipt_uploader/internal/resize_queue"
+	"receipt_uploader/internal/storage"
 	"receipt_uploader/internal/test_utils"
 	"receipt_uploader/internal/utils"
 	"strconv"
@@ -26,24 +33,33 @@ func TestMainStess(t *testing.T) {
 	os.RemoveAll(baseDir)
 
 	config := &configs.Config{
-		Port:          ":8080",
-		ResizedDir:    filepath.Join(baseDir, "resized"),
-		UploadsDir:    filepath.Join(baseDir, "uploads"),
-		Dimensions:    configs.AllowedDimensions,
-		Mode:          "release",
-		QueueCapacity: 100,
+		Port:           ":8080",
+		ResizedDir:     filepath.Join(baseDir, "resized"),
+		UploadsDir:     filepath.Join(baseDir, "uploads"),
+		RecordsDir:     filepath.Join(baseDir, "records"),
+		TrashDir:       filepath.Join(baseDir, "trash"),
+		CollectionsDir: filepath.Join(baseDir, "collections"),
+		Dimensions:     configs.AllowedDimensions,
+		Mode:           "release",
+		QueueCapacity:  100,
 	}
 	numClients := config.QueueCapacity
 	baseUrl := "http://localhost" + config.Port
-	defer os.RemoveAll(baseDir)
 
 	stopChan := make(chan struct{})
+	stopped := make(chan struct{})
 	t.Cleanup(func() {
 		log.Println("Cleanup stress test")
 		close(stopChan)
+		<-stopped // the server drains the resize queue before its directories are removed
+		os.RemoveAll(baseDir)
 	})
 
-	go utils.StartServer(config, stopChan)
+	go func() {
+		utils.StartServer(config, stopChan)
+		close(stopped)
+	}()
+	test_utils.WaitForServer(t, baseUrl)
 	t.Run("stress testing, multiple POST and GET inter-changeably", func(t *testing.T) {
 
 		// to prepare test, upload 10 images sequentialy
@@ -136,3 +152,53 @@ func TestMainStess(t *testing.T) {
 
 	})
 }
+
+// TestResizeWorkersThroughput resizes the same uploads with a single worker and with the default
+// pool of one worker per CPU and logs the speedup of the pool. Wall-clock times depend on the load
+// of the machine, the pool is only asserted to be faster with STRESS_ASSERT_SPEEDUP set and more
+// than one CPU. More workers than CPUs make every resize slower and hit RESIZE_TIMEOUT.
+func TestResizeWorkersThroughput(t *testing.T) {
+	numTasks := 12
+	data, readErr := os.ReadFile("test_image.jpg")
+	assert.Nil(t, readErr)
+
+	resizeAll := func(t *testing.T, workers int) time.Duration {
+		config := &configs.Config{Dimensions: configs.AllowedDimensions}
+		store := storage.NewMemory()
+		imagesService := images.NewService(&config.Dimensions, store, quotas.NewService(config, store), metadata.NewMemory())
+		queue := resize_queue.NewService(numTasks, workers, imagesService)
+
+		for i := 0; i < numTasks; i++ {
+			username := "throughput_user_" + strconv.Itoa(i)
+			receiptId := receipt_record.ReceiptIDOf(username, receipt_record.HashContent(data))
+			imageMeta, saveErr := imagesService.SaveUpload(&data, username, receiptId, "uploads")
+			assert.Nil(t, saveErr)
+			assert.True(t, queue.Enqueue(tasks.ResizeTask{ImageMeta: *imageMeta, DestDir: "resized"}))
+		}
+		queue.Close()
+
+		startTime := time.Now()
+		queue.Process()
+		elapsed := time.Since(startTime)
+
+		// on a slow machine some resizes may hit RESIZE_TIMEOUT, they are processed all the same
+		processed := int64(0)
+		for _, m := range queue.Metrics() {
+			log.Printf("worker %d: completed: %d, failed: %d, busy: %d ms", m.Worker, m.TasksCompleted, m.TasksFailed, m.BusyMs)
+			processed += m.TasksCompleted + m.TasksFailed
+		}
+		assert.Equal(t, int64(numTasks), processed)
+		log.Printf("%d workers: %d tasks in %d ms, %.2f tasks/s", workers, numTasks, elapsed.Milliseconds(), float64(numTasks)/elapsed.Seconds())
+		return elapsed
+	}
+
+	t.Run("stress testing, a pool of workers resizes faster than a single one", func(t *testing.T) {
+		single := resizeAll(t, 1)
+		pooled := resizeAll(t, resize_queue.DefaultWorkers())
+		log.Printf("speedup of the pool: %.2fx", float64(single)/float64(pooled))
+
+		if os.Getenv("STRESS_ASSERT_SPEEDUP") != "" && resize_queue.DefaultWorkers() > 1 {
+			assert.Less(t, pooled, single)
+		}
+	})
+}